@@ -2,31 +2,67 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 
 	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/lib/buildinfo"
+	"ia-online-golang/internal/lib/jwtkeys"
 	"ia-online-golang/internal/lib/logger"
+	"ia-online-golang/internal/lib/metrics"
 	"ia-online-golang/internal/storage"
-	"ia-online-golang/internal/utils"
 
+	AdminService "ia-online-golang/internal/services/admin"
+	APIKeyService "ia-online-golang/internal/services/apikey"
+	AuditService "ia-online-golang/internal/services/audit"
 	AuthService "ia-online-golang/internal/services/auth"
 	BitrixService "ia-online-golang/internal/services/bitrix"
 	CommentService "ia-online-golang/internal/services/comment"
+	ContactService "ia-online-golang/internal/services/contact"
 	EmailService "ia-online-golang/internal/services/email"
+	HealthService "ia-online-golang/internal/services/health"
 	LeadService "ia-online-golang/internal/services/lead"
+	LedgerService "ia-online-golang/internal/services/ledger"
+	OutboxService "ia-online-golang/internal/services/outbox"
 	PasswordCodeService "ia-online-golang/internal/services/passwordcode"
+	PayoutService "ia-online-golang/internal/services/payout"
+	RateLimitService "ia-online-golang/internal/services/ratelimit"
 	ReferralService "ia-online-golang/internal/services/referral"
+	RewardService "ia-online-golang/internal/services/reward"
+	SchedulerService "ia-online-golang/internal/services/scheduler"
+	SMSService "ia-online-golang/internal/services/sms"
 	TokenService "ia-online-golang/internal/services/token"
+	TwoFactorService "ia-online-golang/internal/services/twofactor"
 	UserService "ia-online-golang/internal/services/user"
 
+	AdminController "ia-online-golang/internal/http/controllers/admin"
+	APIKeyController "ia-online-golang/internal/http/controllers/apikey"
+	AuditController "ia-online-golang/internal/http/controllers/audit"
 	AuthController "ia-online-golang/internal/http/controllers/auth"
 	BitrixController "ia-online-golang/internal/http/controllers/bitrix"
 	CommentController "ia-online-golang/internal/http/controllers/comment"
+	ContactController "ia-online-golang/internal/http/controllers/contact"
+	HealthController "ia-online-golang/internal/http/controllers/health"
+	JWKSController "ia-online-golang/internal/http/controllers/jwks"
 	LeadController "ia-online-golang/internal/http/controllers/lead"
+	LedgerController "ia-online-golang/internal/http/controllers/ledger"
+	MeController "ia-online-golang/internal/http/controllers/me"
+	PayoutController "ia-online-golang/internal/http/controllers/payout"
+	ReferralController "ia-online-golang/internal/http/controllers/referral"
+	RewardController "ia-online-golang/internal/http/controllers/reward"
+	SchedulerController "ia-online-golang/internal/http/controllers/scheduler"
+	TwoFactorController "ia-online-golang/internal/http/controllers/twofactor"
 	UserController "ia-online-golang/internal/http/controllers/user"
 	"ia-online-golang/internal/http/middleware"
+	"ia-online-golang/internal/http/router"
 	"ia-online-golang/internal/http/validator"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -35,7 +71,8 @@ func main() {
 
 	// Логирование
 	log := logger.SetupLogger(cfg.Env)
-	log.Info("Starting...")
+	info := buildinfo.Get()
+	log.Infof("Starting %s (commit %s, built %s)...", info.Version, info.Commit, info.BuildTime)
 
 	// Подключение к БД
 	log.Info("Connecting database...")
@@ -52,31 +89,75 @@ func main() {
 		cfg.EmailConfig.SMTP.Username,
 		cfg.EmailConfig.SMTP.Password)
 
-	bitrixService := BitrixService.New(log, cfg.BitrixConfig.IncomingWebhook)
+	smsSender, err := SMSService.New(log, cfg.SMSConfig.Sender)
+	if err != nil {
+		log.Fatal("Error initializing sms sender: ", err)
+	}
+
+	bitrixService := BitrixService.New(log, cfg.BitrixConfig, &http.Client{})
 
-	passwordCodeService := PasswordCodeService.New(log, storage)
+	passwordCodeService := PasswordCodeService.New(log, cfg.PasswordResetConfig, storage)
+
+	rateLimitStore, err := RateLimitService.NewStore(cfg.RateLimitConfig.Store, storage)
+	if err != nil {
+		log.Fatal("Error initializing rate limit store: ", err)
+	}
+	rateLimitService := RateLimitService.New(log, cfg.RateLimitConfig, rateLimitStore)
 
 	userService := UserService.New(log, storage)
 
-	commentService := CommentService.New(log, cfg.BitrixConfig.FunnelID, bitrixService, storage, storage)
+	commentService := CommentService.New(log, cfg.BitrixConfig.FunnelID, bitrixService, storage, storage, storage)
 
-	leadService := LeadService.New(log, commentService, storage, userService, storage, bitrixService)
+	auditService := AuditService.New(log, storage)
+	ledgerService := LedgerService.New(log, storage, storage, storage, storage, auditService)
+	rewardService := RewardService.New(log, storage, storage, storage, auditService)
 
-	referralService := ReferralService.New(log, storage)
+	referralService := ReferralService.New(log, cfg.ReferralConfig, storage, storage, storage, ledgerService, rewardService)
+
+	leadService := LeadService.New(log, commentService, storage, userService, storage, bitrixService, storage, storage, auditService, ledgerService, rewardService, referralService, cfg.BitrixConfig.Stages)
+
+	outboxService := OutboxService.New(log, cfg.OutboxConfig, bitrixService, userService, storage, storage)
+
+	schedulerService := SchedulerService.New(log, cfg.SchedulerConfig, referralService, leadService, ledgerService, rateLimitService, storage)
+
+	accessKeys, err := jwtkeys.Load(cfg.JWTConfig.Access)
+	if err != nil {
+		log.Fatal("Error loading access token keys: ", err)
+	}
+
+	refreshKeys, err := jwtkeys.Load(cfg.JWTConfig.Refresh)
+	if err != nil {
+		log.Fatal("Error loading refresh token keys: ", err)
+	}
 
 	tokenService := TokenService.New(
 		log,
-		cfg.JWTConfig.Access.SecretKey,
-		cfg.JWTConfig.Refresh.SecretKey,
+		accessKeys,
+		refreshKeys,
 		int64(cfg.JWTConfig.Access.Expiration.Seconds()),
 		int64(cfg.JWTConfig.Refresh.Expiration.Seconds()),
+		int64(cfg.TwoFactorConfig.ChallengeTTL.Seconds()),
+		cfg.JWTConfig.SessionCacheTTL,
 		storage,
 		userService,
-		leadService,
-		referralService,
 	)
 
-	authService := AuthService.New(log, cfg.HTTPServerConfig.DomenName, storage, storage, storage, storage, tokenService, emailService, userService, passwordCodeService)
+	twoFactorService := TwoFactorService.New(log, cfg.TwoFactorConfig, storage, storage)
+
+	authService := AuthService.New(log, cfg.HTTPServerConfig.DomenName, storage, storage, storage, storage, tokenService, emailService, userService, passwordCodeService, rateLimitService, twoFactorService, auditService)
+
+	apiKeyService := APIKeyService.New(log, storage, storage)
+
+	contactService := ContactService.New(log, cfg.ContactChangeConfig, cfg.HTTPServerConfig.DomenName, storage, storage, storage, emailService, smsSender, auditService)
+
+	adminService := AdminService.New(log, storage, storage, authService, auditService)
+
+	payoutService, err := PayoutService.New(log, cfg.PayoutConfig, storage, storage, emailService, auditService)
+	if err != nil {
+		log.Fatal("Error initializing payout service: ", err)
+	}
+
+	healthService := HealthService.New(log, cfg.HealthConfig, storage, bitrixService, emailService)
 
 	// Инициализация валидатора
 	validator := validator.New()
@@ -85,68 +166,254 @@ func main() {
 	log.Info("Initializing controllers...")
 	authController := AuthController.New(log, validator, authService)
 	userController := UserController.New(log, validator, userService)
+	meController := MeController.New(log, userService, referralService, leadService)
+	twoFactorController := TwoFactorController.New(log, validator, twoFactorService)
+	contactController := ContactController.New(log, validator, contactService)
+	apiKeyController := APIKeyController.New(log, validator, apiKeyService)
+	adminController := AdminController.New(log, validator, adminService)
+	auditController := AuditController.New(log, auditService)
 	leadController := LeadController.New(log, validator, leadService)
+	ledgerController := LedgerController.New(log, validator, ledgerService)
+	payoutController := PayoutController.New(log, validator, payoutService)
+	rewardController := RewardController.New(log, validator, rewardService)
+	referralController := ReferralController.New(log, referralService)
 	commentController := CommentController.New(log, validator, commentService)
+	schedulerController := SchedulerController.New(log, validator, schedulerService)
+	healthController := HealthController.New(log, healthService)
+	jwksController := JWKSController.New(log, tokenService)
 	bitrixController := BitrixController.New(log, cfg.BitrixConfig.OutgoingWebhookAuth, cfg.BitrixConfig.AuthTokenComment, leadService, commentService)
 
-	// Создаём маршрутизатор
-	mux := http.NewServeMux()
+	// Метрики
+	metrics.RegisterDBStats(storage.Stats)
+	metrics.RegisterLeadsByStatus(storage.LeadsCountByStatus)
+	metricsHandler := promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
 
-	// Открытые маршруты (не требуют авторизации)
-	mux.HandleFunc("/", utils.HandleNotFound)
-	mux.HandleFunc("/api/v1/auth/registration", authController.Registration)
-	mux.HandleFunc("/api/v1/auth/activation/", authController.Activation)
-	mux.HandleFunc("/api/v1/auth/login", authController.Login)
-	mux.HandleFunc("/api/v1/auth/logout", authController.Logout)
-	mux.HandleFunc("/api/v1/auth/refresh", authController.Refresh)
-	mux.HandleFunc("/api/v1/auth/recover", authController.SendNewPassword)
+	// Ограничение запросов с одного IP к маршрутам, которые перебирают
+	limitIP := func(route string) []router.Middleware {
+		return []router.Middleware{middleware.RateLimitMiddleware(rateLimitService, route)}
+	}
 
-	mux.HandleFunc("/api/v1/bitrix/lead/edit", bitrixController.СhangingDeal)
-	mux.HandleFunc("/api/v1/bitrix/comment/new", bitrixController.NewComment)
+	// Таблица маршрутов. Маршруты с Roles требуют JWT-токен или API-ключ и одну из ролей.
+	// API-ключ принимается только маршрутами со Scopes.
+	routes := []router.Route{
+		{Method: http.MethodGet, Pattern: "/healthz", Handler: healthController.Healthz},
+		{Method: http.MethodGet, Pattern: "/readyz", Handler: healthController.Readyz},
+		{Method: http.MethodGet, Pattern: "/version", Handler: healthController.Version},
+		{Method: http.MethodGet, Pattern: "/.well-known/jwks.json", Handler: jwksController.JWKS},
+
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/registration", Handler: authController.Registration, Middleware: limitIP("registration")},
+		{Method: http.MethodGet, Pattern: "/api/v1/auth/activation/{id}", Handler: authController.Activation, Middleware: limitIP("activation")},
+		{Method: http.MethodGet, Pattern: "/api/v1/auth/email/confirm/{id}", Handler: contactController.ConfirmEmail, Middleware: limitIP("email_confirm")},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/login", Handler: authController.Login, Middleware: limitIP("login")},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/2fa/verify", Handler: authController.VerifyTwoFactor, Middleware: limitIP("2fa_verify")},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/2fa/enroll", Handler: authController.EnrollTwoFactor, Middleware: limitIP("2fa_enroll")},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/2fa/enroll/confirm", Handler: authController.ConfirmTwoFactor, Middleware: limitIP("2fa_enroll_confirm")},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/logout", Handler: authController.Logout},
+		{Method: http.MethodGet, Pattern: "/api/v1/auth/refresh", Handler: authController.Refresh},
+		{Method: http.MethodGet, Pattern: "/api/v1/auth/sessions", Handler: authController.Sessions, Auth: true},
+		{Method: http.MethodDelete, Pattern: "/api/v1/auth/sessions/{id}", Handler: authController.DeleteSession, Auth: true},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/recover", Handler: authController.SendPasswordCode, Middleware: limitIP("recover")},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/recover/confirm", Handler: authController.RecoverPassword, Middleware: limitIP("recover_confirm")},
+		{Method: http.MethodPost, Pattern: "/api/v1/auth/new_password", Handler: authController.NewPassword, Roles: []string{"user"}},
+
+		{Method: http.MethodPost, Pattern: "/api/v1/bitrix/lead/edit", Handler: bitrixController.СhangingDeal},
+		{Method: http.MethodPost, Pattern: "/api/v1/bitrix/comment/new", Handler: bitrixController.NewComment},
+
+		{Method: http.MethodGet, Pattern: "/api/v1/me", Handler: meController.Me, Auth: true},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/referrals", Handler: meController.Referrals, Auth: true},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/referrals/tree", Handler: referralController.MyTree, Auth: true},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/statistic", Handler: meController.Statistic, Auth: true},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/balance", Handler: ledgerController.MyBalance, Auth: true},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/ledger", Handler: ledgerController.MyLedger, Auth: true},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/payouts", Handler: payoutController.MyRequests, Auth: true},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/payouts", Handler: payoutController.Create, Auth: true, Middleware: limitIP("payout_create")},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/payouts/{id}", Handler: payoutController.MyRequest, Auth: true},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/payouts/{id}/cancel", Handler: payoutController.Cancel, Auth: true},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/2fa", Handler: twoFactorController.Status, Auth: true},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/2fa/enroll", Handler: twoFactorController.Enroll, Auth: true},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/2fa/confirm", Handler: twoFactorController.Confirm, Auth: true, Middleware: limitIP("2fa_confirm")},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/2fa/disable", Handler: twoFactorController.Disable, Auth: true, Middleware: limitIP("2fa_disable")},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/email", Handler: contactController.ChangeEmail, Auth: true, Middleware: limitIP("email_change")},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/phone", Handler: contactController.ChangePhone, Auth: true, Middleware: limitIP("phone_change")},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/phone/confirm", Handler: contactController.ConfirmPhone, Auth: true, Middleware: limitIP("phone_confirm")},
+		{Method: http.MethodGet, Pattern: "/api/v1/me/api-keys", Handler: apiKeyController.APIKeys, Auth: true},
+		{Method: http.MethodPost, Pattern: "/api/v1/me/api-keys", Handler: apiKeyController.CreateAPIKey, Auth: true},
+		{Method: http.MethodDelete, Pattern: "/api/v1/me/api-keys/{id}", Handler: apiKeyController.DeleteAPIKey, Auth: true},
+
+		{Method: http.MethodGet, Pattern: "/api/v1/users", Handler: userController.Users, Roles: []string{"manager"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/user/{id}", Handler: userController.User, Roles: []string{"manager"}},
+		{Method: http.MethodPut, Pattern: "/api/v1/user/edit", Handler: userController.EditUser, Roles: []string{"user"}},
+
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/users", Handler: adminController.Users, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/users/{id}", Handler: adminController.User, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPut, Pattern: "/api/v1/admin/users/{id}/roles", Handler: adminController.UpdateRoles, Roles: []string{"admin"}},
+		{Method: http.MethodPut, Pattern: "/api/v1/admin/users/{id}/tier", Handler: adminController.UpdateTier, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/activate", Handler: adminController.Activate, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/deactivate", Handler: adminController.Deactivate, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/ban", Handler: adminController.Ban, Roles: []string{"admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/unban", Handler: adminController.Unban, Roles: []string{"admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/activation", Handler: adminController.ResendActivation, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/logout", Handler: adminController.Logout, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodDelete, Pattern: "/api/v1/admin/users/{id}", Handler: adminController.DeleteUser, Roles: []string{"admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/users/{id}/balance", Handler: ledgerController.UserBalance, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/users/{id}/ledger", Handler: ledgerController.UserLedger, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/users/{id}/referrals/tree", Handler: referralController.UserTree, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/payouts", Handler: ledgerController.Payout, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/users/{id}/adjustments", Handler: ledgerController.Adjust, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/payouts", Handler: payoutController.Requests, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/payouts/{id}", Handler: payoutController.Request, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/payouts/{id}/approve", Handler: payoutController.Approve, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/payouts/{id}/reject", Handler: payoutController.Reject, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/payouts/{id}/paid", Handler: payoutController.MarkPaid, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/reward-rules", Handler: rewardController.Rules, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/reward-rules", Handler: rewardController.CreateRule, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPut, Pattern: "/api/v1/admin/reward-rules/{id}", Handler: rewardController.UpdateRule, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodDelete, Pattern: "/api/v1/admin/reward-rules/{id}", Handler: rewardController.DeleteRule, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/admin/reward-rules/dry-run", Handler: rewardController.DryRun, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/reward-rules/discrepancies", Handler: rewardController.Discrepancies, Roles: []string{"manager", "admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/audit", Handler: auditController.Events, Roles: []string{"admin"}},
+		{Method: http.MethodGet, Pattern: "/api/v1/admin/audit/export", Handler: auditController.Export, Roles: []string{"admin"}},
+
+		{Method: http.MethodGet, Pattern: "/api/v1/leads", Handler: leadController.Leads, Roles: []string{"manager", "user"}, Scopes: []string{APIKeyService.ScopeLeadsRead}},
+		{Method: http.MethodPost, Pattern: "/api/v1/lead/save", Handler: leadController.SaveLead, Roles: []string{"user"}, Scopes: []string{APIKeyService.ScopeLeadsWrite}},
+		{Method: http.MethodGet, Pattern: "/api/v1/lead/{id}/history", Handler: leadController.LeadHistory, Roles: []string{"manager", "user"}, Scopes: []string{APIKeyService.ScopeLeadsRead}},
+
+		{Method: http.MethodPost, Pattern: "/api/v1/comment/new", Handler: commentController.SaveComment, Roles: []string{"user"}},
+
+		{Method: http.MethodGet, Pattern: "/api/v1/jobs", Handler: schedulerController.Jobs, Roles: []string{"manager"}},
+		{Method: http.MethodPost, Pattern: "/api/v1/jobs/run", Handler: schedulerController.RunJob, Roles: []string{"manager"}},
+	}
 
-	// Защищённые маршруты (нужен JWT-токен)
-	protectedMux := http.NewServeMux()
-	protectedMux.Handle("/api/v1/users", middleware.RoleMiddleware("manager")(http.HandlerFunc(userController.Users)))
-	protectedMux.Handle("/api/v1/user/", middleware.RoleMiddleware("manager")(http.HandlerFunc(userController.User)))
-	protectedMux.Handle("/api/v1/user/edit", middleware.RoleMiddleware("user")(http.HandlerFunc(userController.EditUser)))
+	var metricsSrv *http.Server
+	if cfg.MetricsConfig.Address != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metricsHandler)
+		metricsSrv = &http.Server{
+			Addr:        cfg.MetricsConfig.Address,
+			Handler:     metricsMux,
+			ReadTimeout: cfg.HTTPServerConfig.ReadTimeout,
+		}
+	} else if cfg.MetricsConfig.Username != "" {
+		routes = append(routes, router.Route{
+			Method:     http.MethodGet,
+			Pattern:    "/metrics",
+			Handler:    metricsHandler.ServeHTTP,
+			Middleware: []router.Middleware{middleware.BasicAuthMiddleware(cfg.MetricsConfig.Username, cfg.MetricsConfig.Password)},
+		})
+	} else {
+		log.Warn("metrics are disabled: set metrics.address or metrics.username")
+	}
 
-	protectedMux.Handle("/api/v1/leads", middleware.RoleMiddleware("manager", "user")(http.HandlerFunc(leadController.Leads)))
-	protectedMux.Handle("/api/v1/lead/save", middleware.RoleMiddleware("user")(http.HandlerFunc(leadController.SaveLead)))
+	authMiddleware := middleware.APIKeyMiddleware(log, apiKeyService, middleware.JWTMiddleware(context.Background(), log, tokenService))
+	appRouter := router.New(authMiddleware, routes...)
+	appRouter.Handle(router.Route{Method: http.MethodGet, Pattern: "/api/v1/admin/routes", Handler: appRouter.ListRoutes, Roles: []string{"manager", "admin"}})
+	for _, route := range appRouter.Routes() {
+		log.Debugf("route %s %s auth=%t roles=%v scopes=%v", route.Method, route.Pattern, route.Auth, route.Roles, route.Scopes)
+	}
 
-	protectedMux.Handle("/api/v1/auth/new_password", middleware.RoleMiddleware("user")(http.HandlerFunc(authController.NewPassword)))
+	srv := &http.Server{
+		Addr:         cfg.HTTPServerConfig.Address,
+		Handler:      middleware.RequestIDMiddleware(middleware.RequestInfoMiddleware(cfg.HTTPServerConfig.TrustProxy)(middleware.MetricsMiddleware(appRouter))),
+		ReadTimeout:  cfg.HTTPServerConfig.ReadTimeout,
+		WriteTimeout: cfg.HTTPServerConfig.WriteTimeout,
+		IdleTimeout:  cfg.HTTPServerConfig.IdleTimeout,
+	}
 
-	protectedMux.Handle("/api/v1/comment/new", middleware.RoleMiddleware("user")(http.HandlerFunc(commentController.SaveComment)))
+	// Завершаем работу по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Оборачиваем защищённые маршруты в JWTMiddleware
-	protectedRoutes := middleware.JWTMiddleware(context.Background(), tokenService)(protectedMux)
+	// Запускаем отправку заявок в битрикс
+	var workers sync.WaitGroup
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		outboxService.Run(workersCtx)
+	}()
 
-	// Основной серверный обработчик
-	finalMux := http.NewServeMux()
-	finalMux.Handle("/", mux) // Открытые маршруты
-	finalMux.Handle("/api/v1/users", protectedRoutes)
-	finalMux.Handle("/api/v1/user", protectedRoutes)
-	finalMux.Handle("/api/v1/user/edit", protectedRoutes)
+	// Запускаем фоновые задачи по расписанию
+	schedulerService.Run()
 
-	finalMux.Handle("/api/v1/leads", protectedRoutes)
-	finalMux.Handle("/api/v1/lead/save", protectedRoutes)
+	// Запускаем сервер
+	serverErr := make(chan error, 2)
+	go func() {
+		log.Info("Server is running on " + cfg.HTTPServerConfig.Address)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	if metricsSrv != nil {
+		go func() {
+			log.Info("Metrics are served on " + cfg.MetricsConfig.Address)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
 
-	finalMux.Handle("/api/v1/auth/new_password", protectedRoutes)
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		log.Info("Shutting down...")
+	case err := <-serverErr:
+		log.Error("failed to start server: ", err)
+		exitCode = 1
+	}
+	stop()
 
-	finalMux.Handle("/api/v1/comment/new", protectedRoutes)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServerConfig.ShutdownTimeout)
+	defer cancel()
 
-	srv := &http.Server{
-		Addr:         cfg.HTTPServerConfig.Address,
-		Handler:      finalMux,
-		ReadTimeout:  cfg.HTTPServerConfig.ReadTimeout,
-		WriteTimeout: cfg.HTTPServerConfig.WriteTimeout,
-		IdleTimeout:  cfg.HTTPServerConfig.IdleTimeout,
+	// Перестаём принимать запросы и ждём текущие, в том числе их запросы в битрикс
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("server shutdown: ", err)
+		exitCode = 1
 	}
 
-	// Запускаем сервер
-	log.Info("Server is running on " + cfg.HTTPServerConfig.Address)
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Error("metrics server shutdown: ", err)
+			exitCode = 1
+		}
+	}
+
+	// Останавливаем фоновые задачи, пока БД ещё доступна
+	if err := schedulerService.Stop(shutdownCtx); err != nil {
+		log.Error("scheduler shutdown: ", err)
+		exitCode = 1
+	}
+
+	stopWorkers()
+	if err := wait(shutdownCtx, &workers); err != nil {
+		log.Error("workers shutdown: ", err)
+		exitCode = 1
 	}
 
-	log.Error("server stopped")
+	if err := storage.Close(); err != nil {
+		log.Error("storage close: ", err)
+		exitCode = 1
+	}
+
+	log.Info("server stopped")
+
+	cancel()
+	os.Exit(exitCode)
+}
+
+// wait ждёт завершения группы горутин, но не дольше, чем живёт ctx
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
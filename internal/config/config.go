@@ -1,22 +1,37 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"math"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Env              string           `yaml:"env" env-default:"local"`
-	StorageConfig    StorageConfig    `yaml:"storage"`
-	DadataConfig     DadataConfig     `yaml:"dadata"`
-	JWTConfig        JWTConfig        `yaml:"jwt"`
-	HTTPServerConfig HTTPServerConfig `yaml:"http_server"`
-	EmailConfig      EmailConfig      `yaml:"email"`
-	BitrixConfig     BitrixConfig     `yaml:"bitrix"`
+	Env                 string              `yaml:"env" env-default:"local"`
+	StorageConfig       StorageConfig       `yaml:"storage"`
+	DadataConfig        DadataConfig        `yaml:"dadata"`
+	JWTConfig           JWTConfig           `yaml:"jwt"`
+	HTTPServerConfig    HTTPServerConfig    `yaml:"http_server"`
+	EmailConfig         EmailConfig         `yaml:"email"`
+	BitrixConfig        BitrixConfig        `yaml:"bitrix"`
+	OutboxConfig        OutboxConfig        `yaml:"outbox"`
+	SchedulerConfig     SchedulerConfig     `yaml:"scheduler"`
+	HealthConfig        HealthConfig        `yaml:"health"`
+	MetricsConfig       MetricsConfig       `yaml:"metrics"`
+	RateLimitConfig     RateLimitConfig     `yaml:"rate_limit"`
+	PasswordResetConfig PasswordResetConfig `yaml:"password_reset"`
+	TwoFactorConfig     TwoFactorConfig     `yaml:"two_factor"`
+	ContactChangeConfig ContactChangeConfig `yaml:"contact_change"`
+	SMSConfig           SMSConfig           `yaml:"sms"`
+	PayoutConfig        PayoutConfig        `yaml:"payout"`
+	ReferralConfig      ReferralConfig      `yaml:"referral"`
 }
 
 type StorageConfig struct {
@@ -31,11 +46,28 @@ type DadataConfig struct {
 type JWTConfig struct {
 	Access  JWTInfo `yaml:"access"`
 	Refresh JWTInfo `yaml:"refresh"`
+
+	// Сколько помнить результат проверки сессии access-токена. Отзыв сессии и блокировка
+	// применяются к уже выданным токенам не позже чем через это время.
+	SessionCacheTTL time.Duration `yaml:"session_cache_ttl" env-default:"5s"`
 }
 
+// JWTInfo настройки подписи токенов. Если заданы keys, токены подписываются ключом signing_key (RS256 или EdDSA),
+// а остальные ключи только проверяют подпись. secret_key (HS256) нужен для токенов, выпущенных без kid:
+// его можно убрать, когда все такие токены истекут.
 type JWTInfo struct {
-	SecretKey  string        `yaml:"secret_key"`
-	Expiration time.Duration `yaml:"expiration"`
+	SecretKey  string         `yaml:"secret_key"`
+	Expiration time.Duration  `yaml:"expiration"`
+	SigningKey string         `yaml:"signing_key"`
+	Keys       []JWTKeyConfig `yaml:"keys"`
+}
+
+// JWTKeyConfig ключ в формате PEM. Для ключа подписи нужен закрытый ключ, для остальных достаточно открытого.
+type JWTKeyConfig struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"` // RS256 или EdDSA
+	PrivateKeyPath string `yaml:"private_key_path"`
+	PublicKeyPath  string `yaml:"public_key_path"`
 }
 
 type HTTPServerConfig struct {
@@ -44,6 +76,10 @@ type HTTPServerConfig struct {
 	ReadTimeout  time.Duration `yaml:"read_timeout" env-default:"4s"`
 	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"4s"`
 	IdleTimeout  time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// ShutdownTimeout сколько ждать завершения запросов и фоновых задач при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"15s"`
+	// TrustProxy брать IP клиента из X-Real-IP и X-Forwarded-For. Включать только за nginx или другим прокси.
+	TrustProxy bool `yaml:"trust_proxy" env-default:"false"`
 }
 
 type EmailConfig struct {
@@ -65,6 +101,253 @@ type BitrixConfig struct {
 	AuthTokenComment    string `yaml:"auth_token_comment"`
 	IncomingWebhook     string `yaml:"incoming_webhook"`
 	FunnelID            string `yaml:"id_funnel"`
+
+	// Настройки клиента REST API. По умолчанию соответствуют лимиту битрикса в 2 запроса в секунду.
+	Timeout      time.Duration `yaml:"timeout" env-default:"10s"`
+	MaxRetries   int           `yaml:"max_retries" env-default:"3"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env-default:"500ms"`
+	RateLimit    float64       `yaml:"rate_limit" env-default:"2"`
+	RateBurst    int           `yaml:"rate_burst" env-default:"2"`
+
+	// Параметры сделки. У тестового и боевого портала разные коды полей и стадии.
+	DealTitle  string               `yaml:"deal_title" env-default:"Заявка с сайта ia-on.ru"`
+	DealTypeID string               `yaml:"deal_type_id" env-default:"SALE"`
+	NewStage   string               `yaml:"new_stage"`
+	Stages     map[string]int64     `yaml:"stages"` // стадия битрикса -> id из таблицы statuses
+	Services   BitrixServicesConfig `yaml:"services"`
+	Fields     BitrixFieldsConfig   `yaml:"fields"`
+}
+
+// BitrixServicesConfig id значений списка услуг в сделке
+type BitrixServicesConfig struct {
+	Internet int `yaml:"internet"`
+	Cleaning int `yaml:"cleaning"`
+	Shipping int `yaml:"shipping"`
+}
+
+// BitrixFieldsConfig коды пользовательских полей сделки (UF_CRM_*)
+type BitrixFieldsConfig struct {
+	Address         string `yaml:"address"`
+	Services        string `yaml:"services"`
+	Comment         string `yaml:"comment"`
+	City            string `yaml:"city"`
+	PartnerName     string `yaml:"partner_name"`
+	PartnerPhone    string `yaml:"partner_phone"`
+	PartnerID       string `yaml:"partner_id"`
+	InternetPayment string `yaml:"internet_payment"`
+	CleaningPayment string `yaml:"cleaning_payment"`
+	ShippingPayment string `yaml:"shipping_payment"`
+}
+
+// Validate проверяет, что маппинг полей и стадий заполнен и согласован с воронкой
+func (c BitrixConfig) Validate() error {
+	var errs []error
+
+	fields := []struct{ name, value string }{
+		{"fields.address", c.Fields.Address},
+		{"fields.services", c.Fields.Services},
+		{"fields.comment", c.Fields.Comment},
+		{"fields.city", c.Fields.City},
+		{"fields.partner_name", c.Fields.PartnerName},
+		{"fields.partner_phone", c.Fields.PartnerPhone},
+		{"fields.partner_id", c.Fields.PartnerID},
+		{"fields.internet_payment", c.Fields.InternetPayment},
+		{"fields.cleaning_payment", c.Fields.CleaningPayment},
+		{"fields.shipping_payment", c.Fields.ShippingPayment},
+	}
+	required := append([]struct{ name, value string }{
+		{"incoming_webhook", c.IncomingWebhook},
+		{"id_funnel", c.FunnelID},
+		{"new_stage", c.NewStage},
+	}, fields...)
+	for _, field := range required {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("bitrix.%s is required", field.name))
+		}
+	}
+
+	// Коды полей становятся ключами полей сделки: при совпадении одно значение молча затрёт другое
+	fieldNames := make(map[string]string)
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if other, ok := fieldNames[field.value]; ok {
+			errs = append(errs, fmt.Errorf("bitrix.%s: code %s is already used by bitrix.%s", field.name, field.value, other))
+			continue
+		}
+		fieldNames[field.value] = field.name
+	}
+
+	// Нулевой лимит частоты или таймаут блокируют все запросы к битриксу
+	if c.RateLimit <= 0 {
+		errs = append(errs, errors.New("bitrix.rate_limit must be positive"))
+	}
+	if c.RateBurst <= 0 {
+		errs = append(errs, errors.New("bitrix.rate_burst must be positive"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("bitrix.timeout must be positive"))
+	}
+	if c.MaxRetries < 0 {
+		errs = append(errs, errors.New("bitrix.max_retries must not be negative"))
+	}
+	if c.RetryBackoff < 0 {
+		errs = append(errs, errors.New("bitrix.retry_backoff must not be negative"))
+	}
+
+	if c.Services.Internet == 0 || c.Services.Cleaning == 0 || c.Services.Shipping == 0 {
+		errs = append(errs, errors.New("bitrix.services: internet, cleaning and shipping are required"))
+	}
+
+	if len(c.Stages) == 0 {
+		errs = append(errs, errors.New("bitrix.stages is required"))
+	}
+	if _, ok := c.Stages[c.NewStage]; c.NewStage != "" && !ok {
+		errs = append(errs, fmt.Errorf("bitrix.new_stage %s is missing in bitrix.stages", c.NewStage))
+	}
+
+	// У всех воронок, кроме основной, стадии имеют префикс вида C42:
+	if c.FunnelID != "" && c.FunnelID != "0" {
+		prefix := "C" + c.FunnelID + ":"
+		for stage := range c.Stages {
+			if !strings.HasPrefix(stage, prefix) {
+				errs = append(errs, fmt.Errorf("bitrix.stages: stage %s does not belong to funnel %s", stage, c.FunnelID))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// OutboxConfig настройки воркера, который отправляет заявки в битрикс
+type OutboxConfig struct {
+	Interval    time.Duration `yaml:"interval" env-default:"5s"`
+	BatchSize   int64         `yaml:"batch_size" env-default:"10"`
+	MaxAttempts int           `yaml:"max_attempts" env-default:"12"`
+	BaseBackoff time.Duration `yaml:"base_backoff" env-default:"10s"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" env-default:"1h"`
+}
+
+// SchedulerConfig расписания фоновых задач в формате cron
+type SchedulerConfig struct {
+	ActiveReferralsSpec   string `yaml:"active_referrals_spec" env-default:"0 3 * * *"`
+	ReconcileSpec         string `yaml:"reconcile_spec" env-default:"*/30 * * * *"`
+	ReconcileDryRun       bool   `yaml:"reconcile_dry_run" env-default:"false"`
+	RateLimitsCleanupSpec string `yaml:"rate_limits_cleanup_spec" env-default:"*/10 * * * *"`
+	// Сверка книги со всеми заявками и рефералами, на большой базе запускать реже
+	LedgerSyncSpec string `yaml:"ledger_sync_spec" env-default:"*/30 * * * *"`
+	// Пересчёт процентов с заявок приглашённых на случай, если вебхук не дошёл или изменились настройки
+	ReferralCommissionsSpec string `yaml:"referral_commissions_spec" env-default:"15 * * * *"`
+}
+
+// HealthConfig настройки проверок готовности
+type HealthConfig struct {
+	CheckTimeout   time.Duration `yaml:"check_timeout" env-default:"2s"`
+	BitrixCacheTTL time.Duration `yaml:"bitrix_cache_ttl" env-default:"1m"`
+}
+
+// MetricsConfig настройки /metrics. Если задан address, метрики отдаются на отдельном порту,
+// иначе на основном сервере под basic auth. Без address и логина метрики не публикуются.
+type MetricsConfig struct {
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// RateLimitConfig защита от перебора. Store: memory для одного экземпляра, postgres, если экземпляров несколько.
+type RateLimitConfig struct {
+	Store string `yaml:"store" env-default:"memory"`
+	// Запросов к каждому маршруту авторизации с одного IP за окно
+	IPLimit  int64         `yaml:"ip_limit" env-default:"20"`
+	IPWindow time.Duration `yaml:"ip_window" env-default:"1m"`
+	// После стольких неверных паролей подряд аккаунт блокируется на login_lockout
+	LoginMaxFailures int64         `yaml:"login_max_failures" env-default:"5"`
+	LoginLockout     time.Duration `yaml:"login_lockout" env-default:"15m"`
+	// Попыток ввести код второго фактора по одному challenge-токену, после них нужно снова войти по паролю
+	ChallengeMaxAttempts int64 `yaml:"challenge_max_attempts" env-default:"5"`
+	// Писем восстановления пароля на один адрес за окно
+	RecoverLimit  int64         `yaml:"recover_limit" env-default:"3"`
+	RecoverWindow time.Duration `yaml:"recover_window" env-default:"1h"`
+}
+
+// PasswordResetConfig настройки кодов восстановления пароля
+type PasswordResetConfig struct {
+	CodeTTL     time.Duration `yaml:"code_ttl" env-default:"15m"`
+	MaxAttempts int           `yaml:"max_attempts" env-default:"5"`
+}
+
+// TwoFactorConfig настройки TOTP. Пользователи с ролями из required_roles не войдут без второго фактора,
+// остальные подключают его по желанию.
+type TwoFactorConfig struct {
+	Issuer        string        `yaml:"issuer" env-default:"IA Online"`
+	RequiredRoles []string      `yaml:"required_roles"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+	// Skew сколько шагов по 30 секунд допускается в обе стороны из-за расхождения часов
+	Skew          int `yaml:"skew" env-default:"1"`
+	RecoveryCodes int `yaml:"recovery_codes" env-default:"10"`
+}
+
+// ContactChangeConfig настройки подтверждения новой почты ссылкой и нового номера кодом из SMS
+type ContactChangeConfig struct {
+	EmailLinkTTL     time.Duration `yaml:"email_link_ttl" env-default:"24h"`
+	PhoneCodeTTL     time.Duration `yaml:"phone_code_ttl" env-default:"10m"`
+	PhoneMaxAttempts int           `yaml:"phone_max_attempts" env-default:"5"`
+}
+
+// SMSConfig Sender: log пишет сообщения в лог вместо отправки
+type SMSConfig struct {
+	Sender string `yaml:"sender" env-default:"log"`
+}
+
+// PayoutConfig DetailsKey ключ AES-256 в base64 для шифрования реквизитов выплат.
+// При смене ключа прежние реквизиты перестанут расшифровываться.
+type PayoutConfig struct {
+	DetailsKey string `yaml:"details_key"`
+}
+
+// ReferralConfig многоуровневая реферальная программа. Levels задаёт процент с вознаграждения за заявки
+// приглашённых: первый элемент для прямых рефералов, второй для приглашённых ими и так далее.
+// Без levels проценты не начисляются.
+type ReferralConfig struct {
+	Levels []ReferralLevelConfig `yaml:"levels"`
+	// Window сколько после регистрации приглашённого начисляются проценты с его заявок, 0 без ограничения
+	Window time.Duration `yaml:"window" env-default:"0"`
+}
+
+// ReferralLevelConfig Cap предел процентов в рублях, которые партнёр получит с одного приглашённого
+// на этом уровне, 0 без ограничения
+type ReferralLevelConfig struct {
+	Percent float64 `yaml:"percent"`
+	Cap     int64   `yaml:"cap"`
+}
+
+// maxReferralLevels глубже дерево не обходится, чтобы пересчёт одной заявки оставался дешёвым
+const maxReferralLevels = 10
+
+func (c ReferralConfig) Validate() error {
+	var errs []error
+
+	if len(c.Levels) > maxReferralLevels {
+		errs = append(errs, fmt.Errorf("referral.levels: at most %d levels are supported", maxReferralLevels))
+	}
+
+	for i, level := range c.Levels {
+		// Проценты считаются в сотых долях, поэтому больше двух знаков после точки не допускается
+		hundredths := level.Percent * 100
+		if level.Percent <= 0 || level.Percent > 100 || math.Abs(hundredths-math.Round(hundredths)) > 1e-9 {
+			errs = append(errs, fmt.Errorf("referral.levels[%d].percent must be in (0, 100] with at most two decimals", i))
+		}
+		if level.Cap < 0 {
+			errs = append(errs, fmt.Errorf("referral.levels[%d].cap must not be negative", i))
+		}
+	}
+
+	if c.Window < 0 {
+		errs = append(errs, errors.New("referral.window must not be negative"))
+	}
+
+	return errors.Join(errs...)
 }
 
 func MustLoad() *Config {
@@ -89,5 +372,13 @@ func MustLoad() *Config {
 		log.Fatalf("Cannot read config: %s", err)
 	}
 
+	if err := cfg.BitrixConfig.Validate(); err != nil {
+		log.Fatalf("Invalid bitrix config: %s", err)
+	}
+
+	if err := cfg.ReferralConfig.Validate(); err != nil {
+		log.Fatalf("Invalid referral config: %s", err)
+	}
+
 	return &cfg
 }
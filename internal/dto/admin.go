@@ -0,0 +1,51 @@
+package dto
+
+import "time"
+
+// AdminUserDTO пользователь в админке: в отличие от UserDTO, с признаками активации и блокировки
+type AdminUserDTO struct {
+	ID           int64      `json:"id"`
+	Email        string     `json:"email"`
+	Name         string     `json:"name"`
+	PhoneNumber  string     `json:"phone_number"`
+	Telegram     string     `json:"telegram"`
+	City         string     `json:"city"`
+	ReferralCode string     `json:"referral_code"`
+	Roles        []string   `json:"roles"`
+	Tier         string     `json:"tier"`
+	IsActive     bool       `json:"is_active"`
+	CreatedAt    time.Time  `json:"created_at"`
+	BannedAt     *time.Time `json:"banned_at"`
+}
+
+type UserFilterDTO struct {
+	City        *string    `json:"city"`
+	Role        *string    `json:"role"`
+	IsActive    *bool      `json:"is_active"`
+	IsBanned    *bool      `json:"is_banned"`
+	CreatedFrom *time.Time `json:"created_from"`
+	CreatedTo   *time.Time `json:"created_to"`
+	Search      *string    `json:"search"`
+	Limit       int64      `json:"limit"`
+	Offset      int64      `json:"offset"`
+}
+
+type UserPageDTO struct {
+	Users  []AdminUserDTO `json:"users"`
+	Total  int64          `json:"total"`
+	Limit  int64          `json:"limit"`
+	Offset int64          `json:"offset"`
+}
+
+type UpdateRolesDTO struct {
+	Roles []string `json:"roles" validate:"required,min=1,dive,oneof=user manager admin"`
+}
+
+type BanUserDTO struct {
+	Reason string `json:"reason" validate:"omitempty,max=500"`
+}
+
+// UpdateTierDTO уровень партнёра, по которому подбираются правила вознаграждения
+type UpdateTierDTO struct {
+	Tier string `json:"tier" validate:"required,max=32,alphanum,lowercase"`
+}
@@ -0,0 +1,26 @@
+package dto
+
+import "time"
+
+// CreateAPIKeyDTO без expires_at ключ действует, пока его не отзовут
+type CreateAPIKeyDTO struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=leads:read leads:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyDTO struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreatedAPIKeyDTO ключ целиком возвращается только при создании
+type CreatedAPIKeyDTO struct {
+	APIKeyDTO
+	Key string `json:"key"`
+}
@@ -0,0 +1,39 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEventDTO struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	Details    json.RawMessage `json:"details"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type AuditFilterDTO struct {
+	ActorID    *int64     `json:"actor_id"`
+	Action     *string    `json:"action"`
+	TargetType *string    `json:"target_type"`
+	TargetID   *string    `json:"target_id"`
+	RequestID  *string    `json:"request_id"`
+	From       *time.Time `json:"from"`
+	To         *time.Time `json:"to"`
+	Limit      int64      `json:"limit"`
+	Offset     int64      `json:"offset"`
+}
+
+type AuditPageDTO struct {
+	Events []AuditEventDTO `json:"events"`
+	Total  int64           `json:"total"`
+	Limit  int64           `json:"limit"`
+	Offset int64           `json:"offset"`
+}
@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 type RegisterUserDTO struct {
 	Email          string `json:"email" validate:"required,email"`
 	Password       string `json:"password" validate:"required,complexpassword"`
@@ -28,15 +30,12 @@ type NewPasswordDTO struct {
 }
 
 type RecoverPasswordDTO struct {
+	Email             string `json:"email" validate:"required,email"`
 	Code              string `json:"code" validate:"required"`
 	NewPassword       string `json:"new_password" validate:"required,complexpassword"`
 	RepeatNewPassword string `json:"repeat_new_password" validate:"required,eqfield=NewPassword"`
 }
 
-type SendNewPasswordDTO struct {
-	Email string `json:"email" validate:"required,email"`
-}
-
 type SendPasswordCodeDTO struct {
 	Email string `json:"email" validate:"required,email"`
 }
@@ -44,3 +43,13 @@ type SendPasswordCodeDTO struct {
 type RefreshTokenDTO struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
+
+type SessionDTO struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
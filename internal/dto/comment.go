@@ -12,4 +12,7 @@ type CommentDTO struct {
 	Manager   bool       `json:"is_manager"`
 	Text      string     `json:"text"`
 	CreatedAt *time.Time `json:"created_at"`
+
+	// Pending комментарий поставлен в очередь и уйдёт в битрикс после создания сделки
+	Pending bool `json:"pending,omitempty"`
 }
@@ -0,0 +1,13 @@
+package dto
+
+type ChangeEmailDTO struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ChangePhoneDTO struct {
+	PhoneNumber string `json:"phone_number" validate:"required,e164"`
+}
+
+type ConfirmPhoneDTO struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
@@ -0,0 +1,19 @@
+package dto
+
+// Статусы проверок
+const (
+	HealthStatusOk   = "ok"
+	HealthStatusFail = "fail"
+)
+
+type HealthCheckDTO struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Cached     bool   `json:"cached,omitempty"`
+}
+
+type ReadinessDTO struct {
+	Status string                    `json:"status"`
+	Checks map[string]HealthCheckDTO `json:"checks"`
+}
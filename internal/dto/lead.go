@@ -1,6 +1,9 @@
 package dto
 
-import "time"
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
 
 type CreateLeadDTO struct {
 	Name        string `json:"name" validate:"required"`
@@ -8,9 +11,9 @@ type CreateLeadDTO struct {
 	Address     string `json:"address" validate:"required"`
 	Comment     string `json:"comment" validate:"omitempty"`
 
-	RewardInternet float64 `json:"reward_internet" validate:"omitempty"`
-	RewardCleaning float64 `json:"reward_cleaning" validate:"omitempty"`
-	RewardShipping float64 `json:"reward_shipping" validate:"omitempty"`
+	RewardInternet money.Money `json:"reward_internet" validate:"omitempty"`
+	RewardCleaning money.Money `json:"reward_cleaning" validate:"omitempty"`
+	RewardShipping money.Money `json:"reward_shipping" validate:"omitempty"`
 
 	IsInternet bool `json:"is_internet"`
 	IsShipping bool `json:"is_shipping"`
@@ -26,12 +29,19 @@ type LeadDTO struct {
 	Internet    bool   `json:"is_internet"`
 	Cleaning    bool   `json:"is_cleaning"`
 	Shipping    bool   `json:"is_shipping"`
+	SyncStatus  string `json:"sync_status"`
 
 	Comments []CommentDTO `json:"comments"`
 
-	RewardInternet float64 `json:"reward_internet"`
-	RewardCleaning float64 `json:"reward_cleaning"`
-	RewardShipping float64 `json:"reward_shipping"`
+	RewardInternet money.Money `json:"reward_internet"`
+	RewardCleaning money.Money `json:"reward_cleaning"`
+	RewardShipping money.Money `json:"reward_shipping"`
+
+	// Ожидаемые вознаграждения по правилам на момент создания заявки, null если правила не было
+	ExpectedRewardInternet *money.Money `json:"expected_reward_internet"`
+	ExpectedRewardCleaning *money.Money `json:"expected_reward_cleaning"`
+	ExpectedRewardShipping *money.Money `json:"expected_reward_shipping"`
+	RewardDiscrepancy      bool         `json:"reward_discrepancy"`
 
 	CreatedAt   *time.Time `json:"created_at"`
 	CompletedAt *time.Time `json:"completed_at"`
@@ -51,11 +61,36 @@ type LeadFilterDTO struct {
 	Search     *string    `json:"search"`
 }
 
+// UserStatistic Commissions проценты с заявок приглашённых, созданных за период
 type UserStatistic struct {
-	StartDate *time.Time `json:"start_date"`
-	Internet  float64    `json:"internet"`
-	Cleaning  float64    `json:"cleaning"`
-	Shipping  float64    `json:"shipping"`
-	Referrals float64    `json:"referrals"`
-	Total     float64    `json:"total"`
+	StartDate   *time.Time  `json:"start_date"`
+	Internet    money.Money `json:"internet"`
+	Cleaning    money.Money `json:"cleaning"`
+	Shipping    money.Money `json:"shipping"`
+	Referrals   money.Money `json:"referrals"`
+	Commissions money.Money `json:"commissions"`
+	Total       money.Money `json:"total"`
+}
+
+// ReconcileSummaryDTO итог сверки заявок со сделками битрикса
+// Drifted считает расхождения, Fixed только исправленные: при пробном запуске Fixed остаётся нулевым.
+type ReconcileSummaryDTO struct {
+	Checked int  `json:"checked"`
+	Drifted int  `json:"drifted"`
+	Fixed   int  `json:"fixed"`
+	Failed  int  `json:"failed"`
+	Skipped int  `json:"skipped"`
+	DryRun  bool `json:"dry_run"`
+}
+
+type LeadHistoryDTO struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`
+	Field     string    `json:"field"`
+	OldValue  *string   `json:"old_value"`
+	NewValue  *string   `json:"new_value"`
+	OldStatus *string   `json:"old_status,omitempty"`
+	NewStatus *string   `json:"new_status,omitempty"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,48 @@
+package dto
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
+// BalanceDTO Pending к выплате, всегда равен Accrued минус Paid. Reserved сумма открытых заявок на выплату,
+// Available остаток, на который можно подать новую заявку.
+type BalanceDTO struct {
+	Accrued   money.Money `json:"accrued"`
+	Pending   money.Money `json:"pending"`
+	Paid      money.Money `json:"paid"`
+	Reserved  money.Money `json:"reserved"`
+	Available money.Money `json:"available"`
+}
+
+type LedgerEntryDTO struct {
+	ID         int64       `json:"id"`
+	Kind       string      `json:"kind"`
+	Amount     money.Money `json:"amount"`
+	Reason     string      `json:"reason"`
+	SourceType string      `json:"source_type"`
+	SourceID   string      `json:"source_id"`
+	CreatedBy  *int64      `json:"created_by"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+type LedgerPageDTO struct {
+	Entries []LedgerEntryDTO `json:"entries"`
+	Total   int64            `json:"total"`
+	Limit   int64            `json:"limit"`
+	Offset  int64            `json:"offset"`
+}
+
+// PayoutDTO Reference номер платёжного поручения или перевода
+type PayoutDTO struct {
+	Amount    money.Money `json:"amount" validate:"required,gt=0"`
+	Reason    string      `json:"reason" validate:"required,max=500"`
+	Reference string      `json:"reference" validate:"required,max=64"`
+}
+
+// AdjustmentDTO положительная сумма начисляет партнёру, отрицательная списывает
+type AdjustmentDTO struct {
+	Amount    money.Money `json:"amount" validate:"required"`
+	Reason    string      `json:"reason" validate:"required,max=500"`
+	Reference string      `json:"reference" validate:"omitempty,max=64"`
+}
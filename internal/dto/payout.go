@@ -0,0 +1,85 @@
+package dto
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
+type CardDetailsDTO struct {
+	Number string `json:"number" validate:"required,credit_card"`
+}
+
+type SBPDetailsDTO struct {
+	PhoneNumber string `json:"phone_number" validate:"required,e164"`
+	BankName    string `json:"bank_name" validate:"required,max=100"`
+}
+
+type BankAccountDetailsDTO struct {
+	AccountNumber string `json:"account_number" validate:"required,len=20,numeric"`
+	BIK           string `json:"bik" validate:"required,len=9,numeric"`
+	RecipientName string `json:"recipient_name" validate:"required,max=255"`
+}
+
+// PayoutDetailsDTO реквизиты выплаты, заполнен только блок выбранного способа
+type PayoutDetailsDTO struct {
+	Card        *CardDetailsDTO        `json:"card,omitempty"`
+	SBP         *SBPDetailsDTO         `json:"sbp,omitempty"`
+	BankAccount *BankAccountDetailsDTO `json:"bank_account,omitempty"`
+}
+
+// CreatePayoutRequestDTO реквизиты передаются в блоке, соответствующем method
+type CreatePayoutRequestDTO struct {
+	Amount      money.Money            `json:"amount" validate:"required,gt=0"`
+	Method      string                 `json:"method" validate:"required,oneof=card sbp bank_account"`
+	Card        *CardDetailsDTO        `json:"card" validate:"required_if=Method card,excluded_unless=Method card"`
+	SBP         *SBPDetailsDTO         `json:"sbp" validate:"required_if=Method sbp,excluded_unless=Method sbp"`
+	BankAccount *BankAccountDetailsDTO `json:"bank_account" validate:"required_if=Method bank_account,excluded_unless=Method bank_account"`
+	Comment     string                 `json:"comment" validate:"omitempty,max=500"`
+}
+
+type PayoutCommentDTO struct {
+	Comment string `json:"comment" validate:"omitempty,max=500"`
+}
+
+// RejectPayoutDTO партнёр должен понимать, почему ему отказали
+type RejectPayoutDTO struct {
+	Comment string `json:"comment" validate:"required,max=500"`
+}
+
+type PayoutRequestEventDTO struct {
+	Status    string    `json:"status"`
+	Comment   string    `json:"comment"`
+	AuthorID  *int64    `json:"author_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PayoutRequestDTO Details заполняется только в карточке заявки для менеджера
+type PayoutRequestDTO struct {
+	ID          int64                   `json:"id"`
+	UserID      int64                   `json:"user_id"`
+	Amount      money.Money             `json:"amount"`
+	Method      string                  `json:"method"`
+	DetailsMask string                  `json:"details_mask"`
+	Details     *PayoutDetailsDTO       `json:"details,omitempty"`
+	Status      string                  `json:"status"`
+	ReviewedBy  *int64                  `json:"reviewed_by"`
+	ReviewedAt  *time.Time              `json:"reviewed_at"`
+	PaidAt      *time.Time              `json:"paid_at"`
+	CreatedAt   time.Time               `json:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at"`
+	History     []PayoutRequestEventDTO `json:"history,omitempty"`
+}
+
+type PayoutFilterDTO struct {
+	UserID *int64
+	Status *string
+	Limit  int64
+	Offset int64
+}
+
+type PayoutPageDTO struct {
+	Requests []PayoutRequestDTO `json:"requests"`
+	Total    int64              `json:"total"`
+	Limit    int64              `json:"limit"`
+	Offset   int64              `json:"offset"`
+}
@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
 type ReferralDTO struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
@@ -7,3 +12,26 @@ type ReferralDTO struct {
 	City        string `json:"city"`
 	Active      bool   `json:"active"`
 }
+
+// ReferralTreeDTO приглашённые партнёра на глубину, за которую начисляются проценты.
+// Earned сумма процентов со всего дерева.
+type ReferralTreeDTO struct {
+	Depth     int               `json:"depth"`
+	Earned    money.Money       `json:"earned"`
+	Referrals []ReferralNodeDTO `json:"referrals"`
+}
+
+// ReferralNodeDTO Earned проценты с заявок самого приглашённого, BranchEarned вместе со всеми приглашёнными им.
+// Percent процент с его заявок, 0 если за этот уровень проценты не начисляются.
+type ReferralNodeDTO struct {
+	UserID       int64             `json:"user_id"`
+	Name         string            `json:"name"`
+	City         string            `json:"city"`
+	Level        int               `json:"level"`
+	Percent      float64           `json:"percent"`
+	Active       bool              `json:"active"`
+	JoinedAt     time.Time         `json:"joined_at"`
+	Earned       money.Money       `json:"earned"`
+	BranchEarned money.Money       `json:"branch_earned"`
+	Referrals    []ReferralNodeDTO `json:"referrals"`
+}
@@ -0,0 +1,83 @@
+package dto
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
+// SaveRewardRuleDTO пустые city и tier подходят для любого города и уровня партнёра,
+// без valid_to правило действует бессрочно. Даты в формате 2006-01-02, valid_to включительно.
+type SaveRewardRuleDTO struct {
+	Service   string      `json:"service" validate:"required,oneof=internet cleaning shipping referral"`
+	City      *string     `json:"city" validate:"omitempty,max=255"`
+	Tier      *string     `json:"tier" validate:"omitempty,max=32,alphanum,lowercase"`
+	Amount    money.Money `json:"amount" validate:"gte=0"`
+	ValidFrom string      `json:"valid_from" validate:"required,datetime=2006-01-02"`
+	ValidTo   *string     `json:"valid_to" validate:"omitempty,datetime=2006-01-02"`
+}
+
+type RewardRuleDTO struct {
+	ID        int64       `json:"id"`
+	Service   string      `json:"service"`
+	City      *string     `json:"city"`
+	Tier      *string     `json:"tier"`
+	Amount    money.Money `json:"amount"`
+	ValidFrom string      `json:"valid_from"`
+	ValidTo   *string     `json:"valid_to"`
+	CreatedBy *int64      `json:"created_by"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// RewardDryRunRequestDTO проверка правил на заявках за период. Если rules не передан, проверяются текущие правила.
+type RewardDryRunRequestDTO struct {
+	Rules     []SaveRewardRuleDTO `json:"rules" validate:"omitempty,dive"`
+	StartDate *time.Time          `json:"start_date"`
+	EndDate   *time.Time          `json:"end_date"`
+}
+
+// RewardDryRunLeadDTO Actual заполнен только у завершённых заявок, по которым битрикс прислал итоговую сумму
+type RewardDryRunLeadDTO struct {
+	LeadID      int64        `json:"lead_id"`
+	UserID      int64        `json:"user_id"`
+	StatusID    int64        `json:"status_id"`
+	Expected    money.Money  `json:"expected"`
+	Actual      *money.Money `json:"actual"`
+	MissingRule bool         `json:"missing_rule"`
+	Discrepancy bool         `json:"discrepancy"`
+}
+
+// RewardDryRunDTO ExpectedTotal и ActualTotal считаются по завершённым заявкам, чтобы их можно было сравнить.
+// В Leads попадают только заявки без правила или с расхождением.
+type RewardDryRunDTO struct {
+	Checked       int                   `json:"checked"`
+	MissingRule   int                   `json:"missing_rule"`
+	Completed     int                   `json:"completed"`
+	Discrepancies int                   `json:"discrepancies"`
+	ExpectedTotal money.Money           `json:"expected_total"`
+	ActualTotal   money.Money           `json:"actual_total"`
+	Leads         []RewardDryRunLeadDTO `json:"leads"`
+	Truncated     bool                  `json:"truncated"`
+}
+
+// RewardDiscrepancyDTO заявка, по которой сумма из битрикса не совпала с ожидаемой
+type RewardDiscrepancyDTO struct {
+	LeadID                 int64        `json:"lead_id"`
+	BitrixID               *int64       `json:"bitrix_id"`
+	UserID                 int64        `json:"user_id"`
+	StatusID               int64        `json:"status_id"`
+	ExpectedRewardInternet *money.Money `json:"expected_reward_internet"`
+	ExpectedRewardCleaning *money.Money `json:"expected_reward_cleaning"`
+	ExpectedRewardShipping *money.Money `json:"expected_reward_shipping"`
+	RewardInternet         money.Money  `json:"reward_internet"`
+	RewardCleaning         money.Money  `json:"reward_cleaning"`
+	RewardShipping         money.Money  `json:"reward_shipping"`
+	CreatedAt              *time.Time   `json:"created_at"`
+}
+
+type RewardDiscrepancyPageDTO struct {
+	Leads  []RewardDiscrepancyDTO `json:"leads"`
+	Total  int64                  `json:"total"`
+	Limit  int64                  `json:"limit"`
+	Offset int64                  `json:"offset"`
+}
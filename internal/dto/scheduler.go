@@ -0,0 +1,18 @@
+package dto
+
+import "time"
+
+type SchedulerJobDTO struct {
+	Name           string     `json:"name"`
+	Spec           string     `json:"spec"`
+	Running        bool       `json:"running"`
+	NextRunAt      *time.Time `json:"next_run_at"`
+	LastStartedAt  *time.Time `json:"last_started_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at"`
+	LastDurationMs *int64     `json:"last_duration_ms"`
+	LastError      *string    `json:"last_error"`
+}
+
+type RunJobDTO struct {
+	Name string `json:"name" validate:"required"`
+}
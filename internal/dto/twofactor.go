@@ -0,0 +1,45 @@
+package dto
+
+// LoginResultDTO результат входа по паролю: либо токены, либо запрос второго фактора
+type LoginResultDTO struct {
+	Tokens    *AuthTokensDTO
+	Challenge *TwoFactorChallengeDTO
+}
+
+// TwoFactorChallengeDTO выдаётся после верного пароля. Токены выдаются после проверки кода.
+// Если EnrollmentRequired, роль пользователя требует 2FA, а он её ещё не подключил.
+type TwoFactorChallengeDTO struct {
+	ChallengeToken     string `json:"challenge_token"`
+	ExpiresIn          int64  `json:"expires_in"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+type TwoFactorChallengeTokenDTO struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+// TwoFactorVerifyDTO код из приложения или код восстановления
+type TwoFactorVerifyDTO struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type TwoFactorCodeDTO struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TOTPEnrollmentDTO struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TwoFactorStatusDTO struct {
+	Enabled  bool `json:"enabled"`
+	Required bool `json:"required"`
+}
+
+// TwoFactorEnabledDTO коды восстановления показываются один раз. Tokens заполнены, если 2FA подключали при входе.
+type TwoFactorEnabledDTO struct {
+	RecoveryCodes []string       `json:"recovery_codes"`
+	Tokens        *AuthTokensDTO `json:"tokens,omitempty"`
+}
@@ -4,6 +4,12 @@ package context_keys
 type contextKey string
 
 const (
-	UserIDKey   contextKey = "userID"
-	UserRoleKey contextKey = "userRole"
+	UserIDKey    contextKey = "userID"
+	UserRoleKey  contextKey = "userRole"
+	SessionIDKey contextKey = "sessionID"
+	ClientIPKey  contextKey = "clientIP"
+	UserAgentKey contextKey = "userAgent"
+	RequestIDKey contextKey = "requestID"
+	// APIKeyScopesKey есть в контексте, только если запрос авторизован API-ключом
+	APIKeyScopesKey contextKey = "apiKeyScopes"
 )
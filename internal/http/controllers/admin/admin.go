@@ -0,0 +1,467 @@
+// Package admin. Управление пользователями для менеджеров и админов.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/admin"
+	"ia-online-golang/internal/services/user"
+	"ia-online-golang/internal/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type AdminController struct {
+	log          *logrus.Logger
+	validator    *validator.Validate
+	AdminService admin.AdminServiceI
+}
+
+type AdminControllerI interface {
+	Users(w http.ResponseWriter, r *http.Request)
+	User(w http.ResponseWriter, r *http.Request)
+	UpdateRoles(w http.ResponseWriter, r *http.Request)
+	UpdateTier(w http.ResponseWriter, r *http.Request)
+	Activate(w http.ResponseWriter, r *http.Request)
+	Deactivate(w http.ResponseWriter, r *http.Request)
+	Ban(w http.ResponseWriter, r *http.Request)
+	Unban(w http.ResponseWriter, r *http.Request)
+	ResendActivation(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	DeleteUser(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, adminService admin.AdminServiceI) *AdminController {
+	return &AdminController{
+		log:          log,
+		validator:    validator,
+		AdminService: adminService,
+	}
+}
+
+// Users GET /api/v1/admin/users?city=&role=&is_active=&is_banned=&created_from=&created_to=&search=&limit=&offset=
+func (a *AdminController) Users(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.Users"
+
+	a.log.Debugf("%s: start", op)
+
+	filter, err := parseUserFilters(r)
+	if err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, err.Error())
+		return
+	}
+
+	page, err := a.AdminService.Users(r.Context(), filter)
+	if err != nil {
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	a.log.Debugf("%s: users send", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// User GET /api/v1/admin/users/{id}
+func (a *AdminController) User(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.User"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	userDTO, err := a.AdminService.User(r.Context(), userID)
+	if err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userDTO)
+}
+
+// UpdateRoles PUT /api/v1/admin/users/{id}/roles
+func (a *AdminController) UpdateRoles(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.UpdateRoles"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	var dto dto.UpdateRolesDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	if err := a.AdminService.UpdateRoles(r.Context(), userID, dto.Roles); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Infof("%s: roles of user %d changed to %v", op, userID, dto.Roles)
+
+	responses.Ok(w)
+}
+
+// UpdateTier PUT /api/v1/admin/users/{id}/tier
+func (a *AdminController) UpdateTier(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.UpdateTier"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	var dto dto.UpdateTierDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	if err := a.AdminService.UpdateTier(r.Context(), userID, dto.Tier); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Infof("%s: tier of user %d changed to %s", op, userID, dto.Tier)
+
+	responses.Ok(w)
+}
+
+// Activate POST /api/v1/admin/users/{id}/activate
+func (a *AdminController) Activate(w http.ResponseWriter, r *http.Request) {
+	a.setActive(w, r, "AdminController.Activate", true)
+}
+
+// Deactivate POST /api/v1/admin/users/{id}/deactivate
+func (a *AdminController) Deactivate(w http.ResponseWriter, r *http.Request) {
+	a.setActive(w, r, "AdminController.Deactivate", false)
+}
+
+func (a *AdminController) setActive(w http.ResponseWriter, r *http.Request, op string, isActive bool) {
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.AdminService.SetActive(r.Context(), userID, isActive); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Infof("%s: user %d is_active=%t", op, userID, isActive)
+
+	responses.Ok(w)
+}
+
+// Ban POST /api/v1/admin/users/{id}/ban
+func (a *AdminController) Ban(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.Ban"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	// Причина необязательна, поэтому пустое тело допустимо
+	var dto dto.BanUserDTO
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+			a.log.Infof("%s: %v", op, err)
+
+			responses.InvalidRequest(w)
+			return
+		}
+	}
+
+	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	if err := a.AdminService.Ban(r.Context(), userID, dto.Reason); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Infof("%s: user %d banned", op, userID)
+
+	responses.Ok(w)
+}
+
+// Unban POST /api/v1/admin/users/{id}/unban
+func (a *AdminController) Unban(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.Unban"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.AdminService.Unban(r.Context(), userID); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Infof("%s: user %d unbanned", op, userID)
+
+	responses.Ok(w)
+}
+
+// ResendActivation POST /api/v1/admin/users/{id}/activation
+func (a *AdminController) ResendActivation(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.ResendActivation"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.AdminService.ResendActivation(r.Context(), userID); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Debugf("%s: activation link sent", op)
+
+	responses.Ok(w)
+}
+
+// Logout POST /api/v1/admin/users/{id}/logout
+func (a *AdminController) Logout(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.Logout"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.AdminService.Logout(r.Context(), userID); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Infof("%s: sessions of user %d revoked", op, userID)
+
+	responses.Ok(w)
+}
+
+// DeleteUser DELETE /api/v1/admin/users/{id}
+func (a *AdminController) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	const op = "AdminController.DeleteUser"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.AdminService.DeleteUser(r.Context(), userID); err != nil {
+		a.handleError(w, op, err)
+		return
+	}
+
+	a.log.Infof("%s: user %d deleted", op, userID)
+
+	responses.Ok(w)
+}
+
+// handleError отвечает на ошибки, общие для всех действий с пользователем
+func (a *AdminController) handleError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		a.log.Infof("%s: user not found", op)
+		responses.UserNotFound(w)
+	case errors.Is(err, admin.ErrNotEnoughRights):
+		a.log.Infof("%s: not enough rights", op)
+		responses.Forbidden(w)
+	case errors.Is(err, admin.ErrSelfAction):
+		a.log.Infof("%s: action on own account", op)
+		responses.SelfAction(w)
+	case errors.Is(err, admin.ErrUserAlreadyActive):
+		a.log.Infof("%s: user already active", op)
+		responses.UserAlreadyActive(w)
+	case errors.Is(err, admin.ErrUserAlreadyBanned):
+		a.log.Infof("%s: user already banned", op)
+		responses.UserAlreadyBanned(w)
+	case errors.Is(err, admin.ErrUserIsNotBanned):
+		a.log.Infof("%s: user is not banned", op)
+		responses.UserIsNotBanned(w)
+	case errors.Is(err, admin.ErrUserHasRelations):
+		a.log.Infof("%s: user has related data", op)
+		responses.UserHasRelations(w)
+	default:
+		a.log.Errorf("%s: %v", op, err)
+		responses.ServerError(w)
+	}
+}
+
+func parseUserFilters(r *http.Request) (dto.UserFilterDTO, error) {
+	query := r.URL.Query()
+
+	parseBool := func(key string) (*bool, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+			return &parsed, nil
+		}
+		return nil, nil
+	}
+
+	parseDate := func(key string) (*time.Time, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := time.Parse(time.DateOnly, val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+			return &parsed, nil
+		}
+		return nil, nil
+	}
+
+	parseString := func(key string) *string {
+		if val := query.Get(key); val != "" {
+			return &val
+		}
+		return nil
+	}
+
+	parseInt := func(key string) (int64, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || parsed < 0 {
+				return 0, fmt.Errorf("invalid %s", key)
+			}
+			return parsed, nil
+		}
+		return 0, nil
+	}
+
+	role := parseString("role")
+	if role != nil && !utils.Contains([]string{"user", "manager", "admin"}, *role) {
+		return dto.UserFilterDTO{}, fmt.Errorf("invalid role")
+	}
+
+	isActive, err := parseBool("is_active")
+	if err != nil {
+		return dto.UserFilterDTO{}, err
+	}
+
+	isBanned, err := parseBool("is_banned")
+	if err != nil {
+		return dto.UserFilterDTO{}, err
+	}
+
+	createdFrom, err := parseDate("created_from")
+	if err != nil {
+		return dto.UserFilterDTO{}, err
+	}
+
+	createdTo, err := parseDate("created_to")
+	if err != nil {
+		return dto.UserFilterDTO{}, err
+	}
+
+	limit, err := parseInt("limit")
+	if err != nil {
+		return dto.UserFilterDTO{}, err
+	}
+
+	offset, err := parseInt("offset")
+	if err != nil {
+		return dto.UserFilterDTO{}, err
+	}
+
+	return dto.UserFilterDTO{
+		City:        parseString("city"),
+		Role:        role,
+		IsActive:    isActive,
+		IsBanned:    isBanned,
+		CreatedFrom: createdFrom,
+		CreatedTo:   createdTo,
+		Search:      parseString("search"),
+		Limit:       limit,
+		Offset:      offset,
+	}, nil
+}
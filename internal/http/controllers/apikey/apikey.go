@@ -0,0 +1,148 @@
+// Package apikey. Управление API-ключами текущего пользователя.
+package apikey
+
+import (
+	"encoding/json"
+	"errors"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/apikey"
+	"ia-online-golang/internal/utils"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type APIKeyController struct {
+	log           *logrus.Logger
+	validator     *validator.Validate
+	APIKeyService apikey.APIKeyServiceI
+}
+
+type APIKeyControllerI interface {
+	APIKeys(w http.ResponseWriter, r *http.Request)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	DeleteAPIKey(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, apiKeyService apikey.APIKeyServiceI) *APIKeyController {
+	return &APIKeyController{
+		log:           log,
+		validator:     validator,
+		APIKeyService: apiKeyService,
+	}
+}
+
+// Функция для получения API-ключей текущего пользователя.
+func (a *APIKeyController) APIKeys(w http.ResponseWriter, r *http.Request) {
+	const op = "APIKeyController.APIKeys"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		a.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	keys, err := a.APIKeyService.APIKeys(r.Context(), userID)
+	if err != nil {
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	a.log.Debugf("%s: api keys received", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// Функция для создания API-ключа. Ключ показывается только в этом ответе.
+func (a *APIKeyController) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	const op = "APIKeyController.CreateAPIKey"
+
+	a.log.Debugf("%s: start", op)
+
+	var dto dto.CreateAPIKeyDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		a.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	key, err := a.APIKeyService.CreateAPIKey(r.Context(), userID, dto)
+	if err != nil {
+		if errors.Is(err, apikey.ErrAPIKeyExpiresInPast) {
+			a.log.Infof("%s: expiration in the past", op)
+
+			responses.APIKeyExpiresInPast(w)
+			return
+		}
+
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	a.log.Debugf("%s: api key created", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// Функция для отзыва API-ключа.
+func (a *APIKeyController) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	const op = "APIKeyController.DeleteAPIKey"
+
+	a.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		a.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	err := a.APIKeyService.RevokeAPIKey(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, apikey.ErrAPIKeyNotFound) {
+			a.log.Infof("%s: api key not found", op)
+
+			responses.APIKeyNotFound(w)
+			return
+		}
+
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	a.log.Debugf("%s: api key revoked", op)
+
+	responses.Ok(w)
+}
@@ -0,0 +1,161 @@
+// Package audit. Просмотр и выгрузка журнала действий для админов.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/audit"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type AuditController struct {
+	log          *logrus.Logger
+	AuditService audit.AuditServiceI
+}
+
+type AuditControllerI interface {
+	Events(w http.ResponseWriter, r *http.Request)
+	Export(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, auditService audit.AuditServiceI) *AuditController {
+	return &AuditController{
+		log:          log,
+		AuditService: auditService,
+	}
+}
+
+// Events GET /api/v1/admin/audit?actor_id=&action=&target_type=&target_id=&request_id=&from=&to=&limit=&offset=
+func (a *AuditController) Events(w http.ResponseWriter, r *http.Request) {
+	const op = "AuditController.Events"
+
+	a.log.Debugf("%s: start", op)
+
+	filter, err := parseAuditFilters(r)
+	if err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, err.Error())
+		return
+	}
+
+	page, err := a.AuditService.Events(r.Context(), filter)
+	if err != nil {
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	a.log.Debugf("%s: events send", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// Export GET /api/v1/admin/audit/export с теми же фильтрами, отдаёт CSV без пагинации
+func (a *AuditController) Export(w http.ResponseWriter, r *http.Request) {
+	const op = "AuditController.Export"
+
+	a.log.Debugf("%s: start", op)
+
+	filter, err := parseAuditFilters(r)
+	if err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.csv", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Выгрузка пишется в ответ по мере чтения, поэтому после начала ответа ошибку можно только залогировать
+	if err := a.AuditService.ExportCSV(r.Context(), filter, w); err != nil {
+		a.log.Errorf("%s: %v", op, err)
+		return
+	}
+
+	a.log.Debugf("%s: events exported", op)
+}
+
+func parseAuditFilters(r *http.Request) (dto.AuditFilterDTO, error) {
+	query := r.URL.Query()
+
+	parseDate := func(key string) (*time.Time, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := time.Parse(time.DateOnly, val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+			return &parsed, nil
+		}
+		return nil, nil
+	}
+
+	parseString := func(key string) *string {
+		if val := query.Get(key); val != "" {
+			return &val
+		}
+		return nil
+	}
+
+	parseInt := func(key string) (int64, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || parsed < 0 {
+				return 0, fmt.Errorf("invalid %s", key)
+			}
+			return parsed, nil
+		}
+		return 0, nil
+	}
+
+	var actorID *int64
+	if query.Get("actor_id") != "" {
+		parsed, err := parseInt("actor_id")
+		if err != nil {
+			return dto.AuditFilterDTO{}, err
+		}
+		actorID = &parsed
+	}
+
+	from, err := parseDate("from")
+	if err != nil {
+		return dto.AuditFilterDTO{}, err
+	}
+
+	to, err := parseDate("to")
+	if err != nil {
+		return dto.AuditFilterDTO{}, err
+	}
+
+	limit, err := parseInt("limit")
+	if err != nil {
+		return dto.AuditFilterDTO{}, err
+	}
+
+	offset, err := parseInt("offset")
+	if err != nil {
+		return dto.AuditFilterDTO{}, err
+	}
+
+	return dto.AuditFilterDTO{
+		ActorID:    actorID,
+		Action:     parseString("action"),
+		TargetType: parseString("target_type"),
+		TargetID:   parseString("target_id"),
+		RequestID:  parseString("request_id"),
+		From:       from,
+		To:         to,
+		Limit:      limit,
+		Offset:     offset,
+	}, nil
+}
@@ -13,7 +13,9 @@ import (
 
 	"ia-online-golang/internal/services/auth"
 	"ia-online-golang/internal/services/passwordcode"
+	"ia-online-golang/internal/services/ratelimit"
 	"ia-online-golang/internal/services/token"
+	"ia-online-golang/internal/services/twofactor"
 	"ia-online-golang/internal/services/user"
 
 	"github.com/go-playground/validator/v10"
@@ -29,12 +31,17 @@ type AuthController struct {
 type AuthControllerI interface {
 	Registration(w http.ResponseWriter, r *http.Request)
 	Login(w http.ResponseWriter, r *http.Request)
+	VerifyTwoFactor(w http.ResponseWriter, r *http.Request)
+	EnrollTwoFactor(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactor(w http.ResponseWriter, r *http.Request)
 	Activation(w http.ResponseWriter, r *http.Request)
 	Refresh(w http.ResponseWriter, r *http.Request)
 	Logout(w http.ResponseWriter, r *http.Request)
+	Sessions(w http.ResponseWriter, r *http.Request)
+	DeleteSession(w http.ResponseWriter, r *http.Request)
 	NewPassword(w http.ResponseWriter, r *http.Request)
-	// SendPasswordCode(w http.ResponseWriter, r *http.Request)
-	// RecoverPassword(w http.ResponseWriter, r *http.Request)
+	SendPasswordCode(w http.ResponseWriter, r *http.Request)
+	RecoverPassword(w http.ResponseWriter, r *http.Request)
 }
 
 // New создаёт новый экземпляр AuthController
@@ -52,16 +59,6 @@ func (a *AuthController) Registration(w http.ResponseWriter, r *http.Request) {
 
 	a.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPost {
-		a.log.Infof("%s: method not allowed", op)
-
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	a.log.Debugf("%s: method is correct", op)
-
 	var dto dto.RegisterUserDTO
 	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
 		a.log.Infof("%s: %v", op, err)
@@ -130,18 +127,8 @@ func (a *AuthController) Activation(w http.ResponseWriter, r *http.Request) {
 
 	a.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodGet {
-		a.log.Infof("%s: method not allowed", op)
-
-		w.Header().Set("Allow", http.MethodGet)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	a.log.Debugf("%s: method is correct", op)
-
 	w.Header().Set("Content-Type", "application/json")
-	activation_id := r.URL.Path[len("/api/v1/auth/activation/"):]
+	activation_id := r.PathValue("id")
 
 	a.log.Debugf("%s: activation id received", op)
 
@@ -177,17 +164,6 @@ func (a *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 
 	a.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-
-		a.log.Infof("%s: method not allowed", op)
-
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	a.log.Debugf("%s: method is correct", op)
-
 	var dto dto.LoginUserDTO
 	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
 		a.log.Infof("%s: %v", op, err)
@@ -206,8 +182,15 @@ func (a *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 
 	a.log.Debugf("%s: validation completed", op)
 
-	tokens, err := a.AuthService.LoginUser(r.Context(), dto)
+	result, err := a.AuthService.LoginUser(r.Context(), dto)
 	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			a.log.Infof("%s: account temporarily locked", op)
+			responses.TooManyRequests(w, limitErr.RetryAfter)
+			return
+		}
+
 		if errors.Is(err, user.ErrUserNotFound) {
 			a.log.Infof("%s: user not found", op)
 			responses.UserNotFound(w)
@@ -226,41 +209,225 @@ func (a *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if errors.Is(err, user.ErrUserBanned) {
+			a.log.Infof("%s: user banned", op)
+			responses.UserBanned(w)
+			return
+		}
+
 		a.log.Errorf("%s: server error: %v", op, err)
 		responses.ServerError(w)
 		return
 	}
 
-	a.log.Debugf("%s: token created", op)
+	// Пароль верный, но нужен второй фактор: токены выдаст /api/v1/auth/2fa/verify
+	if result.Challenge != nil {
+		a.log.Infof("%s: two-factor challenge send", op)
 
-	// Создаем cookie с токеном
-	cookie := &http.Cookie{
-		Name:     "refresh_token",
-		Value:    tokens.RefreshToken,
-		HttpOnly: true,
-		Secure:   true,
-		Path:     "/",
-		MaxAge:   3600 * 24 * 30, // 30 дней
-		SameSite: http.SameSiteStrictMode,
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result.Challenge)
+		return
 	}
 
-	http.SetCookie(w, cookie)
+	a.log.Debugf("%s: token created", op)
+
+	setRefreshCookie(w, result.Tokens.RefreshToken)
 
 	a.log.Debugf("%s: refresh token add from cookie", op)
 
+	w.Header().Set("Content-Type", "application/json")
+	a.log.Infof("%s: tokens send", op)
+	json.NewEncoder(w).Encode(result.Tokens)
+}
+
+// Функция для второго шага входа: код из приложения или код восстановления.
+func (a *AuthController) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	const op = "AuthController.VerifyTwoFactor"
+
+	a.log.Debugf("%s: start", op)
+
+	var dto dto.TwoFactorVerifyDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	tokens, err := a.AuthService.VerifyTwoFactor(r.Context(), dto)
+	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			a.log.Infof("%s: two-factor temporarily locked", op)
+
+			responses.TooManyRequests(w, limitErr.RetryAfter)
+			return
+		}
+
+		if errors.Is(err, token.ErrInvalidChallengeToken) {
+			a.log.Infof("%s: invalid challenge token", op)
+
+			responses.InvalidChallengeToken(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorCodeIncorrect) {
+			a.log.Infof("%s: two-factor code incorrect", op)
+
+			responses.TwoFactorCodeIncorrect(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorNotEnabled) {
+			a.log.Infof("%s: two-factor not enabled", op)
+
+			responses.TwoFactorNotEnabled(w)
+			return
+		}
+
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	setRefreshCookie(w, tokens.RefreshToken)
+
 	w.Header().Set("Content-Type", "application/json")
 	a.log.Infof("%s: tokens send", op)
 	json.NewEncoder(w).Encode(tokens)
 }
 
-// Функция для логаута.
-func (a *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
+// Функция для подключения 2FA при входе, когда роль требует второй фактор. Возвращает секрет и otpauth-ссылку для QR-кода.
+func (a *AuthController) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	const op = "AuthController.EnrollTwoFactor"
+
+	a.log.Debugf("%s: start", op)
+
+	var dto dto.TwoFactorChallengeTokenDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	enrollment, err := a.AuthService.EnrollTwoFactor(r.Context(), dto.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidChallengeToken) {
+			a.log.Infof("%s: invalid challenge token", op)
+
+			responses.InvalidChallengeToken(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorAlreadyEnabled) {
+			a.log.Infof("%s: two-factor already enabled", op)
+
+			responses.TwoFactorAlreadyEnabled(w)
+			return
+		}
+
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	a.log.Debugf("%s: secret generated", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// Функция для подтверждения 2FA при входе. Возвращает коды восстановления и токены.
+func (a *AuthController) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	const op = "AuthController.ConfirmTwoFactor"
+
+	a.log.Debugf("%s: start", op)
+
+	var dto dto.TwoFactorVerifyDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	enabled, err := a.AuthService.ConfirmTwoFactor(r.Context(), dto)
+	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			a.log.Infof("%s: two-factor temporarily locked", op)
+
+			responses.TooManyRequests(w, limitErr.RetryAfter)
+			return
+		}
+
+		if errors.Is(err, token.ErrInvalidChallengeToken) {
+			a.log.Infof("%s: invalid challenge token", op)
+
+			responses.InvalidChallengeToken(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorCodeIncorrect) {
+			a.log.Infof("%s: two-factor code incorrect", op)
+
+			responses.TwoFactorCodeIncorrect(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorNotEnrolled) {
+			a.log.Infof("%s: two-factor enrollment not started", op)
+
+			responses.TwoFactorNotEnrolled(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorAlreadyEnabled) {
+			a.log.Infof("%s: two-factor already enabled", op)
+
+			responses.TwoFactorAlreadyEnabled(w)
+			return
+		}
+
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
 		return
 	}
 
+	setRefreshCookie(w, enabled.Tokens.RefreshToken)
+
+	w.Header().Set("Content-Type", "application/json")
+	a.log.Infof("%s: two-factor enabled, tokens send", op)
+	json.NewEncoder(w).Encode(enabled)
+}
+
+// Функция для логаута.
+func (a *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := r.Cookie("refresh_token")
 	if err != nil {
 		responses.RefreshTokenNotFound(w)
@@ -268,7 +435,9 @@ func (a *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = a.AuthService.LogoutUser(r.Context(), refreshToken.Value)
-	if err != nil {
+	if err != nil && !errors.Is(err, token.ErrInvalidRefreshToken) {
+		a.log.Errorf("Controller.Logout: %v", err)
+
 		responses.ServerError(w)
 		return
 	}
@@ -294,14 +463,6 @@ func (a *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	a.log.Debugf("%s: %v", op, r.RemoteAddr)
 
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", http.MethodGet)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	a.log.Debugf("%s: method is correct", op)
-
 	refreshToken, err := r.Cookie("refresh_token")
 	if err != nil {
 		a.log.Infof("%s: refresh token not found", op)
@@ -321,11 +482,17 @@ func (a *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if errors.Is(err, token.ErrRefreshTokenNotExists) {
-			a.log.Infof("%s: user not activated", op)
+			a.log.Infof("%s: session not found or revoked", op)
 			responses.RefreshTokenNotFound(w)
 			return
 		}
 
+		if errors.Is(err, token.ErrRefreshTokenReused) {
+			a.log.Warnf("%s: refresh token reused from %s", op, r.RemoteAddr)
+			responses.RefreshTokenReused(w)
+			return
+		}
+
 		a.log.Errorf("%s: %v", op, err)
 		responses.ServerError(w)
 		return
@@ -350,21 +517,57 @@ func (a *AuthController) Refresh(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tokens)
 }
 
-// Функция для изменения пароля.
-func (a *AuthController) NewPassword(w http.ResponseWriter, r *http.Request) {
-	op := "AuthController.NewPassword"
+// Функция для получения активных сессий пользователя.
+func (a *AuthController) Sessions(w http.ResponseWriter, r *http.Request) {
+	const op = "AuthController.Sessions"
+
+	a.log.Debugf("%s: start", op)
+
+	sessions, err := a.AuthService.Sessions(r.Context())
+	if err != nil {
+		a.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	a.log.Debugf("%s: sessions received", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// Функция для завершения сессии на другом устройстве.
+func (a *AuthController) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	const op = "AuthController.DeleteSession"
 
 	a.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPost {
-		a.log.Infof("%s: method not allowed. method: %s", op, r.Method)
+	err := a.AuthService.RevokeSession(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, token.ErrSessionNotFound) {
+			a.log.Infof("%s: session not found", op)
+
+			responses.SessionNotFound(w)
+			return
+		}
+
+		a.log.Errorf("%s: %v", op, err)
 
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
+		responses.ServerError(w)
 		return
 	}
 
-	a.log.Debugf("%s: method is correct", op)
+	a.log.Debugf("%s: session revoked", op)
+
+	responses.Ok(w)
+}
+
+// Функция для изменения пароля.
+func (a *AuthController) NewPassword(w http.ResponseWriter, r *http.Request) {
+	op := "AuthController.NewPassword"
+
+	a.log.Debugf("%s: start", op)
 
 	var dto dto.NewPasswordDTO
 	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
@@ -397,6 +600,13 @@ func (a *AuthController) NewPassword(w http.ResponseWriter, r *http.Request) {
 
 	err := a.AuthService.ChangingPassword(r.Context(), dto, userID)
 	if err != nil {
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			a.log.Infof("%s: account temporarily locked", op)
+
+			responses.TooManyRequests(w, limitErr.RetryAfter)
+			return
+		}
 		if errors.Is(err, auth.ErrIncorrectOldPassword) {
 			a.log.Infof("%s: old password incorrect", op)
 
@@ -414,21 +624,13 @@ func (a *AuthController) NewPassword(w http.ResponseWriter, r *http.Request) {
 	responses.Ok(w)
 }
 
-// Функция для восстановления пароля. Отправляем новый пароль на почту, который сгенерирует система.
-func (a *AuthController) SendNewPassword(w http.ResponseWriter, r *http.Request) {
-	const op = "AuthController.SendNewPassword"
-
-	a.log.Debugf("%s: %v", op, r.RemoteAddr)
-
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
+// Функция для запроса кода восстановления пароля. Код приходит на почту.
+func (a *AuthController) SendPasswordCode(w http.ResponseWriter, r *http.Request) {
+	const op = "AuthController.SendPasswordCode"
 
-	a.log.Debugf("%s: method is correct", op)
+	a.log.Debugf("%s: start", op)
 
-	var dto dto.SendNewPasswordDTO
+	var dto dto.SendPasswordCodeDTO
 	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
 		a.log.Infof("%s: %v", op, err)
 
@@ -447,85 +649,84 @@ func (a *AuthController) SendNewPassword(w http.ResponseWriter, r *http.Request)
 
 	err := a.AuthService.RecoverPassword(r.Context(), dto.Email)
 	if err != nil {
-		if errors.Is(err, user.ErrUserNotFound) {
-			responses.UserNotFound(w)
-			return
-		}
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			a.log.Infof("%s: recover limit exceeded", op)
 
-		responses.ServerError(w)
-		return
-	}
-
-	responses.Ok(w)
-}
-
-// Нереализованная функция для отправки кода восстановления пароля. Хотелось реализовать изменение пароля через код на почту. Оставил на будущее.
-func (a *AuthController) SendPasswordCode(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	var dto dto.SendPasswordCodeDTO
-	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
-		responses.InvalidRequest(w)
-		return
-	}
-
-	if err := a.validator.Struct(dto); err != nil {
-		responses.ValidationError(w, utils.FormatValidationErrors(err))
-		return
-	}
-
-	err := a.AuthService.RecoverPassword(r.Context(), dto.Email)
-	if err != nil {
-		if errors.Is(err, user.ErrUserNotFound) {
-			responses.UserNotFound(w)
+			responses.TooManyRequests(w, limitErr.RetryAfter)
 			return
 		}
 
+		a.log.Errorf("%s: %v", op, err)
+
 		responses.ServerError(w)
 		return
 	}
 
+	a.log.Debugf("%s: password recovery accepted", op)
+
 	responses.Ok(w)
 }
 
-// Нереализованная функция для получения кода восстановления пароля и нового пароля. Хотелось реализовать изменение пароля через код на почту. Оставил на будущее.
+// Функция для смены пароля по коду из письма. После смены все сессии пользователя завершаются.
 func (a *AuthController) RecoverPassword(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
+	const op = "AuthController.RecoverPassword"
+
+	a.log.Debugf("%s: start", op)
 
 	var dto dto.RecoverPasswordDTO
 	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
 		responses.InvalidRequest(w)
 		return
 	}
 
 	if err := a.validator.Struct(dto); err != nil {
+		a.log.Infof("%s: %v", op, err)
+
 		responses.ValidationError(w, utils.FormatValidationErrors(err))
 		return
 	}
 
+	a.log.Debugf("%s: validation completed", op)
+
 	err := a.AuthService.NewPassword(r.Context(), dto)
 	if err != nil {
-		if errors.Is(err, passwordcode.ErrPasswordCodeIsNotFound) || errors.Is(err, passwordcode.ErrPasswordCodeIncorrect) {
+		if errors.Is(err, passwordcode.ErrPasswordCodeIncorrect) {
+			a.log.Infof("%s: password code incorrect", op)
+
 			responses.PasswordCodeIncorrect(w)
 			return
 		}
 
 		if errors.Is(err, passwordcode.ErrPasswordCodeHasExpired) {
+			a.log.Infof("%s: password code has expired", op)
+
 			responses.PasswordCodeHasExpired(w)
 			return
 		}
 
+		a.log.Errorf("%s: %v", op, err)
+
 		responses.ServerError(w)
 		return
 	}
 
+	a.log.Debugf("%s: password changed", op)
+
 	responses.Ok(w)
 }
+
+// setRefreshCookie кладёт refresh-токен в cookie, как при обычном входе
+func setRefreshCookie(w http.ResponseWriter, refreshToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		HttpOnly: true,
+		Secure:   true,
+		Path:     "/",
+		MaxAge:   3600 * 24 * 30, // 30 дней
+		SameSite: http.SameSiteStrictMode,
+	})
+}
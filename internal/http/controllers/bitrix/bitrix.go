@@ -43,14 +43,6 @@ func (c *BitrixController) СhangingDeal(w http.ResponseWriter, r *http.Request)
 
 	c.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPost {
-		c.log.Infof("%s: method not allowed. method: %s", op, r.Method)
-
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
 	err := r.ParseForm()
 	if err != nil {
 		c.log.Errorf("%s: %v", op, err)
@@ -93,6 +85,19 @@ func (c *BitrixController) СhangingDeal(w http.ResponseWriter, r *http.Request)
 
 	err = c.LeadService.EditDeal(r.Context(), hook.DocumentID)
 	if err != nil {
+		if errors.Is(err, lead.ErrLeadNotFound) {
+			c.log.Infof("%s: %v", op, err)
+
+			responses.LeadNotFound(w)
+			return
+		}
+		// Сумма уже залогирована с сырым значением, сделку нужно исправить в битриксе
+		if errors.Is(err, lead.ErrInvalidDealAmount) {
+			c.log.Errorf("%s: %v", op, err)
+
+			responses.ValidationError(w, "invalid amount in deal")
+			return
+		}
 		c.log.Errorf("%s: %v", op, err)
 
 		responses.ServerError(w)
@@ -110,14 +115,6 @@ func (c *BitrixController) NewComment(w http.ResponseWriter, r *http.Request) {
 
 	c.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPost {
-		c.log.Infof("%s: method not allowed. method: %s", op, r.Method)
-
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
 	err := r.ParseForm()
 	if err != nil {
 		c.log.Errorf("%s: error parsing form: %v", op, err)
@@ -158,7 +155,7 @@ func (c *BitrixController) NewComment(w http.ResponseWriter, r *http.Request) {
 
 	err = c.CommentService.SaveCommentFromBitrix(r.Context(), hook.Data.Fields.ID)
 	if err != nil {
-		if errors.Is(err, comment.ErrCommentDoesNotBelongToTheFunnel) {
+		if errors.Is(err, comment.ErrCommentDoesNotBelongToTheFunnel) || errors.Is(err, comment.ErrLeadNotFound) {
 			c.log.Infof("%s: %v", op, err)
 
 			responses.Forbidden(w)
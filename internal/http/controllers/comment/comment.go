@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"ia-online-golang/internal/dto"
 	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/bitrix"
 	CommentService "ia-online-golang/internal/services/comment"
 	"ia-online-golang/internal/utils"
 	"net/http"
@@ -37,16 +38,6 @@ func (c *CommentController) SaveComment(w http.ResponseWriter, r *http.Request)
 
 	c.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPost {
-		c.log.Infof("%s: method not allowed. method: %s", op, r.Method)
-
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	c.log.Debugf("%s: method id correct", op)
-
 	var comment dto.AddCommentDTO
 	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
 		c.log.Infof("%s: decode error", op)
@@ -74,6 +65,11 @@ func (c *CommentController) SaveComment(w http.ResponseWriter, r *http.Request)
 
 			responses.LeadNotFound(w)
 			return
+		} else if errors.Is(err, bitrix.ErrBitrixUnavailable) || errors.Is(err, bitrix.ErrBitrixRateLimited) {
+			c.log.Warnf("%s: %v", op, err)
+
+			responses.CrmUnavailable(w)
+			return
 		} else if errors.Is(err, CommentService.ErrLeadDoesNotBelongToUser) {
 			c.log.Infof("%s: lead does not belong to user", op)
 
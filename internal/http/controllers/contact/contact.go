@@ -0,0 +1,259 @@
+// Package contact. Смена почты и телефона текущего пользователя с подтверждением.
+package contact
+
+import (
+	"encoding/json"
+	"errors"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/contact"
+	"ia-online-golang/internal/utils"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type ContactController struct {
+	log            *logrus.Logger
+	validator      *validator.Validate
+	ContactService contact.ContactServiceI
+}
+
+type ContactControllerI interface {
+	ChangeEmail(w http.ResponseWriter, r *http.Request)
+	ConfirmEmail(w http.ResponseWriter, r *http.Request)
+	ChangePhone(w http.ResponseWriter, r *http.Request)
+	ConfirmPhone(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, contactService contact.ContactServiceI) *ContactController {
+	return &ContactController{
+		log:            log,
+		validator:      validator,
+		ContactService: contactService,
+	}
+}
+
+// Функция для запроса смены почты. Ссылка подтверждения уходит на новый адрес.
+func (c *ContactController) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	const op = "ContactController.ChangeEmail"
+
+	c.log.Debugf("%s: start", op)
+
+	var emailDTO dto.ChangeEmailDTO
+	if err := json.NewDecoder(r.Body).Decode(&emailDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := c.validator.Struct(emailDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		c.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	err := c.ContactService.RequestEmailChange(r.Context(), userID, emailDTO.Email)
+	if err != nil {
+		if errors.Is(err, contact.ErrContactUnchanged) {
+			c.log.Infof("%s: email unchanged", op)
+
+			responses.ContactUnchanged(w)
+			return
+		}
+
+		if errors.Is(err, contact.ErrEmailAlreadyUsed) {
+			c.log.Infof("%s: email already used", op)
+
+			responses.EmailAlreadyUsed(w)
+			return
+		}
+
+		c.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	c.log.Debugf("%s: confirmation link sent", op)
+
+	responses.Ok(w)
+}
+
+// Функция для подтверждения смены почты по ссылке из письма.
+func (c *ContactController) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	const op = "ContactController.ConfirmEmail"
+
+	c.log.Debugf("%s: start", op)
+
+	err := c.ContactService.ConfirmEmailChange(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, contact.ErrEmailChangeLinkNotFound) {
+			c.log.Infof("%s: email change link not exists", op)
+
+			responses.ActivationLinkNotExists(w)
+			return
+		}
+
+		if errors.Is(err, contact.ErrEmailChangeLinkExpired) {
+			c.log.Infof("%s: email change link expired", op)
+
+			responses.ActivationLinkExpired(w)
+			return
+		}
+
+		if errors.Is(err, contact.ErrEmailAlreadyUsed) {
+			c.log.Infof("%s: email already used", op)
+
+			responses.EmailAlreadyUsed(w)
+			return
+		}
+
+		c.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	c.log.Debugf("%s: email changed", op)
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// Функция для запроса смены телефона. Код уходит в SMS на новый номер.
+func (c *ContactController) ChangePhone(w http.ResponseWriter, r *http.Request) {
+	const op = "ContactController.ChangePhone"
+
+	c.log.Debugf("%s: start", op)
+
+	var phoneDTO dto.ChangePhoneDTO
+	if err := json.NewDecoder(r.Body).Decode(&phoneDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := c.validator.Struct(phoneDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		c.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	err := c.ContactService.RequestPhoneChange(r.Context(), userID, phoneDTO.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, contact.ErrContactUnchanged) {
+			c.log.Infof("%s: phone number unchanged", op)
+
+			responses.ContactUnchanged(w)
+			return
+		}
+
+		if errors.Is(err, contact.ErrPhoneAlreadyUsed) {
+			c.log.Infof("%s: phone number already used", op)
+
+			responses.PhoneAlreadyUsed(w)
+			return
+		}
+
+		c.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	c.log.Debugf("%s: phone code sent", op)
+
+	responses.Ok(w)
+}
+
+// Функция для подтверждения смены телефона кодом из SMS.
+func (c *ContactController) ConfirmPhone(w http.ResponseWriter, r *http.Request) {
+	const op = "ContactController.ConfirmPhone"
+
+	c.log.Debugf("%s: start", op)
+
+	var codeDTO dto.ConfirmPhoneDTO
+	if err := json.NewDecoder(r.Body).Decode(&codeDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := c.validator.Struct(codeDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		c.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	err := c.ContactService.ConfirmPhoneChange(r.Context(), userID, codeDTO.Code)
+	if err != nil {
+		if errors.Is(err, contact.ErrPhoneCodeNotFound) {
+			c.log.Infof("%s: phone change not requested", op)
+
+			responses.PhoneCodeNotFound(w)
+			return
+		}
+
+		if errors.Is(err, contact.ErrPhoneCodeIncorrect) {
+			c.log.Infof("%s: phone code incorrect", op)
+
+			responses.PhoneCodeIncorrect(w)
+			return
+		}
+
+		if errors.Is(err, contact.ErrPhoneCodeExpired) {
+			c.log.Infof("%s: phone code expired", op)
+
+			responses.PhoneCodeExpired(w)
+			return
+		}
+
+		if errors.Is(err, contact.ErrPhoneAlreadyUsed) {
+			c.log.Infof("%s: phone number already used", op)
+
+			responses.PhoneAlreadyUsed(w)
+			return
+		}
+
+		c.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	c.log.Infof("%s: phone number changed for user %d", op, userID)
+
+	responses.Ok(w)
+}
@@ -0,0 +1,55 @@
+package health
+
+import (
+	"encoding/json"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/lib/buildinfo"
+	HealthService "ia-online-golang/internal/services/health"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+type HealthController struct {
+	log           *logrus.Logger
+	HealthService HealthService.HealthServiceI
+}
+
+type HealthControllerI interface {
+	Healthz(w http.ResponseWriter, r *http.Request)
+	Readyz(w http.ResponseWriter, r *http.Request)
+	Version(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, healthService HealthService.HealthServiceI) *HealthController {
+	return &HealthController{
+		log:           log,
+		HealthService: healthService,
+	}
+}
+
+// Healthz процесс жив и отвечает на запросы
+func (h *HealthController) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": dto.HealthStatusOk})
+}
+
+// Readyz сервис может обслуживать запросы: доступны БД, битрикс и SMTP
+func (h *HealthController) Readyz(w http.ResponseWriter, r *http.Request) {
+	const op = "HealthController.Readyz"
+
+	h.log.Debugf("%s: start", op)
+
+	result := h.HealthService.Ready(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status != dto.HealthStatusOk {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *HealthController) Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildinfo.Get())
+}
@@ -0,0 +1,33 @@
+package jwks
+
+import (
+	"encoding/json"
+	TokenService "ia-online-golang/internal/services/token"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+type JWKSController struct {
+	log          *logrus.Logger
+	TokenService TokenService.TokenServiceI
+}
+
+type JWKSControllerI interface {
+	JWKS(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, tokenService TokenService.TokenServiceI) *JWKSController {
+	return &JWKSController{
+		log:          log,
+		TokenService: tokenService,
+	}
+}
+
+// JWKS открытые ключи, которыми другие сервисы проверяют access-токены
+func (j *JWKSController) JWKS(w http.ResponseWriter, r *http.Request) {
+	// Ключи меняются редко, но новый ключ должен разойтись по клиентам до переключения подписи на него
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j.TokenService.JWKS())
+}
@@ -2,6 +2,7 @@ package leads
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"ia-online-golang/internal/dto"
 	"ia-online-golang/internal/http/context_keys"
@@ -25,6 +26,7 @@ type LeadController struct {
 type LeadControllerI interface {
 	SaveLead(w http.ResponseWriter, r *http.Request)
 	Leads(w http.ResponseWriter, r *http.Request)
+	LeadHistory(w http.ResponseWriter, r *http.Request)
 }
 
 func New(log *logrus.Logger, validator *validator.Validate, leadService lead.LeadServiceI) *LeadController {
@@ -40,14 +42,6 @@ func (c *LeadController) SaveLead(w http.ResponseWriter, r *http.Request) {
 
 	c.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	c.log.Debugf("%s: method id correct", op)
-
 	var lead dto.CreateLeadDTO
 	if err := json.NewDecoder(r.Body).Decode(&lead); err != nil {
 		c.log.Infof("%s: decode error", op)
@@ -84,16 +78,6 @@ func (c *LeadController) Leads(w http.ResponseWriter, r *http.Request) {
 
 	c.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodGet {
-		c.log.Infof("%s: method not allowed. method: %s", op, r.Method)
-
-		w.Header().Set("Allow", http.MethodGet)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	c.log.Debugf("%s: method allowed", op)
-
 	// Парсим фильтры
 	filter, err := parseLeadFilters(r)
 	if err != nil {
@@ -140,6 +124,48 @@ func (c *LeadController) Leads(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(leads)
 }
 
+// LeadHistory GET /api/v1/lead/{id}/history
+func (c *LeadController) LeadHistory(w http.ResponseWriter, r *http.Request) {
+	const op = "LeadController.LeadHistory"
+
+	c.log.Debugf("%s: start", op)
+
+	leadID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		c.log.Infof("%s: invalid lead id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	c.log.Debugf("%s: lead id received", op)
+
+	history, err := c.LeadService.LeadHistory(r.Context(), leadID)
+	if err != nil {
+		if errors.Is(err, lead.ErrLeadNotFound) {
+			c.log.Infof("%s: lead not found", op)
+
+			responses.LeadNotFound(w)
+			return
+		} else if errors.Is(err, lead.ErrLeadDoesNotBelongToUser) {
+			c.log.Infof("%s: lead does not belong to user", op)
+
+			responses.Forbidden(w)
+			return
+		} else {
+			c.log.Errorf("%s: %v", op, err)
+
+			responses.ServerError(w)
+			return
+		}
+	}
+
+	c.log.Debugf("%s: history send", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
 func parseLeadFilters(r *http.Request) (dto.LeadFilterDTO, error) {
 	query := r.URL.Query()
 
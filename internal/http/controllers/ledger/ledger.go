@@ -0,0 +1,269 @@
+// Package ledger. Баланс и проводки партнёра, выплаты и корректировки менеджерами.
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/ledger"
+	"ia-online-golang/internal/services/user"
+	"ia-online-golang/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type LedgerController struct {
+	log           *logrus.Logger
+	validator     *validator.Validate
+	LedgerService ledger.LedgerServiceI
+}
+
+type LedgerControllerI interface {
+	MyBalance(w http.ResponseWriter, r *http.Request)
+	MyLedger(w http.ResponseWriter, r *http.Request)
+	UserBalance(w http.ResponseWriter, r *http.Request)
+	UserLedger(w http.ResponseWriter, r *http.Request)
+	Payout(w http.ResponseWriter, r *http.Request)
+	Adjust(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, ledgerService ledger.LedgerServiceI) *LedgerController {
+	return &LedgerController{
+		log:           log,
+		validator:     validator,
+		LedgerService: ledgerService,
+	}
+}
+
+// MyBalance GET /api/v1/me/balance
+func (l *LedgerController) MyBalance(w http.ResponseWriter, r *http.Request) {
+	const op = "LedgerController.MyBalance"
+
+	l.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		l.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	l.balance(w, r, op, userID)
+}
+
+// MyLedger GET /api/v1/me/ledger?limit=&offset=
+func (l *LedgerController) MyLedger(w http.ResponseWriter, r *http.Request) {
+	const op = "LedgerController.MyLedger"
+
+	l.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		l.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	l.ledger(w, r, op, userID)
+}
+
+// UserBalance GET /api/v1/admin/users/{id}/balance
+func (l *LedgerController) UserBalance(w http.ResponseWriter, r *http.Request) {
+	const op = "LedgerController.UserBalance"
+
+	l.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		l.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	l.balance(w, r, op, userID)
+}
+
+// UserLedger GET /api/v1/admin/users/{id}/ledger?limit=&offset=
+func (l *LedgerController) UserLedger(w http.ResponseWriter, r *http.Request) {
+	const op = "LedgerController.UserLedger"
+
+	l.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		l.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	l.ledger(w, r, op, userID)
+}
+
+// Payout POST /api/v1/admin/users/{id}/payouts
+func (l *LedgerController) Payout(w http.ResponseWriter, r *http.Request) {
+	const op = "LedgerController.Payout"
+
+	l.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		l.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	var payoutDTO dto.PayoutDTO
+	if err := json.NewDecoder(r.Body).Decode(&payoutDTO); err != nil {
+		l.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := l.validator.Struct(payoutDTO); err != nil {
+		l.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	if err := l.LedgerService.Payout(r.Context(), userID, payoutDTO); err != nil {
+		l.handleError(w, op, err)
+		return
+	}
+
+	l.log.Infof("%s: payout %s to user %d saved", op, payoutDTO.Amount, userID)
+
+	responses.Ok(w)
+}
+
+// Adjust POST /api/v1/admin/users/{id}/adjustments
+func (l *LedgerController) Adjust(w http.ResponseWriter, r *http.Request) {
+	const op = "LedgerController.Adjust"
+
+	l.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		l.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	var adjustmentDTO dto.AdjustmentDTO
+	if err := json.NewDecoder(r.Body).Decode(&adjustmentDTO); err != nil {
+		l.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := l.validator.Struct(adjustmentDTO); err != nil {
+		l.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	if err := l.LedgerService.Adjust(r.Context(), userID, adjustmentDTO); err != nil {
+		l.handleError(w, op, err)
+		return
+	}
+
+	l.log.Infof("%s: adjustment %s for user %d saved", op, adjustmentDTO.Amount, userID)
+
+	responses.Ok(w)
+}
+
+func (l *LedgerController) balance(w http.ResponseWriter, r *http.Request, op string, userID int64) {
+	balance, err := l.LedgerService.Balance(r.Context(), userID)
+	if err != nil {
+		l.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(balance)
+}
+
+func (l *LedgerController) ledger(w http.ResponseWriter, r *http.Request, op string, userID int64) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		l.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, err.Error())
+		return
+	}
+
+	page, err := l.LedgerService.Ledger(r.Context(), userID, limit, offset)
+	if err != nil {
+		l.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (l *LedgerController) handleError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		l.log.Infof("%s: user not found", op)
+		responses.UserNotFound(w)
+	case errors.Is(err, ledger.ErrSelfOperation):
+		l.log.Infof("%s: operation on own balance", op)
+		responses.SelfAction(w)
+	case errors.Is(err, ledger.ErrInsufficientBalance):
+		l.log.Infof("%s: insufficient balance", op)
+		responses.InsufficientBalance(w)
+	case errors.Is(err, ledger.ErrDuplicatePayout):
+		l.log.Infof("%s: payout reference already booked", op)
+		responses.DuplicatePayout(w)
+	default:
+		l.log.Errorf("%s: %v", op, err)
+		responses.ServerError(w)
+	}
+}
+
+func parsePagination(r *http.Request) (int64, int64, error) {
+	query := r.URL.Query()
+
+	parseInt := func(key string) (int64, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || parsed < 0 {
+				return 0, fmt.Errorf("invalid %s", key)
+			}
+			return parsed, nil
+		}
+		return 0, nil
+	}
+
+	limit, err := parseInt("limit")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	offset, err := parseInt("offset")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,176 @@
+// Package me. Данные текущего пользователя: профиль, рефералы и статистика выплат.
+package me
+
+import (
+	"encoding/json"
+	"errors"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/lead"
+	"ia-online-golang/internal/services/referral"
+	"ia-online-golang/internal/services/user"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type MeController struct {
+	log             *logrus.Logger
+	UserService     user.UserServiceI
+	ReferralService referral.ReferralServiceI
+	LeadService     lead.LeadServiceI
+}
+
+type MeControllerI interface {
+	Me(w http.ResponseWriter, r *http.Request)
+	Referrals(w http.ResponseWriter, r *http.Request)
+	Statistic(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, userService user.UserServiceI, referralService referral.ReferralServiceI, leadService lead.LeadServiceI) *MeController {
+	return &MeController{
+		log:             log,
+		UserService:     userService,
+		ReferralService: referralService,
+		LeadService:     leadService,
+	}
+}
+
+// Функция для получения профиля текущего пользователя.
+func (m *MeController) Me(w http.ResponseWriter, r *http.Request) {
+	const op = "MeController.Me"
+
+	m.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		m.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	userDTO, err := m.UserService.UserById(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			m.log.Infof("%s: user not found", op)
+
+			responses.UserNotFound(w)
+			return
+		}
+
+		m.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	m.log.Debugf("%s: user received", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userDTO)
+}
+
+// Функция для получения рефералов текущего пользователя.
+func (m *MeController) Referrals(w http.ResponseWriter, r *http.Request) {
+	const op = "MeController.Referrals"
+
+	m.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		m.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	userDTO, err := m.UserService.UserById(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			m.log.Infof("%s: user not found", op)
+
+			responses.UserNotFound(w)
+			return
+		}
+
+		m.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	referrals, err := m.ReferralService.ReferralsUser(r.Context(), userDTO.ReferralCode)
+	if err != nil {
+		m.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	m.log.Debugf("%s: referrals received", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(referrals)
+}
+
+// Функция для получения статистики выплат за период. Параметры from и to в формате 2006-01-02,
+// to включительно. По умолчанию статистика с начала текущего месяца.
+func (m *MeController) Statistic(w http.ResponseWriter, r *http.Request) {
+	const op = "MeController.Statistic"
+
+	m.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		m.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	query := r.URL.Query()
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if val := query.Get("from"); val != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, val, now.Location())
+		if err != nil {
+			m.log.Infof("%s: invalid from", op)
+
+			responses.ValidationError(w, "invalid from")
+			return
+		}
+		from = parsed
+	}
+
+	var to *time.Time
+	if val := query.Get("to"); val != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, val, now.Location())
+		if err != nil || parsed.Before(from) {
+			m.log.Infof("%s: invalid to", op)
+
+			responses.ValidationError(w, "invalid to")
+			return
+		}
+		// Конец дня, чтобы заявки за последний день попали в статистику
+		endOfDay := parsed.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		to = &endOfDay
+	}
+
+	m.log.Debugf("%s: period parsed", op)
+
+	statistic, err := m.LeadService.GetUserPaymentStatistic(r.Context(), userID, &from, to)
+	if err != nil {
+		m.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	m.log.Debugf("%s: statistic received", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statistic)
+}
@@ -0,0 +1,379 @@
+// Package payout. Заявки на выплату: подача и отмена партнёром, рассмотрение менеджером.
+package payout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/payout"
+	"ia-online-golang/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type PayoutController struct {
+	log           *logrus.Logger
+	validator     *validator.Validate
+	PayoutService payout.PayoutServiceI
+}
+
+type PayoutControllerI interface {
+	MyRequests(w http.ResponseWriter, r *http.Request)
+	MyRequest(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+	Cancel(w http.ResponseWriter, r *http.Request)
+	Requests(w http.ResponseWriter, r *http.Request)
+	Request(w http.ResponseWriter, r *http.Request)
+	Approve(w http.ResponseWriter, r *http.Request)
+	Reject(w http.ResponseWriter, r *http.Request)
+	MarkPaid(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, payoutService payout.PayoutServiceI) *PayoutController {
+	return &PayoutController{
+		log:           log,
+		validator:     validator,
+		PayoutService: payoutService,
+	}
+}
+
+// MyRequests GET /api/v1/me/payouts?limit=&offset=
+func (p *PayoutController) MyRequests(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.MyRequests"
+
+	p.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		p.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	filter, err := parsePayoutFilters(r)
+	if err != nil {
+		p.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, err.Error())
+		return
+	}
+
+	page, err := p.PayoutService.UserRequests(r.Context(), userID, filter.Limit, filter.Offset)
+	if err != nil {
+		p.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// MyRequest GET /api/v1/me/payouts/{id}
+func (p *PayoutController) MyRequest(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.MyRequest"
+
+	p.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		p.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		p.log.Infof("%s: invalid payout request id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	request, err := p.PayoutService.UserRequest(r.Context(), userID, id)
+	if err != nil {
+		p.handleError(w, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(request)
+}
+
+// Create POST /api/v1/me/payouts
+func (p *PayoutController) Create(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.Create"
+
+	p.log.Debugf("%s: start", op)
+
+	var createDTO dto.CreatePayoutRequestDTO
+	if err := json.NewDecoder(r.Body).Decode(&createDTO); err != nil {
+		p.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := p.validator.Struct(createDTO); err != nil {
+		p.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		p.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	request, err := p.PayoutService.Create(r.Context(), userID, createDTO)
+	if err != nil {
+		p.handleError(w, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(request)
+}
+
+// Cancel POST /api/v1/me/payouts/{id}/cancel
+func (p *PayoutController) Cancel(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.Cancel"
+
+	p.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		p.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	p.review(w, r, op, func(id int64, comment string) error {
+		return p.PayoutService.Cancel(r.Context(), userID, id, comment)
+	})
+}
+
+// Requests GET /api/v1/admin/payouts?status=&user_id=&limit=&offset=
+func (p *PayoutController) Requests(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.Requests"
+
+	p.log.Debugf("%s: start", op)
+
+	filter, err := parsePayoutFilters(r)
+	if err != nil {
+		p.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, err.Error())
+		return
+	}
+
+	page, err := p.PayoutService.Requests(r.Context(), filter)
+	if err != nil {
+		p.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// Request GET /api/v1/admin/payouts/{id}
+func (p *PayoutController) Request(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.Request"
+
+	p.log.Debugf("%s: start", op)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		p.log.Infof("%s: invalid payout request id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	request, err := p.PayoutService.Request(r.Context(), id)
+	if err != nil {
+		p.handleError(w, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(request)
+}
+
+// Approve POST /api/v1/admin/payouts/{id}/approve
+func (p *PayoutController) Approve(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.Approve"
+
+	p.log.Debugf("%s: start", op)
+
+	p.review(w, r, op, func(id int64, comment string) error {
+		return p.PayoutService.Approve(r.Context(), id, comment)
+	})
+}
+
+// Reject POST /api/v1/admin/payouts/{id}/reject
+func (p *PayoutController) Reject(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.Reject"
+
+	p.log.Debugf("%s: start", op)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		p.log.Infof("%s: invalid payout request id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	var rejectDTO dto.RejectPayoutDTO
+	if err := json.NewDecoder(r.Body).Decode(&rejectDTO); err != nil {
+		p.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := p.validator.Struct(rejectDTO); err != nil {
+		p.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	if err := p.PayoutService.Reject(r.Context(), id, rejectDTO.Comment); err != nil {
+		p.handleError(w, op, err)
+		return
+	}
+
+	responses.Ok(w)
+}
+
+// MarkPaid POST /api/v1/admin/payouts/{id}/paid
+func (p *PayoutController) MarkPaid(w http.ResponseWriter, r *http.Request) {
+	const op = "PayoutController.MarkPaid"
+
+	p.log.Debugf("%s: start", op)
+
+	p.review(w, r, op, func(id int64, comment string) error {
+		return p.PayoutService.MarkPaid(r.Context(), id, comment)
+	})
+}
+
+// review разбирает id заявки и необязательный комментарий и выполняет переход статуса
+func (p *PayoutController) review(w http.ResponseWriter, r *http.Request, op string, action func(id int64, comment string) error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		p.log.Infof("%s: invalid payout request id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	// Тело необязательно: комментарий к переходу можно не писать
+	var commentDTO dto.PayoutCommentDTO
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&commentDTO); err != nil {
+			p.log.Infof("%s: %v", op, err)
+
+			responses.InvalidRequest(w)
+			return
+		}
+	}
+
+	if err := p.validator.Struct(commentDTO); err != nil {
+		p.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	if err := action(id, commentDTO.Comment); err != nil {
+		p.handleError(w, op, err)
+		return
+	}
+
+	responses.Ok(w)
+}
+
+func (p *PayoutController) handleError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, payout.ErrPayoutRequestNotFound):
+		p.log.Infof("%s: payout request not found", op)
+		responses.PayoutRequestNotFound(w)
+	case errors.Is(err, payout.ErrPayoutStatusConflict):
+		p.log.Infof("%s: payout request status conflict", op)
+		responses.PayoutStatusConflict(w)
+	case errors.Is(err, payout.ErrInsufficientBalance):
+		p.log.Infof("%s: insufficient balance", op)
+		responses.InsufficientBalance(w)
+	case errors.Is(err, payout.ErrSelfReview):
+		p.log.Infof("%s: review of own payout request", op)
+		responses.SelfAction(w)
+	default:
+		p.log.Errorf("%s: %v", op, err)
+		responses.ServerError(w)
+	}
+}
+
+func parsePayoutFilters(r *http.Request) (dto.PayoutFilterDTO, error) {
+	query := r.URL.Query()
+
+	parseInt := func(key string) (int64, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || parsed < 0 {
+				return 0, fmt.Errorf("invalid %s", key)
+			}
+			return parsed, nil
+		}
+		return 0, nil
+	}
+
+	var filter dto.PayoutFilterDTO
+
+	if val := query.Get("status"); val != "" {
+		if !utils.Contains([]string{
+			models.PayoutStatusRequested, models.PayoutStatusApproved, models.PayoutStatusRejected,
+			models.PayoutStatusPaid, models.PayoutStatusCancelled,
+		}, val) {
+			return dto.PayoutFilterDTO{}, fmt.Errorf("invalid status")
+		}
+		filter.Status = &val
+	}
+
+	if query.Get("user_id") != "" {
+		userID, err := parseInt("user_id")
+		if err != nil {
+			return dto.PayoutFilterDTO{}, err
+		}
+		filter.UserID = &userID
+	}
+
+	var err error
+	if filter.Limit, err = parseInt("limit"); err != nil {
+		return dto.PayoutFilterDTO{}, err
+	}
+	if filter.Offset, err = parseInt("offset"); err != nil {
+		return dto.PayoutFilterDTO{}, err
+	}
+
+	return filter, nil
+}
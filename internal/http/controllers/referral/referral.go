@@ -0,0 +1,86 @@
+// Package referral. Дерево приглашённых партнёра с процентами по веткам.
+package referral
+
+import (
+	"encoding/json"
+	"errors"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/referral"
+	"ia-online-golang/internal/services/user"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ReferralController struct {
+	log             *logrus.Logger
+	ReferralService referral.ReferralServiceI
+}
+
+type ReferralControllerI interface {
+	MyTree(w http.ResponseWriter, r *http.Request)
+	UserTree(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, referralService referral.ReferralServiceI) *ReferralController {
+	return &ReferralController{
+		log:             log,
+		ReferralService: referralService,
+	}
+}
+
+// MyTree GET /api/v1/me/referrals/tree
+func (c *ReferralController) MyTree(w http.ResponseWriter, r *http.Request) {
+	const op = "ReferralController.MyTree"
+
+	c.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		c.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	c.tree(w, r, op, userID)
+}
+
+// UserTree GET /api/v1/admin/users/{id}/referrals/tree
+func (c *ReferralController) UserTree(w http.ResponseWriter, r *http.Request) {
+	const op = "ReferralController.UserTree"
+
+	c.log.Debugf("%s: start", op)
+
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		c.log.Infof("%s: invalid user id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	c.tree(w, r, op, userID)
+}
+
+func (c *ReferralController) tree(w http.ResponseWriter, r *http.Request, op string, userID int64) {
+	tree, err := c.ReferralService.Tree(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			c.log.Infof("%s: user not found", op)
+
+			responses.UserNotFound(w)
+			return
+		}
+
+		c.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
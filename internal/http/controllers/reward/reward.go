@@ -0,0 +1,258 @@
+// Package reward. Управление правилами вознаграждения и проверка их на прошлых заявках.
+package reward
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/reward"
+	"ia-online-golang/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type RewardController struct {
+	log           *logrus.Logger
+	validator     *validator.Validate
+	RewardService reward.RewardServiceI
+}
+
+type RewardControllerI interface {
+	Rules(w http.ResponseWriter, r *http.Request)
+	CreateRule(w http.ResponseWriter, r *http.Request)
+	UpdateRule(w http.ResponseWriter, r *http.Request)
+	DeleteRule(w http.ResponseWriter, r *http.Request)
+	DryRun(w http.ResponseWriter, r *http.Request)
+	Discrepancies(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, rewardService reward.RewardServiceI) *RewardController {
+	return &RewardController{
+		log:           log,
+		validator:     validator,
+		RewardService: rewardService,
+	}
+}
+
+// Rules GET /api/v1/admin/reward-rules
+func (c *RewardController) Rules(w http.ResponseWriter, r *http.Request) {
+	const op = "RewardController.Rules"
+
+	c.log.Debugf("%s: start", op)
+
+	rules, err := c.RewardService.Rules(r.Context())
+	if err != nil {
+		c.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// CreateRule POST /api/v1/admin/reward-rules
+func (c *RewardController) CreateRule(w http.ResponseWriter, r *http.Request) {
+	const op = "RewardController.CreateRule"
+
+	c.log.Debugf("%s: start", op)
+
+	ruleDTO, ok := c.decodeRule(w, r, op)
+	if !ok {
+		return
+	}
+
+	rule, err := c.RewardService.CreateRule(r.Context(), ruleDTO)
+	if err != nil {
+		c.handleError(w, op, err)
+		return
+	}
+
+	c.log.Infof("%s: reward rule %d created", op, rule.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// UpdateRule PUT /api/v1/admin/reward-rules/{id}
+func (c *RewardController) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	const op = "RewardController.UpdateRule"
+
+	c.log.Debugf("%s: start", op)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		c.log.Infof("%s: invalid rule id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	ruleDTO, ok := c.decodeRule(w, r, op)
+	if !ok {
+		return
+	}
+
+	rule, err := c.RewardService.UpdateRule(r.Context(), id, ruleDTO)
+	if err != nil {
+		c.handleError(w, op, err)
+		return
+	}
+
+	c.log.Infof("%s: reward rule %d updated", op, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// DeleteRule DELETE /api/v1/admin/reward-rules/{id}
+func (c *RewardController) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	const op = "RewardController.DeleteRule"
+
+	c.log.Debugf("%s: start", op)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		c.log.Infof("%s: invalid rule id", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := c.RewardService.DeleteRule(r.Context(), id); err != nil {
+		c.handleError(w, op, err)
+		return
+	}
+
+	c.log.Infof("%s: reward rule %d deleted", op, id)
+
+	responses.Ok(w)
+}
+
+// DryRun POST /api/v1/admin/reward-rules/dry-run
+func (c *RewardController) DryRun(w http.ResponseWriter, r *http.Request) {
+	const op = "RewardController.DryRun"
+
+	c.log.Debugf("%s: start", op)
+
+	var dryRunDTO dto.RewardDryRunRequestDTO
+	if err := json.NewDecoder(r.Body).Decode(&dryRunDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := c.validator.Struct(dryRunDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	result, err := c.RewardService.DryRun(r.Context(), dryRunDTO)
+	if err != nil {
+		c.handleError(w, op, err)
+		return
+	}
+
+	c.log.Infof("%s: %d leads checked, %d discrepancies", op, result.Checked, result.Discrepancies)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Discrepancies GET /api/v1/admin/reward-rules/discrepancies?limit=&offset=
+func (c *RewardController) Discrepancies(w http.ResponseWriter, r *http.Request) {
+	const op = "RewardController.Discrepancies"
+
+	c.log.Debugf("%s: start", op)
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, err.Error())
+		return
+	}
+
+	page, err := c.RewardService.Discrepancies(r.Context(), limit, offset)
+	if err != nil {
+		c.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (c *RewardController) decodeRule(w http.ResponseWriter, r *http.Request, op string) (dto.SaveRewardRuleDTO, bool) {
+	var ruleDTO dto.SaveRewardRuleDTO
+	if err := json.NewDecoder(r.Body).Decode(&ruleDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return dto.SaveRewardRuleDTO{}, false
+	}
+
+	if err := c.validator.Struct(ruleDTO); err != nil {
+		c.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return dto.SaveRewardRuleDTO{}, false
+	}
+
+	return ruleDTO, true
+}
+
+func (c *RewardController) handleError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, reward.ErrRewardRuleNotFound):
+		c.log.Infof("%s: reward rule not found", op)
+		responses.RewardRuleNotFound(w)
+	case errors.Is(err, reward.ErrRuleOverlap):
+		c.log.Infof("%s: %v", op, err)
+		responses.RewardRuleOverlap(w)
+	case errors.Is(err, reward.ErrInvalidRulePeriod):
+		c.log.Infof("%s: %v", op, err)
+		responses.ValidationError(w, "valid_to must not be before valid_from")
+	default:
+		c.log.Errorf("%s: %v", op, err)
+		responses.ServerError(w)
+	}
+}
+
+func parsePagination(r *http.Request) (int64, int64, error) {
+	query := r.URL.Query()
+
+	parseInt := func(key string) (int64, error) {
+		if val := query.Get(key); val != "" {
+			parsed, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || parsed < 0 {
+				return 0, fmt.Errorf("invalid %s", key)
+			}
+			return parsed, nil
+		}
+		return 0, nil
+	}
+
+	limit, err := parseInt("limit")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	offset, err := parseInt("offset")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/responses"
+	SchedulerService "ia-online-golang/internal/services/scheduler"
+	"ia-online-golang/internal/utils"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type SchedulerController struct {
+	log              *logrus.Logger
+	validator        *validator.Validate
+	SchedulerService SchedulerService.SchedulerServiceI
+}
+
+type SchedulerControllerI interface {
+	Jobs(w http.ResponseWriter, r *http.Request)
+	RunJob(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, schedulerService SchedulerService.SchedulerServiceI) *SchedulerController {
+	return &SchedulerController{
+		log:              log,
+		validator:        validator,
+		SchedulerService: schedulerService,
+	}
+}
+
+func (s *SchedulerController) Jobs(w http.ResponseWriter, r *http.Request) {
+	const op = "SchedulerController.Jobs"
+
+	s.log.Debugf("%s: start", op)
+
+	jobs, err := s.SchedulerService.Jobs(r.Context())
+	if err != nil {
+		s.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	s.log.Debugf("%s: jobs received", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func (s *SchedulerController) RunJob(w http.ResponseWriter, r *http.Request) {
+	const op = "SchedulerController.RunJob"
+
+	s.log.Debugf("%s: start", op)
+
+	var runJobDTO dto.RunJobDTO
+	if err := json.NewDecoder(r.Body).Decode(&runJobDTO); err != nil {
+		s.log.Infof("%s: decode error", op)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	s.log.Debugf("%s: decode completed", op)
+
+	if err := s.validator.Struct(runJobDTO); err != nil {
+		s.log.Infof("%s: validation error", op)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	s.log.Debugf("%s: validation completed", op)
+
+	err := s.SchedulerService.RunJob(r.Context(), runJobDTO.Name)
+	if err != nil {
+		if errors.Is(err, SchedulerService.ErrJobNotFound) {
+			s.log.Infof("%s: job %s not found", op, runJobDTO.Name)
+
+			responses.JobNotFound(w)
+			return
+		} else if errors.Is(err, SchedulerService.ErrJobAlreadyRunning) {
+			s.log.Infof("%s: job %s already running", op, runJobDTO.Name)
+
+			responses.JobAlreadyRunning(w)
+			return
+		} else if errors.Is(err, SchedulerService.ErrSchedulerStopped) {
+			s.log.Infof("%s: scheduler stopped", op)
+
+			responses.SchedulerStopped(w)
+			return
+		} else {
+			s.log.Errorf("%s: %v", op, err)
+
+			responses.ServerError(w)
+			return
+		}
+	}
+
+	s.log.Infof("%s: job %s started manually", op, runJobDTO.Name)
+
+	responses.JobStarted(w)
+}
@@ -0,0 +1,225 @@
+// Package twofactor. Подключение и отключение второго фактора текущим пользователем.
+package twofactor
+
+import (
+	"encoding/json"
+	"errors"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/twofactor"
+	"ia-online-golang/internal/utils"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+type TwoFactorController struct {
+	log              *logrus.Logger
+	validator        *validator.Validate
+	TwoFactorService twofactor.TwoFactorServiceI
+}
+
+type TwoFactorControllerI interface {
+	Status(w http.ResponseWriter, r *http.Request)
+	Enroll(w http.ResponseWriter, r *http.Request)
+	Confirm(w http.ResponseWriter, r *http.Request)
+	Disable(w http.ResponseWriter, r *http.Request)
+}
+
+func New(log *logrus.Logger, validator *validator.Validate, twoFactorService twofactor.TwoFactorServiceI) *TwoFactorController {
+	return &TwoFactorController{
+		log:              log,
+		validator:        validator,
+		TwoFactorService: twoFactorService,
+	}
+}
+
+// Функция для получения состояния 2FA текущего пользователя.
+func (t *TwoFactorController) Status(w http.ResponseWriter, r *http.Request) {
+	const op = "TwoFactorController.Status"
+
+	t.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		t.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	status, err := t.TwoFactorService.Status(r.Context(), userID)
+	if err != nil {
+		t.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Функция для начала подключения 2FA. Возвращает секрет и otpauth-ссылку для QR-кода.
+func (t *TwoFactorController) Enroll(w http.ResponseWriter, r *http.Request) {
+	const op = "TwoFactorController.Enroll"
+
+	t.log.Debugf("%s: start", op)
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		t.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	enrollment, err := t.TwoFactorService.Enroll(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrTwoFactorAlreadyEnabled) {
+			t.log.Infof("%s: two-factor already enabled", op)
+
+			responses.TwoFactorAlreadyEnabled(w)
+			return
+		}
+
+		t.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	t.log.Debugf("%s: secret generated", op)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// Функция для подтверждения 2FA первым кодом из приложения. Возвращает коды восстановления.
+func (t *TwoFactorController) Confirm(w http.ResponseWriter, r *http.Request) {
+	const op = "TwoFactorController.Confirm"
+
+	t.log.Debugf("%s: start", op)
+
+	var codeDTO dto.TwoFactorCodeDTO
+	if err := json.NewDecoder(r.Body).Decode(&codeDTO); err != nil {
+		t.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := t.validator.Struct(codeDTO); err != nil {
+		t.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		t.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	codes, err := t.TwoFactorService.Confirm(r.Context(), userID, codeDTO.Code)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrTwoFactorCodeIncorrect) {
+			t.log.Infof("%s: two-factor code incorrect", op)
+
+			responses.TwoFactorCodeIncorrect(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorNotEnrolled) {
+			t.log.Infof("%s: two-factor enrollment not started", op)
+
+			responses.TwoFactorNotEnrolled(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorAlreadyEnabled) {
+			t.log.Infof("%s: two-factor already enabled", op)
+
+			responses.TwoFactorAlreadyEnabled(w)
+			return
+		}
+
+		t.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	t.log.Infof("%s: two-factor enabled for user %d", op, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dto.TwoFactorEnabledDTO{RecoveryCodes: codes})
+}
+
+// Функция для отключения 2FA. Нужен действующий код из приложения или код восстановления.
+func (t *TwoFactorController) Disable(w http.ResponseWriter, r *http.Request) {
+	const op = "TwoFactorController.Disable"
+
+	t.log.Debugf("%s: start", op)
+
+	var dto dto.TwoFactorCodeDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		t.log.Infof("%s: %v", op, err)
+
+		responses.InvalidRequest(w)
+		return
+	}
+
+	if err := t.validator.Struct(dto); err != nil {
+		t.log.Infof("%s: %v", op, err)
+
+		responses.ValidationError(w, utils.FormatValidationErrors(err))
+		return
+	}
+
+	userID, ok := r.Context().Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		t.log.Errorf("%s: id user not received", op)
+
+		responses.ServerError(w)
+		return
+	}
+
+	err := t.TwoFactorService.Disable(r.Context(), userID, dto.Code)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrTwoFactorRequired) {
+			t.log.Infof("%s: two-factor required for role", op)
+
+			responses.TwoFactorRequired(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorCodeIncorrect) {
+			t.log.Infof("%s: two-factor code incorrect", op)
+
+			responses.TwoFactorCodeIncorrect(w)
+			return
+		}
+
+		if errors.Is(err, twofactor.ErrTwoFactorNotEnabled) {
+			t.log.Infof("%s: two-factor not enabled", op)
+
+			responses.TwoFactorNotEnabled(w)
+			return
+		}
+
+		t.log.Errorf("%s: %v", op, err)
+
+		responses.ServerError(w)
+		return
+	}
+
+	t.log.Infof("%s: two-factor disabled for user %d", op, userID)
+
+	responses.Ok(w)
+}
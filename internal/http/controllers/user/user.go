@@ -37,14 +37,8 @@ func New(log *logrus.Logger, validator *validator.Validate, userService user.Use
 }
 
 func (u UserController) User(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", http.MethodGet)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	user_id := r.URL.Path[len("/api/v1/user/"):]
+	user_id := r.PathValue("id")
 	num, err := strconv.ParseInt(user_id, 10, 64)
 	if err != nil {
 		responses.InvalidRequest(w)
@@ -62,12 +56,6 @@ func (u UserController) User(w http.ResponseWriter, r *http.Request) {
 }
 
 func (u UserController) Users(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.Header().Set("Allow", http.MethodGet)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
 	users, err := u.UserService.Users(r.Context())
 	if err != nil {
 		responses.ServerError(w)
@@ -83,16 +71,6 @@ func (u UserController) EditUser(w http.ResponseWriter, r *http.Request) {
 
 	u.log.Debugf("%s: start", op)
 
-	if r.Method != http.MethodPut {
-		u.log.Infof("%s: method not allowed. method: %s", op, r.Method)
-
-		w.Header().Set("Allow", http.MethodPut)
-		responses.MethodNotAllowed(w)
-		return
-	}
-
-	u.log.Debugf("%s: method allowed", op)
-
 	var userDTO dto.UserDTO
 	if err := json.NewDecoder(r.Body).Decode(&userDTO); err != nil {
 		u.log.Infof("%s: decode error", op)
@@ -142,6 +120,13 @@ func (u UserController) EditUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if errors.Is(err, user.ErrContactChangeNotAllowed) {
+			u.log.Infof("%s: %v", op, err)
+
+			responses.ContactChangeNotAllowed(w)
+			return
+		}
+
 		u.log.Errorf("%s: %v", op, err)
 
 		responses.ServerError(w)
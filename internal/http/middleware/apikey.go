@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/apikey"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyHeader заголовок, в котором интеграции партнёров передают ключ вместо Bearer JWT
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyMiddleware авторизует запросы с заголовком X-API-Key, остальные передаёт в jwt
+func APIKeyMiddleware(log *logrus.Logger, apiKeyService apikey.APIKeyServiceI, jwt func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		jwtHandler := jwt(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				jwtHandler.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := apiKeyService.Authenticate(r.Context(), key)
+			if err != nil {
+				if errors.Is(err, apikey.ErrInvalidAPIKey) {
+					responses.InvalidAPIKey(w)
+					return
+				}
+
+				log.Errorf("middleware.APIKeyMiddleware: %v", err)
+				responses.ServerError(w)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), context_keys.UserIDKey, principal.UserID)
+			ctx = context.WithValue(ctx, context_keys.UserRoleKey, principal.Roles)
+			ctx = context.WithValue(ctx, context_keys.APIKeyScopesKey, principal.Scopes)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ScopeMiddleware пропускает запрос по API-ключу, только если у ключа есть одна из областей маршрута.
+// Маршрут без областей доступен только с JWT. На запросы с JWT не влияет.
+func ScopeMiddleware(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyScopes, ok := r.Context().Value(context_keys.APIKeyScopesKey).([]string)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, keyScope := range keyScopes {
+				for _, scope := range scopes {
+					if keyScope == scope {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			responses.InsufficientScope(w)
+		})
+	}
+}
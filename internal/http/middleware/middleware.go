@@ -2,14 +2,19 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"ia-online-golang/internal/http/context_keys"
 	"ia-online-golang/internal/http/responses"
 	"ia-online-golang/internal/services/token"
 	"net/http"
 	"strings"
+
+	"github.com/sirupsen/logrus"
 )
 
-func JWTMiddleware(ctx context.Context, tokenService token.TokenServiceI) func(http.Handler) http.Handler {
+// JWTMiddleware принимает access-токен, только если его сессия не отозвана, а пользователь не заблокирован,
+// поэтому смена ролей, блокировка и принудительный выход действуют на уже выданные токены
+func JWTMiddleware(ctx context.Context, log *logrus.Logger, tokenService token.TokenServiceI) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -39,9 +44,21 @@ func JWTMiddleware(ctx context.Context, tokenService token.TokenServiceI) func(h
 				return
 			}
 
-			// Добавляем userID и роли в контекст
+			if err := tokenService.ValidateSession(r.Context(), userClaims.UserID, userClaims.SessionID); err != nil {
+				if errors.Is(err, token.ErrSessionRevoked) {
+					responses.InvalidAccessToken(w)
+					return
+				}
+
+				log.Errorf("middleware.JWTMiddleware: %v", err)
+				responses.ServerError(w)
+				return
+			}
+
+			// Добавляем userID, роли и id сессии в контекст
 			ctx := context.WithValue(r.Context(), context_keys.UserIDKey, userClaims.UserID)
 			ctx = context.WithValue(ctx, context_keys.UserRoleKey, userClaims.Roles)
+			ctx = context.WithValue(ctx, context_keys.SessionIDKey, userClaims.SessionID)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
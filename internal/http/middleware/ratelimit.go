@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"errors"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/services/ratelimit"
+	"net/http"
+)
+
+// RateLimitMiddleware ограничивает запросы к маршруту с одного IP. IP кладёт RequestInfoMiddleware.
+func RateLimitMiddleware(rateLimitService ratelimit.RateLimitServiceI, route string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _ := r.Context().Value(context_keys.ClientIPKey).(string)
+
+			err := rateLimitService.AllowIP(r.Context(), route, ip)
+			var limitErr *ratelimit.LimitError
+			if errors.As(err, &limitErr) {
+				responses.TooManyRequests(w, limitErr.RetryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"context"
+	"ia-online-golang/internal/http/context_keys"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern ограничивает идентификатор от клиента: он попадает в логи и журнал действий
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDMiddleware кладёт в контекст идентификатор запроса и возвращает его в заголовке ответа.
+// Идентификатор от прокси или клиента используется, если он корректен, иначе генерируется новый.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+
+		ctx := context.WithValue(r.Context(), context_keys.RequestIDKey, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"ia-online-golang/internal/http/context_keys"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequestInfoMiddleware кладёт в контекст IP и User-Agent клиента, они сохраняются в сессии.
+// Заголовкам X-Real-IP и X-Forwarded-For верим, только если сервер стоит за прокси: иначе их подделает кто угодно.
+func RequestInfoMiddleware(trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), context_keys.ClientIPKey, clientIP(r, trustProxy))
+			ctx = context.WithValue(ctx, context_keys.UserAgentKey, r.UserAgent())
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -2,7 +2,10 @@ package responses
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // errorResponse структура для JSON-ответа
@@ -42,6 +45,9 @@ func ReferralNotFound(w http.ResponseWriter) {
 func LeadNotFound(w http.ResponseWriter) {
 	SendError(w, http.StatusConflict, "lead not found")
 }
+func CrmUnavailable(w http.ResponseWriter) {
+	SendError(w, http.StatusServiceUnavailable, "crm is temporarily unavailable")
+}
 func ServerError(w http.ResponseWriter) {
 	SendError(w, http.StatusInternalServerError, "error server")
 }
@@ -63,6 +69,12 @@ func ValidationError(w http.ResponseWriter, err string) {
 func RefreshTokenNotFound(w http.ResponseWriter) {
 	SendError(w, http.StatusUnauthorized, "refresh token not found")
 }
+func RefreshTokenReused(w http.ResponseWriter) {
+	SendError(w, http.StatusUnauthorized, "refresh token reused, session revoked")
+}
+func SessionNotFound(w http.ResponseWriter) {
+	SendError(w, http.StatusNotFound, "session not found")
+}
 func AccessTokenNotFound(w http.ResponseWriter) {
 	SendError(w, http.StatusUnauthorized, "access token not found")
 }
@@ -90,3 +102,106 @@ func PasswordCodeHasExpired(w http.ResponseWriter) {
 func PasswordCodeIncorrect(w http.ResponseWriter) {
 	SendError(w, http.StatusUnauthorized, "password code incorrect")
 }
+func JobStarted(w http.ResponseWriter) {
+	SendError(w, http.StatusAccepted, "job started")
+}
+func JobNotFound(w http.ResponseWriter) {
+	SendError(w, http.StatusNotFound, "job not found")
+}
+func JobAlreadyRunning(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "job already running")
+}
+func SchedulerStopped(w http.ResponseWriter) {
+	SendError(w, http.StatusServiceUnavailable, "scheduler stopped")
+}
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	SendError(w, http.StatusTooManyRequests, "too many requests")
+}
+func InvalidChallengeToken(w http.ResponseWriter) {
+	SendError(w, http.StatusUnauthorized, "challenge token invalid")
+}
+func TwoFactorCodeIncorrect(w http.ResponseWriter) {
+	SendError(w, http.StatusUnauthorized, "two-factor code incorrect")
+}
+func TwoFactorAlreadyEnabled(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "two-factor authentication already enabled")
+}
+func TwoFactorNotEnabled(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "two-factor authentication not enabled")
+}
+func TwoFactorNotEnrolled(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "two-factor enrollment not started")
+}
+func TwoFactorRequired(w http.ResponseWriter) {
+	SendError(w, http.StatusForbidden, "two-factor authentication required for your role")
+}
+func InvalidAPIKey(w http.ResponseWriter) {
+	SendError(w, http.StatusUnauthorized, "api key invalid")
+}
+func InsufficientScope(w http.ResponseWriter) {
+	SendError(w, http.StatusForbidden, "api key scope insufficient")
+}
+func APIKeyNotFound(w http.ResponseWriter) {
+	SendError(w, http.StatusNotFound, "api key not found")
+}
+func APIKeyExpiresInPast(w http.ResponseWriter) {
+	SendError(w, http.StatusBadRequest, "expires_at must be in the future")
+}
+func UserBanned(w http.ResponseWriter) {
+	SendError(w, http.StatusForbidden, "user banned")
+}
+func SelfAction(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "action not allowed on own account")
+}
+func UserAlreadyActive(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "user already active")
+}
+func UserAlreadyBanned(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "user already banned")
+}
+func UserIsNotBanned(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "user is not banned")
+}
+func UserHasRelations(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "user has leads, referrals or comments, ban the user instead")
+}
+func ContactChangeNotAllowed(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "email and phone number are changed via /api/v1/me/email and /api/v1/me/phone")
+}
+func ContactUnchanged(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "new value matches current")
+}
+func EmailAlreadyUsed(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "email already used")
+}
+func PhoneAlreadyUsed(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "phone number already used")
+}
+func PhoneCodeNotFound(w http.ResponseWriter) {
+	SendError(w, http.StatusNotFound, "phone change not requested")
+}
+func PhoneCodeIncorrect(w http.ResponseWriter) {
+	SendError(w, http.StatusUnauthorized, "phone code incorrect")
+}
+func PhoneCodeExpired(w http.ResponseWriter) {
+	SendError(w, http.StatusGone, "phone code has expired")
+}
+func InsufficientBalance(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "amount exceeds pending balance")
+}
+func DuplicatePayout(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "payout with this reference already booked")
+}
+func PayoutRequestNotFound(w http.ResponseWriter) {
+	SendError(w, http.StatusNotFound, "payout request not found")
+}
+func PayoutStatusConflict(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "payout request status does not allow this action")
+}
+func RewardRuleNotFound(w http.ResponseWriter) {
+	SendError(w, http.StatusNotFound, "reward rule not found")
+}
+func RewardRuleOverlap(w http.ResponseWriter) {
+	SendError(w, http.StatusConflict, "reward rule overlaps an existing rule for the same service, city and tier")
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"encoding/json"
+	"ia-online-golang/internal/http/middleware"
+	"ia-online-golang/internal/http/responses"
+	"ia-online-golang/internal/utils"
+	"net/http"
+)
+
+// Middleware обёртка над обработчиком
+type Middleware func(http.Handler) http.Handler
+
+// Route описание маршрута. Если заданы Roles, маршрут требует авторизации и одну из ролей.
+// Scopes области API-ключей, с которыми доступен маршрут. Без Scopes маршрут доступен только с JWT.
+type Route struct {
+	Method     string
+	Pattern    string
+	Handler    http.HandlerFunc
+	Auth       bool
+	Roles      []string
+	Scopes     []string
+	Middleware []Middleware
+}
+
+// RouteInfo маршрут без обработчика, для документации и тестов
+type RouteInfo struct {
+	Method  string   `json:"method"`
+	Pattern string   `json:"pattern"`
+	Auth    bool     `json:"auth"`
+	Roles   []string `json:"roles,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
+}
+
+type Router struct {
+	mux    *http.ServeMux
+	auth   Middleware
+	routes []Route
+}
+
+// New создаёт маршрутизатор. auth применяется к маршрутам с Auth или Roles.
+func New(auth Middleware, routes ...Route) *Router {
+	r := &Router{
+		mux:  http.NewServeMux(),
+		auth: auth,
+	}
+
+	for _, route := range routes {
+		r.Handle(route)
+	}
+
+	return r
+}
+
+// Handle регистрирует маршрут вида "GET /api/v1/user/{id}" с цепочкой middleware.
+// Порядок: Middleware маршрута, затем авторизация, затем проверка областей API-ключа и ролей.
+func (r *Router) Handle(route Route) {
+	var handler http.Handler = route.Handler
+
+	if len(route.Roles) > 0 {
+		handler = middleware.RoleMiddleware(route.Roles...)(handler)
+	}
+	if route.Auth || len(route.Roles) > 0 {
+		handler = middleware.ScopeMiddleware(route.Scopes...)(handler)
+		handler = r.auth(handler)
+	}
+	for i := len(route.Middleware) - 1; i >= 0; i-- {
+		handler = route.Middleware[i](handler)
+	}
+
+	r.mux.Handle(route.Method+" "+route.Pattern, handler)
+	r.routes = append(r.routes, route)
+}
+
+// Routes возвращает список зарегистрированных маршрутов в порядке регистрации
+func (r *Router) Routes() []RouteInfo {
+	result := make([]RouteInfo, 0, len(r.routes))
+	for _, route := range r.routes {
+		result = append(result, RouteInfo{
+			Method:  route.Method,
+			Pattern: route.Pattern,
+			Auth:    route.Auth || len(route.Roles) > 0,
+			Roles:   route.Roles,
+			Scopes:  route.Scopes,
+		})
+	}
+
+	return result
+}
+
+// ListRoutes GET /api/v1/admin/routes
+// Отдаёт таблицу маршрутов с требуемыми ролями и областями API-ключей
+func (r *Router) ListRoutes(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.Routes())
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Пустой шаблон значит, что маршрут не найден: ServeMux ответит 404 или 405 с заголовком Allow.
+	// Подменяем его текстовый ответ на JSON, как у остальных ошибок.
+	if _, pattern := r.mux.Handler(req); pattern == "" {
+		w = &errorWriter{ResponseWriter: w, request: req}
+	}
+
+	r.mux.ServeHTTP(w, req)
+}
+
+// errorWriter заменяет тело ответов 404 и 405, которые формирует ServeMux
+type errorWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	intercepted bool
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusNotFound:
+		w.intercepted = true
+		utils.HandleNotFound(w.ResponseWriter, w.request)
+	case http.StatusMethodNotAllowed:
+		w.intercepted = true
+		responses.MethodNotAllowed(w.ResponseWriter)
+	default:
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	if w.intercepted {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
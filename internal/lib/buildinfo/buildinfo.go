@@ -0,0 +1,45 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Значения подставляются при сборке:
+//
+//	go build -ldflags "-X ia-online-golang/internal/lib/buildinfo.Version=1.2.0 \
+//		-X ia-online-golang/internal/lib/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//		-X ia-online-golang/internal/lib/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/main
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get возвращает информацию о сборке. Если коммит не передан через ldflags,
+// берём его из данных VCS, которые go build записывает в бинарник.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "unknown" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	return info
+}
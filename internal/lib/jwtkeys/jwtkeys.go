@@ -0,0 +1,228 @@
+// Package jwtkeys ключи подписи JWT.
+//
+// Ротация ключа без разлогина пользователей:
+//  1. Сгенерировать новую пару и добавить её в keys, не меняя signing_key.
+//     Новый ключ появится в /.well-known/jwks.json, и другие сервисы успеют его подхватить.
+//  2. Переключить signing_key на новый ключ. Токены со старым kid продолжают проверяться.
+//  3. Когда истечёт срок жизни токенов (expiration), удалить старый ключ из keys.
+//
+// Пары ключей создаются так:
+//
+//	openssl genpkey -algorithm RSA -pkeyopt rsa_keygen_bits:2048 -out access-2025-01.pem
+//	openssl genpkey -algorithm ed25519 -out access-2025-01.pem
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/config"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown key id")
+	ErrUnexpectedMethod = errors.New("unexpected signing method")
+)
+
+// Key ключ проверки подписи. У ключа подписи также есть закрытый ключ.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeySet ключ подписи и все ключи, которыми проверяются токены
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	secret  []byte
+}
+
+// JWK открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Load читает ключи из файлов. Без keys токены подписываются HS256 секретом, как раньше.
+func Load(cfg config.JWTInfo) (*KeySet, error) {
+	const op = "jwtkeys.Load"
+
+	set := &KeySet{keys: make(map[string]*Key)}
+	if cfg.SecretKey != "" {
+		set.secret = []byte(cfg.SecretKey)
+	}
+
+	for _, keyCfg := range cfg.Keys {
+		key, err := loadKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %s: %w", op, keyCfg.ID, err)
+		}
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate key id %s", op, key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	switch {
+	case cfg.SigningKey != "":
+		key, ok := set.keys[cfg.SigningKey]
+		if !ok {
+			return nil, fmt.Errorf("%s: signing key %s: %w", op, cfg.SigningKey, ErrUnknownKey)
+		}
+		if key.private == nil {
+			return nil, fmt.Errorf("%s: signing key %s has no private key", op, cfg.SigningKey)
+		}
+		set.signing = key
+	case len(set.keys) > 0:
+		return nil, fmt.Errorf("%s: signing_key is required when keys are set", op)
+	case set.secret == nil:
+		return nil, fmt.Errorf("%s: either secret_key or keys are required", op)
+	}
+
+	return set, nil
+}
+
+func loadKey(cfg config.JWTKeyConfig) (*Key, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	if cfg.PrivateKeyPath == "" && cfg.PublicKeyPath == "" {
+		return nil, errors.New("private_key_path or public_key_path is required")
+	}
+
+	key := &Key{ID: cfg.ID}
+
+	var privatePEM, publicPEM []byte
+	var err error
+	if cfg.PrivateKeyPath != "" {
+		if privatePEM, err = os.ReadFile(cfg.PrivateKeyPath); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PublicKeyPath != "" {
+		if publicPEM, err = os.ReadFile(cfg.PublicKeyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	switch cfg.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key.Method = jwt.SigningMethodRS256
+		if privatePEM != nil {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, &private.PublicKey
+		}
+		if publicPEM != nil {
+			if key.public, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	case jwt.SigningMethodEdDSA.Alg():
+		key.Method = jwt.SigningMethodEdDSA
+		if privatePEM != nil {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, private.(ed25519.PrivateKey).Public()
+		}
+		if publicPEM != nil {
+			if key.public, err = jwt.ParseEdPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	return key, nil
+}
+
+// Sign подписывает claims текущим ключом и проставляет kid в заголовок
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+
+	return token.SignedString(s.signing.private)
+}
+
+// Keyfunc выбирает ключ проверки по kid. Алгоритм токена должен совпадать с алгоритмом ключа,
+// иначе открытый ключ можно было бы подсунуть как HMAC-секрет.
+func (s *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if s.secret == nil {
+			return nil, ErrUnknownKey
+		}
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedMethod, token.Method.Alg())
+		}
+		return s.secret, nil
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedMethod, token.Method.Alg())
+	}
+
+	return key.public, nil
+}
+
+// JWKS открытые ключи для проверки токенов другими сервисами. HS256 секрет не публикуется.
+func (s *KeySet) JWKS() JWKS {
+	result := JWKS{Keys: make([]JWK, 0, len(s.keys))}
+
+	for _, key := range s.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		result.Keys = append(result.Keys, jwk)
+	}
+
+	// Порядок map случайный, а ответ удобнее сравнивать и кешировать, когда он стабилен
+	sort.Slice(result.Keys, func(i, j int) bool { return result.Keys[i].Kid < result.Keys[j].Kid })
+
+	return result
+}
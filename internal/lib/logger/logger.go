@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"ia-online-golang/internal/lib/buildinfo"
 	"io"
 	"os"
 	"time"
@@ -68,12 +69,36 @@ func SetupLogger(env string) *logrus.Logger {
 		})
 	}
 
-	// Добавление дополнительной информации, например, о версии приложения или хосте
-	log.WithFields(logrus.Fields{
+	// Добавление дополнительной информации о версии приложения и хосте в каждую запись
+	info := buildinfo.Get()
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	log.AddHook(staticFieldsHook{fields: logrus.Fields{
 		"app":     "ia-online-golang",
-		"version": "1.0.0",
-		"host":    "localhost",
-	})
+		"version": info.Version,
+		"commit":  info.Commit,
+		"host":    host,
+	}})
 
 	return log
 }
+
+// staticFieldsHook добавляет постоянные поля в каждую запись лога
+type staticFieldsHook struct {
+	fields logrus.Fields
+}
+
+func (h staticFieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h staticFieldsHook) Fire(entry *logrus.Entry) error {
+	for key, value := range h.fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package money денежные суммы в копейках. Суммы хранятся в БД как NUMERIC(12,2),
+// а в JSON передаются числом в рублях с двумя знаками после точки.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money сумма в копейках. Целое число не накапливает ошибку округления при сложении.
+type Money int64
+
+// maxIntegerDigits столько цифр до точки помещается в NUMERIC(12,2)
+const maxIntegerDigits = 10
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// FromKopecks сумма из целого числа копеек
+func FromKopecks(kopecks int64) Money {
+	return Money(kopecks)
+}
+
+// FromRubles сумма из целого числа рублей
+func FromRubles(rubles int64) Money {
+	return Money(rubles * 100)
+}
+
+// Parse разбирает сумму вида "1500", "1500.5", "-20,75". Больше двух знаков после точки — ошибка,
+// чтобы копейки не терялись при округлении. Денежное поле битрикса приходит как "1500.50|RUB",
+// валюта отбрасывается.
+func Parse(value string) (Money, error) {
+	raw := value
+	value = strings.TrimSpace(value)
+	if amount, _, found := strings.Cut(value, "|"); found {
+		value = amount
+	}
+
+	negative := false
+	if value != "" && (value[0] == '-' || value[0] == '+') {
+		negative = value[0] == '-'
+		value = value[1:]
+	}
+
+	integer, fraction, _ := strings.Cut(strings.Replace(value, ",", ".", 1), ".")
+	if integer == "" || len(integer) > maxIntegerDigits || len(fraction) > 2 || !digits(integer) || !digits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+
+	rubles, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+
+	kopecks := int64(0)
+	if fraction != "" {
+		fraction += strings.Repeat("0", 2-len(fraction))
+		kopecks, _ = strconv.ParseInt(fraction, 10, 64)
+	}
+
+	amount := Money(rubles*100 + kopecks)
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
+
+func digits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Kopecks сумма целым числом копеек
+func (m Money) Kopecks() int64 {
+	return int64(m)
+}
+
+// String сумма в рублях с двумя знаками после точки, например "1500.50"
+func (m Money) String() string {
+	sign := ""
+	kopecks := int64(m)
+	if kopecks < 0 {
+		sign = "-"
+		kopecks = -kopecks
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, kopecks/100, kopecks%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON принимает число или строку. Дробная часть длиннее двух знаков отклоняется,
+// незначащие нули в ней допускаются.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if value == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	if integer, fraction, found := strings.Cut(value, "."); found {
+		value = strings.TrimSuffix(integer+"."+strings.TrimRight(fraction, "0"), ".")
+	}
+
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// Scan читает NUMERIC из БД. NULL читается как ноль: старые колонки наград допускают NULL.
+func (m *Money) Scan(src any) error {
+	var value string
+	switch src := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		value = string(src)
+	case string:
+		value = src
+	case int64:
+		*m = FromRubles(src)
+		return nil
+	default:
+		return fmt.Errorf("money: unsupported type %T", src)
+	}
+
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// Value передаёт сумму в БД строкой, PostgreSQL приводит её к NUMERIC без потерь
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
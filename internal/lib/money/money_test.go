@@ -0,0 +1,157 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Money
+		wantErr bool
+	}{
+		{name: "integer", value: "1500", want: 150000},
+		{name: "one fraction digit", value: "1500.5", want: 150050},
+		{name: "two fraction digits", value: "1500.05", want: 150005},
+		{name: "comma decimal", value: "20,75", want: 2075},
+		{name: "negative comma decimal", value: "-20,75", want: -2075},
+		{name: "plus sign", value: "+3", want: 300},
+		{name: "spaces", value: " 42.10 ", want: 4210},
+		{name: "currency suffix", value: "1500.50|RUB", want: 150050},
+		{name: "currency suffix without fraction", value: "700|RUB", want: 70000},
+		{name: "trailing dot", value: "12.", want: 1200},
+		{name: "ten digits", value: "9999999999.99", want: 999999999999},
+		{name: "eleven digits", value: "10000000000", wantErr: true},
+		{name: "three fraction digits", value: "1.005", wantErr: true},
+		{name: "trailing zero beyond cents", value: "1.500", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+		{name: "only currency", value: "|RUB", wantErr: true},
+		{name: "no integer part", value: ".50", wantErr: true},
+		{name: "letters", value: "12a", wantErr: true},
+		{name: "two separators", value: "1.2.3", wantErr: true},
+		{name: "exponent", value: "1e3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("Parse(%q) error = %v, want ErrInvalidAmount", tt.value, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Money
+		wantErr bool
+	}{
+		{name: "number", data: `1500.5`, want: 150050},
+		{name: "integer", data: `42`, want: 4200},
+		{name: "string", data: `"1500.50"`, want: 150050},
+		{name: "negative", data: `-0.01`, want: -1},
+		{name: "trailing zeros", data: `1.500`, want: 150},
+		{name: "only zeros in fraction", data: `7.000`, want: 700},
+		{name: "quoted trailing zeros", data: `"2.10000"`, want: 210},
+		{name: "three significant digits", data: `1.005`, wantErr: true},
+		{name: "not a number", data: `"abc"`, wantErr: true},
+		{name: "bool", data: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Unmarshal(%s) = %d, want error", tt.data, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) unexpected error: %v", tt.data, err)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSONNullKeepsValue(t *testing.T) {
+	got := Money(500)
+	if err := json.Unmarshal([]byte(`null`), &got); err != nil {
+		t.Fatalf("Unmarshal(null) unexpected error: %v", err)
+	}
+	if got != 500 {
+		t.Errorf("Unmarshal(null) = %d, want 500", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     any
+		want    Money
+		wantErr bool
+	}{
+		{name: "null", src: nil, want: 0},
+		{name: "bytes", src: []byte("1500.50"), want: 150050},
+		{name: "string", src: "-20.75", want: -2075},
+		{name: "int64 rubles", src: int64(12), want: 1200},
+		{name: "invalid bytes", src: []byte("1.005"), wantErr: true},
+		{name: "float", src: 1.5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Money(999)
+			err := got.Scan(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Scan(%v) = %d, want error", tt.src, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan(%v) unexpected error: %v", tt.src, err)
+			}
+			if got != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value Money
+		want  string
+	}{
+		{value: 0, want: "0.00"},
+		{value: 5, want: "0.05"},
+		{value: 150050, want: "1500.50"},
+		{value: -2075, want: "-20.75"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.value), got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package models
 
 import "time"
 
+// ActivationLink ссылка из письма. Если NewEmail задан, ссылка подтверждает смену почты, а не активацию.
 type ActivationLink struct {
 	ID           int
 	UserID       int64
 	ActivationID string
+	NewEmail     *string
 	ExpiresAt    time.Time
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey ключ для интеграций партнёров. Сам ключ показывается один раз, хранится его хеш.
+// Prefix начало ключа, по которому пользователь узнаёт его в списке.
+type APIKey struct {
+	ID         string
+	UserID     int64
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     pq.StringArray
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent запись журнала действий. ActorID nil, если действие выполнила система.
+// Before и After содержат только изменившиеся поля объекта.
+type AuditEvent struct {
+	ID         int64
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     json.RawMessage
+	After      json.RawMessage
+	Details    json.RawMessage
+	IP         string
+	RequestID  string
+	CreatedAt  time.Time
+}
+
+// AuditFilter условия поиска по журналу. Пустые поля не фильтруют.
+type AuditFilter struct {
+	ActorID    *int64
+	Action     *string
+	TargetType *string
+	TargetID   *string
+	RequestID  *string
+	From       *time.Time
+	To         *time.Time
+	Limit      int64
+	Offset     int64
+}
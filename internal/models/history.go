@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Источники изменений заявки. Менеджеры меняют заявки в битриксе, их правки приходят вебхуком или сверкой.
+const (
+	HistorySourceWebhook        = "webhook"
+	HistorySourceReconciliation = "reconciliation"
+)
+
+// Действия в истории заявки
+const (
+	HistoryActionStatusChanged = "status_changed"
+	HistoryActionRewardChanged = "reward_changed"
+	HistoryActionDateChanged   = "date_changed"
+)
+
+type HistoryEntry struct {
+	ID       int64
+	LeadID   int64
+	Action   string
+	Field    string
+	OldValue *string
+	NewValue *string
+	Source   string
+	UserID   *int64
+
+	// Названия статусов заполняются только для изменений status_id
+	OldStatus *string
+	NewStatus *string
+
+	CreatedAt time.Time
+}
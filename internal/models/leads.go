@@ -1,9 +1,26 @@
 package models
 
-import "time"
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
+// Статусы синхронизации заявки с битриксом
+const (
+	LeadSyncPending = "pending"
+	LeadSyncSynced  = "synced"
+	LeadSyncFailed  = "failed"
+)
+
+// Статусы заявки из таблицы statuses, за которые партнёру начисляется вознаграждение
+const (
+	LeadStatusReady int64 = 4
+	LeadStatusPaid  int64 = 5
+)
 
 type Lead struct {
 	ID          int64  `json:"id"`
+	BitrixID    *int64 `json:"bitrix_id"`
 	UserID      int64  `json:"user_id"`
 	FIO         string `json:"fio"`
 	Address     string `json:"address"`
@@ -12,10 +29,18 @@ type Lead struct {
 	Internet    bool   `json:"is_internet"`
 	Cleaning    bool   `json:"is_cleaning"`
 	Shipping    bool   `json:"is_shipping"`
+	SyncStatus  string `json:"sync_status"`
+
+	RewardInternet money.Money `json:"reward_internet"`
+	RewardCleaning money.Money `json:"reward_cleaning"`
+	RewardShipping money.Money `json:"reward_shipping"`
 
-	RewardInternet float64 `json:"reward_internet"`
-	RewardCleaning float64 `json:"reward_cleaning"`
-	RewardShipping float64 `json:"reward_shipping"`
+	// Ожидаемые вознаграждения по правилам на момент создания заявки
+	ExpectedRewardInternet *money.Money `json:"expected_reward_internet"`
+	ExpectedRewardCleaning *money.Money `json:"expected_reward_cleaning"`
+	ExpectedRewardShipping *money.Money `json:"expected_reward_shipping"`
+	// RewardDiscrepancy сумма из битрикса не совпала с ожидаемой
+	RewardDiscrepancy bool `json:"reward_discrepancy"`
 
 	CreatedAt   *time.Time `json:"created_at"`
 	CompletedAt *time.Time `json:"completed_at"`
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
+// Виды проводок
+const (
+	LedgerKindLeadReward         = "lead_reward"
+	LedgerKindReferralBonus      = "referral_bonus"
+	LedgerKindReferralCommission = "referral_commission"
+	LedgerKindPayout             = "payout"
+	LedgerKindAdjustment         = "adjustment"
+)
+
+// Счета. Счёт партнёра ведётся для каждого пользователя отдельно, остальные общие.
+const (
+	LedgerAccountPartner       = "partner"
+	LedgerAccountRewardExpense = "reward_expense"
+	LedgerAccountCash          = "cash"
+)
+
+// Источники проводок
+const (
+	LedgerSourceLead               = "lead"
+	LedgerSourceReferral           = "referral"
+	LedgerSourceReferralCommission = "referral_commission"
+	LedgerSourcePaymentOrder       = "payment_order"
+	LedgerSourceManual             = "manual"
+	LedgerSourcePayoutRequest      = "payout_request"
+)
+
+type LedgerTransaction struct {
+	ID         int64
+	Kind       string
+	UserID     int64
+	Reason     string
+	SourceType string
+	SourceID   string
+	CreatedBy  *int64
+	CreatedAt  time.Time
+}
+
+// LedgerRecord проводка глазами партнёра: Amount положительный для начислений и отрицательный для выплат
+type LedgerRecord struct {
+	LedgerTransaction
+	Amount money.Money
+}
+
+// LedgerBalance Pending всегда равен Accrued минус Paid. Reserved часть Pending, на которую уже
+// поданы заявки на выплату, новую заявку можно подать только на остаток.
+type LedgerBalance struct {
+	Accrued  money.Money
+	Paid     money.Money
+	Pending  money.Money
+	Reserved money.Money
+}
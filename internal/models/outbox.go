@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// События, которые отправляются в битрикс через outbox
+const (
+	OutboxEventCreateDeal    = "crm.deal.add"
+	OutboxEventCreateComment = "crm.timeline.comment.add"
+)
+
+// Статусы сообщений outbox
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusDone    = "done"
+	OutboxStatusFailed  = "failed"
+)
+
+// OutboxComment полезная нагрузка сообщения OutboxEventCreateComment
+type OutboxComment struct {
+	UserID int64  `json:"user_id"`
+	Text   string `json:"text"`
+}
+
+type OutboxMessage struct {
+	ID            int64
+	LeadID        int64
+	Event         string
+	Payload       []byte
+	Status        string
+	Attempts      int
+	LastError     *string
+	BitrixID      *int64
+	ContactID     *int64
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	ProcessedAt   *time.Time
+}
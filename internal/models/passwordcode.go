@@ -2,9 +2,11 @@ package models
 
 import "time"
 
+// PasswordCode одноразовый код восстановления пароля. Хранится только bcrypt-хеш кода.
 type PasswordCode struct {
 	ID        int
 	UserID    int64
-	Code      string
+	CodeHash  string
+	Attempts  int
 	ExpiresAt time.Time
 }
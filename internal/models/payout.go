@@ -0,0 +1,57 @@
+package models
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
+// Статусы заявки на выплату: requested → approved или rejected, approved → paid или rejected.
+// Партнёр может отменить заявку, пока её не рассмотрели.
+const (
+	PayoutStatusRequested = "requested"
+	PayoutStatusApproved  = "approved"
+	PayoutStatusRejected  = "rejected"
+	PayoutStatusPaid      = "paid"
+	PayoutStatusCancelled = "cancelled"
+)
+
+// Способы выплаты
+const (
+	PayoutMethodCard        = "card"
+	PayoutMethodSBP         = "sbp"
+	PayoutMethodBankAccount = "bank_account"
+)
+
+// PayoutRequest Details зашифрованные реквизиты, DetailsMask их безопасная часть для списков
+type PayoutRequest struct {
+	ID          int64
+	UserID      int64
+	Amount      money.Money
+	Method      string
+	Details     []byte
+	DetailsMask string
+	Status      string
+	ReviewedBy  *int64
+	ReviewedAt  *time.Time
+	PaidAt      *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// PayoutRequestEvent смена статуса заявки. AuthorID nil, если статус сменила система.
+type PayoutRequestEvent struct {
+	ID        int64
+	RequestID int64
+	Status    string
+	Comment   string
+	AuthorID  *int64
+	CreatedAt time.Time
+}
+
+// PayoutFilter условия поиска заявок. Пустые поля не фильтруют.
+type PayoutFilter struct {
+	UserID *int64
+	Status *string
+	Limit  int64
+	Offset int64
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PhoneCode код из SMS для подтверждения нового номера. В БД хранится только хеш кода.
+type PhoneCode struct {
+	ID          int
+	UserID      int64
+	PhoneNumber string
+	CodeHash    string
+	Attempts    int
+	ExpiresAt   time.Time
+}
@@ -1,12 +1,15 @@
 package models
 
-import "time"
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
 
 type Referral struct {
 	ID           int64
 	UserID       int64
 	ReferralCode string
-	Cost         float64
+	Cost         money.Money
 	CreatedAt    time.Time
 	Active       bool
 }
@@ -15,3 +18,36 @@ type ReferralAndUser struct {
 	Referral Referral
 	User     User
 }
+
+// ReferralAncestor партнёр, пригласивший пользователя напрямую (Level 1) или через других.
+// JoinedAt момент, когда пользователь зарегистрировался по коду своего пригласившего.
+type ReferralAncestor struct {
+	UserID   int64
+	Level    int
+	JoinedAt time.Time
+}
+
+// ReferralNode партнёр в дереве приглашённых. ParentID пригласивший его партнёр.
+type ReferralNode struct {
+	UserID   int64
+	ParentID int64
+	Level    int
+	Name     string
+	City     string
+	Active   bool
+	JoinedAt time.Time
+}
+
+// ReferralCommission процент партнёру UserID с вознаграждения за заявку SourceUserID, который находится
+// на Level уровней ниже в дереве приглашённых
+type ReferralCommission struct {
+	ID           int64
+	LeadID       int64
+	UserID       int64
+	SourceUserID int64
+	Level        int
+	Percent      float64
+	Amount       money.Money
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"time"
+)
+
+// Услуги, за которые начисляется вознаграждение
+const (
+	RewardServiceInternet = "internet"
+	RewardServiceCleaning = "cleaning"
+	RewardServiceShipping = "shipping"
+	RewardServiceReferral = "referral"
+)
+
+// DefaultPartnerTier уровень новых партнёров
+const DefaultPartnerTier = "base"
+
+// RewardRule вознаграждение за услугу. City и Tier nil подходят для любого города и уровня,
+// ValidTo nil действует бессрочно. Из подходящих правил выбирается самое точное.
+type RewardRule struct {
+	ID        int64
+	Service   string
+	City      *string
+	Tier      *string
+	Amount    money.Money
+	ValidFrom time.Time
+	ValidTo   *time.Time
+	CreatedBy *int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SchedulerJob результат последнего запуска фоновой задачи
+type SchedulerJob struct {
+	Name           string
+	Spec           string
+	LastStartedAt  *time.Time
+	LastFinishedAt *time.Time
+	LastDuration   *time.Duration
+	LastError      *string
+}
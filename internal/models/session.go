@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session сессия пользователя на одном устройстве. Хранится хеш текущего refresh-токена,
+// при каждом обновлении токен меняется.
+type Session struct {
+	ID         string
+	UserID     int64
+	TokenHash  string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
@@ -1,7 +0,0 @@
-package models
-
-type Token struct {
-	ID           int
-	UserID       int
-	RefreshToken string
-}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// TOTP секрет второго фактора. Пока EnabledAt пуст, пользователь не подтвердил подключение.
+// LastStep последний принятый шаг, чтобы один код нельзя было использовать дважды.
+type TOTP struct {
+	UserID    int64
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  int64
+}
@@ -18,4 +18,19 @@ type User struct {
 	CreatedAt    time.Time
 	Roles        pq.StringArray
 	IsActive     bool
+	BannedAt     *time.Time
+	Tier         string
+}
+
+// UserFilter условия поиска пользователей. Пустые поля не фильтруют.
+type UserFilter struct {
+	City        *string
+	Role        *string
+	IsActive    *bool
+	IsBanned    *bool
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Search      *string
+	Limit       int64
+	Offset      int64
 }
@@ -0,0 +1,412 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/audit"
+	"ia-online-golang/internal/services/auth"
+	"ia-online-golang/internal/services/user"
+	"ia-online-golang/internal/storage"
+	"ia-online-golang/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxUsersLimit больше пользователей за один запрос не отдаётся
+const maxUsersLimit = 100
+
+type AdminService struct {
+	log             *logrus.Logger
+	UserRepository  storage.UserRepositoryI
+	TokenRepository storage.TokenRepositoryI
+	AuthService     auth.AuthServiceI
+	AuditService    audit.AuditServiceI
+}
+
+type AdminServiceI interface {
+	Users(ctx context.Context, filterDTO dto.UserFilterDTO) (dto.UserPageDTO, error)
+	User(ctx context.Context, userID int64) (dto.AdminUserDTO, error)
+	UpdateRoles(ctx context.Context, userID int64, roles []string) error
+	UpdateTier(ctx context.Context, userID int64, tier string) error
+	SetActive(ctx context.Context, userID int64, isActive bool) error
+	Ban(ctx context.Context, userID int64, reason string) error
+	Unban(ctx context.Context, userID int64) error
+	ResendActivation(ctx context.Context, userID int64) error
+	Logout(ctx context.Context, userID int64) error
+	DeleteUser(ctx context.Context, userID int64) error
+}
+
+var (
+	ErrSelfAction        = errors.New("action not allowed on own account")
+	ErrNotEnoughRights   = errors.New("not enough rights")
+	ErrUserAlreadyActive = errors.New("user already active")
+	ErrUserHasRelations  = errors.New("user has related data")
+	ErrUserAlreadyBanned = errors.New("user already banned")
+	ErrUserIsNotBanned   = errors.New("user is not banned")
+)
+
+func New(
+	log *logrus.Logger,
+	userRepo storage.UserRepositoryI,
+	tokenRepo storage.TokenRepositoryI,
+	authService auth.AuthServiceI,
+	auditService audit.AuditServiceI,
+) *AdminService {
+	return &AdminService{
+		log:             log,
+		UserRepository:  userRepo,
+		TokenRepository: tokenRepo,
+		AuthService:     authService,
+		AuditService:    auditService,
+	}
+}
+
+// Users ищет пользователей по фильтру. Дата окончания периода включительная.
+func (a *AdminService) Users(ctx context.Context, filterDTO dto.UserFilterDTO) (dto.UserPageDTO, error) {
+	op := "AdminService.Users"
+
+	limit := filterDTO.Limit
+	if limit <= 0 || limit > maxUsersLimit {
+		limit = maxUsersLimit
+	}
+
+	filter := models.UserFilter{
+		City:        filterDTO.City,
+		Role:        filterDTO.Role,
+		IsActive:    filterDTO.IsActive,
+		IsBanned:    filterDTO.IsBanned,
+		CreatedFrom: filterDTO.CreatedFrom,
+		Search:      filterDTO.Search,
+		Limit:       limit,
+		Offset:      filterDTO.Offset,
+	}
+	if filterDTO.CreatedTo != nil {
+		createdTo := filterDTO.CreatedTo.AddDate(0, 0, 1)
+		filter.CreatedTo = &createdTo
+	}
+
+	users, total, err := a.UserRepository.SearchUsers(ctx, filter)
+	if err != nil {
+		return dto.UserPageDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := dto.UserPageDTO{
+		Users:  make([]dto.AdminUserDTO, 0, len(users)),
+		Total:  total,
+		Limit:  limit,
+		Offset: filterDTO.Offset,
+	}
+	for _, u := range users {
+		page.Users = append(page.Users, userToAdminDTO(u))
+	}
+
+	return page, nil
+}
+
+func (a *AdminService) User(ctx context.Context, userID int64) (dto.AdminUserDTO, error) {
+	op := "AdminService.User"
+
+	target, err := a.userByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return dto.AdminUserDTO{}, err
+		}
+
+		return dto.AdminUserDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userToAdminDTO(target), nil
+}
+
+// UpdateRoles заменяет роли пользователя. Сессии завершаются, чтобы новые роли попали в токены сразу.
+func (a *AdminService) UpdateRoles(ctx context.Context, userID int64, roles []string) error {
+	op := "AdminService.UpdateRoles"
+
+	target, err := a.target(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	// Смена ролей сохраняется только вместе с записью в журнале
+	auditEvent, err := a.AuditService.Prepare(ctx, audit.Event{
+		Action:     audit.ActionUserRolesChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Before:     map[string]any{"roles": []string(target.Roles)},
+		After:      map[string]any{"roles": roles},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.UserRepository.UpdateUserRoles(ctx, userID, roles, auditEvent); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.TokenRepository.RevokeUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdateTier меняет уровень партнёра. Новый уровень действует для заявок, созданных после изменения.
+func (a *AdminService) UpdateTier(ctx context.Context, userID int64, tier string) error {
+	op := "AdminService.UpdateTier"
+
+	target, err := a.target(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+	if target.Tier == tier {
+		return nil
+	}
+
+	if err := a.UserRepository.UpdateUserTier(ctx, userID, tier); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionUserTierChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Before:     map[string]any{"tier": target.Tier},
+		After:      map[string]any{"tier": tier},
+	})
+
+	return nil
+}
+
+// SetActive меняет признак подтверждённой почты. Деактивированный пользователь при входе
+// снова получит письмо со ссылкой активации.
+func (a *AdminService) SetActive(ctx context.Context, userID int64, isActive bool) error {
+	op := "AdminService.SetActive"
+
+	target, err := a.target(ctx, userID, !isActive)
+	if err != nil {
+		return err
+	}
+
+	if err := a.UserRepository.UpdateActiveUser(ctx, userID, isActive); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	action := audit.ActionUserActivated
+	if !isActive {
+		action = audit.ActionUserDeactivated
+
+		if err := a.TokenRepository.RevokeUserSessions(ctx, userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Before:     map[string]any{"is_active": target.IsActive},
+		After:      map[string]any{"is_active": isActive},
+	})
+
+	return nil
+}
+
+// Ban блокирует вход, обновление токенов и API-ключи пользователя
+func (a *AdminService) Ban(ctx context.Context, userID int64, reason string) error {
+	op := "AdminService.Ban"
+
+	target, err := a.target(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+	if target.BannedAt != nil {
+		return ErrUserAlreadyBanned
+	}
+
+	now := time.Now()
+	if err := a.UserRepository.UpdateBannedUser(ctx, userID, &now); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.TokenRepository.RevokeUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionUserBanned,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Before:     map[string]any{"banned_at": nil},
+		After:      map[string]any{"banned_at": now},
+		Details:    map[string]any{"reason": reason},
+	})
+
+	return nil
+}
+
+func (a *AdminService) Unban(ctx context.Context, userID int64) error {
+	op := "AdminService.Unban"
+
+	target, err := a.target(ctx, userID, false)
+	if err != nil {
+		return err
+	}
+	if target.BannedAt == nil {
+		return ErrUserIsNotBanned
+	}
+
+	if err := a.UserRepository.UpdateBannedUser(ctx, userID, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionUserUnbanned,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Before:     map[string]any{"banned_at": target.BannedAt},
+		After:      map[string]any{"banned_at": nil},
+	})
+
+	return nil
+}
+
+func (a *AdminService) ResendActivation(ctx context.Context, userID int64) error {
+	op := "AdminService.ResendActivation"
+
+	target, err := a.target(ctx, userID, false)
+	if err != nil {
+		return err
+	}
+	if target.IsActive {
+		return ErrUserAlreadyActive
+	}
+
+	if err := a.AuthService.SendActivationLink(ctx, userID, target.Email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionUserActivationSent,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+	})
+
+	return nil
+}
+
+// Logout завершает все сессии пользователя. Выданные access-токены перестают приниматься через SessionCacheTTL.
+func (a *AdminService) Logout(ctx context.Context, userID int64) error {
+	op := "AdminService.Logout"
+
+	if _, err := a.target(ctx, userID, false); err != nil {
+		return err
+	}
+
+	if err := a.TokenRepository.RevokeUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionUserSessionsRevoked,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+	})
+
+	return nil
+}
+
+// DeleteUser удаляет пользователя без заявок, рефералов и комментариев, например ошибочную регистрацию
+func (a *AdminService) DeleteUser(ctx context.Context, userID int64) error {
+	op := "AdminService.DeleteUser"
+
+	target, err := a.target(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	if err := a.UserRepository.DeleteUser(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserHasRelations) {
+			return ErrUserHasRelations
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return user.ErrUserNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Пользователя больше нет, поэтому сохраняем в журнале, кто это был
+	a.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionUserDeleted,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Before:     map[string]any{"email": target.Email, "phone_number": target.PhoneNumber},
+	})
+
+	return nil
+}
+
+// target загружает пользователя, над которым выполняется действие, и проверяет права.
+// Менеджер управляет только партнёрами, аккаунты менеджеров и админов меняет админ.
+// Если selfForbidden, действие нельзя выполнить над собой, чтобы не потерять доступ.
+func (a *AdminService) target(ctx context.Context, userID int64, selfForbidden bool) (models.User, error) {
+	op := "AdminService.target"
+
+	actorID, _ := ctx.Value(context_keys.UserIDKey).(int64)
+	if selfForbidden && actorID == userID {
+		return models.User{}, ErrSelfAction
+	}
+
+	target, err := a.userByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return models.User{}, err
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	actorRoles, _ := ctx.Value(context_keys.UserRoleKey).([]string)
+	if !utils.Contains(actorRoles, "admin") &&
+		(utils.Contains(target.Roles, "manager") || utils.Contains(target.Roles, "admin")) {
+		return models.User{}, ErrNotEnoughRights
+	}
+
+	return target, nil
+}
+
+func (a *AdminService) userByID(ctx context.Context, userID int64) (models.User, error) {
+	target, err := a.UserRepository.UserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, user.ErrUserNotFound
+		}
+
+		return models.User{}, err
+	}
+
+	return target, nil
+}
+
+func userToAdminDTO(u models.User) dto.AdminUserDTO {
+	return dto.AdminUserDTO{
+		ID:           u.ID,
+		Email:        u.Email,
+		Name:         u.Name,
+		PhoneNumber:  u.PhoneNumber,
+		Telegram:     u.Telegram,
+		City:         u.City,
+		ReferralCode: u.ReferralCode,
+		Roles:        u.Roles,
+		Tier:         u.Tier,
+		IsActive:     u.IsActive,
+		CreatedAt:    u.CreatedAt,
+		BannedAt:     u.BannedAt,
+	}
+}
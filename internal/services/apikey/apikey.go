@@ -0,0 +1,208 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/storage"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// keyPrefix помогает узнать ключ в логах и сканерах утечек
+	keyPrefix = "iak_"
+	// visiblePrefixLength сколько первых символов ключа хранится открыто для списка ключей
+	visiblePrefixLength = 12
+
+	ScopeLeadsRead  = "leads:read"
+	ScopeLeadsWrite = "leads:write"
+)
+
+type APIKeyService struct {
+	log              *logrus.Logger
+	APIKeyRepository storage.APIKeyRepositoryI
+	UserRepository   storage.UserRepositoryI
+}
+
+type APIKeyServiceI interface {
+	CreateAPIKey(ctx context.Context, userID int64, createDTO dto.CreateAPIKeyDTO) (dto.CreatedAPIKeyDTO, error)
+	APIKeys(ctx context.Context, userID int64) ([]dto.APIKeyDTO, error)
+	RevokeAPIKey(ctx context.Context, userID int64, id string) error
+	Authenticate(ctx context.Context, key string) (Principal, error)
+}
+
+// Principal от чьего имени и с какими правами выполняется запрос по ключу
+type Principal struct {
+	UserID int64
+	Roles  []string
+	Scopes []string
+}
+
+var (
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKey       = errors.New("api key is invalid")
+	ErrAPIKeyExpiresInPast = errors.New("api key expiration is in the past")
+)
+
+func New(log *logrus.Logger, apiKeyRepository storage.APIKeyRepositoryI, userRepository storage.UserRepositoryI) *APIKeyService {
+	return &APIKeyService{
+		log:              log,
+		APIKeyRepository: apiKeyRepository,
+		UserRepository:   userRepository,
+	}
+}
+
+// CreateAPIKey выпускает ключ. Ключ целиком возвращается только здесь, в БД сохраняется хеш.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, userID int64, createDTO dto.CreateAPIKeyDTO) (dto.CreatedAPIKeyDTO, error) {
+	op := "APIKeyService.CreateAPIKey"
+
+	now := time.Now()
+	if createDTO.ExpiresAt != nil && !createDTO.ExpiresAt.After(now) {
+		return dto.CreatedAPIKeyDTO{}, ErrAPIKeyExpiresInPast
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return dto.CreatedAPIKeyDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      createDTO.Name,
+		Prefix:    key[:visiblePrefixLength],
+		KeyHash:   hashKey(key),
+		Scopes:    uniqueScopes(createDTO.Scopes),
+		CreatedAt: now,
+		ExpiresAt: createDTO.ExpiresAt,
+	}
+
+	if err := s.APIKeyRepository.SaveAPIKey(ctx, apiKey); err != nil {
+		return dto.CreatedAPIKeyDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Infof("%s: api key %s created for user %d", op, apiKey.ID, userID)
+
+	return dto.CreatedAPIKeyDTO{APIKeyDTO: apiKeyToDTO(apiKey), Key: key}, nil
+}
+
+func (s *APIKeyService) APIKeys(ctx context.Context, userID int64) ([]dto.APIKeyDTO, error) {
+	op := "APIKeyService.APIKeys"
+
+	keys, err := s.APIKeyRepository.UserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result := make([]dto.APIKeyDTO, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, apiKeyToDTO(key))
+	}
+
+	return result, nil
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, userID int64, id string) error {
+	op := "APIKeyService.RevokeAPIKey"
+
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrAPIKeyNotFound
+	}
+
+	if err := s.APIKeyRepository.RevokeAPIKey(ctx, userID, id); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return ErrAPIKeyNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Authenticate проверяет ключ из запроса. Роли берутся из БД, поэтому снятие роли сразу действует и на ключи.
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (Principal, error) {
+	op := "APIKeyService.Authenticate"
+
+	if !strings.HasPrefix(key, keyPrefix) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.APIKeyRepository.APIKeyByHash(ctx, hashKey(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return Principal{}, ErrInvalidAPIKey
+		}
+
+		return Principal{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now())) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	user, err := s.UserRepository.UserById(ctx, apiKey.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return Principal{}, ErrInvalidAPIKey
+		}
+
+		return Principal{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !user.IsActive || user.BannedAt != nil {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	// Время использования справочное, ошибка записи не должна отклонять запрос
+	if err := s.APIKeyRepository.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		s.log.Errorf("%s: %v", op, err)
+	}
+
+	return Principal{
+		UserID: apiKey.UserID,
+		Roles:  user.Roles,
+		Scopes: apiKey.Scopes,
+	}, nil
+}
+
+func apiKeyToDTO(key models.APIKey) dto.APIKeyDTO {
+	return dto.APIKeyDTO{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+func uniqueScopes(scopes []string) []string {
+	result := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+
+	return result
+}
+
+// hashKey у ключа 256 бит случайных данных, поэтому достаточно sha256 без соли
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,338 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/storage"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Действия, которые пишутся в журнал
+const (
+	ActionUserRolesChanged    = "user.roles_changed"
+	ActionUserActivated       = "user.activated"
+	ActionUserDeactivated     = "user.deactivated"
+	ActionUserBanned          = "user.banned"
+	ActionUserUnbanned        = "user.unbanned"
+	ActionUserActivationSent  = "user.activation_sent"
+	ActionUserSessionsRevoked = "user.sessions_revoked"
+	ActionUserDeleted         = "user.deleted"
+	ActionUserEmailChanged    = "user.email_changed"
+	ActionUserPhoneChanged    = "user.phone_changed"
+	ActionUserTierChanged     = "user.tier_changed"
+
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionPasswordChanged = "auth.password_changed"
+	ActionPasswordReset   = "auth.password_reset"
+
+	ActionLeadCreated        = "lead.created"
+	ActionLeadWebhookApplied = "lead.webhook_applied"
+	ActionLeadReconciled     = "lead.reconciled"
+	ActionLeadPaid           = "lead.paid"
+	ActionLeadRewardMismatch = "lead.reward_mismatch"
+
+	ActionLedgerPayout     = "ledger.payout"
+	ActionLedgerAdjustment = "ledger.adjustment"
+
+	ActionPayoutRequested     = "payout.requested"
+	ActionPayoutCancelled     = "payout.cancelled"
+	ActionPayoutApproved      = "payout.approved"
+	ActionPayoutRejected      = "payout.rejected"
+	ActionPayoutPaid          = "payout.paid"
+	ActionPayoutDetailsViewed = "payout.details_viewed"
+
+	ActionRewardRuleCreated = "reward_rule.created"
+	ActionRewardRuleUpdated = "reward_rule.updated"
+	ActionRewardRuleDeleted = "reward_rule.deleted"
+)
+
+// Типы объектов, над которыми выполняются действия
+const (
+	TargetUser = "user"
+	TargetLead = "lead"
+
+	TargetPayoutRequest = "payout_request"
+	TargetRewardRule    = "reward_rule"
+)
+
+const (
+	// maxEventsLimit больше событий за один запрос не отдаётся
+	maxEventsLimit = 100
+	// maxExportEvents ограничивает выгрузку, чтобы случайный запрос без фильтров не выгружал весь журнал
+	maxExportEvents = 100000
+)
+
+// Event событие для журнала. Before и After сравниваются, в журнал попадают только изменившиеся поля.
+// Если ActorID не задан, автор берётся из контекста запроса, без него событие считается системным.
+type Event struct {
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+	Details    any
+}
+
+type AuditService struct {
+	log             *logrus.Logger
+	AuditRepository storage.AuditRepositoryI
+}
+
+type AuditServiceI interface {
+	Record(ctx context.Context, event Event) error
+	Log(ctx context.Context, event Event)
+	Prepare(ctx context.Context, event Event) (models.AuditEvent, error)
+	Events(ctx context.Context, filterDTO dto.AuditFilterDTO) (dto.AuditPageDTO, error)
+	ExportCSV(ctx context.Context, filterDTO dto.AuditFilterDTO, w io.Writer) error
+}
+
+func New(log *logrus.Logger, auditRepository storage.AuditRepositoryI) *AuditService {
+	return &AuditService{
+		log:             log,
+		AuditRepository: auditRepository,
+	}
+}
+
+// Record пишет событие в журнал вместе с IP и идентификатором запроса из контекста
+func (a *AuditService) Record(ctx context.Context, event Event) error {
+	op := "AuditService.Record"
+
+	auditEvent, err := a.Prepare(ctx, event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.AuditRepository.SaveAuditEvent(ctx, auditEvent); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Infof("%s: %s %s %s by %v", op, event.Action, event.TargetType, event.TargetID, actorOrSystem(auditEvent.ActorID))
+
+	return nil
+}
+
+// Log пишет событие для уже выполненного действия. Действие из-за журнала не откатывается, поэтому ошибка только логируется.
+func (a *AuditService) Log(ctx context.Context, event Event) {
+	if err := a.Record(ctx, event); err != nil {
+		a.log.Errorf("AuditService.Log: %v", err)
+	}
+}
+
+// Prepare собирает запись журнала, не сохраняя её. Действия, которые нельзя выполнить без записи в журнал,
+// передают её в хранилище и сохраняют в своей транзакции.
+func (a *AuditService) Prepare(ctx context.Context, event Event) (models.AuditEvent, error) {
+	op := "AuditService.Prepare"
+
+	auditEvent := models.AuditEvent{
+		ActorID:    event.ActorID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+	}
+
+	if auditEvent.ActorID == nil {
+		if actorID, ok := ctx.Value(context_keys.UserIDKey).(int64); ok {
+			auditEvent.ActorID = &actorID
+		}
+	}
+	auditEvent.IP, _ = ctx.Value(context_keys.ClientIPKey).(string)
+	auditEvent.RequestID, _ = ctx.Value(context_keys.RequestIDKey).(string)
+
+	before, after, err := diff(event.Before, event.After)
+	if err != nil {
+		return models.AuditEvent{}, fmt.Errorf("%s: %w", op, err)
+	}
+	auditEvent.Before, auditEvent.After = before, after
+
+	if event.Details != nil {
+		data, err := json.Marshal(event.Details)
+		if err != nil {
+			return models.AuditEvent{}, fmt.Errorf("%s: %w", op, err)
+		}
+		auditEvent.Details = data
+	}
+
+	return auditEvent, nil
+}
+
+// Events ищет события по фильтру. Дата окончания периода включительная.
+func (a *AuditService) Events(ctx context.Context, filterDTO dto.AuditFilterDTO) (dto.AuditPageDTO, error) {
+	op := "AuditService.Events"
+
+	limit := filterDTO.Limit
+	if limit <= 0 || limit > maxEventsLimit {
+		limit = maxEventsLimit
+	}
+
+	filter := auditFilter(filterDTO)
+	filter.Limit = limit
+	filter.Offset = filterDTO.Offset
+
+	events, total, err := a.AuditRepository.AuditEvents(ctx, filter)
+	if err != nil {
+		return dto.AuditPageDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := dto.AuditPageDTO{
+		Events: make([]dto.AuditEventDTO, 0, len(events)),
+		Total:  total,
+		Limit:  limit,
+		Offset: filterDTO.Offset,
+	}
+	for _, event := range events {
+		page.Events = append(page.Events, eventToDTO(event))
+	}
+
+	return page, nil
+}
+
+// ExportCSV пишет события по фильтру в CSV. Пагинация фильтра не учитывается.
+func (a *AuditService) ExportCSV(ctx context.Context, filterDTO dto.AuditFilterDTO, w io.Writer) error {
+	op := "AuditService.ExportCSV"
+
+	filter := auditFilter(filterDTO)
+	filter.Limit = maxExportEvents
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{
+		"id", "created_at", "actor_id", "action", "target_type", "target_id",
+		"ip", "request_id", "before", "after", "details",
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err := a.AuditRepository.EachAuditEvent(ctx, filter, func(event models.AuditEvent) error {
+		actorID := ""
+		if event.ActorID != nil {
+			actorID = strconv.FormatInt(*event.ActorID, 10)
+		}
+
+		return writer.Write([]string{
+			strconv.FormatInt(event.ID, 10),
+			event.CreatedAt.Format(time.RFC3339),
+			actorID,
+			csvSafe(event.Action),
+			csvSafe(event.TargetType),
+			csvSafe(event.TargetID),
+			csvSafe(event.IP),
+			csvSafe(event.RequestID),
+			csvSafe(string(event.Before)),
+			csvSafe(string(event.After)),
+			csvSafe(string(event.Details)),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func auditFilter(filterDTO dto.AuditFilterDTO) models.AuditFilter {
+	filter := models.AuditFilter{
+		ActorID:    filterDTO.ActorID,
+		Action:     filterDTO.Action,
+		TargetType: filterDTO.TargetType,
+		TargetID:   filterDTO.TargetID,
+		RequestID:  filterDTO.RequestID,
+		From:       filterDTO.From,
+	}
+	if filterDTO.To != nil {
+		to := filterDTO.To.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	return filter
+}
+
+// diff оставляет в состояниях до и после только отличающиеся поля верхнего уровня.
+// Если одно из состояний не объект, оба сохраняются целиком.
+func diff(before, after any) (json.RawMessage, json.RawMessage, error) {
+	beforeData, err := marshalState(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterData, err := marshalState(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var beforeFields, afterFields map[string]json.RawMessage
+	if json.Unmarshal(beforeData, &beforeFields) != nil || json.Unmarshal(afterData, &afterFields) != nil ||
+		beforeFields == nil || afterFields == nil {
+		return beforeData, afterData, nil
+	}
+
+	for key, value := range beforeFields {
+		if other, ok := afterFields[key]; ok && bytes.Equal(value, other) {
+			delete(beforeFields, key)
+			delete(afterFields, key)
+		}
+	}
+
+	beforeData, err = json.Marshal(beforeFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterData, err = json.Marshal(afterFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return beforeData, afterData, nil
+}
+
+func marshalState(state any) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+// csvSafe экранирует значения, которые табличный редактор принял бы за формулу
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
+
+func eventToDTO(event models.AuditEvent) dto.AuditEventDTO {
+	return dto.AuditEventDTO{
+		ID:         event.ID,
+		ActorID:    event.ActorID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Before:     event.Before,
+		After:      event.After,
+		Details:    event.Details,
+		IP:         event.IP,
+		RequestID:  event.RequestID,
+		CreatedAt:  event.CreatedAt,
+	}
+}
+
+func actorOrSystem(actorID *int64) any {
+	if actorID == nil {
+		return "system"
+	}
+	return *actorID
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/services/audit"
 	"ia-online-golang/internal/services/email"
 	"ia-online-golang/internal/services/passwordcode"
+	"ia-online-golang/internal/services/ratelimit"
 	"ia-online-golang/internal/services/token"
+	"ia-online-golang/internal/services/twofactor"
 	UserService "ia-online-golang/internal/services/user"
 	"ia-online-golang/internal/utils"
 
@@ -32,14 +37,22 @@ type AuthService struct {
 	EmailService             email.EmailServiceI
 	UserService              UserService.UserServiceI
 	PasswordCodeService      passwordcode.PasswordCodeServiceI
+	RateLimitService         ratelimit.RateLimitServiceI
+	TwoFactorService         twofactor.TwoFactorServiceI
+	AuditService             audit.AuditServiceI
 }
 
 type AuthServiceI interface {
 	RegistrationUser(ctx context.Context, registerDTO dto.RegisterUserDTO) (dto.AuthTokensDTO, error)
 	ActivationUser(ctx context.Context, activation_id string) error
-	LoginUser(ctx context.Context, loginDTO dto.LoginUserDTO) (dto.AuthTokensDTO, error)
+	LoginUser(ctx context.Context, loginDTO dto.LoginUserDTO) (dto.LoginResultDTO, error)
+	VerifyTwoFactor(ctx context.Context, verifyDTO dto.TwoFactorVerifyDTO) (dto.AuthTokensDTO, error)
+	EnrollTwoFactor(ctx context.Context, challengeToken string) (dto.TOTPEnrollmentDTO, error)
+	ConfirmTwoFactor(ctx context.Context, verifyDTO dto.TwoFactorVerifyDTO) (dto.TwoFactorEnabledDTO, error)
 	LogoutUser(ctx context.Context, refreshToken string) error
 	RefreshUserTokens(ctx context.Context, refresh_token string) (dto.AuthTokensDTO, error)
+	Sessions(ctx context.Context) ([]dto.SessionDTO, error)
+	RevokeSession(ctx context.Context, sessionID string) error
 	SendActivationLink(ctx context.Context, userID int64, email string) error
 	ChangingPassword(ctx context.Context, newPasswordDTO dto.NewPasswordDTO, userID int64) error
 	RecoverPassword(ctx context.Context, email string) error
@@ -62,7 +75,9 @@ func New(
 	emailService email.EmailServiceI,
 	userService UserService.UserServiceI,
 	passwordCodeService passwordcode.PasswordCodeServiceI,
-
+	rateLimitService ratelimit.RateLimitServiceI,
+	twoFactorService twofactor.TwoFactorServiceI,
+	auditService audit.AuditServiceI,
 ) *AuthService {
 	return &AuthService{
 		log:                      log,
@@ -74,6 +89,10 @@ func New(
 		TokenService:             tokenService,
 		EmailService:             emailService,
 		UserService:              userService,
+		PasswordCodeService:      passwordCodeService,
+		RateLimitService:         rateLimitService,
+		TwoFactorService:         twoFactorService,
+		AuditService:             auditService,
 	}
 }
 
@@ -149,27 +168,50 @@ func (a *AuthService) RegistrationUser(ctx context.Context, registerDTO dto.Regi
 	return tokens, nil
 }
 
-func (a *AuthService) LoginUser(ctx context.Context, loginDTO dto.LoginUserDTO) (dto.AuthTokensDTO, error) {
+// LoginUser проверяет пароль. Если у пользователя подключён второй фактор или его роль требует 2FA,
+// вместо токенов возвращается challenge-токен, который обменивается на токены в VerifyTwoFactor.
+func (a *AuthService) LoginUser(ctx context.Context, loginDTO dto.LoginUserDTO) (dto.LoginResultDTO, error) {
 	const op = "AuthService.LoginUser"
 
+	// Проверяем блокировку до пароля, иначе перебор продолжится и во время блокировки
+	if err := a.RateLimitService.AllowLogin(ctx, loginDTO.Email); err != nil {
+		return dto.LoginResultDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
 	user, err := a.UserRepository.UserByEmail(ctx, loginDTO.Email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			a.log.Error(err)
 
-			return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, UserService.ErrUserNotFound)
+			return dto.LoginResultDTO{}, fmt.Errorf("%s: %w", op, UserService.ErrUserNotFound)
 		}
 
 		a.log.Error(err)
 
-		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
+		return dto.LoginResultDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginDTO.Password))
 	if err != nil {
 		a.log.Error(err)
 
-		return dto.AuthTokensDTO{}, ErrIncorrectPassword
+		a.AuditService.Log(ctx, audit.Event{
+			ActorID:    &user.ID,
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   strconv.FormatInt(user.ID, 10),
+			Details:    map[string]any{"reason": "incorrect_password"},
+		})
+
+		return dto.LoginResultDTO{}, ErrIncorrectPassword
+	}
+
+	if err := a.RateLimitService.ResetLogin(ctx, loginDTO.Email); err != nil {
+		a.log.Errorf("%s: %v", op, err)
+	}
+
+	if user.BannedAt != nil {
+		return dto.LoginResultDTO{}, UserService.ErrUserBanned
 	}
 
 	if !user.IsActive {
@@ -179,10 +221,30 @@ func (a *AuthService) LoginUser(ctx context.Context, loginDTO dto.LoginUserDTO)
 		if err != nil {
 			a.log.Error(err)
 
-			return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
+			return dto.LoginResultDTO{}, fmt.Errorf("%s: %w", op, err)
 		}
 
-		return dto.AuthTokensDTO{}, UserService.ErrUserNotActivated
+		return dto.LoginResultDTO{}, UserService.ErrUserNotActivated
+	}
+
+	enabled, err := a.TwoFactorService.Enabled(ctx, user.ID)
+	if err != nil {
+		return dto.LoginResultDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if enabled || a.TwoFactorService.Required(user.Roles) {
+		enrollment := !enabled
+
+		challengeToken, err := a.TokenService.CreateChallengeToken(ctx, user.ID, enrollment)
+		if err != nil {
+			return dto.LoginResultDTO{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return dto.LoginResultDTO{Challenge: &dto.TwoFactorChallengeDTO{
+			ChallengeToken:     challengeToken,
+			ExpiresIn:          a.TokenService.ChallengeTTL(),
+			EnrollmentRequired: enrollment,
+		}}, nil
 	}
 
 	userDTO := utils.UserToDTO(user)
@@ -191,12 +253,191 @@ func (a *AuthService) LoginUser(ctx context.Context, loginDTO dto.LoginUserDTO)
 	if err != nil {
 		a.log.Error(err)
 
+		return dto.LoginResultDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		ActorID:    &user.ID,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		Details:    map[string]any{"two_factor": false},
+	})
+
+	return dto.LoginResultDTO{Tokens: &tokens}, nil
+}
+
+// VerifyTwoFactor обменивает challenge-токен и код второго фактора на токены
+func (a *AuthService) VerifyTwoFactor(ctx context.Context, verifyDTO dto.TwoFactorVerifyDTO) (dto.AuthTokensDTO, error) {
+	const op = "AuthService.VerifyTwoFactor"
+
+	challenge, err := a.TokenService.ValidateChallengeToken(ctx, verifyDTO.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidChallengeToken) {
+			return dto.AuthTokensDTO{}, token.ErrInvalidChallengeToken
+		}
+
+		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.allowChallenge(ctx, challenge); err != nil {
+		return dto.AuthTokensDTO{}, err
+	}
+
+	// Шесть цифр перебираются быстро, поэтому неверные коды блокируют так же, как неверные пароли
+	account := twoFactorAccount(challenge.UserID)
+	if err := a.RateLimitService.AllowLogin(ctx, account); err != nil {
+		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.TwoFactorService.Verify(ctx, challenge.UserID, verifyDTO.Code)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrTwoFactorCodeIncorrect) {
+			a.AuditService.Log(ctx, audit.Event{
+				ActorID:    &challenge.UserID,
+				Action:     audit.ActionLoginFailed,
+				TargetType: audit.TargetUser,
+				TargetID:   strconv.FormatInt(challenge.UserID, 10),
+				Details:    map[string]any{"reason": "two_factor_code_incorrect"},
+			})
+
+			return dto.AuthTokensDTO{}, err
+		}
+		if errors.Is(err, twofactor.ErrTwoFactorNotEnabled) {
+			return dto.AuthTokensDTO{}, err
+		}
+
+		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.RateLimitService.ResetLogin(ctx, account); err != nil {
+		a.log.Errorf("%s: %v", op, err)
+	}
+
+	tokens, err := a.TokenService.CreateUserTokens(ctx, challenge.UserID)
+	if err != nil {
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	a.AuditService.Log(ctx, audit.Event{
+		ActorID:    &challenge.UserID,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(challenge.UserID, 10),
+		Details:    map[string]any{"two_factor": true},
+	})
+
 	return tokens, nil
 }
 
+// EnrollTwoFactor начинает подключение 2FA при входе, если роль требует второй фактор, а он ещё не подключён
+func (a *AuthService) EnrollTwoFactor(ctx context.Context, challengeToken string) (dto.TOTPEnrollmentDTO, error) {
+	const op = "AuthService.EnrollTwoFactor"
+
+	challenge, err := a.TokenService.ValidateChallengeToken(ctx, challengeToken)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidChallengeToken) {
+			return dto.TOTPEnrollmentDTO{}, token.ErrInvalidChallengeToken
+		}
+
+		return dto.TOTPEnrollmentDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Иначе по паролю можно было бы заменить уже подключённый секрет
+	if !challenge.Enrollment {
+		return dto.TOTPEnrollmentDTO{}, twofactor.ErrTwoFactorAlreadyEnabled
+	}
+
+	enrollment, err := a.TwoFactorService.Enroll(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrTwoFactorAlreadyEnabled) {
+			return dto.TOTPEnrollmentDTO{}, err
+		}
+
+		return dto.TOTPEnrollmentDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return enrollment, nil
+}
+
+// ConfirmTwoFactor завершает подключение 2FA при входе и сразу выдаёт токены
+func (a *AuthService) ConfirmTwoFactor(ctx context.Context, verifyDTO dto.TwoFactorVerifyDTO) (dto.TwoFactorEnabledDTO, error) {
+	const op = "AuthService.ConfirmTwoFactor"
+
+	challenge, err := a.TokenService.ValidateChallengeToken(ctx, verifyDTO.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidChallengeToken) {
+			return dto.TwoFactorEnabledDTO{}, token.ErrInvalidChallengeToken
+		}
+
+		return dto.TwoFactorEnabledDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !challenge.Enrollment {
+		return dto.TwoFactorEnabledDTO{}, twofactor.ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := a.allowChallenge(ctx, challenge); err != nil {
+		return dto.TwoFactorEnabledDTO{}, err
+	}
+
+	account := twoFactorAccount(challenge.UserID)
+	if err := a.RateLimitService.AllowLogin(ctx, account); err != nil {
+		return dto.TwoFactorEnabledDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	codes, err := a.TwoFactorService.Confirm(ctx, challenge.UserID, verifyDTO.Code)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrTwoFactorCodeIncorrect) ||
+			errors.Is(err, twofactor.ErrTwoFactorNotEnrolled) ||
+			errors.Is(err, twofactor.ErrTwoFactorAlreadyEnabled) {
+			return dto.TwoFactorEnabledDTO{}, err
+		}
+
+		return dto.TwoFactorEnabledDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.RateLimitService.ResetLogin(ctx, account); err != nil {
+		a.log.Errorf("%s: %v", op, err)
+	}
+
+	tokens, err := a.TokenService.CreateUserTokens(ctx, challenge.UserID)
+	if err != nil {
+		return dto.TwoFactorEnabledDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		ActorID:    &challenge.UserID,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(challenge.UserID, 10),
+		Details:    map[string]any{"two_factor": true, "enrollment": true},
+	})
+
+	return dto.TwoFactorEnabledDTO{RecoveryCodes: codes, Tokens: &tokens}, nil
+}
+
+// allowChallenge challenge-токен перестаёт действовать после нескольких попыток ввести код,
+// после этого нужно снова войти по паролю
+func (a *AuthService) allowChallenge(ctx context.Context, challenge token.PayloadChallenge) error {
+	if challenge.TokenID == "" {
+		return token.ErrInvalidChallengeToken
+	}
+
+	ttl := time.Duration(a.TokenService.ChallengeTTL()) * time.Second
+	if err := a.RateLimitService.AllowChallenge(ctx, challenge.TokenID, ttl); err != nil {
+		a.log.Infof("AuthService.allowChallenge: attempts exhausted for user %d", challenge.UserID)
+		return token.ErrInvalidChallengeToken
+	}
+
+	return nil
+}
+
+// twoFactorAccount ключ счётчика неверных кодов второго фактора, отдельный от счётчика паролей
+func twoFactorAccount(userID int64) string {
+	return fmt.Sprintf("2fa:%d", userID)
+}
+
 func (a *AuthService) SendActivationLink(ctx context.Context, userID int64, email string) error {
 	op := "AuthService.SendActivationLink"
 
@@ -249,12 +490,12 @@ func (a *AuthService) SendActivationLink(ctx context.Context, userID int64, emai
 }
 
 func (a *AuthService) LogoutUser(ctx context.Context, refreshToken string) error {
-	op := "TokenService.DeleteToken"
+	op := "AuthService.LogoutUser"
 
-	err := a.TokenRepository.DeleteRefreshToken(ctx, refreshToken)
+	err := a.TokenService.RevokeSession(ctx, refreshToken)
 	if err != nil {
-		if errors.Is(err, storage.ErrTokenNotFound) {
-			return token.ErrRefreshTokenNotExists
+		if errors.Is(err, token.ErrInvalidRefreshToken) || errors.Is(err, token.ErrExpiredRefreshToken) {
+			return token.ErrInvalidRefreshToken
 		}
 
 		return fmt.Errorf("%s: %w", op, err)
@@ -275,6 +516,11 @@ func (a *AuthService) ActivationUser(ctx context.Context, activationID string) e
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	// Ссылка смены почты подтверждается в ContactService и не должна активировать аккаунт
+	if activation.NewEmail != nil {
+		return ErrActiveLinkNotExists
+	}
+
 	// Проверяем, не истек ли срок действия активационной ссылки
 	if activation.ExpiresAt.Before(time.Now()) {
 		return ErrActiveLinkExpired
@@ -291,21 +537,18 @@ func (a *AuthService) ActivationUser(ctx context.Context, activationID string) e
 func (a *AuthService) RefreshUserTokens(ctx context.Context, refresh_token string) (dto.AuthTokensDTO, error) {
 	op := "AuthService.RefreshToken"
 
-	// Создаём переменную payload и передаём её в `ValidateRefreshToken`
-	var payload token.PayloadUserRefresh
-	_, err := a.TokenService.ValidateRefreshToken(ctx, refresh_token, &payload)
+	tokens, err := a.TokenService.RotateUserTokens(ctx, refresh_token)
 	if err != nil {
-		if errors.Is(err, token.ErrInvalidRefreshToken) {
+		if errors.Is(err, token.ErrInvalidRefreshToken) || errors.Is(err, token.ErrExpiredRefreshToken) {
 			return dto.AuthTokensDTO{}, token.ErrInvalidRefreshToken
 		}
 		if errors.Is(err, token.ErrRefreshTokenNotExists) {
 			return dto.AuthTokensDTO{}, token.ErrRefreshTokenNotExists
 		}
-		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
-	}
+		if errors.Is(err, token.ErrRefreshTokenReused) {
+			return dto.AuthTokensDTO{}, token.ErrRefreshTokenReused
+		}
 
-	tokens, err := a.TokenService.CreateUserTokens(ctx, payload.UserID)
-	if err != nil {
 		a.log.Error(err)
 
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
@@ -314,6 +557,45 @@ func (a *AuthService) RefreshUserTokens(ctx context.Context, refresh_token strin
 	return tokens, nil
 }
 
+// Sessions возвращает действующие сессии текущего пользователя
+func (a *AuthService) Sessions(ctx context.Context) ([]dto.SessionDTO, error) {
+	op := "AuthService.Sessions"
+
+	userID, ok := ctx.Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		return nil, fmt.Errorf("%s: user id not found in context", op)
+	}
+	sessionID, _ := ctx.Value(context_keys.SessionIDKey).(string)
+
+	sessions, err := a.TokenService.Sessions(ctx, userID, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession завершает одну из сессий текущего пользователя
+func (a *AuthService) RevokeSession(ctx context.Context, sessionID string) error {
+	op := "AuthService.RevokeSession"
+
+	userID, ok := ctx.Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		return fmt.Errorf("%s: user id not found in context", op)
+	}
+
+	err := a.TokenService.RevokeUserSession(ctx, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, token.ErrSessionNotFound) {
+			return token.ErrSessionNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
 func (a *AuthService) ChangingPassword(ctx context.Context, newPasswordDTO dto.NewPasswordDTO, userID int64) error {
 	op := "AuthService.NewPassword"
 
@@ -322,10 +604,19 @@ func (a *AuthService) ChangingPassword(ctx context.Context, newPasswordDTO dto.N
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	// Старый пароль перебирают так же, как при входе, поэтому счётчик общий
+	if err := a.RateLimitService.AllowLogin(ctx, user.Email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(newPasswordDTO.OldPassword)); err != nil {
 		return ErrIncorrectOldPassword
 	}
 
+	if err := a.RateLimitService.ResetLogin(ctx, user.Email); err != nil {
+		a.log.Errorf("%s: %v", op, err)
+	}
+
 	newPassHash, err := bcrypt.GenerateFromPassword([]byte(newPasswordDTO.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -336,59 +627,78 @@ func (a *AuthService) ChangingPassword(ctx context.Context, newPasswordDTO dto.N
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	a.AuditService.Log(ctx, audit.Event{
+		ActorID:    &userID,
+		Action:     audit.ActionPasswordChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+	})
+
 	return nil
 }
 
+// RecoverPassword отправляет код для смены пароля. На неизвестный адрес ответ такой же, как на известный,
+// чтобы не подсказывать, какие адреса зарегистрированы.
 func (a *AuthService) RecoverPassword(ctx context.Context, email string) error {
 	const op = "AuthService.RecoverPassword"
 
+	if err := a.RateLimitService.AllowRecover(ctx, email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	user, err := a.UserRepository.UserByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
-			return UserService.ErrUserNotFound
+			a.log.Infof("%s: password recovery requested for unknown email", op)
+			return nil
 		}
 
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	new_password, err := utils.GeneratePasswordCode(8)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	// Код создаётся и отправляется в фоне: время ответа и ошибка почтового сервера выдавали бы, что адрес зарегистрирован
+	go a.sendPasswordCode(context.WithoutCancel(ctx), user.ID, email)
 
-	new_password_hash, err := bcrypt.GenerateFromPassword([]byte(new_password), bcrypt.DefaultCost)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	return nil
+}
 
-	err = a.UserRepository.UpdatePasswordUser(ctx, string(new_password_hash), user.ID)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+// sendPasswordCode создаёт и отправляет код для смены пароля. Ответ уже отдан, поэтому ошибки только логируются.
+func (a *AuthService) sendPasswordCode(ctx context.Context, userID int64, email string) {
+	const op = "AuthService.sendPasswordCode"
 
-	err = a.EmailService.SendNewPassword(ctx, email, new_password)
+	code, err := a.PasswordCodeService.GeneratePasswordCode(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		a.log.Errorf("%s: user %d: %v", op, userID, err)
+		return
 	}
 
-	return nil
+	if err := a.EmailService.SendPasswordCode(ctx, email, code, a.PasswordCodeService.CodeTTL()); err != nil {
+		a.log.Errorf("%s: user %d: %v", op, userID, err)
+	}
 }
 
+// NewPassword меняет пароль по коду из письма и завершает все сессии пользователя
 func (a *AuthService) NewPassword(ctx context.Context, dto dto.RecoverPasswordDTO) error {
 	op := "AuthService.NewPassword"
 
-	password_code, err := a.PasswordCodeService.PasswordCode(ctx, dto.Code)
+	// Неизвестный адрес отвечает так же, как неверный код, чтобы не подсказывать, какие адреса зарегистрированы
+	user, err := a.UserRepository.UserByEmail(ctx, dto.Email)
 	if err != nil {
-		if errors.Is(err, passwordcode.ErrPasswordCodeIsNotFound) {
-			return passwordcode.ErrPasswordCodeIsNotFound
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return passwordcode.ErrPasswordCodeIncorrect
 		}
 
-		if errors.Is(err, passwordcode.ErrPasswordCodeIncorrect) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.PasswordCodeService.UsePasswordCode(ctx, user.ID, dto.Code)
+	if err != nil {
+		if errors.Is(err, passwordcode.ErrPasswordCodeIsNotFound) || errors.Is(err, passwordcode.ErrPasswordCodeIncorrect) {
 			return passwordcode.ErrPasswordCodeIncorrect
 		}
 
-		if errors.Is(err, passwordcode.ErrPasswordCodeHasExpired) {
-			return passwordcode.ErrPasswordCodeIncorrect
+		if errors.Is(err, passwordcode.ErrPasswordCodeHasExpired) || errors.Is(err, passwordcode.ErrPasswordCodeAttemptsExceeded) {
+			return passwordcode.ErrPasswordCodeHasExpired
 		}
 
 		return fmt.Errorf("%s: %w", op, err)
@@ -399,15 +709,27 @@ func (a *AuthService) NewPassword(ctx context.Context, dto dto.RecoverPasswordDT
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = a.UserRepository.UpdatePasswordUser(ctx, string(newPassHash), password_code.UserID)
+	err = a.UserRepository.UpdatePasswordUser(ctx, string(newPassHash), user.ID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = a.PasswordCodeService.DeleteRefreshToken(ctx, password_code.Code)
+	// Пароль могли сменить из-за утечки, поэтому выходим на всех устройствах
+	err = a.TokenRepository.RevokeUserSessions(ctx, user.ID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := a.RateLimitService.ResetLogin(ctx, user.Email); err != nil {
+		a.log.Errorf("%s: %v", op, err)
+	}
+
+	a.AuditService.Log(ctx, audit.Event{
+		ActorID:    &user.ID,
+		Action:     audit.ActionPasswordReset,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	})
+
 	return nil
 }
@@ -1,34 +1,65 @@
 package bitrix
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
+	"ia-online-golang/internal/config"
 	"ia-online-golang/internal/dto"
-	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 type BitrixService struct {
-	log     *logrus.Logger
-	webhook string
+	log          *logrus.Logger
+	webhook      string
+	client       *http.Client
+	limiter      *rate.Limiter
+	timeout      time.Duration
+	maxRetries   int
+	retryBackoff time.Duration
+	funnelID     string
+	newStage     string
+	dealTitle    string
+	dealTypeID   string
+	services     config.BitrixServicesConfig
+	fields       config.BitrixFieldsConfig
 }
 
 type BitrixServiceI interface {
 	GetLead(ctx context.Context, id_deal int64) (ReturnDataDeal, error)
+	ListDeals(ctx context.Context, start int) (ReturnDataDealList, error)
 	GetComment(ctx context.Context, id_comment int64) (ReturnDataComment, error)
-	SendDeal(ctx context.Context, lead dto.CreateLeadDTO, user dto.UserDTO) (ReturnDataCreate, error)
+	SendDeal(ctx context.Context, lead dto.CreateLeadDTO, user dto.UserDTO, contactID int64, originID string) (ReturnDataCreate, error)
+	DealByOrigin(ctx context.Context, originID string) (int64, error)
 	SendContact(ctx context.Context, dto dto.CreateLeadDTO) (ReturnDataCreate, error)
 	SendComment(ctx context.Context, id_deal int64, comment string) (ReturnDataCreate, error)
+	Ping(ctx context.Context) error
 }
 
-func New(log *logrus.Logger, webhook string) *BitrixService {
+// New создаёт клиент битрикса. Все методы используют общий httpClient и общий лимит запросов.
+func New(log *logrus.Logger, cfg config.BitrixConfig, httpClient *http.Client) *BitrixService {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
 	return &BitrixService{
-		log:     log,
-		webhook: webhook,
+		log:          log,
+		webhook:      cfg.IncomingWebhook,
+		client:       httpClient,
+		limiter:      rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.RateBurst),
+		timeout:      cfg.Timeout,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+		funnelID:     cfg.FunnelID,
+		newStage:     cfg.NewStage,
+		dealTitle:    cfg.DealTitle,
+		dealTypeID:   cfg.DealTypeID,
+		services:     cfg.Services,
+		fields:       cfg.Fields,
 	}
 }
 
@@ -39,34 +70,45 @@ func (b *BitrixService) GetLead(ctx context.Context, id_deal int64) (ReturnDataD
 		"ID": id_deal,
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return ReturnDataDeal{}, fmt.Errorf("%s: %v", op, err)
+	var result ReturnDataDeal
+	if err := b.call(ctx, "crm.deal.get", true, data, &result); err != nil {
+		return ReturnDataDeal{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	url := b.webhook + "crm.deal.get"
+	b.fillPayments(&result.Result)
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return ReturnDataDeal{}, fmt.Errorf("%s: %v", op, err)
-	}
-	defer resp.Body.Close()
+	return result, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ReturnDataDeal{}, fmt.Errorf("%s: %v", op, err)
+// ListDeals возвращает страницу сделок воронки. Следующая страница начинается с Next, на последней Next пустой.
+func (b *BitrixService) ListDeals(ctx context.Context, start int) (ReturnDataDealList, error) {
+	const op = "BitrixService.ListDeals"
+
+	data := map[string]any{
+		"filter": map[string]any{
+			"CATEGORY_ID": b.funnelID,
+		},
+		"select": []string{
+			"ID",
+			"STAGE_ID",
+			"CATEGORY_ID",
+			b.fields.InternetPayment,
+			b.fields.CleaningPayment,
+			b.fields.ShippingPayment,
+		},
+		"order": map[string]string{
+			"ID": "ASC",
+		},
+		"start": start,
 	}
 
-	// Попробуем сначала распарсить как ошибку
-	var errData ErrorData
-	if err := json.Unmarshal(body, &errData); err == nil && errData.Error != "" {
-		return ReturnDataDeal{}, fmt.Errorf("%s: %s - %s", op, errData.Error, errData.ErrorDescription)
+	var result ReturnDataDealList
+	if err := b.call(ctx, "crm.deal.list", true, data, &result); err != nil {
+		return ReturnDataDealList{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Если ошибки нет — пробуем распарсить как успешный ответ
-	var result ReturnDataDeal
-	if err := json.Unmarshal(body, &result); err != nil {
-		return ReturnDataDeal{}, fmt.Errorf("%s: %v", op, err)
+	for i := range result.Result {
+		b.fillPayments(&result.Result[i])
 	}
 
 	return result, nil
@@ -79,34 +121,9 @@ func (b *BitrixService) GetComment(ctx context.Context, id_comment int64) (Retur
 		"ID": id_comment,
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return ReturnDataComment{}, fmt.Errorf("%s: %v", op, err)
-	}
-
-	url := b.webhook + "crm.timeline.comment.get"
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return ReturnDataComment{}, fmt.Errorf("%s: %v", op, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ReturnDataComment{}, fmt.Errorf("%s: %v", op, err)
-	}
-
-	// Попробуем сначала распарсить как ошибку
-	var errData ErrorData
-	if err := json.Unmarshal(body, &errData); err == nil && errData.Error != "" {
-		return ReturnDataComment{}, fmt.Errorf("%s: %s - %s", op, errData.Error, errData.ErrorDescription)
-	}
-
-	// Если ошибки нет — пробуем распарсить как успешный ответ
 	var result ReturnDataComment
-	if err := json.Unmarshal(body, &result); err != nil {
-		return ReturnDataComment{}, fmt.Errorf("%s: %v", op, err)
+	if err := b.call(ctx, "crm.timeline.comment.get", true, data, &result); err != nil {
+		return ReturnDataComment{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return result, nil
@@ -123,107 +140,86 @@ func (b *BitrixService) SendComment(ctx context.Context, id_deal int64, comment
 		},
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
-	}
-
-	url := b.webhook + "crm.timeline.comment.add"
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
-	}
-
-	// Попробуем сначала распарсить как ошибку
-	var errData ErrorData
-	if err := json.Unmarshal(body, &errData); err == nil && errData.Error != "" {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %s - %s", op, errData.Error, errData.ErrorDescription)
-	}
-
-	// Если ошибки нет — пробуем распарсить как успешный ответ
 	var result ReturnDataCreate
-	if err := json.Unmarshal(body, &result); err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
+	if err := b.call(ctx, "crm.timeline.comment.add", false, data, &result); err != nil {
+		return ReturnDataCreate{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return result, nil
 }
 
-func (b *BitrixService) SendDeal(ctx context.Context, lead dto.CreateLeadDTO, user dto.UserDTO) (ReturnDataCreate, error) {
+// SendDeal создаёт сделку с уже созданным контактом. originID записывается в ORIGIN_ID, по нему DealByOrigin
+// находит сделку, если ответ на создание потерялся.
+func (b *BitrixService) SendDeal(ctx context.Context, lead dto.CreateLeadDTO, user dto.UserDTO, contactID int64, originID string) (ReturnDataCreate, error) {
 	op := "BitrixService.SendLead"
 
-	contact, err := b.SendContact(ctx, lead)
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
-	}
-
 	var services []int
 	if lead.IsInternet {
-		services = append(services, 514)
+		services = append(services, b.services.Internet)
 	}
 	if lead.IsCleaning {
-		services = append(services, 510)
+		services = append(services, b.services.Cleaning)
 	}
 	if lead.IsShipping {
-		services = append(services, 512)
+		services = append(services, b.services.Shipping)
 	}
 
 	data := map[string]any{
 		"fields": map[string]any{
-			"TITLE":                 "Заявка с сайта ia-on.ru",
-			"TYPE_ID":               "SALE",
-			"STAGE_ID":              "C42:NEW",
+			"TITLE":                 b.dealTitle,
+			"TYPE_ID":               b.dealTypeID,
+			"STAGE_ID":              b.newStage,
 			"IS_MANUAL_OPPORTUNITY": "Y",
-			"CATEGORY_ID":           42,
-			"CONTACT_ID":            contact.Result,
-			"UF_CRM_1697646751446":  lead.Address,
-			"UF_CRM_1743744405443":  services,
-			"UF_CRM_1697294923031":  lead.Comment,
-			"UF_CRM_1703703644316":  user.City,
-			"UF_CRM_1697357613372":  user.Name,
-			"UF_CRM_1700909419606":  user.PhoneNumber,
-			"UF_CRM_1701035680304":  user.ID,
+			"CATEGORY_ID":           b.funnelID,
+			"CONTACT_ID":            contactID,
+			"ORIGIN_ID":             originID,
+			b.fields.Address:        lead.Address,
+			b.fields.Services:       services,
+			b.fields.Comment:        lead.Comment,
+			b.fields.City:           user.City,
+			b.fields.PartnerName:    user.Name,
+			b.fields.PartnerPhone:   user.PhoneNumber,
+			b.fields.PartnerID:      user.ID,
 		},
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
+	var result ReturnDataCreate
+	if err := b.call(ctx, "crm.deal.add", false, data, &result); err != nil {
+		return ReturnDataCreate{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	url := b.webhook + "crm.deal.add"
+	return result, nil
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
-	}
-	defer resp.Body.Close()
+// DealByOrigin id сделки воронки с данным ORIGIN_ID или 0, если такой нет
+func (b *BitrixService) DealByOrigin(ctx context.Context, originID string) (int64, error) {
+	const op = "BitrixService.DealByOrigin"
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
+	data := map[string]any{
+		"filter": map[string]any{
+			"CATEGORY_ID": b.funnelID,
+			"ORIGIN_ID":   originID,
+		},
+		"select": []string{"ID"},
+		"order": map[string]string{
+			"ID": "ASC",
+		},
 	}
 
-	// Попробуем сначала распарсить как ошибку
-	var errData ErrorData
-	if err := json.Unmarshal(body, &errData); err == nil && errData.Error != "" {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %s - %s", op, errData.Error, errData.ErrorDescription)
+	var result ReturnDataDealList
+	if err := b.call(ctx, "crm.deal.list", true, data, &result); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(result.Result) == 0 {
+		return 0, nil
 	}
 
-	// Если ошибки нет — пробуем распарсить как успешный ответ
-	var result ReturnDataCreate
-	if err := json.Unmarshal(body, &result); err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
+	id, err := strconv.ParseInt(result.Result[0].ID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid deal id %q: %w", op, result.Result[0].ID, err)
 	}
 
-	return result, nil
+	return id, nil
 }
 
 func (b *BitrixService) SendContact(ctx context.Context, dto dto.CreateLeadDTO) (ReturnDataCreate, error) {
@@ -241,35 +237,33 @@ func (b *BitrixService) SendContact(ctx context.Context, dto dto.CreateLeadDTO)
 		},
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
+	var result ReturnDataCreate
+	if err := b.call(ctx, "crm.contact.add", false, data, &result); err != nil {
+		return ReturnDataCreate{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	url := b.webhook + "crm.contact.add"
+	return result, nil
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
-	}
-	defer resp.Body.Close()
+// Ping проверяет доступность вебхука методом profile. Повторов нет: проверка должна отвечать быстро.
+func (b *BitrixService) Ping(ctx context.Context) error {
+	const op = "BitrixService.Ping"
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
+	if err := b.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Попробуем сначала распарсить как ошибку
-	var errData ErrorData
-	if err := json.Unmarshal(body, &errData); err == nil && errData.Error != "" {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %s - %s", op, errData.Error, errData.ErrorDescription)
+	var result map[string]any
+	if err := b.do(ctx, "profile", []byte("{}"), &result); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Если ошибки нет — пробуем распарсить как успешный ответ
-	var result ReturnDataCreate
-	if err := json.Unmarshal(body, &result); err != nil {
-		return ReturnDataCreate{}, fmt.Errorf("%s: %v", op, err)
-	}
+	return nil
+}
 
-	return result, nil
+// fillPayments заполняет суммы выплат по кодам полей из конфига
+func (b *BitrixService) fillPayments(deal *InfoDeal) {
+	deal.InternetPayment = deal.Field(b.fields.InternetPayment)
+	deal.CleaningPayment = deal.Field(b.fields.CleaningPayment)
+	deal.ShippingPayment = deal.Field(b.fields.ShippingPayment)
 }
@@ -0,0 +1,178 @@
+package bitrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/lib/metrics"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Коды ошибок битрикса, после которых имеет смысл повторить запрос
+const (
+	errorQueryLimitExceeded = "QUERY_LIMIT_EXCEEDED"
+	errorInternalServer     = "INTERNAL_SERVER_ERROR"
+)
+
+// maxRetryBackoff предел задержки между повторами, чтобы при большом max_retries запрос не ждал часами
+const maxRetryBackoff = 30 * time.Second
+
+// errNotProcessed битрикс отклонил запрос, не выполняя его: повтор безопасен и для методов, создающих объекты
+var errNotProcessed = errors.New("request not processed")
+
+// call выполняет метод REST API с ограничением частоты и повторами.
+// ErrBitrixRateLimited и ответ 503 повторяются всегда: запрос не был выполнен. Остальные ErrBitrixUnavailable,
+// в том числе таймауты, повторяются только для idempotent методов, чтение которых не создаёт дублей.
+func (b *BitrixService) call(ctx context.Context, method string, idempotent bool, data any, result any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= b.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := b.backoff(attempt)
+
+			// Повтор не успеет выполниться до истечения контекста, возвращаем последнюю ошибку сразу
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				return lastErr
+			}
+
+			b.log.Warnf("BitrixService.%s: attempt %d failed, retry in %s: %v", method, attempt, delay, lastErr)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		// Ждём свободный токен, чтобы не упереться в лимит битрикса
+		if err := b.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		lastErr = b.do(ctx, method, body, result)
+		if lastErr == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !retryable(lastErr, idempotent) {
+			return lastErr
+		}
+	}
+
+	return lastErr
+}
+
+// backoff экспоненциальная задержка перед повтором, не больше maxRetryBackoff
+func (b *BitrixService) backoff(attempt int) time.Duration {
+	delay := b.retryBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+
+	return min(delay, maxRetryBackoff)
+}
+
+func retryable(err error, idempotent bool) bool {
+	switch {
+	case errors.Is(err, ErrBitrixRateLimited), errors.Is(err, errNotProcessed):
+		return true
+	case errors.Is(err, ErrBitrixUnavailable):
+		return idempotent
+	default:
+		return false
+	}
+}
+
+// do выполняет одну попытку запроса и записывает её в метрики
+func (b *BitrixService) do(ctx context.Context, method string, body []byte, result any) error {
+	start := time.Now()
+	err := b.doRequest(ctx, method, body, result)
+
+	outcome := metrics.OutcomeOk
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		outcome = metrics.OutcomeCanceled
+	case errors.Is(err, ErrBitrixRateLimited):
+		outcome = metrics.OutcomeRateLimited
+	case errors.Is(err, ErrBitrixUnavailable):
+		outcome = metrics.OutcomeUnavailable
+	default:
+		outcome = metrics.OutcomeError
+	}
+
+	metrics.BitrixCalls.WithLabelValues(method, outcome).Inc()
+	metrics.BitrixDuration.WithLabelValues(method, outcome).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (b *BitrixService) doRequest(ctx context.Context, method string, body []byte, result any) error {
+	// Если у контекста дедлайн раньше, он и останется
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.webhook+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBitrixUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBitrixUnavailable, err)
+	}
+
+	// Попробуем сначала распарсить как ошибку
+	var errData ErrorData
+	if err := json.Unmarshal(respBody, &errData); err == nil && errData.Error != "" {
+		switch {
+		case errData.Error == errorQueryLimitExceeded:
+			return fmt.Errorf("%w: %s", ErrBitrixRateLimited, errData.ErrorDescription)
+		case resp.StatusCode == http.StatusServiceUnavailable:
+			return fmt.Errorf("%w: %w: %s - %s", ErrBitrixUnavailable, errNotProcessed, errData.Error, errData.ErrorDescription)
+		case errData.Error == errorInternalServer || resp.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("%w: %s - %s", ErrBitrixUnavailable, errData.Error, errData.ErrorDescription)
+		default:
+			return fmt.Errorf("%w: %s - %s", ErrBitrixRequest, errData.Error, errData.ErrorDescription)
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: status %d", ErrBitrixRateLimited, resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return fmt.Errorf("%w: %w: status %d", ErrBitrixUnavailable, errNotProcessed, resp.StatusCode)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: status %d", ErrBitrixUnavailable, resp.StatusCode)
+	}
+
+	// Если ошибки нет — пробуем распарсить как успешный ответ
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("%w: status %d: %v", ErrBitrixRequest, resp.StatusCode, err)
+	}
+
+	return nil
+}
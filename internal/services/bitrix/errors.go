@@ -0,0 +1,12 @@
+package bitrix
+
+import "errors"
+
+var (
+	// ErrBitrixRateLimited битрикс ответил QUERY_LIMIT_EXCEEDED и попытки закончились
+	ErrBitrixRateLimited = errors.New("bitrix rate limit exceeded")
+	// ErrBitrixUnavailable битрикс не ответил или ответил 5xx
+	ErrBitrixUnavailable = errors.New("bitrix is unavailable")
+	// ErrBitrixRequest битрикс отклонил запрос, повтор не поможет
+	ErrBitrixRequest = errors.New("bitrix rejected request")
+)
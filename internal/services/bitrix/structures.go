@@ -1,12 +1,24 @@
 package bitrix
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 type ReturnDataDeal struct {
 	Result InfoDeal `json:"result"`
 	Time   TimeInfo `json:"time"`
 }
 
+type ReturnDataDealList struct {
+	Result []InfoDeal `json:"result"`
+	Next   *int       `json:"next"`
+	Total  int        `json:"total"`
+	Time   TimeInfo   `json:"time"`
+}
+
 type ReturnDataCreate struct {
 	Result int      `json:"result"`
 	Time   TimeInfo `json:"time"`
@@ -18,14 +30,42 @@ type ReturnDataComment struct {
 }
 
 type InfoDeal struct {
-	ID              string `json:"ID"`
-	Title           string `json:"TITLE"`
-	Status          string `json:"STAGE_ID"`
-	ContactID       string `json:"CONTACT_ID"`
-	CategoryID      string `json:"CATEGORY_ID"`
-	InternetPayment string `json:"UF_CRM_1737451536004"`
-	CleaningPayment string `json:"UF_CRM_1744353480781"`
-	ShippingPayment string `json:"UF_CRM_1744354030686"`
+	ID         string `json:"ID"`
+	Title      string `json:"TITLE"`
+	Status     string `json:"STAGE_ID"`
+	ContactID  string `json:"CONTACT_ID"`
+	CategoryID string `json:"CATEGORY_ID"`
+
+	// Суммы выплат заполняются по кодам полей из конфига
+	InternetPayment string `json:"-"`
+	CleaningPayment string `json:"-"`
+	ShippingPayment string `json:"-"`
+
+	// Все поля сделки, включая пользовательские UF_CRM_*
+	Fields map[string]any `json:"-"`
+}
+
+func (d *InfoDeal) UnmarshalJSON(data []byte) error {
+	type plain InfoDeal
+	if err := json.Unmarshal(data, (*plain)(d)); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &d.Fields)
+}
+
+// Field возвращает значение поля сделки строкой. Для отсутствующего поля вернёт пустую строку.
+func (d InfoDeal) Field(code string) string {
+	switch value := d.Fields[code].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
 }
 
 type InfoComment struct {
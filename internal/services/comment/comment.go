@@ -2,6 +2,7 @@ package comment
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"ia-online-golang/internal/dto"
@@ -21,6 +22,7 @@ type CommentService struct {
 	BitrixService     bitrix.BitrixServiceI
 	LeadRepository    storage.LeadRepositoryI
 	CommentRepository storage.CommentsRepositoryI
+	OutboxRepository  storage.OutboxRepositoryI
 }
 
 type CommentServiceI interface {
@@ -37,13 +39,14 @@ var (
 )
 
 // Конструктор для создания нового экземпляра EmailService
-func New(log *logrus.Logger, id_funnel string, bitrixService bitrix.BitrixServiceI, leadRepository storage.LeadRepositoryI, commentRepository storage.CommentsRepositoryI) *CommentService {
+func New(log *logrus.Logger, id_funnel string, bitrixService bitrix.BitrixServiceI, leadRepository storage.LeadRepositoryI, commentRepository storage.CommentsRepositoryI, outboxRepository storage.OutboxRepositoryI) *CommentService {
 	return &CommentService{
 		log:               log,
 		id_funnel:         id_funnel,
 		BitrixService:     bitrixService,
 		LeadRepository:    leadRepository,
 		CommentRepository: commentRepository,
+		OutboxRepository:  outboxRepository,
 	}
 }
 
@@ -69,9 +72,28 @@ func (c *CommentService) SaveComment(ctx context.Context, id_lead int64, text st
 		return dto.CommentDTO{}, ErrLeadDoesNotBelongToUser
 	}
 
-	commentBitrix, err := c.BitrixService.SendComment(ctx, id_lead, text)
+	// Сделка ещё не создана: комментарий уходит через outbox следом за ней и сохраняется после отправки
+	if lead.BitrixID == nil {
+		payload, err := json.Marshal(models.OutboxComment{UserID: userID, Text: text})
+		if err != nil {
+			return dto.CommentDTO{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		message := models.OutboxMessage{
+			LeadID:  lead.ID,
+			Event:   models.OutboxEventCreateComment,
+			Payload: payload,
+		}
+		if err := c.OutboxRepository.EnqueueOutboxMessage(ctx, message); err != nil {
+			return dto.CommentDTO{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return dto.CommentDTO{Text: text, Pending: true}, nil
+	}
+
+	commentBitrix, err := c.BitrixService.SendComment(ctx, *lead.BitrixID, text)
 	if err != nil {
-		return dto.CommentDTO{}, fmt.Errorf("%s: %v", op, err)
+		return dto.CommentDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	commentObj := models.Comment{
@@ -128,14 +150,23 @@ func (c *CommentService) SaveCommentFromBitrix(ctx context.Context, id_comment i
 		return ErrCommentDoesNotBelongToTheFunnel
 	}
 
-	leadID, err := strconv.ParseInt(lead.Result.ID, 10, 64)
+	bitrixID, err := strconv.ParseInt(lead.Result.ID, 10, 64)
 	if err != nil {
 		return fmt.Errorf("%s: invalid LeadID: %v", op, err)
 	}
 
+	leadDB, err := c.LeadRepository.LeadByBitrixID(ctx, bitrixID)
+	if err != nil {
+		if errors.Is(err, storage.ErrLeadNotFound) {
+			return ErrLeadNotFound
+		}
+
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
 	commentObj := models.Comment{
 		ID:     id_comment,
-		LeadID: leadID,
+		LeadID: leadDB.ID,
 		UserID: 228,
 		Text:   comment.Result.Comment,
 	}
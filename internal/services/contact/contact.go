@@ -0,0 +1,289 @@
+// Package contact. Смена почты и телефона с подтверждением нового адреса или номера.
+package contact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/audit"
+	"ia-online-golang/internal/services/email"
+	"ia-online-golang/internal/services/sms"
+	"ia-online-golang/internal/storage"
+	"ia-online-golang/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// phoneCodeLength длина кода из SMS
+const phoneCodeLength = 6
+
+type ContactService struct {
+	log                      *logrus.Logger
+	cfg                      config.ContactChangeConfig
+	Address                  string
+	UserRepository           storage.UserRepositoryI
+	ActivationLinkRepository storage.ActivationLinkRepositoryI
+	PhoneCodeRepository      storage.PhoneCodeRepositoryI
+	EmailService             email.EmailServiceI
+	SMSSender                sms.SMSSenderI
+	AuditService             audit.AuditServiceI
+}
+
+type ContactServiceI interface {
+	RequestEmailChange(ctx context.Context, userID int64, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, linkID string) error
+	RequestPhoneChange(ctx context.Context, userID int64, phoneNumber string) error
+	ConfirmPhoneChange(ctx context.Context, userID int64, code string) error
+}
+
+var (
+	ErrContactUnchanged        = errors.New("new contact matches current")
+	ErrEmailAlreadyUsed        = errors.New("email already used")
+	ErrPhoneAlreadyUsed        = errors.New("phone number already used")
+	ErrEmailChangeLinkNotFound = errors.New("email change link not found")
+	ErrEmailChangeLinkExpired  = errors.New("email change link expired")
+	ErrPhoneCodeNotFound       = errors.New("phone code not found")
+	ErrPhoneCodeIncorrect      = errors.New("phone code incorrect")
+	ErrPhoneCodeExpired        = errors.New("phone code expired")
+)
+
+func New(
+	log *logrus.Logger,
+	cfg config.ContactChangeConfig,
+	address string,
+	userRepo storage.UserRepositoryI,
+	activationLinkRepo storage.ActivationLinkRepositoryI,
+	phoneCodeRepo storage.PhoneCodeRepositoryI,
+	emailService email.EmailServiceI,
+	smsSender sms.SMSSenderI,
+	auditService audit.AuditServiceI,
+) *ContactService {
+	return &ContactService{
+		log:                      log,
+		cfg:                      cfg,
+		Address:                  address,
+		UserRepository:           userRepo,
+		ActivationLinkRepository: activationLinkRepo,
+		PhoneCodeRepository:      phoneCodeRepo,
+		EmailService:             emailService,
+		SMSSender:                smsSender,
+		AuditService:             auditService,
+	}
+}
+
+// RequestEmailChange отправляет ссылку подтверждения на новый адрес. Почта меняется только после перехода по ссылке.
+func (c *ContactService) RequestEmailChange(ctx context.Context, userID int64, newEmail string) error {
+	op := "ContactService.RequestEmailChange"
+
+	user, err := c.UserRepository.UserById(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Email == newEmail {
+		return ErrContactUnchanged
+	}
+
+	if _, err := c.UserRepository.UserIdByEmail(ctx, newEmail); err == nil {
+		return ErrEmailAlreadyUsed
+	} else if !errors.Is(err, storage.ErrUserNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	link := models.ActivationLink{
+		UserID:       userID,
+		ActivationID: uuid.New().String(),
+		NewEmail:     &newEmail,
+		ExpiresAt:    time.Now().Add(c.cfg.EmailLinkTTL),
+	}
+	if err := c.ActivationLinkRepository.SaveEmailChangeLink(ctx, link); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	confirmLink := "https://" + c.Address + "/api/v1/auth/email/confirm/" + link.ActivationID
+	if err := c.EmailService.SendEmailChangeLink(ctx, newEmail, confirmLink); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange меняет почту по ссылке из письма. Ссылка одноразовая, прежний адрес получает уведомление.
+func (c *ContactService) ConfirmEmailChange(ctx context.Context, linkID string) error {
+	op := "ContactService.ConfirmEmailChange"
+
+	link, err := c.ActivationLinkRepository.ActivationLinkByActivationId(ctx, linkID)
+	if err != nil {
+		if errors.Is(err, storage.ErrActivationLinkIsNotFound) {
+			return ErrEmailChangeLinkNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Ссылка активации аккаунта не должна менять почту
+	if link.NewEmail == nil {
+		return ErrEmailChangeLinkNotFound
+	}
+
+	if link.ExpiresAt.Before(time.Now()) {
+		c.deleteLink(ctx, link)
+		return ErrEmailChangeLinkExpired
+	}
+
+	user, err := c.UserRepository.UserById(ctx, link.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Адрес могли занять, пока письмо шло
+	if err := c.UserRepository.UpdateUserEmail(ctx, link.UserID, *link.NewEmail); err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return ErrEmailAlreadyUsed
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.deleteLink(ctx, link)
+
+	if err := c.EmailService.SendEmailChanged(ctx, user.Email, *link.NewEmail); err != nil {
+		c.log.Errorf("%s: %v", op, err)
+	}
+
+	c.AuditService.Log(ctx, audit.Event{
+		ActorID:    &link.UserID,
+		Action:     audit.ActionUserEmailChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(link.UserID, 10),
+		Before:     map[string]any{"email": user.Email},
+		After:      map[string]any{"email": *link.NewEmail},
+	})
+
+	return nil
+}
+
+// RequestPhoneChange отправляет код на новый номер. Номер меняется только после ввода кода.
+func (c *ContactService) RequestPhoneChange(ctx context.Context, userID int64, phoneNumber string) error {
+	op := "ContactService.RequestPhoneChange"
+
+	user, err := c.UserRepository.UserById(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.PhoneNumber == phoneNumber {
+		return ErrContactUnchanged
+	}
+
+	if _, err := c.UserRepository.UserIdByPhone(ctx, phoneNumber); err == nil {
+		return ErrPhoneAlreadyUsed
+	} else if !errors.Is(err, storage.ErrUserNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := utils.GenerateDigitCode(phoneCodeLength)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = c.PhoneCodeRepository.SavePhoneCode(ctx, models.PhoneCode{
+		UserID:      userID,
+		PhoneNumber: phoneNumber,
+		CodeHash:    string(codeHash),
+		ExpiresAt:   time.Now().Add(c.cfg.PhoneCodeTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	text := fmt.Sprintf("Код подтверждения номера: %s. Действует %d мин.", code, int(c.cfg.PhoneCodeTTL.Minutes()))
+	if err := c.SMSSender.SendSMS(ctx, phoneNumber, text); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConfirmPhoneChange проверяет код из SMS и меняет номер. Код одноразовый и допускает PhoneMaxAttempts попыток.
+func (c *ContactService) ConfirmPhoneChange(ctx context.Context, userID int64, code string) error {
+	op := "ContactService.ConfirmPhoneChange"
+
+	phoneCode, err := c.PhoneCodeRepository.AttemptPhoneCode(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPhoneCodeIsNotFound) {
+			return ErrPhoneCodeNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if time.Now().After(phoneCode.ExpiresAt) || phoneCode.Attempts > c.cfg.PhoneMaxAttempts {
+		c.deletePhoneCode(ctx, phoneCode.ID)
+		return ErrPhoneCodeExpired
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(phoneCode.CodeHash), []byte(code)); err != nil {
+		return ErrPhoneCodeIncorrect
+	}
+
+	if err := c.PhoneCodeRepository.DeletePhoneCode(ctx, phoneCode.ID); err != nil {
+		// Код уже использовали параллельным запросом
+		if errors.Is(err, storage.ErrPhoneCodeIsNotFound) {
+			return ErrPhoneCodeNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := c.UserRepository.UserById(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := c.UserRepository.UpdateUserPhone(ctx, userID, phoneCode.PhoneNumber); err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return ErrPhoneAlreadyUsed
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.AuditService.Log(ctx, audit.Event{
+		ActorID:    &userID,
+		Action:     audit.ActionUserPhoneChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Before:     map[string]any{"phone_number": user.PhoneNumber},
+		After:      map[string]any{"phone_number": phoneCode.PhoneNumber},
+	})
+
+	return nil
+}
+
+func (c *ContactService) deleteLink(ctx context.Context, link models.ActivationLink) {
+	op := "ContactService.deleteLink"
+
+	err := c.ActivationLinkRepository.DeleteActivationLink(ctx, link)
+	if err != nil && !errors.Is(err, storage.ErrActivationLinkIsNotFound) {
+		c.log.Errorf("%s: %v", op, err)
+	}
+}
+
+func (c *ContactService) deletePhoneCode(ctx context.Context, id int) {
+	op := "ContactService.deletePhoneCode"
+
+	err := c.PhoneCodeRepository.DeletePhoneCode(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrPhoneCodeIsNotFound) {
+		c.log.Errorf("%s: %v", op, err)
+	}
+}
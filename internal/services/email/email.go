@@ -4,8 +4,15 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"html"
+	"ia-online-golang/internal/lib/metrics"
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+	"net"
 	"net/smtp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Структура EmailService для хранения настроек SMTP
@@ -19,7 +26,11 @@ type EmailService struct {
 type EmailServiceI interface {
 	SendEmail(ctx context.Context, toAddress, subject, body string) error
 	SendActivationLink(ctx context.Context, toAddress string, activationLink string) error
-	SendNewPassword(ctx context.Context, toAddress string, new_password string) error
+	SendPasswordCode(ctx context.Context, toAddress string, code string, ttl time.Duration) error
+	SendEmailChangeLink(ctx context.Context, toAddress string, confirmLink string) error
+	SendEmailChanged(ctx context.Context, toAddress string, newAddress string) error
+	SendPayoutStatus(ctx context.Context, toAddress string, requestID int64, amount money.Money, status string, comment string) error
+	Ping(ctx context.Context) error
 }
 
 // Конструктор для создания нового экземпляра EmailService
@@ -34,6 +45,17 @@ func New(smtpServer, smtpPort, email, password string) *EmailService {
 
 // Функция для отправки письма
 func (e *EmailService) SendEmail(ctx context.Context, toAddress, subject, body string) error {
+	err := e.sendEmail(ctx, toAddress, subject, body)
+	if err != nil {
+		metrics.EmailsSent.WithLabelValues(metrics.OutcomeError).Inc()
+		return err
+	}
+
+	metrics.EmailsSent.WithLabelValues(metrics.OutcomeOk).Inc()
+	return nil
+}
+
+func (e *EmailService) sendEmail(ctx context.Context, toAddress, subject, body string) error {
 	op := "EmailService.SendEmail"
 
 	serverAddr := e.SMTPServer + ":" + e.SMTPPort
@@ -121,6 +143,41 @@ func (e *EmailService) SendEmail(ctx context.Context, toAddress, subject, body s
 	return nil
 }
 
+// Ping проверяет, что SMTP-сервер принимает соединения и отвечает приветствием
+func (e *EmailService) Ping(ctx context.Context) error {
+	op := "EmailService.Ping"
+
+	serverAddr := e.SMTPServer + ":" + e.SMTPPort
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", serverAddr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if e.SMTPPort == "465" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: e.SMTPServer})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		conn = tlsConn
+	}
+
+	// NewClient читает приветствие сервера
+	client, err := smtp.NewClient(conn, e.SMTPServer)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_ = client.Quit()
+
+	return nil
+}
+
 func (e *EmailService) SendActivationLink(ctx context.Context, toAddress string, activationLink string) error {
 	op := "EmailService.SendActivationLink"
 
@@ -201,7 +258,7 @@ func (e *EmailService) SendActivationLink(ctx context.Context, toAddress string,
 	return nil
 }
 
-func (e *EmailService) SendNewPassword(ctx context.Context, toAddress string, new_password string) error {
+func (e *EmailService) SendPasswordCode(ctx context.Context, toAddress string, code string, ttl time.Duration) error {
 	op := "EmailService.SendPasswordCode"
 
 	htmlBody := `
@@ -210,7 +267,7 @@ func (e *EmailService) SendNewPassword(ctx context.Context, toAddress string, ne
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Новый пароль</title>
+    <title>Восстановление пароля</title>
     <style>
         body {
             font-family: Arial, sans-serif;
@@ -260,19 +317,272 @@ func (e *EmailService) SendNewPassword(ctx context.Context, toAddress string, ne
 </head>
 <body>
     <div class="container">
-        <div class="header">Временный пароль</div>
+        <div class="header">Восстановление пароля</div>
+        <div class="content">
+            <h2>Код для смены пароля:</h2>
+            <div class="password-box">{{.Code}}</div>
+            <p>Код действует {{.TTL}} минут и подходит только для одной смены пароля.</p>
+            <p class="footer">Если вы не запрашивали восстановление, просто проигнорируйте это письмо.</p>
+        </div>
+    </div>
+</body>
+</html>
+`
+	htmlBody = strings.Replace(htmlBody, "{{.Code}}", code, -1)
+	htmlBody = strings.Replace(htmlBody, "{{.TTL}}", strconv.Itoa(int(ttl.Minutes())), -1)
+
+	err := e.SendEmail(ctx, toAddress, "Код для смены пароля", htmlBody)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SendEmailChangeLink отправляет на новый адрес ссылку подтверждения смены почты
+func (e *EmailService) SendEmailChangeLink(ctx context.Context, toAddress string, confirmLink string) error {
+	op := "EmailService.SendEmailChangeLink"
+
+	htmlBody := `
+<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Подтверждение почты</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            background-color: #f0f0f0;
+            color: #333;
+            padding: 0;
+            margin: 0;
+        }
+        .container {
+            max-width: 600px;
+            margin: 40px auto;
+            background-color: #ffffff;
+            border-radius: 8px;
+            overflow: hidden;
+            box-shadow: 0 4px 12px rgba(0, 0, 0, 0.1);
+        }
+        .header {
+            background-color: #7ed956;
+            padding: 20px;
+            text-align: center;
+            color: white;
+            font-size: 24px;
+        }
+        .content {
+            display: flex;
+            align-items: center;
+            flex-direction: column;
+            padding: 30px;
+        }
+        .button {
+            display: inline-block;
+            margin-top: 20px;
+            padding: 12px 24px;
+            background-color: #7ed956;
+            color: white;
+            text-decoration: none;
+            border-radius: 6px;
+            font-weight: bold;
+        }
+        .footer {
+            margin-top: 40px;
+            font-size: 12px;
+            color: #999;
+            text-align: center;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">Смена почты</div>
         <div class="content">
-            <h2>Ваш новый временный пароль:</h2>
-            <div class="password-box">{{.NewPassword}}</div>
-            <p class="footer">Рекомендуем сменить его сразу после входа.</p>
+            <h2>Подтвердите новый адрес</h2>
+            <p>Чтобы использовать этот адрес для входа в аккаунт, нажмите на кнопку ниже:</p>
+            <a class="button" href="{{.ConfirmLink}}">Подтвердить почту</a>
+            <p class="footer">Если вы не меняли почту, просто проигнорируйте это письмо.</p>
         </div>
     </div>
 </body>
 </html>
 `
-	htmlBody = strings.Replace(htmlBody, "{{.NewPassword}}", new_password, -1)
+	htmlBody = strings.Replace(htmlBody, "{{.ConfirmLink}}", confirmLink, -1)
+
+	err := e.SendEmail(ctx, toAddress, "Подтверждение новой почты", htmlBody)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SendEmailChanged предупреждает прежний адрес о смене почты, чтобы владелец заметил захват аккаунта
+func (e *EmailService) SendEmailChanged(ctx context.Context, toAddress string, newAddress string) error {
+	op := "EmailService.SendEmailChanged"
+
+	htmlBody := `
+<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Почта изменена</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            background-color: #f0f0f0;
+            color: #333;
+            padding: 0;
+            margin: 0;
+        }
+        .container {
+            max-width: 600px;
+            margin: 40px auto;
+            background-color: #ffffff;
+            border-radius: 8px;
+            overflow: hidden;
+            box-shadow: 0 4px 12px rgba(0, 0, 0, 0.1);
+        }
+        .header {
+            background-color: #7ed956;
+            padding: 20px;
+            text-align: center;
+            color: white;
+            font-size: 24px;
+        }
+        .content {
+            display: flex;
+            flex-direction: column;
+            align-items: center;
+            padding: 30px;
+        }
+        .footer {
+            margin-top: 40px;
+            font-size: 12px;
+            color: #999;
+            text-align: center;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">Почта изменена</div>
+        <div class="content">
+            <h2>Почта аккаунта изменена</h2>
+            <p>Теперь для входа используется адрес {{.NewAddress}}.</p>
+            <p class="footer">Если вы не меняли почту, срочно обратитесь к менеджеру.</p>
+        </div>
+    </div>
+</body>
+</html>
+`
+	htmlBody = strings.Replace(htmlBody, "{{.NewAddress}}", html.EscapeString(newAddress), -1)
+
+	err := e.SendEmail(ctx, toAddress, "Почта аккаунта изменена", htmlBody)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// payoutStatusTexts заголовок письма и пояснение для каждого статуса заявки на выплату
+var payoutStatusTexts = map[string][2]string{
+	models.PayoutStatusRequested: {"Заявка на выплату принята", "Мы получили вашу заявку и передали её менеджеру на рассмотрение."},
+	models.PayoutStatusApproved:  {"Заявка на выплату одобрена", "Менеджер одобрил заявку, деньги поступят по указанным реквизитам."},
+	models.PayoutStatusRejected:  {"Заявка на выплату отклонена", "Менеджер отклонил заявку. Сумма снова доступна для вывода."},
+	models.PayoutStatusPaid:      {"Выплата отправлена", "Деньги отправлены по указанным реквизитам."},
+	models.PayoutStatusCancelled: {"Заявка на выплату отменена", "Вы отменили заявку. Сумма снова доступна для вывода."},
+}
+
+// SendPayoutStatus сообщает партнёру о смене статуса заявки на выплату
+func (e *EmailService) SendPayoutStatus(ctx context.Context, toAddress string, requestID int64, amount money.Money, status string, comment string) error {
+	op := "EmailService.SendPayoutStatus"
+
+	texts, ok := payoutStatusTexts[status]
+	if !ok {
+		return fmt.Errorf("%s: unknown payout status %q", op, status)
+	}
+
+	htmlBody := `
+<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            background-color: #f0f0f0;
+            color: #333;
+            padding: 0;
+            margin: 0;
+        }
+        .container {
+            max-width: 600px;
+            margin: 40px auto;
+            background-color: #ffffff;
+            border-radius: 8px;
+            overflow: hidden;
+            box-shadow: 0 4px 12px rgba(0, 0, 0, 0.1);
+        }
+        .header {
+            background-color: #7ed956;
+            padding: 20px;
+            text-align: center;
+            color: white;
+            font-size: 24px;
+        }
+        .content {
+            display: flex;
+            flex-direction: column;
+            align-items: center;
+            padding: 30px;
+        }
+        .amount {
+            font-size: 28px;
+            font-weight: bold;
+            margin: 10px 0;
+        }
+        .footer {
+            margin-top: 40px;
+            font-size: 12px;
+            color: #999;
+            text-align: center;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">{{.Title}}</div>
+        <div class="content">
+            <h2>Заявка №{{.RequestID}}</h2>
+            <div class="amount">{{.Amount}} ₽</div>
+            <p>{{.Message}}</p>
+            {{.Comment}}
+            <p class="footer">Статус заявки можно посмотреть в личном кабинете.</p>
+        </div>
+    </div>
+</body>
+</html>
+`
+	commentBlock := ""
+	if comment != "" {
+		commentBlock = "<p>Комментарий: " + html.EscapeString(comment) + "</p>"
+	}
+
+	htmlBody = strings.Replace(htmlBody, "{{.Title}}", texts[0], -1)
+	htmlBody = strings.Replace(htmlBody, "{{.RequestID}}", strconv.FormatInt(requestID, 10), -1)
+	htmlBody = strings.Replace(htmlBody, "{{.Amount}}", amount.String(), -1)
+	htmlBody = strings.Replace(htmlBody, "{{.Message}}", texts[1], -1)
+	htmlBody = strings.Replace(htmlBody, "{{.Comment}}", commentBlock, -1)
 
-	err := e.SendEmail(ctx, toAddress, "Новый временный пароль", htmlBody)
+	err := e.SendEmail(ctx, toAddress, texts[0], htmlBody)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
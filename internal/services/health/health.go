@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/services/bitrix"
+	"ia-online-golang/internal/services/email"
+	"ia-online-golang/internal/storage"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type HealthService struct {
+	log              *logrus.Logger
+	cfg              config.HealthConfig
+	HealthRepository storage.HealthRepositoryI
+	BitrixService    bitrix.BitrixServiceI
+	EmailService     email.EmailServiceI
+
+	// Результат проверки битрикса кэшируется, чтобы частые пробы не расходовали лимит запросов
+	mu              sync.Mutex
+	bitrixCheck     dto.HealthCheckDTO
+	bitrixCheckedAt time.Time
+}
+
+type HealthServiceI interface {
+	Ready(ctx context.Context) dto.ReadinessDTO
+}
+
+func New(
+	log *logrus.Logger,
+	cfg config.HealthConfig,
+	healthRepository storage.HealthRepositoryI,
+	bitrixService bitrix.BitrixServiceI,
+	emailService email.EmailServiceI,
+) *HealthService {
+	return &HealthService{
+		log:              log,
+		cfg:              cfg,
+		HealthRepository: healthRepository,
+		BitrixService:    bitrixService,
+		EmailService:     emailService,
+	}
+}
+
+// Ready параллельно проверяет БД, битрикс и SMTP. Сервис готов, только если прошли все проверки.
+func (h *HealthService) Ready(ctx context.Context) dto.ReadinessDTO {
+	const op = "HealthService.Ready"
+
+	checks := map[string]func(ctx context.Context) dto.HealthCheckDTO{
+		"database": func(ctx context.Context) dto.HealthCheckDTO {
+			return h.check(ctx, h.HealthRepository.Ping)
+		},
+		"bitrix": h.checkBitrix,
+		"smtp": func(ctx context.Context) dto.HealthCheckDTO {
+			return h.check(ctx, h.EmailService.Ping)
+		},
+	}
+
+	result := dto.ReadinessDTO{
+		Status: dto.HealthStatusOk,
+		Checks: make(map[string]dto.HealthCheckDTO, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkResult := check(ctx)
+
+			mu.Lock()
+			result.Checks[name] = checkResult
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for name, check := range result.Checks {
+		if check.Status != dto.HealthStatusOk {
+			h.log.Warnf("%s: %s check failed: %s", op, name, check.Error)
+			result.Status = dto.HealthStatusFail
+		}
+	}
+
+	return result
+}
+
+func (h *HealthService) checkBitrix(ctx context.Context) dto.HealthCheckDTO {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.bitrixCheckedAt.IsZero() && time.Since(h.bitrixCheckedAt) < h.cfg.BitrixCacheTTL {
+		cached := h.bitrixCheck
+		cached.Cached = true
+		return cached
+	}
+
+	h.bitrixCheck = h.check(ctx, h.BitrixService.Ping)
+	h.bitrixCheckedAt = time.Now()
+
+	return h.bitrixCheck
+}
+
+// check выполняет проверку с таймаутом из конфига
+func (h *HealthService) check(ctx context.Context, ping func(ctx context.Context) error) dto.HealthCheckDTO {
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ping(ctx)
+
+	result := dto.HealthCheckDTO{
+		Status:     dto.HealthStatusOk,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = dto.HealthStatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
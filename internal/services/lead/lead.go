@@ -2,15 +2,22 @@ package lead
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"ia-online-golang/internal/dto"
 	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/lib/money"
 	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/audit"
 	"ia-online-golang/internal/services/bitrix"
 	"ia-online-golang/internal/services/comment"
+	"ia-online-golang/internal/services/ledger"
+	"ia-online-golang/internal/services/referral"
+	"ia-online-golang/internal/services/reward"
 	"ia-online-golang/internal/services/user"
 	"ia-online-golang/internal/storage"
+	"ia-online-golang/internal/utils"
 	"strconv"
 	"strings"
 	"time"
@@ -20,11 +27,18 @@ import (
 
 type LeadService struct {
 	log                *logrus.Logger
+	stages             map[string]int64
 	CommentService     comment.CommentServiceI
 	UserService        user.UserServiceI
 	BitrixService      bitrix.BitrixServiceI
 	LeadRepository     storage.LeadRepositoryI
 	ReferralRepository storage.ReferralRepositoryI
+	OutboxRepository   storage.OutboxRepositoryI
+	HistoryRepository  storage.HistoryRepositoryI
+	AuditService       audit.AuditServiceI
+	LedgerService      ledger.LedgerServiceI
+	RewardService      reward.RewardServiceI
+	ReferralService    referral.ReferralServiceI
 }
 
 type LeadServiceI interface {
@@ -32,8 +46,16 @@ type LeadServiceI interface {
 	GetUserPaymentStatistic(ctx context.Context, userID int64, startDate *time.Time, endDate *time.Time) (dto.UserStatistic, error)
 	SaveLead(ctx context.Context, lead dto.CreateLeadDTO) error
 	EditDeal(ctx context.Context, arrInfoBitrix []string) error
+	ReconcileDeals(ctx context.Context, dryRun bool) (dto.ReconcileSummaryDTO, error)
+	LeadHistory(ctx context.Context, leadID int64) ([]dto.LeadHistoryDTO, error)
 }
 
+var (
+	ErrLeadNotFound            = errors.New("lead not found")
+	ErrLeadDoesNotBelongToUser = errors.New("lead does not belong to user")
+	ErrInvalidDealAmount       = errors.New("invalid amount in bitrix deal")
+)
+
 func New(
 	log *logrus.Logger,
 	commentService comment.CommentServiceI,
@@ -41,14 +63,28 @@ func New(
 	userService user.UserServiceI,
 	referralRepository storage.ReferralRepositoryI,
 	bitrixService bitrix.BitrixServiceI,
+	outboxRepository storage.OutboxRepositoryI,
+	historyRepository storage.HistoryRepositoryI,
+	auditService audit.AuditServiceI,
+	ledgerService ledger.LedgerServiceI,
+	rewardService reward.RewardServiceI,
+	referralService referral.ReferralServiceI,
+	stages map[string]int64,
 ) *LeadService {
 	return &LeadService{
 		log:                log,
+		stages:             stages,
 		CommentService:     commentService,
 		LeadRepository:     leadRepository,
 		UserService:        userService,
 		ReferralRepository: referralRepository,
 		BitrixService:      bitrixService,
+		OutboxRepository:   outboxRepository,
+		HistoryRepository:  historyRepository,
+		AuditService:       auditService,
+		LedgerService:      ledgerService,
+		RewardService:      rewardService,
+		ReferralService:    referralService,
 	}
 }
 
@@ -98,12 +134,18 @@ func (l *LeadService) Leads(ctx context.Context, filterDTO dto.LeadFilterDTO) ([
 			Internet:       lead.Internet,
 			Cleaning:       lead.Cleaning,
 			Shipping:       lead.Shipping,
+			SyncStatus:     lead.SyncStatus,
 			CreatedAt:      lead.CreatedAt,
 			CompletedAt:    lead.CompletedAt,
 			PaymentAt:      lead.PaymentAt,
 			RewardInternet: lead.RewardInternet,
 			RewardCleaning: lead.RewardCleaning,
 			RewardShipping: lead.RewardShipping,
+
+			ExpectedRewardInternet: lead.ExpectedRewardInternet,
+			ExpectedRewardCleaning: lead.ExpectedRewardCleaning,
+			ExpectedRewardShipping: lead.ExpectedRewardShipping,
+			RewardDiscrepancy:      lead.RewardDiscrepancy,
 		}
 
 		comments, err := l.CommentService.Comments(ctx, lead.ID)
@@ -123,6 +165,8 @@ func (l *LeadService) Leads(ctx context.Context, filterDTO dto.LeadFilterDTO) ([
 	return result, nil
 }
 
+// SaveLead сохраняет заявку локально и ставит её в очередь на отправку в битрикс.
+// Сделка создаётся фоновым воркером outbox, поэтому недоступность битрикса не мешает партнёру оставить заявку.
 func (l *LeadService) SaveLead(ctx context.Context, lead dto.CreateLeadDTO) error {
 	const op = "LeadService.SaveLead"
 
@@ -132,18 +176,12 @@ func (l *LeadService) SaveLead(ctx context.Context, lead dto.CreateLeadDTO) erro
 		return fmt.Errorf("%s: %v", op, "user id not found")
 	}
 
-	user, err := l.UserService.UserById(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("%s: %v", op, err)
-	}
-
-	bitrix_result, err := l.BitrixService.SendDeal(ctx, lead, user)
+	payload, err := json.Marshal(lead)
 	if err != nil {
 		return fmt.Errorf("%s: %v", op, err)
 	}
 
 	leadDB := models.Lead{
-		ID:             int64(bitrix_result.Result),
 		UserID:         userID,
 		FIO:            lead.Name,
 		Address:        lead.Address,
@@ -152,22 +190,35 @@ func (l *LeadService) SaveLead(ctx context.Context, lead dto.CreateLeadDTO) erro
 		Internet:       lead.IsInternet,
 		Cleaning:       lead.IsCleaning,
 		Shipping:       lead.IsShipping,
+		SyncStatus:     models.LeadSyncPending,
 		RewardInternet: lead.RewardInternet,
 		RewardCleaning: lead.RewardCleaning,
 		RewardShipping: lead.RewardShipping,
 	}
 
-	err = l.LeadRepository.CreateLead(ctx, &leadDB)
+	// Без ожидаемой суммы заявка всё равно принимается, расхождение по ней просто не будет отслеживаться
+	if err := l.RewardService.ExpectedLeadRewards(ctx, &leadDB); err != nil {
+		l.log.Errorf("%s: %v", op, err)
+	}
+
+	message := models.OutboxMessage{
+		Event:   models.OutboxEventCreateDeal,
+		Payload: payload,
+	}
+
+	err = l.OutboxRepository.CreateLeadWithOutbox(ctx, &leadDB, message)
 	if err != nil {
 		return fmt.Errorf("%s: %v", op, err)
 	}
 
-	if lead.Comment != "" {
-		_, err = l.CommentService.SaveComment(ctx, int64(bitrix_result.Result), lead.Comment)
-		if err != nil {
-			return fmt.Errorf("%s: %v", op, err)
-		}
-	}
+	l.log.Debugf("%s: lead %d queued for bitrix", op, leadDB.ID)
+
+	l.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionLeadCreated,
+		TargetType: audit.TargetLead,
+		TargetID:   strconv.FormatInt(leadDB.ID, 10),
+		After:      lead,
+	})
 
 	return nil
 }
@@ -182,68 +233,446 @@ func (l *LeadService) EditDeal(ctx context.Context, arrInfoBitrix []string) erro
 		return fmt.Errorf("%s: %v", op, err)
 	}
 
+	lead, err := l.LeadRepository.LeadByBitrixID(ctx, idDeal)
+	if err != nil {
+		if errors.Is(err, storage.ErrLeadNotFound) {
+			return ErrLeadNotFound
+		}
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
 	infoDeal, err := l.BitrixService.GetLead(ctx, idDeal)
 	if err != nil {
 		return fmt.Errorf("%s: %v", op, err)
 	}
 
-	statuses := map[string]int64{
-		"C42:NEW":               0,
-		"C42:PREPARATION":       1,
-		"C42:PREPAYMENT_INVOIC": 2,
-		"C42:EXECUTING":         7,
-		"C42:FINAL_INVOICE":     3,
-		"C42:1":                 4,
-		"C42:LOSE":              6,
-		"C42:WON":               5,
+	update, err := l.dealUpdate(*lead, infoDeal.Result)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if update.empty() {
+		return nil
+	}
+
+	if err := l.applyUpdate(ctx, *lead, update, models.HistorySourceWebhook); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// ReconcileDeals сверяет заявки со сделками воронки в битриксе и исправляет расхождения.
+// В режиме dryRun расхождения только логируются.
+func (l *LeadService) ReconcileDeals(ctx context.Context, dryRun bool) (dto.ReconcileSummaryDTO, error) {
+	const op = "LeadService.ReconcileDeals"
+
+	summary := dto.ReconcileSummaryDTO{DryRun: dryRun}
+
+	start := 0
+	for {
+		page, err := l.BitrixService.ListDeals(ctx, start)
+		if err != nil {
+			return summary, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Заявки загружаются только для сделок текущей страницы
+		dealIDs := make(map[string]int64, len(page.Result))
+		bitrixIDs := make([]int64, 0, len(page.Result))
+		for _, deal := range page.Result {
+			dealID, err := strconv.ParseInt(deal.ID, 10, 64)
+			if err != nil {
+				continue
+			}
+			dealIDs[deal.ID] = dealID
+			bitrixIDs = append(bitrixIDs, dealID)
+		}
+
+		leads, err := l.LeadRepository.LeadsByBitrixIDs(ctx, bitrixIDs)
+		if err != nil {
+			return summary, fmt.Errorf("%s: %w", op, err)
+		}
+		leadsByDeal := make(map[int64]models.Lead, len(leads))
+		for _, lead := range leads {
+			leadsByDeal[*lead.BitrixID] = lead
+		}
+
+		for _, deal := range page.Result {
+			dealID, ok := dealIDs[deal.ID]
+			if !ok {
+				l.log.Warnf("%s: invalid deal id %q", op, deal.ID)
+				summary.Failed++
+				continue
+			}
+
+			// В воронке есть сделки, созданные не через сайт
+			lead, ok := leadsByDeal[dealID]
+			if !ok {
+				summary.Skipped++
+				continue
+			}
+
+			summary.Checked++
+
+			update, err := l.dealUpdate(lead, deal)
+			if err != nil {
+				l.log.Warnf("%s: lead %d (deal %d): %v", op, lead.ID, dealID, err)
+				summary.Failed++
+				continue
+			}
+			if update.empty() {
+				continue
+			}
+
+			l.log.Infof("%s: lead %d (deal %d) drift: %s", op, lead.ID, dealID, update)
+			summary.Drifted++
+
+			if dryRun {
+				continue
+			}
+
+			if err := l.applyUpdate(ctx, lead, update, models.HistorySourceReconciliation); err != nil {
+				l.log.Errorf("%s: lead %d (deal %d): %v", op, lead.ID, dealID, err)
+				summary.Failed++
+				continue
+			}
+
+			summary.Fixed++
+		}
+
+		if page.Next == nil {
+			break
+		}
+		start = *page.Next
+	}
+
+	l.log.Infof("%s: checked %d, drifted %d, fixed %d, failed %d, skipped %d (dry run: %t)",
+		op, summary.Checked, summary.Drifted, summary.Fixed, summary.Failed, summary.Skipped, summary.DryRun)
+
+	return summary, nil
+}
+
+// leadUpdate изменения заявки по данным сделки. Пустые поля не меняются.
+type leadUpdate struct {
+	statusID       *int64
+	rewardInternet *money.Money
+	rewardCleaning *money.Money
+	rewardShipping *money.Money
+	completedAt    *time.Time
+	paymentAt      *time.Time
+}
+
+func (u leadUpdate) empty() bool {
+	return u.statusID == nil && u.rewardInternet == nil && u.rewardCleaning == nil && u.rewardShipping == nil &&
+		u.completedAt == nil && u.paymentAt == nil
+}
+
+func (u leadUpdate) String() string {
+	var parts []string
+	if u.statusID != nil {
+		parts = append(parts, fmt.Sprintf("status_id=%d", *u.statusID))
+	}
+	if u.rewardInternet != nil {
+		parts = append(parts, fmt.Sprintf("reward_internet=%s", *u.rewardInternet))
+	}
+	if u.rewardCleaning != nil {
+		parts = append(parts, fmt.Sprintf("reward_cleaning=%s", *u.rewardCleaning))
+	}
+	if u.rewardShipping != nil {
+		parts = append(parts, fmt.Sprintf("reward_shipping=%s", *u.rewardShipping))
+	}
+	if u.completedAt != nil {
+		parts = append(parts, "completed_at")
 	}
+	if u.paymentAt != nil {
+		parts = append(parts, "payment_at")
+	}
+
+	return strings.Join(parts, ", ")
+}
 
-	status, ok := statuses[infoDeal.Result.Status]
+// dealUpdate сравнивает заявку со сделкой и возвращает только отличающиеся поля
+func (l *LeadService) dealUpdate(lead models.Lead, deal bitrix.InfoDeal) (leadUpdate, error) {
+	var update leadUpdate
+
+	status, ok := l.stages[deal.Status]
 	if !ok {
-		return fmt.Errorf("%s: статус не найден для %s", op, infoDeal.Result.Status)
+		return update, fmt.Errorf("статус не найден для %s", deal.Status)
+	}
+
+	if status != lead.StatusID {
+		update.statusID = &status
 	}
 
-	var paymentAt *time.Time
-	var completedAt *time.Time
-	if status == 4 {
-		now := time.Now()
-		completedAt = &now
+	// Дату проставляем при переходе в статус или если её ещё нет
+	now := time.Now()
+	if status == models.LeadStatusReady && (update.statusID != nil || lead.CompletedAt == nil) {
+		update.completedAt = &now
 	}
-	if status == 5 {
-		now := time.Now()
-		paymentAt = &now
+	if status == models.LeadStatusPaid && (update.statusID != nil || lead.PaymentAt == nil) {
+		update.paymentAt = &now
 	}
 
-	// Преобразуем строки в float64
-	internetPayment, err := strconv.ParseFloat(infoDeal.Result.InternetPayment, 64)
+	// Пустое поле значит, что вознаграждение не назначено. Нечитаемую сумму нулём не считаем:
+	// так партнёр молча остался бы без вознаграждения, поэтому сделка не применяется целиком.
+	parseAmount := func(field, value string) (money.Money, error) {
+		if strings.TrimSpace(value) == "" {
+			return 0, nil
+		}
+
+		amount, err := money.Parse(value)
+		if err != nil {
+			l.log.Errorf("LeadService.dealUpdate: deal %s, lead %d: unparsable %s %q", deal.ID, lead.ID, field, value)
+			return 0, fmt.Errorf("%w: %s: %v", ErrInvalidDealAmount, field, err)
+		}
+
+		return amount, nil
+	}
+
+	internetPayment, err := parseAmount("internet_payment", deal.InternetPayment)
 	if err != nil {
-		internetPayment = 0
+		return update, err
 	}
 
-	cleaningPayment, err := strconv.ParseFloat(infoDeal.Result.CleaningPayment, 64)
+	cleaningPayment, err := parseAmount("cleaning_payment", deal.CleaningPayment)
 	if err != nil {
-		cleaningPayment = 0
+		return update, err
 	}
 
-	shippingPayment, err := strconv.ParseFloat(infoDeal.Result.ShippingPayment, 64)
+	shippingPayment, err := parseAmount("shipping_payment", deal.ShippingPayment)
 	if err != nil {
-		shippingPayment = 0
+		return update, err
 	}
 
-	l.LeadRepository.UpdateLead(
+	if internetPayment != lead.RewardInternet {
+		update.rewardInternet = &internetPayment
+	}
+	if cleaningPayment != lead.RewardCleaning {
+		update.rewardCleaning = &cleaningPayment
+	}
+	if shippingPayment != lead.RewardShipping {
+		update.rewardShipping = &shippingPayment
+	}
+
+	return update, nil
+}
+
+// applyUpdate сохраняет изменения заявки вместе с записями в истории и пишет их в журнал действий
+func (l *LeadService) applyUpdate(ctx context.Context, lead models.Lead, update leadUpdate, source string) error {
+	err := l.HistoryRepository.UpdateLeadWithHistory(
 		ctx,
-		&idDeal,
-		nil,
-		&status,
-		&internetPayment,
-		&cleaningPayment,
-		&shippingPayment,
-		nil, nil, nil, nil, nil, nil, nil, completedAt, paymentAt,
+		lead.ID,
+		update.statusID,
+		update.rewardInternet,
+		update.rewardCleaning,
+		update.rewardShipping,
+		update.completedAt,
+		update.paymentAt,
+		update.history(lead, source),
 	)
+	if err != nil {
+		return err
+	}
+
+	action := audit.ActionLeadWebhookApplied
+	if source == models.HistorySourceReconciliation {
+		action = audit.ActionLeadReconciled
+	}
+
+	before, after := update.auditState(lead)
+	targetID := strconv.FormatInt(lead.ID, 10)
+
+	l.AuditService.Log(ctx, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetLead,
+		TargetID:   targetID,
+		Before:     before,
+		After:      after,
+		Details:    map[string]any{"bitrix_id": lead.BitrixID},
+	})
+
+	// Выплата вознаграждения партнёру пишется отдельным событием, чтобы её можно было найти по действию
+	if update.paymentAt != nil {
+		l.AuditService.Log(ctx, audit.Event{
+			Action:     audit.ActionLeadPaid,
+			TargetType: audit.TargetLead,
+			TargetID:   targetID,
+			Details: map[string]any{
+				"user_id":         lead.UserID,
+				"reward_internet": valueOr(update.rewardInternet, lead.RewardInternet),
+				"reward_cleaning": valueOr(update.rewardCleaning, lead.RewardCleaning),
+				"reward_shipping": valueOr(update.rewardShipping, lead.RewardShipping),
+				"source":          source,
+			},
+		})
+	}
+
+	// Начисление сверяется и задачей ledger_sync, поэтому ошибка здесь только логируется
+	updated := update.apply(lead)
+	if err := l.LedgerService.SyncLeadReward(ctx, updated); err != nil {
+		l.log.Errorf("LeadService.applyUpdate: %v", err)
+	}
+
+	// Отметка о расхождении пересчитывается при следующем изменении заявки
+	if err := l.RewardService.CheckLeadReward(ctx, updated); err != nil {
+		l.log.Errorf("LeadService.applyUpdate: %v", err)
+	}
+
+	// Проценты пригласившим досчитает задача referral_commissions
+	if err := l.ReferralService.SyncLeadCommissions(ctx, updated); err != nil {
+		l.log.Errorf("LeadService.applyUpdate: %v", err)
+	}
 
 	return nil
 }
 
+// apply заявка с применёнными изменениями
+func (u leadUpdate) apply(lead models.Lead) models.Lead {
+	if u.statusID != nil {
+		lead.StatusID = *u.statusID
+	}
+	lead.RewardInternet = valueOr(u.rewardInternet, lead.RewardInternet)
+	lead.RewardCleaning = valueOr(u.rewardCleaning, lead.RewardCleaning)
+	lead.RewardShipping = valueOr(u.rewardShipping, lead.RewardShipping)
+
+	return lead
+}
+
+// auditState состояние изменённых полей заявки до и после обновления
+func (u leadUpdate) auditState(lead models.Lead) (map[string]any, map[string]any) {
+	before := make(map[string]any)
+	after := make(map[string]any)
+
+	if u.statusID != nil {
+		before["status_id"], after["status_id"] = lead.StatusID, *u.statusID
+	}
+	if u.rewardInternet != nil {
+		before["reward_internet"], after["reward_internet"] = lead.RewardInternet, *u.rewardInternet
+	}
+	if u.rewardCleaning != nil {
+		before["reward_cleaning"], after["reward_cleaning"] = lead.RewardCleaning, *u.rewardCleaning
+	}
+	if u.rewardShipping != nil {
+		before["reward_shipping"], after["reward_shipping"] = lead.RewardShipping, *u.rewardShipping
+	}
+	if u.completedAt != nil {
+		before["completed_at"], after["completed_at"] = lead.CompletedAt, *u.completedAt
+	}
+	if u.paymentAt != nil {
+		before["payment_at"], after["payment_at"] = lead.PaymentAt, *u.paymentAt
+	}
+
+	return before, after
+}
+
+func valueOr(value *money.Money, fallback money.Money) money.Money {
+	if value != nil {
+		return *value
+	}
+	return fallback
+}
+
+// history описывает изменения как записи истории со старыми и новыми значениями
+func (u leadUpdate) history(lead models.Lead, source string) []models.HistoryEntry {
+	var entries []models.HistoryEntry
+
+	add := func(action, field string, oldValue, newValue *string) {
+		entries = append(entries, models.HistoryEntry{
+			LeadID:   lead.ID,
+			Action:   action,
+			Field:    field,
+			OldValue: oldValue,
+			NewValue: newValue,
+			Source:   source,
+		})
+	}
+
+	formatInt := func(v int64) *string {
+		s := strconv.FormatInt(v, 10)
+		return &s
+	}
+	formatMoney := func(v money.Money) *string {
+		s := v.String()
+		return &s
+	}
+	formatTime := func(v *time.Time) *string {
+		if v == nil {
+			return nil
+		}
+		s := v.Format(time.RFC3339)
+		return &s
+	}
+
+	if u.statusID != nil {
+		add(models.HistoryActionStatusChanged, "status_id", formatInt(lead.StatusID), formatInt(*u.statusID))
+	}
+	if u.rewardInternet != nil {
+		add(models.HistoryActionRewardChanged, "reward_internet", formatMoney(lead.RewardInternet), formatMoney(*u.rewardInternet))
+	}
+	if u.rewardCleaning != nil {
+		add(models.HistoryActionRewardChanged, "reward_cleaning", formatMoney(lead.RewardCleaning), formatMoney(*u.rewardCleaning))
+	}
+	if u.rewardShipping != nil {
+		add(models.HistoryActionRewardChanged, "reward_shipping", formatMoney(lead.RewardShipping), formatMoney(*u.rewardShipping))
+	}
+	if u.completedAt != nil {
+		add(models.HistoryActionDateChanged, "completed_at", formatTime(lead.CompletedAt), formatTime(u.completedAt))
+	}
+	if u.paymentAt != nil {
+		add(models.HistoryActionDateChanged, "payment_at", formatTime(lead.PaymentAt), formatTime(u.paymentAt))
+	}
+
+	return entries
+}
+
+// LeadHistory возвращает историю изменений заявки. Партнёр видит только свои заявки, менеджер — все.
+func (l *LeadService) LeadHistory(ctx context.Context, leadID int64) ([]dto.LeadHistoryDTO, error) {
+	const op = "LeadService.LeadHistory"
+
+	userID, ok := ctx.Value(context_keys.UserIDKey).(int64)
+	if !ok {
+		return nil, fmt.Errorf("%s: error receiving userID", op)
+	}
+
+	userRoles, ok := ctx.Value(context_keys.UserRoleKey).([]string)
+	if !ok {
+		return nil, fmt.Errorf("%s: error receiving user roles", op)
+	}
+
+	lead, err := l.LeadRepository.LeadByID(ctx, leadID)
+	if err != nil {
+		if errors.Is(err, storage.ErrLeadNotFound) {
+			return nil, ErrLeadNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if lead.UserID != userID && !utils.Contains(userRoles, "manager") {
+		return nil, ErrLeadDoesNotBelongToUser
+	}
+
+	entries, err := l.HistoryRepository.LeadHistory(ctx, leadID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result := make([]dto.LeadHistoryDTO, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, dto.LeadHistoryDTO{
+			ID:        entry.ID,
+			Action:    entry.Action,
+			Field:     entry.Field,
+			OldValue:  entry.OldValue,
+			NewValue:  entry.NewValue,
+			OldStatus: entry.OldStatus,
+			NewStatus: entry.NewStatus,
+			Source:    entry.Source,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
 func (l *LeadService) GetUserPaymentStatistic(ctx context.Context, userID int64, startDate *time.Time, endDate *time.Time) (dto.UserStatistic, error) {
 	const op = "LeadService.GetUserPaymentStatistic"
 
@@ -282,7 +711,12 @@ func (l *LeadService) GetUserPaymentStatistic(ctx context.Context, userID int64,
 		result.Referrals += referral.Cost
 	}
 
-	result.Total = result.Cleaning + result.Referrals + result.Internet + result.Shipping
+	result.Commissions, err = l.ReferralService.Earnings(ctx, userID, startDate, endDate)
+	if err != nil {
+		return dto.UserStatistic{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	result.Total = result.Cleaning + result.Referrals + result.Commissions + result.Internet + result.Shipping
 
 	result.StartDate = startDate
 
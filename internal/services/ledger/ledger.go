@@ -0,0 +1,342 @@
+// Package ledger. Баланс партнёров по двойной записи: начисления за заявки и рефералов, выплаты и корректировки.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/audit"
+	"ia-online-golang/internal/services/user"
+	"ia-online-golang/internal/storage"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxLedgerLimit больше проводок за один запрос не отдаётся
+const maxLedgerLimit = 100
+
+type LedgerService struct {
+	log                *logrus.Logger
+	LedgerRepository   storage.LedgerRepositoryI
+	LeadRepository     storage.LeadRepositoryI
+	ReferralRepository storage.ReferralRepositoryI
+	UserRepository     storage.UserRepositoryI
+	AuditService       audit.AuditServiceI
+}
+
+type LedgerServiceI interface {
+	SyncLeadReward(ctx context.Context, lead models.Lead) error
+	SyncReferralBonus(ctx context.Context, referral models.Referral) error
+	SyncReferralCommission(ctx context.Context, commission models.ReferralCommission) error
+	SyncAll(ctx context.Context) error
+	Payout(ctx context.Context, userID int64, payoutDTO dto.PayoutDTO) error
+	Adjust(ctx context.Context, userID int64, adjustmentDTO dto.AdjustmentDTO) error
+	Balance(ctx context.Context, userID int64) (dto.BalanceDTO, error)
+	Ledger(ctx context.Context, userID int64, limit, offset int64) (dto.LedgerPageDTO, error)
+}
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrSelfOperation       = errors.New("operation not allowed on own balance")
+	ErrDuplicatePayout     = errors.New("payout with this reference already booked")
+)
+
+func New(
+	log *logrus.Logger,
+	ledgerRepository storage.LedgerRepositoryI,
+	leadRepository storage.LeadRepositoryI,
+	referralRepository storage.ReferralRepositoryI,
+	userRepository storage.UserRepositoryI,
+	auditService audit.AuditServiceI,
+) *LedgerService {
+	return &LedgerService{
+		log:                log,
+		LedgerRepository:   ledgerRepository,
+		LeadRepository:     leadRepository,
+		ReferralRepository: referralRepository,
+		UserRepository:     userRepository,
+		AuditService:       auditService,
+	}
+}
+
+// SyncLeadReward приводит начисление за заявку к её вознаграждению. В статусах «Готова» и «Оплачено»
+// начисляется сумма вознаграждений, в остальных ноль, поэтому изменение суммы в битриксе
+// или откат статуса проводятся корректирующей проводкой.
+func (l *LedgerService) SyncLeadReward(ctx context.Context, lead models.Lead) error {
+	op := "LedgerService.SyncLeadReward"
+
+	var target money.Money
+	if lead.StatusID == models.LeadStatusReady || lead.StatusID == models.LeadStatusPaid {
+		target = lead.RewardInternet + lead.RewardCleaning + lead.RewardShipping
+	}
+
+	posted, err := l.LedgerRepository.SyncLedgerAccrual(ctx, models.LedgerTransaction{
+		Kind:       models.LedgerKindLeadReward,
+		UserID:     lead.UserID,
+		Reason:     fmt.Sprintf("Вознаграждение за заявку %d", lead.ID),
+		SourceType: models.LedgerSourceLead,
+		SourceID:   strconv.FormatInt(lead.ID, 10),
+	}, target)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if posted {
+		l.log.Infof("%s: lead %d reward synced to %s", op, lead.ID, target)
+	}
+
+	return nil
+}
+
+// SyncReferralBonus начисляет бонус владельцу реферального кода, когда приглашённый становится активным
+func (l *LedgerService) SyncReferralBonus(ctx context.Context, referral models.Referral) error {
+	op := "LedgerService.SyncReferralBonus"
+
+	referrer, err := l.UserRepository.UserByReferralCode(ctx, referral.ReferralCode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var target money.Money
+	if referral.Active {
+		target = referral.Cost
+	}
+
+	posted, err := l.LedgerRepository.SyncLedgerAccrual(ctx, models.LedgerTransaction{
+		Kind:       models.LedgerKindReferralBonus,
+		UserID:     referrer.ID,
+		Reason:     fmt.Sprintf("Бонус за реферала %d", referral.UserID),
+		SourceType: models.LedgerSourceReferral,
+		SourceID:   strconv.FormatInt(referral.ID, 10),
+	}, target)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if posted {
+		l.log.Infof("%s: referral %d bonus synced to %s", op, referral.ID, target)
+	}
+
+	return nil
+}
+
+// SyncReferralCommission доводит начисление процента с заявки приглашённого до суммы, рассчитанной ReferralService
+func (l *LedgerService) SyncReferralCommission(ctx context.Context, commission models.ReferralCommission) error {
+	op := "LedgerService.SyncReferralCommission"
+
+	posted, err := l.LedgerRepository.SyncLedgerAccrual(ctx, models.LedgerTransaction{
+		Kind:       models.LedgerKindReferralCommission,
+		UserID:     commission.UserID,
+		Reason:     fmt.Sprintf("Процент с заявки %d реферала %d уровня %d", commission.LeadID, commission.SourceUserID, commission.Level),
+		SourceType: models.LedgerSourceReferralCommission,
+		SourceID:   strconv.FormatInt(commission.ID, 10),
+	}, commission.Amount)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if posted {
+		l.log.Infof("%s: commission %d synced to %s", op, commission.ID, commission.Amount)
+	}
+
+	return nil
+}
+
+// SyncAll сверяет начисления со всеми заявками, рефералами и процентами с заявок приглашённых.
+// Досоздаёт проводки, которые не удалось провести сразу, и переносит в книгу историю, накопленную до её появления.
+func (l *LedgerService) SyncAll(ctx context.Context) error {
+	op := "LedgerService.SyncAll"
+
+	var failed int
+	err := l.LeadRepository.EachLead(ctx, nil, nil, func(lead models.Lead) error {
+		if err := l.SyncLeadReward(ctx, lead); err != nil {
+			l.log.Errorf("%s: %v", op, err)
+			failed++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	referrals, err := l.ReferralRepository.Referrals(ctx)
+	if err != nil && !errors.Is(err, storage.ErrReferralsNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, referral := range referrals {
+		if err := l.SyncReferralBonus(ctx, referral); err != nil {
+			l.log.Errorf("%s: %v", op, err)
+			failed++
+		}
+	}
+
+	commissions, err := l.ReferralRepository.ReferralCommissions(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, commission := range commissions {
+		if err := l.SyncReferralCommission(ctx, commission); err != nil {
+			l.log.Errorf("%s: %v", op, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%s: %d sources failed to sync", op, failed)
+	}
+
+	return nil
+}
+
+// Payout отражает выплату партнёру. Выплатить можно только баланс к выплате за вычетом открытых заявок,
+// повторная выплата по тому же платёжному поручению отклоняется.
+func (l *LedgerService) Payout(ctx context.Context, userID int64, payoutDTO dto.PayoutDTO) error {
+	op := "LedgerService.Payout"
+
+	txn := models.LedgerTransaction{
+		Kind:       models.LedgerKindPayout,
+		UserID:     userID,
+		Reason:     payoutDTO.Reason,
+		SourceType: models.LedgerSourcePaymentOrder,
+		SourceID:   payoutDTO.Reference,
+	}
+
+	event := audit.Event{
+		Action:     audit.ActionLedgerPayout,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Details:    map[string]any{"amount": payoutDTO.Amount, "reason": payoutDTO.Reason, "reference": payoutDTO.Reference},
+	}
+
+	if err := l.save(ctx, txn, -payoutDTO.Amount, event); err != nil {
+		if errors.Is(err, ErrInsufficientBalance) || errors.Is(err, ErrSelfOperation) || errors.Is(err, ErrDuplicatePayout) || errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Adjust исправляет баланс вручную. Списание не может затронуть сумму, зарезервированную открытыми заявками на выплату.
+func (l *LedgerService) Adjust(ctx context.Context, userID int64, adjustmentDTO dto.AdjustmentDTO) error {
+	op := "LedgerService.Adjust"
+
+	txn := models.LedgerTransaction{
+		Kind:       models.LedgerKindAdjustment,
+		UserID:     userID,
+		Reason:     adjustmentDTO.Reason,
+		SourceType: models.LedgerSourceManual,
+		SourceID:   adjustmentDTO.Reference,
+	}
+
+	event := audit.Event{
+		Action:     audit.ActionLedgerAdjustment,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Details:    map[string]any{"amount": adjustmentDTO.Amount, "reason": adjustmentDTO.Reason, "reference": adjustmentDTO.Reference},
+	}
+
+	if err := l.save(ctx, txn, adjustmentDTO.Amount, event); err != nil {
+		if errors.Is(err, ErrInsufficientBalance) || errors.Is(err, ErrSelfOperation) || errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (l *LedgerService) Balance(ctx context.Context, userID int64) (dto.BalanceDTO, error) {
+	op := "LedgerService.Balance"
+
+	balance, err := l.LedgerRepository.LedgerBalance(ctx, userID)
+	if err != nil {
+		return dto.BalanceDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return dto.BalanceDTO{
+		Accrued:   balance.Accrued,
+		Pending:   balance.Pending,
+		Paid:      balance.Paid,
+		Reserved:  balance.Reserved,
+		Available: balance.Pending - balance.Reserved,
+	}, nil
+}
+
+func (l *LedgerService) Ledger(ctx context.Context, userID int64, limit, offset int64) (dto.LedgerPageDTO, error) {
+	op := "LedgerService.Ledger"
+
+	if limit <= 0 || limit > maxLedgerLimit {
+		limit = maxLedgerLimit
+	}
+
+	records, total, err := l.LedgerRepository.LedgerRecords(ctx, userID, limit, offset)
+	if err != nil {
+		return dto.LedgerPageDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := dto.LedgerPageDTO{
+		Entries: make([]dto.LedgerEntryDTO, 0, len(records)),
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	for _, record := range records {
+		page.Entries = append(page.Entries, dto.LedgerEntryDTO{
+			ID:         record.ID,
+			Kind:       record.Kind,
+			Amount:     record.Amount,
+			Reason:     record.Reason,
+			SourceType: record.SourceType,
+			SourceID:   record.SourceID,
+			CreatedBy:  record.CreatedBy,
+			CreatedAt:  record.CreatedAt,
+		})
+	}
+
+	return page, nil
+}
+
+// save проводит операцию менеджера от его имени. Проводить операции по своему балансу нельзя.
+func (l *LedgerService) save(ctx context.Context, txn models.LedgerTransaction, amount money.Money, event audit.Event) error {
+	if actorID, ok := ctx.Value(context_keys.UserIDKey).(int64); ok {
+		if actorID == txn.UserID {
+			return ErrSelfOperation
+		}
+		txn.CreatedBy = &actorID
+	}
+
+	if _, err := l.UserRepository.UserById(ctx, txn.UserID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return user.ErrUserNotFound
+		}
+		return err
+	}
+
+	// Операция проводится только вместе с записью в журнале
+	auditEvent, err := l.AuditService.Prepare(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	err = l.LedgerRepository.SaveLedgerTransaction(ctx, txn, amount, auditEvent)
+	if err != nil {
+		if errors.Is(err, storage.ErrInsufficientBalance) {
+			return ErrInsufficientBalance
+		}
+		if errors.Is(err, storage.ErrDuplicateReference) {
+			return ErrDuplicatePayout
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/bitrix"
+	"ia-online-golang/internal/services/user"
+	"ia-online-golang/internal/storage"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// claimLease время, на которое сообщение закрепляется за воркером
+const claimLease = 5 * time.Minute
+
+// OutboxService фоновый воркер, который отправляет сохранённые заявки и комментарии к ним в битрикс
+type OutboxService struct {
+	log              *logrus.Logger
+	cfg              config.OutboxConfig
+	BitrixService    bitrix.BitrixServiceI
+	UserService      user.UserServiceI
+	LeadRepository   storage.LeadRepositoryI
+	OutboxRepository storage.OutboxRepositoryI
+}
+
+type OutboxServiceI interface {
+	Run(ctx context.Context)
+	ProcessPending(ctx context.Context) (int, error)
+}
+
+func New(
+	log *logrus.Logger,
+	cfg config.OutboxConfig,
+	bitrixService bitrix.BitrixServiceI,
+	userService user.UserServiceI,
+	leadRepository storage.LeadRepositoryI,
+	outboxRepository storage.OutboxRepositoryI,
+) *OutboxService {
+	return &OutboxService{
+		log:              log,
+		cfg:              cfg,
+		BitrixService:    bitrixService,
+		UserService:      userService,
+		LeadRepository:   leadRepository,
+		OutboxRepository: outboxRepository,
+	}
+}
+
+// Run обрабатывает очередь с заданным интервалом, пока не отменён контекст
+func (o *OutboxService) Run(ctx context.Context) {
+	const op = "OutboxService.Run"
+
+	ticker := time.NewTicker(o.cfg.Interval)
+	defer ticker.Stop()
+
+	o.log.Infof("%s: outbox worker started", op)
+
+	for {
+		// Разбираем очередь целиком, пока есть готовые сообщения
+		for {
+			processed, err := o.ProcessPending(ctx)
+			if err != nil {
+				o.log.Errorf("%s: %v", op, err)
+				break
+			}
+			if processed < int(o.cfg.BatchSize) || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			o.log.Infof("%s: outbox worker stopped", op)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessPending отправляет одну пачку сообщений и возвращает их количество
+func (o *OutboxService) ProcessPending(ctx context.Context) (int, error) {
+	const op = "OutboxService.ProcessPending"
+
+	messages, err := o.OutboxRepository.ClaimOutboxMessages(ctx, o.cfg.BatchSize, claimLease)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, message := range messages {
+		// Начатую отправку доводим до конца, даже если воркер останавливается
+		o.process(context.WithoutCancel(ctx), message)
+	}
+
+	return len(messages), nil
+}
+
+func (o *OutboxService) process(ctx context.Context, message models.OutboxMessage) {
+	const op = "OutboxService.process"
+
+	var err error
+	switch message.Event {
+	case models.OutboxEventCreateDeal:
+		err = o.createDeal(ctx, message)
+	case models.OutboxEventCreateComment:
+		err = o.createComment(ctx, message)
+	default:
+		err = fmt.Errorf("unknown event %s", message.Event)
+	}
+	if err == nil {
+		return
+	}
+
+	attempts := message.Attempts + 1
+	if attempts >= o.cfg.MaxAttempts {
+		o.log.Errorf("%s: message %d for lead %d failed after %d attempts: %v", op, message.ID, message.LeadID, attempts, err)
+
+		if err := o.OutboxRepository.FailOutboxMessage(ctx, message.ID, message.LeadID, attempts, err.Error()); err != nil {
+			o.log.Errorf("%s: %v", op, err)
+		}
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(o.backoff(attempts))
+
+	o.log.Warnf("%s: message %d for lead %d failed (attempt %d), next attempt at %s: %v",
+		op, message.ID, message.LeadID, attempts, nextAttemptAt.Format(time.RFC3339), err)
+
+	if err := o.OutboxRepository.RetryOutboxMessage(ctx, message.ID, attempts, nextAttemptAt, err.Error()); err != nil {
+		o.log.Errorf("%s: %v", op, err)
+	}
+}
+
+func (o *OutboxService) createDeal(ctx context.Context, message models.OutboxMessage) error {
+	const op = "OutboxService.createDeal"
+
+	var leadDTO dto.CreateLeadDTO
+	if err := json.Unmarshal(message.Payload, &leadDTO); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	lead, err := o.LeadRepository.LeadByID(ctx, message.LeadID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Комментарий ставится в очередь вместе с завершением сделки, чтобы не потеряться при ошибке отправки
+	var next []models.OutboxMessage
+	if leadDTO.Comment != "" {
+		payload, err := json.Marshal(models.OutboxComment{UserID: lead.UserID, Text: leadDTO.Comment})
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		next = append(next, models.OutboxMessage{Event: models.OutboxEventCreateComment, Payload: payload})
+	}
+
+	// Сделка создана при прошлой попытке, повторяется только сохранение
+	if message.BitrixID != nil {
+		if err := o.OutboxRepository.CompleteOutboxMessage(ctx, message.ID, lead.ID, *message.BitrixID, next); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		o.log.Infof("%s: lead %d synced with deal %d", op, lead.ID, *message.BitrixID)
+		return nil
+	}
+
+	originID := strconv.FormatInt(lead.ID, 10)
+
+	// Контакт создаётся отдельным шагом, его id сохраняется до создания сделки. Если он уже есть, сделка могла
+	// быть создана при прошлой попытке без сохранения результата, её ищем по ORIGIN_ID.
+	var contactID int64
+	if message.ContactID != nil {
+		contactID = *message.ContactID
+
+		dealID, err := o.BitrixService.DealByOrigin(ctx, originID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if dealID != 0 {
+			if err := o.OutboxRepository.CompleteOutboxMessage(ctx, message.ID, lead.ID, dealID, next); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			o.log.Infof("%s: lead %d synced with existing deal %d", op, lead.ID, dealID)
+			return nil
+		}
+	} else {
+		contact, err := o.BitrixService.SendContact(ctx, leadDTO)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		contactID = int64(contact.Result)
+
+		// Без сохранённого контакта сделку не создаём: повторная попытка создала бы второй контакт
+		if err := o.OutboxRepository.SaveOutboxContactID(ctx, message.ID, contactID); err != nil {
+			return fmt.Errorf("%s: contact %d created but not saved: %w", op, contactID, err)
+		}
+	}
+
+	userDTO, err := o.UserService.UserById(ctx, lead.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	result, err := o.BitrixService.SendDeal(ctx, leadDTO, userDTO, contactID, originID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	bitrixID := int64(result.Result)
+
+	if err := o.OutboxRepository.CompleteOutboxMessage(ctx, message.ID, lead.ID, bitrixID, next); err != nil {
+		o.saveBitrixID(ctx, message, bitrixID)
+		return fmt.Errorf("%s: deal %d created but not saved: %w", op, bitrixID, err)
+	}
+
+	o.log.Infof("%s: lead %d synced with deal %d", op, lead.ID, bitrixID)
+
+	return nil
+}
+
+func (o *OutboxService) createComment(ctx context.Context, message models.OutboxMessage) error {
+	const op = "OutboxService.createComment"
+
+	var payload models.OutboxComment
+	if err := json.Unmarshal(message.Payload, &payload); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	comment := models.Comment{
+		LeadID: message.LeadID,
+		UserID: payload.UserID,
+		Text:   payload.Text,
+	}
+
+	if message.BitrixID != nil {
+		comment.ID = *message.BitrixID
+		if err := o.OutboxRepository.CompleteOutboxComment(ctx, message.ID, comment); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	lead, err := o.LeadRepository.LeadByID(ctx, message.LeadID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if lead.BitrixID == nil {
+		return fmt.Errorf("%s: lead %d is not synced with bitrix", op, lead.ID)
+	}
+
+	result, err := o.BitrixService.SendComment(ctx, *lead.BitrixID, payload.Text)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	comment.ID = int64(result.Result)
+
+	if err := o.OutboxRepository.CompleteOutboxComment(ctx, message.ID, comment); err != nil {
+		o.saveBitrixID(ctx, message, comment.ID)
+		return fmt.Errorf("%s: comment %d created but not saved: %w", op, comment.ID, err)
+	}
+
+	o.log.Infof("%s: comment %d sent for lead %d", op, comment.ID, lead.ID)
+
+	return nil
+}
+
+// saveBitrixID запоминает результат уже выполненного вызова, чтобы следующая попытка только сохранила его.
+// Если не удалось и это, сообщение уйдёт повторно и создаст дубль, поэтому id остаётся в логах для ручного разбора.
+func (o *OutboxService) saveBitrixID(ctx context.Context, message models.OutboxMessage, bitrixID int64) {
+	const op = "OutboxService.saveBitrixID"
+
+	if err := o.OutboxRepository.SaveOutboxBitrixID(ctx, message.ID, bitrixID); err != nil {
+		o.log.Errorf("%s: %s %d created for lead %d but not saved, message %d will be resent: %v",
+			op, message.Event, bitrixID, message.LeadID, message.ID, err)
+	}
+}
+
+// backoff экспоненциальная задержка перед следующей попыткой
+func (o *OutboxService) backoff(attempts int) time.Duration {
+	delay := o.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= o.cfg.MaxBackoff {
+			return o.cfg.MaxBackoff
+		}
+	}
+
+	return delay
+}
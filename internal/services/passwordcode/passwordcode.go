@@ -1,105 +1,125 @@
 package passwordcode
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"ia-online-golang/internal/config"
 	"ia-online-golang/internal/models"
 	"ia-online-golang/internal/storage"
 	"ia-online-golang/internal/utils"
 	"time"
 
 	"github.com/sirupsen/logrus"
-	"golang.org/x/net/context"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// codeLength длина кода из цифр и заглавных латинских букв
+const codeLength = 6
+
 type PasswordCodeService struct {
 	log                    *logrus.Logger
+	cfg                    config.PasswordResetConfig
 	PasswordCodeRepository storage.PasswordCodeRepositoryI
 }
 
 type PasswordCodeServiceI interface {
-	PasswordCode(ctx context.Context, password_code string) (models.PasswordCode, error)
 	GeneratePasswordCode(ctx context.Context, userID int64) (string, error)
-	DeleteRefreshToken(ctx context.Context, code string) error
+	UsePasswordCode(ctx context.Context, userID int64, code string) error
+	CodeTTL() time.Duration
 }
 
 var (
-	ErrPasswordCodeIsNotFound = errors.New("password code is not found")
-	ErrPasswordCodeIncorrect  = errors.New("password code incorrect")
-	ErrPasswordCodeHasExpired = errors.New("password code has expired")
+	ErrPasswordCodeIsNotFound       = errors.New("password code is not found")
+	ErrPasswordCodeIncorrect        = errors.New("password code incorrect")
+	ErrPasswordCodeHasExpired       = errors.New("password code has expired")
+	ErrPasswordCodeAttemptsExceeded = errors.New("password code attempts exceeded")
 )
 
-func New(log *logrus.Logger, passwordCodeRepository storage.PasswordCodeRepositoryI) *PasswordCodeService {
+func New(log *logrus.Logger, cfg config.PasswordResetConfig, passwordCodeRepository storage.PasswordCodeRepositoryI) *PasswordCodeService {
 	return &PasswordCodeService{
 		log:                    log,
+		cfg:                    cfg,
 		PasswordCodeRepository: passwordCodeRepository,
 	}
 }
 
-func (p *PasswordCodeService) PasswordCode(ctx context.Context, password_code string) (models.PasswordCode, error) {
-	op := "PasswordCodeService.PasswordCode"
-
-	code, err := p.PasswordCodeRepository.PasswordCode(ctx, password_code)
-	if err != nil {
-		if errors.Is(err, storage.ErrPasswordCodeIsNotFound) {
-			return models.PasswordCode{}, ErrPasswordCodeIsNotFound
-		}
-
-		return models.PasswordCode{}, fmt.Errorf("%s:%w", op, err)
-	}
-
-	return code, nil
-}
+// GeneratePasswordCode создаёт новый код и заменяет им предыдущий. В БД сохраняется только хеш.
 func (p *PasswordCodeService) GeneratePasswordCode(ctx context.Context, userID int64) (string, error) {
 	op := "PasswordCodeService.GeneratePasswordCode"
 
-	now := time.Now()
-	tomorrow := now.Add(24 * time.Hour)
+	code, err := utils.GeneratePasswordCode(codeLength)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
 
-	newCode, err := utils.GeneratePasswordCode(6)
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	result := models.PasswordCode{
+	err = p.PasswordCodeRepository.SavePasswordCode(ctx, models.PasswordCode{
 		UserID:    userID,
-		Code:      newCode,
-		ExpiresAt: tomorrow,
+		CodeHash:  string(codeHash),
+		ExpiresAt: time.Now().Add(p.cfg.CodeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	password_code, err := p.PasswordCodeRepository.PasswordCodeByUserId(ctx, userID)
-	if err != nil {
-		if errors.Is(err, storage.ErrPasswordCodeIsNotFound) {
+	return code, nil
+}
 
-			err := p.PasswordCodeRepository.SavePasswordCode(ctx, result)
-			if err != nil {
-				return "", fmt.Errorf("%s: %w", op, err)
-			}
+// UsePasswordCode проверяет код и гасит его. Код одноразовый, живёт CodeTTL и допускает MaxAttempts попыток.
+func (p *PasswordCodeService) UsePasswordCode(ctx context.Context, userID int64, code string) error {
+	op := "PasswordCodeService.UsePasswordCode"
 
-			return result.Code, nil
+	passwordCode, err := p.PasswordCodeRepository.AttemptPasswordCode(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordCodeIsNotFound) {
+			return ErrPasswordCodeIsNotFound
 		}
 
-		return "", fmt.Errorf("%s:%w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if now.After(password_code.ExpiresAt) {
-		err := p.PasswordCodeRepository.UpdatePasswordCode(ctx, result)
-		if err != nil {
-			return "", fmt.Errorf("%s:%w", op, err)
-		}
+	if time.Now().After(passwordCode.ExpiresAt) {
+		p.deletePasswordCode(ctx, passwordCode.ID)
+		return ErrPasswordCodeHasExpired
+	}
 
-		return result.Code, nil
+	if passwordCode.Attempts > p.cfg.MaxAttempts {
+		p.deletePasswordCode(ctx, passwordCode.ID)
+		return ErrPasswordCodeAttemptsExceeded
 	}
 
-	return password_code.Code, nil
-}
-func (p *PasswordCodeService) DeleteRefreshToken(ctx context.Context, code string) error {
-	op := "PasswordCodeService.GeneratePasswordCode"
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordCode.CodeHash), []byte(code)); err != nil {
+		return ErrPasswordCodeIncorrect
+	}
 
-	err := p.PasswordCodeRepository.DeletePasswordCode(ctx, code)
+	err = p.PasswordCodeRepository.DeletePasswordCode(ctx, passwordCode.ID)
 	if err != nil {
+		// Код уже использовали параллельным запросом
+		if errors.Is(err, storage.ErrPasswordCodeIsNotFound) {
+			return ErrPasswordCodeIsNotFound
+		}
+
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
+
+// CodeTTL срок жизни кода, указывается в письме
+func (p *PasswordCodeService) CodeTTL() time.Duration {
+	return p.cfg.CodeTTL
+}
+
+func (p *PasswordCodeService) deletePasswordCode(ctx context.Context, id int) {
+	op := "PasswordCodeService.deletePasswordCode"
+
+	err := p.PasswordCodeRepository.DeletePasswordCode(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrPasswordCodeIsNotFound) {
+		p.log.Errorf("%s: %v", op, err)
+	}
+}
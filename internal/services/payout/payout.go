@@ -0,0 +1,496 @@
+// Package payout. Заявки партнёров на выплату и их рассмотрение менеджерами.
+package payout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/audit"
+	"ia-online-golang/internal/services/email"
+	"ia-online-golang/internal/storage"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxPayoutsLimit больше заявок за один запрос не отдаётся
+const maxPayoutsLimit = 100
+
+type PayoutService struct {
+	log              *logrus.Logger
+	cipher           *detailsCipher
+	PayoutRepository storage.PayoutRepositoryI
+	UserRepository   storage.UserRepositoryI
+	EmailService     email.EmailServiceI
+	AuditService     audit.AuditServiceI
+}
+
+type PayoutServiceI interface {
+	Create(ctx context.Context, userID int64, createDTO dto.CreatePayoutRequestDTO) (dto.PayoutRequestDTO, error)
+	UserRequests(ctx context.Context, userID int64, limit, offset int64) (dto.PayoutPageDTO, error)
+	UserRequest(ctx context.Context, userID int64, id int64) (dto.PayoutRequestDTO, error)
+	Cancel(ctx context.Context, userID int64, id int64, comment string) error
+	Requests(ctx context.Context, filterDTO dto.PayoutFilterDTO) (dto.PayoutPageDTO, error)
+	Request(ctx context.Context, id int64) (dto.PayoutRequestDTO, error)
+	Approve(ctx context.Context, id int64, comment string) error
+	Reject(ctx context.Context, id int64, comment string) error
+	MarkPaid(ctx context.Context, id int64, comment string) error
+}
+
+var (
+	ErrPayoutRequestNotFound = errors.New("payout request not found")
+	ErrPayoutStatusConflict  = errors.New("payout request status does not allow transition")
+	ErrInsufficientBalance   = errors.New("insufficient balance")
+	ErrSelfReview            = errors.New("payout request can not be reviewed by its author")
+)
+
+func New(
+	log *logrus.Logger,
+	cfg config.PayoutConfig,
+	payoutRepository storage.PayoutRepositoryI,
+	userRepository storage.UserRepositoryI,
+	emailService email.EmailServiceI,
+	auditService audit.AuditServiceI,
+) (*PayoutService, error) {
+	cipher, err := newDetailsCipher(cfg.DetailsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PayoutService{
+		log:              log,
+		cipher:           cipher,
+		PayoutRepository: payoutRepository,
+		UserRepository:   userRepository,
+		EmailService:     emailService,
+		AuditService:     auditService,
+	}, nil
+}
+
+// Create подаёт заявку на выплату. Сумма не может превышать баланс к выплате за вычетом открытых заявок.
+func (p *PayoutService) Create(ctx context.Context, userID int64, createDTO dto.CreatePayoutRequestDTO) (dto.PayoutRequestDTO, error) {
+	op := "PayoutService.Create"
+
+	details := dto.PayoutDetailsDTO{
+		Card:        createDTO.Card,
+		SBP:         createDTO.SBP,
+		BankAccount: createDTO.BankAccount,
+	}
+
+	plaintext, err := json.Marshal(details)
+	if err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	encrypted, err := p.cipher.encrypt(plaintext)
+	if err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	request := models.PayoutRequest{
+		UserID:      userID,
+		Amount:      createDTO.Amount,
+		Method:      createDTO.Method,
+		Details:     encrypted,
+		DetailsMask: maskDetails(details),
+	}
+
+	// id заявки в записи журнала заполняет хранилище
+	auditEvent, err := p.AuditService.Prepare(ctx, audit.Event{
+		Action:     audit.ActionPayoutRequested,
+		TargetType: audit.TargetPayoutRequest,
+		Details:    map[string]any{"amount": request.Amount, "method": request.Method},
+	})
+	if err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := p.PayoutRepository.SavePayoutRequest(ctx, request, createDTO.Comment, auditEvent)
+	if err != nil {
+		if errors.Is(err, storage.ErrInsufficientBalance) {
+			return dto.PayoutRequestDTO{}, ErrInsufficientBalance
+		}
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	request, err = p.PayoutRepository.PayoutRequest(ctx, id)
+	if err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p.log.Infof("%s: payout request %d for %s created by user %d", op, id, request.Amount, userID)
+
+	p.notify(ctx, request, models.PayoutStatusRequested, createDTO.Comment)
+
+	return payoutToDTO(request), nil
+}
+
+func (p *PayoutService) UserRequests(ctx context.Context, userID int64, limit, offset int64) (dto.PayoutPageDTO, error) {
+	op := "PayoutService.UserRequests"
+
+	page, err := p.requests(ctx, models.PayoutFilter{UserID: &userID, Limit: limit, Offset: offset})
+	if err != nil {
+		return dto.PayoutPageDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return page, nil
+}
+
+// UserRequest заявка партнёра с историей. Реквизиты партнёр видит только маской.
+func (p *PayoutService) UserRequest(ctx context.Context, userID int64, id int64) (dto.PayoutRequestDTO, error) {
+	op := "PayoutService.UserRequest"
+
+	request, err := p.userRequest(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, ErrPayoutRequestNotFound) {
+			return dto.PayoutRequestDTO{}, err
+		}
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	requestDTO := payoutToDTO(request)
+	if requestDTO.History, err = p.history(ctx, id); err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return requestDTO, nil
+}
+
+// Cancel отменяет заявку, пока менеджер её не рассмотрел
+func (p *PayoutService) Cancel(ctx context.Context, userID int64, id int64, comment string) error {
+	op := "PayoutService.Cancel"
+
+	request, err := p.userRequest(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, ErrPayoutRequestNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	event := audit.Event{Action: audit.ActionPayoutCancelled}
+	if err := p.transition(ctx, request, []string{models.PayoutStatusRequested}, models.PayoutStatusCancelled, comment, event); err != nil {
+		if errors.Is(err, ErrPayoutStatusConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (p *PayoutService) Requests(ctx context.Context, filterDTO dto.PayoutFilterDTO) (dto.PayoutPageDTO, error) {
+	op := "PayoutService.Requests"
+
+	page, err := p.requests(ctx, models.PayoutFilter{
+		UserID: filterDTO.UserID,
+		Status: filterDTO.Status,
+		Limit:  filterDTO.Limit,
+		Offset: filterDTO.Offset,
+	})
+	if err != nil {
+		return dto.PayoutPageDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return page, nil
+}
+
+// Request карточка заявки для менеджера с расшифрованными реквизитами. Каждый просмотр реквизитов пишется в журнал.
+func (p *PayoutService) Request(ctx context.Context, id int64) (dto.PayoutRequestDTO, error) {
+	op := "PayoutService.Request"
+
+	request, err := p.request(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrPayoutRequestNotFound) {
+			return dto.PayoutRequestDTO{}, err
+		}
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	plaintext, err := p.cipher.decrypt(request.Details)
+	if err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: decrypt details of request %d: %w", op, id, err)
+	}
+
+	var details dto.PayoutDetailsDTO
+	if err := json.Unmarshal(plaintext, &details); err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	requestDTO := payoutToDTO(request)
+	requestDTO.Details = &details
+	if requestDTO.History, err = p.history(ctx, id); err != nil {
+		return dto.PayoutRequestDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionPayoutDetailsViewed,
+		TargetType: audit.TargetPayoutRequest,
+		TargetID:   strconv.FormatInt(id, 10),
+	})
+
+	return requestDTO, nil
+}
+
+func (p *PayoutService) Approve(ctx context.Context, id int64, comment string) error {
+	op := "PayoutService.Approve"
+
+	request, err := p.reviewable(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	event := audit.Event{Action: audit.ActionPayoutApproved, Details: map[string]any{"comment": comment}}
+	if err := p.transition(ctx, request, []string{models.PayoutStatusRequested}, models.PayoutStatusApproved, comment, event); err != nil {
+		if errors.Is(err, ErrPayoutStatusConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Reject отклоняет заявку до выплаты, зарезервированная сумма снова доступна партнёру
+func (p *PayoutService) Reject(ctx context.Context, id int64, comment string) error {
+	op := "PayoutService.Reject"
+
+	request, err := p.reviewable(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	from := []string{models.PayoutStatusRequested, models.PayoutStatusApproved}
+	event := audit.Event{Action: audit.ActionPayoutRejected, Details: map[string]any{"comment": comment}}
+	if err := p.transition(ctx, request, from, models.PayoutStatusRejected, comment, event); err != nil {
+		if errors.Is(err, ErrPayoutStatusConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// MarkPaid отмечает одобренную заявку выплаченной и проводит выплату по книге
+func (p *PayoutService) MarkPaid(ctx context.Context, id int64, comment string) error {
+	op := "PayoutService.MarkPaid"
+
+	request, err := p.reviewable(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	event := models.PayoutRequestEvent{Status: models.PayoutStatusPaid, Comment: comment, AuthorID: actorID(ctx)}
+	txn := models.LedgerTransaction{
+		Kind:       models.LedgerKindPayout,
+		UserID:     request.UserID,
+		Reason:     fmt.Sprintf("Выплата по заявке %d", id),
+		SourceType: models.LedgerSourcePayoutRequest,
+		SourceID:   strconv.FormatInt(id, 10),
+		CreatedBy:  event.AuthorID,
+	}
+
+	auditEvent, err := p.AuditService.Prepare(ctx, audit.Event{
+		Action:     audit.ActionPayoutPaid,
+		TargetType: audit.TargetPayoutRequest,
+		TargetID:   strconv.FormatInt(id, 10),
+		Details:    map[string]any{"amount": request.Amount, "comment": comment},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := p.PayoutRepository.PayPayoutRequest(ctx, id, event, txn, auditEvent); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrPayoutStatusConflict):
+			return ErrPayoutStatusConflict
+		case errors.Is(err, storage.ErrPayoutRequestNotFound):
+			return ErrPayoutRequestNotFound
+		case errors.Is(err, storage.ErrInsufficientBalance):
+			return ErrInsufficientBalance
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	p.log.Infof("%s: payout request %d paid", op, id)
+
+	p.notify(ctx, request, models.PayoutStatusPaid, comment)
+
+	return nil
+}
+
+// reviewable загружает заявку для менеджера. Свою заявку менеджер рассматривать не может.
+func (p *PayoutService) reviewable(ctx context.Context, id int64) (models.PayoutRequest, error) {
+	op := "PayoutService.reviewable"
+
+	request, err := p.request(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrPayoutRequestNotFound) {
+			return models.PayoutRequest{}, err
+		}
+		return models.PayoutRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if actor := actorID(ctx); actor != nil && *actor == request.UserID {
+		return models.PayoutRequest{}, ErrSelfReview
+	}
+
+	return request, nil
+}
+
+// transition меняет статус заявки вместе с записью в журнале и сообщает партнёру
+func (p *PayoutService) transition(ctx context.Context, request models.PayoutRequest, from []string, status string, comment string, audited audit.Event) error {
+	event := models.PayoutRequestEvent{Status: status, Comment: comment, AuthorID: actorID(ctx)}
+
+	audited.TargetType = audit.TargetPayoutRequest
+	audited.TargetID = strconv.FormatInt(request.ID, 10)
+	auditEvent, err := p.AuditService.Prepare(ctx, audited)
+	if err != nil {
+		return err
+	}
+
+	if err := p.PayoutRepository.UpdatePayoutStatus(ctx, request.ID, from, event, auditEvent); err != nil {
+		if errors.Is(err, storage.ErrPayoutStatusConflict) {
+			return ErrPayoutStatusConflict
+		}
+		return err
+	}
+
+	p.log.Infof("PayoutService.transition: payout request %d %s -> %s", request.ID, request.Status, status)
+
+	p.notify(ctx, request, status, comment)
+
+	return nil
+}
+
+func (p *PayoutService) requests(ctx context.Context, filter models.PayoutFilter) (dto.PayoutPageDTO, error) {
+	if filter.Limit <= 0 || filter.Limit > maxPayoutsLimit {
+		filter.Limit = maxPayoutsLimit
+	}
+
+	requests, total, err := p.PayoutRepository.PayoutRequests(ctx, filter)
+	if err != nil {
+		return dto.PayoutPageDTO{}, err
+	}
+
+	page := dto.PayoutPageDTO{
+		Requests: make([]dto.PayoutRequestDTO, 0, len(requests)),
+		Total:    total,
+		Limit:    filter.Limit,
+		Offset:   filter.Offset,
+	}
+	for _, request := range requests {
+		page.Requests = append(page.Requests, payoutToDTO(request))
+	}
+
+	return page, nil
+}
+
+func (p *PayoutService) request(ctx context.Context, id int64) (models.PayoutRequest, error) {
+	request, err := p.PayoutRepository.PayoutRequest(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrPayoutRequestNotFound) {
+			return models.PayoutRequest{}, ErrPayoutRequestNotFound
+		}
+		return models.PayoutRequest{}, err
+	}
+
+	return request, nil
+}
+
+// userRequest чужая заявка для партнёра не существует
+func (p *PayoutService) userRequest(ctx context.Context, userID int64, id int64) (models.PayoutRequest, error) {
+	request, err := p.request(ctx, id)
+	if err != nil {
+		return models.PayoutRequest{}, err
+	}
+	if request.UserID != userID {
+		return models.PayoutRequest{}, ErrPayoutRequestNotFound
+	}
+
+	return request, nil
+}
+
+func (p *PayoutService) history(ctx context.Context, id int64) ([]dto.PayoutRequestEventDTO, error) {
+	events, err := p.PayoutRepository.PayoutRequestHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]dto.PayoutRequestEventDTO, 0, len(events))
+	for _, event := range events {
+		history = append(history, dto.PayoutRequestEventDTO{
+			Status:    event.Status,
+			Comment:   event.Comment,
+			AuthorID:  event.AuthorID,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	return history, nil
+}
+
+// notify пишет партнёру о смене статуса. Статус уже сменён, поэтому ошибка отправки только логируется.
+func (p *PayoutService) notify(ctx context.Context, request models.PayoutRequest, status string, comment string) {
+	op := "PayoutService.notify"
+
+	user, err := p.UserRepository.UserById(ctx, request.UserID)
+	if err != nil {
+		p.log.Errorf("%s: %v", op, err)
+		return
+	}
+
+	if err := p.EmailService.SendPayoutStatus(ctx, user.Email, request.ID, request.Amount, status, comment); err != nil {
+		p.log.Errorf("%s: %v", op, err)
+	}
+}
+
+func actorID(ctx context.Context) *int64 {
+	if id, ok := ctx.Value(context_keys.UserIDKey).(int64); ok {
+		return &id
+	}
+	return nil
+}
+
+// maskDetails оставляет открытыми последние цифры, по которым партнёр узнает свои реквизиты
+func maskDetails(details dto.PayoutDetailsDTO) string {
+	switch {
+	case details.Card != nil:
+		return "Карта •••• " + lastDigits(details.Card.Number, 4)
+	case details.SBP != nil:
+		return "СБП •••• " + lastDigits(details.SBP.PhoneNumber, 2) + ", " + details.SBP.BankName
+	case details.BankAccount != nil:
+		return "Счёт •••• " + lastDigits(details.BankAccount.AccountNumber, 4)
+	default:
+		return ""
+	}
+}
+
+func lastDigits(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	return value[len(value)-n:]
+}
+
+func payoutToDTO(request models.PayoutRequest) dto.PayoutRequestDTO {
+	return dto.PayoutRequestDTO{
+		ID:          request.ID,
+		UserID:      request.UserID,
+		Amount:      request.Amount,
+		Method:      request.Method,
+		DetailsMask: request.DetailsMask,
+		Status:      request.Status,
+		ReviewedBy:  request.ReviewedBy,
+		ReviewedAt:  request.ReviewedAt,
+		PaidAt:      request.PaidAt,
+		CreatedAt:   request.CreatedAt,
+		UpdatedAt:   request.UpdatedAt,
+	}
+}
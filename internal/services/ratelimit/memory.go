@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval как часто MemoryStore удаляет истёкшие счётчики
+const sweepInterval = time.Minute
+
+type counter struct {
+	count   int64
+	resetAt time.Time
+}
+
+// MemoryStore хранит счётчики в памяти процесса. Подходит, пока сервис запущен в одном экземпляре.
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters:  make(map[string]*counter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryStore) HitRateLimit(ctx context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.resetAt) {
+		c = &counter{resetAt: now.Add(window)}
+		m.counters[key] = c
+	}
+	c.count++
+
+	return c.count, c.resetAt, nil
+}
+
+func (m *MemoryStore) ResetRateLimit(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.counters, key)
+
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpiredRateLimits(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(time.Now())
+
+	return nil
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, c := range m.counters {
+		if !now.Before(c.resetAt) {
+			delete(m.counters, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/storage"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Хранилища счётчиков
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+var (
+	ErrRateLimited  = errors.New("too many requests")
+	ErrUnknownStore = errors.New("unknown rate limit store")
+)
+
+// LimitError лимит исчерпан. RetryAfter через сколько можно повторить, отдаётся в заголовке Retry-After.
+type LimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+type RateLimitService struct {
+	log                 *logrus.Logger
+	cfg                 config.RateLimitConfig
+	RateLimitRepository storage.RateLimitRepositoryI
+}
+
+type RateLimitServiceI interface {
+	AllowIP(ctx context.Context, route, ip string) error
+	AllowLogin(ctx context.Context, account string) error
+	ResetLogin(ctx context.Context, account string) error
+	AllowRecover(ctx context.Context, email string) error
+	AllowChallenge(ctx context.Context, challengeID string, ttl time.Duration) error
+	Cleanup(ctx context.Context) error
+}
+
+func New(log *logrus.Logger, cfg config.RateLimitConfig, rateLimitRepository storage.RateLimitRepositoryI) *RateLimitService {
+	return &RateLimitService{
+		log:                 log,
+		cfg:                 cfg,
+		RateLimitRepository: rateLimitRepository,
+	}
+}
+
+// NewStore выбирает хранилище счётчиков: память подходит для одного экземпляра,
+// при нескольких экземплярах счётчики должны быть общими и храниться в БД
+func NewStore(kind string, db storage.RateLimitRepositoryI) (storage.RateLimitRepositoryI, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		return db, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStore, kind)
+	}
+}
+
+// AllowIP ограничивает число запросов к маршруту с одного IP
+func (s *RateLimitService) AllowIP(ctx context.Context, route, ip string) error {
+	return s.allow(ctx, "ip:"+route+":"+ip, s.cfg.IPLimit, s.cfg.IPWindow)
+}
+
+// AllowLogin вызывается перед проверкой пароля. Успешный вход сбрасывает счётчик через ResetLogin,
+// поэтому считаются только неудачные попытки подряд.
+func (s *RateLimitService) AllowLogin(ctx context.Context, account string) error {
+	return s.allow(ctx, loginKey(account), s.cfg.LoginMaxFailures, s.cfg.LoginLockout)
+}
+
+func (s *RateLimitService) ResetLogin(ctx context.Context, account string) error {
+	const op = "RateLimitService.ResetLogin"
+
+	if err := s.RateLimitRepository.ResetRateLimit(ctx, loginKey(account)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AllowRecover ограничивает число писем восстановления пароля на один адрес
+func (s *RateLimitService) AllowRecover(ctx context.Context, email string) error {
+	return s.allow(ctx, "recover:"+strings.ToLower(email), s.cfg.RecoverLimit, s.cfg.RecoverWindow)
+}
+
+// AllowChallenge ограничивает число кодов второго фактора по одному challenge-токену. Счётчик живёт,
+// пока действует токен, поэтому перебор с разных IP упирается в тот же предел.
+func (s *RateLimitService) AllowChallenge(ctx context.Context, challengeID string, ttl time.Duration) error {
+	return s.allow(ctx, "2fa_challenge:"+challengeID, s.cfg.ChallengeMaxAttempts, ttl)
+}
+
+// Cleanup удаляет счётчики с истёкшим окном
+func (s *RateLimitService) Cleanup(ctx context.Context) error {
+	const op = "RateLimitService.Cleanup"
+
+	if err := s.RateLimitRepository.DeleteExpiredRateLimits(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *RateLimitService) allow(ctx context.Context, key string, limit int64, window time.Duration) error {
+	const op = "RateLimitService.allow"
+
+	count, resetAt, err := s.RateLimitRepository.HitRateLimit(ctx, key, window)
+	if err != nil {
+		// Недоступное хранилище не должно блокировать вход всем пользователям
+		s.log.Errorf("%s: %v", op, err)
+		return nil
+	}
+
+	if count > limit {
+		s.log.Infof("%s: limit exceeded for %s", op, key)
+		return &LimitError{RetryAfter: time.Until(resetAt)}
+	}
+
+	return nil
+}
+
+func loginKey(account string) string {
+	return "login:" + strings.ToLower(account)
+}
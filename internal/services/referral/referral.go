@@ -4,26 +4,75 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"ia-online-golang/internal/config"
 	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/ledger"
+	"ia-online-golang/internal/services/reward"
+	"ia-online-golang/internal/services/user"
 	"ia-online-golang/internal/storage"
+	"math"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// level настройки уровня реферальной программы. Процент хранится в сотых долях, чтобы считать в копейках без округлений float.
+type level struct {
+	percent     float64
+	basisPoints int64
+	cap         money.Money
+}
+
 type ReferralService struct {
 	log                *logrus.Logger
+	levels             []level
+	window             time.Duration
 	ReferralRepository storage.ReferralRepositoryI
+	LeadRepository     storage.LeadRepositoryI
+	UserRepository     storage.UserRepositoryI
+	LedgerService      ledger.LedgerServiceI
+	RewardService      reward.RewardServiceI
 }
 
 type ReferralServiceI interface {
 	ReferralsUser(ctx context.Context, referral_code string) ([]dto.ReferralDTO, error)
 	UpdateActiveReferrals(ctx context.Context) error
+	SyncLeadCommissions(ctx context.Context, lead models.Lead) error
+	SyncCommissions(ctx context.Context) error
+	Earnings(ctx context.Context, userID int64, startDate, endDate *time.Time) (money.Money, error)
+	Tree(ctx context.Context, userID int64) (dto.ReferralTreeDTO, error)
 }
 
-func New(log *logrus.Logger, referralRepository storage.ReferralRepositoryI) *ReferralService {
+// New cfg должен пройти ReferralConfig.Validate
+func New(
+	log *logrus.Logger,
+	cfg config.ReferralConfig,
+	referralRepository storage.ReferralRepositoryI,
+	leadRepository storage.LeadRepositoryI,
+	userRepository storage.UserRepositoryI,
+	ledgerService ledger.LedgerServiceI,
+	rewardService reward.RewardServiceI,
+) *ReferralService {
+	levels := make([]level, 0, len(cfg.Levels))
+	for _, levelCfg := range cfg.Levels {
+		levels = append(levels, level{
+			percent:     levelCfg.Percent,
+			basisPoints: int64(math.Round(levelCfg.Percent * 100)),
+			cap:         money.FromRubles(levelCfg.Cap),
+		})
+	}
+
 	return &ReferralService{
 		log:                log,
+		levels:             levels,
+		window:             cfg.Window,
 		ReferralRepository: referralRepository,
+		LeadRepository:     leadRepository,
+		UserRepository:     userRepository,
+		LedgerService:      ledgerService,
+		RewardService:      rewardService,
 	}
 }
 
@@ -63,12 +112,275 @@ func (r *ReferralService) UpdateActiveReferrals(ctx context.Context) error {
 	}
 
 	for _, referral := range referrals {
+		// Бонус фиксируется по правилам на дату активации. Без подходящего правила бонуса нет,
+		// при ошибке реферал будет активирован при следующем запуске.
+		bonus, err := r.RewardService.ReferralBonus(ctx, referral)
+		if err != nil {
+			r.log.Errorf("%s: %v", op, err)
+			continue
+		}
+		var cost money.Money
+		if bonus != nil {
+			cost = *bonus
+		} else {
+			r.log.Warnf("%s: no referral rule for referral %d, bonus is zero", op, referral.ID)
+		}
+		if cost != referral.Cost {
+			if err := r.ReferralRepository.UpdateReferralCost(ctx, referral.ID, cost); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			referral.Cost = cost
+		}
+
 		err = r.ReferralRepository.UpdateActive(ctx, referral.ID, true)
 		if err != nil {
 			r.log.Error(err)
 			return fmt.Errorf("%s: %w", op, err)
 		}
+
+		// Бонус, не начисленный здесь, досоздаст задача ledger_sync
+		referral.Active = true
+		if err := r.LedgerService.SyncReferralBonus(ctx, referral); err != nil {
+			r.log.Errorf("%s: %v", op, err)
+		}
+	}
+
+	return nil
+}
+
+// SyncLeadCommissions пересчитывает проценты с заявки для всех пригласивших её автора по цепочке.
+// Проценты начисляются только с завершённой заявки, поэтому при откате статуса или после выхода
+// за окно они обнуляются вместе с начислением в книге.
+func (r *ReferralService) SyncLeadCommissions(ctx context.Context, lead models.Lead) error {
+	op := "ReferralService.SyncLeadCommissions"
+
+	existing, err := r.ReferralRepository.LeadReferralCommissions(ctx, lead.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.syncLeadCommissions(ctx, lead, existing); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SyncCommissions пересчитывает проценты по всем завершённым заявкам и заявкам, по которым они уже начислялись.
+// Подхватывает потерянные вебхуки и изменения настроек программы.
+func (r *ReferralService) SyncCommissions(ctx context.Context) error {
+	op := "ReferralService.SyncCommissions"
+
+	commissions, err := r.ReferralRepository.ReferralCommissions(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	byLead := make(map[int64][]models.ReferralCommission)
+	for _, commission := range commissions {
+		byLead[commission.LeadID] = append(byLead[commission.LeadID], commission)
+	}
+
+	var failed int
+	err = r.LeadRepository.EachLead(ctx, nil, nil, func(lead models.Lead) error {
+		if !completed(lead) && len(byLead[lead.ID]) == 0 {
+			return nil
+		}
+
+		if err := r.syncLeadCommissions(ctx, lead, byLead[lead.ID]); err != nil {
+			r.log.Errorf("%s: lead %d: %v", op, lead.ID, err)
+			failed++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%s: %d leads failed to sync", op, failed)
+	}
+
+	return nil
+}
+
+func (r *ReferralService) syncLeadCommissions(ctx context.Context, lead models.Lead, existing []models.ReferralCommission) error {
+	commissions, err := r.commissions(ctx, lead)
+	if err != nil {
+		return err
+	}
+
+	// Проценты, которые больше не положены, обнуляются, а не удаляются: на запись ссылается книга
+	saved := make(map[int64]bool, len(existing))
+	for _, commission := range existing {
+		saved[commission.UserID] = true
+	}
+	due := make(map[int64]bool, len(commissions))
+	for _, commission := range commissions {
+		due[commission.UserID] = true
+	}
+	for _, commission := range existing {
+		if !due[commission.UserID] {
+			commission.Amount = 0
+			commissions = append(commissions, commission)
+		}
+	}
+
+	for _, commission := range commissions {
+		if commission.Amount == 0 && !saved[commission.UserID] {
+			continue
+		}
+
+		var limit money.Money
+		if commission.Level <= len(r.levels) {
+			limit = r.levels[commission.Level-1].cap
+		}
+
+		commission, err := r.ReferralRepository.SaveReferralCommission(ctx, commission, limit)
+		if err != nil {
+			return err
+		}
+
+		// Начисление сверяется и задачей ledger_sync, поэтому ошибка здесь только логируется
+		if err := r.LedgerService.SyncReferralCommission(ctx, commission); err != nil {
+			r.log.Errorf("ReferralService.syncLeadCommissions: %v", err)
+		}
 	}
 
 	return nil
 }
+
+// commissions проценты, положенные с заявки пригласившим её автора, без учёта предела на уровень
+func (r *ReferralService) commissions(ctx context.Context, lead models.Lead) ([]models.ReferralCommission, error) {
+	reward := lead.RewardInternet + lead.RewardCleaning + lead.RewardShipping
+	if len(r.levels) == 0 || !completed(lead) || reward <= 0 {
+		return nil, nil
+	}
+
+	upline, err := r.ReferralRepository.ReferralUpline(ctx, lead.UserID, len(r.levels))
+	if err != nil {
+		return nil, err
+	}
+	if len(upline) == 0 {
+		return nil, nil
+	}
+
+	// Окно отсчитывается от регистрации автора заявки по коду пригласившего
+	if r.window > 0 && lead.CreatedAt != nil && lead.CreatedAt.After(upline[0].JoinedAt.Add(r.window)) {
+		return nil, nil
+	}
+
+	commissions := make([]models.ReferralCommission, 0, len(upline))
+	seen := map[int64]bool{lead.UserID: true}
+	for _, ancestor := range upline {
+		// Цикл в цепочке возможен только при ручной правке данных, дальше него проценты не идут
+		if seen[ancestor.UserID] {
+			break
+		}
+		seen[ancestor.UserID] = true
+
+		level := r.levels[ancestor.Level-1]
+		commissions = append(commissions, models.ReferralCommission{
+			LeadID:       lead.ID,
+			UserID:       ancestor.UserID,
+			SourceUserID: lead.UserID,
+			Level:        ancestor.Level,
+			Percent:      level.percent,
+			Amount:       percentOf(reward, level.basisPoints),
+		})
+	}
+
+	return commissions, nil
+}
+
+// Earnings проценты партнёра с заявок приглашённых, созданных в периоде
+func (r *ReferralService) Earnings(ctx context.Context, userID int64, startDate, endDate *time.Time) (money.Money, error) {
+	op := "ReferralService.Earnings"
+
+	earned, err := r.ReferralRepository.ReferralEarnings(ctx, userID, startDate, endDate)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return earned, nil
+}
+
+// Tree дерево приглашённых партнёра с процентами по каждой ветке. Глубина равна числу уровней программы,
+// но не меньше одного, чтобы прямые рефералы были видны и без процентов.
+func (r *ReferralService) Tree(ctx context.Context, userID int64) (dto.ReferralTreeDTO, error) {
+	op := "ReferralService.Tree"
+
+	if _, err := r.UserRepository.UserById(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return dto.ReferralTreeDTO{}, user.ErrUserNotFound
+		}
+		return dto.ReferralTreeDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	depth := max(len(r.levels), 1)
+
+	nodes, err := r.ReferralRepository.ReferralDownline(ctx, userID, depth)
+	if err != nil {
+		return dto.ReferralTreeDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	earnings, err := r.ReferralRepository.ReferralEarningsBySource(ctx, userID)
+	if err != nil {
+		return dto.ReferralTreeDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	children := make(map[int64][]models.ReferralNode)
+	for _, node := range nodes {
+		children[node.ParentID] = append(children[node.ParentID], node)
+	}
+
+	seen := map[int64]bool{userID: true}
+	var build func(parentID int64) []dto.ReferralNodeDTO
+	build = func(parentID int64) []dto.ReferralNodeDTO {
+		branch := make([]dto.ReferralNodeDTO, 0, len(children[parentID]))
+		for _, node := range children[parentID] {
+			if seen[node.UserID] {
+				continue
+			}
+			seen[node.UserID] = true
+
+			nodeDTO := dto.ReferralNodeDTO{
+				UserID:   node.UserID,
+				Name:     node.Name,
+				City:     node.City,
+				Level:    node.Level,
+				Active:   node.Active,
+				JoinedAt: node.JoinedAt,
+				Earned:   earnings[node.UserID],
+			}
+			if node.Level <= len(r.levels) {
+				nodeDTO.Percent = r.levels[node.Level-1].percent
+			}
+
+			nodeDTO.Referrals = build(node.UserID)
+			nodeDTO.BranchEarned = nodeDTO.Earned
+			for _, child := range nodeDTO.Referrals {
+				nodeDTO.BranchEarned += child.BranchEarned
+			}
+
+			branch = append(branch, nodeDTO)
+		}
+		return branch
+	}
+
+	tree := dto.ReferralTreeDTO{Depth: depth, Referrals: build(userID)}
+	for _, node := range tree.Referrals {
+		tree.Earned += node.BranchEarned
+	}
+
+	return tree, nil
+}
+
+// percentOf доля от суммы в сотых долях процента с округлением до копейки
+func percentOf(amount money.Money, basisPoints int64) money.Money {
+	return money.FromKopecks((amount.Kopecks()*basisPoints + 5000) / 10000)
+}
+
+// completed за заявки в статусах «Готова» и «Оплачено» партнёру начисляется вознаграждение
+func completed(lead models.Lead) bool {
+	return lead.StatusID == models.LeadStatusReady || lead.StatusID == models.LeadStatusPaid
+}
@@ -0,0 +1,33 @@
+package referral
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"testing"
+)
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      money.Money
+		basisPoints int64
+		want        money.Money
+	}{
+		{name: "whole percent", amount: money.FromRubles(1000), basisPoints: 500, want: money.FromRubles(50)},
+		{name: "fractional percent", amount: money.FromRubles(1000), basisPoints: 250, want: money.FromRubles(25)},
+		{name: "hundredth of percent", amount: money.FromRubles(10000), basisPoints: 1, want: money.FromRubles(1)},
+		{name: "rounds half up", amount: money.FromKopecks(1), basisPoints: 5000, want: money.FromKopecks(1)},
+		{name: "rounds down below half", amount: money.FromKopecks(333), basisPoints: 1000, want: money.FromKopecks(33)},
+		{name: "rounds up above half", amount: money.FromKopecks(337), basisPoints: 1500, want: money.FromKopecks(51)},
+		{name: "zero percent", amount: money.FromRubles(1000), basisPoints: 0, want: 0},
+		{name: "zero amount", amount: 0, basisPoints: 500, want: 0},
+		{name: "full amount", amount: money.FromKopecks(123456), basisPoints: 10000, want: money.FromKopecks(123456)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentOf(tt.amount, tt.basisPoints); got != tt.want {
+				t.Errorf("percentOf(%s, %d) = %s, want %s", tt.amount, tt.basisPoints, got, tt.want)
+			}
+		})
+	}
+}
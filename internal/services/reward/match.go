@@ -0,0 +1,146 @@
+package reward
+
+import (
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+	"strings"
+	"time"
+)
+
+// match самое точное из правил услуги, действующих на дату: правило для города важнее правила
+// для уровня, при равной точности выигрывает начавшее действовать позже. nil, если правила нет.
+func match(rules []models.RewardRule, service, city, tier string, at time.Time) *models.RewardRule {
+	date := day(at.Local())
+
+	var best *models.RewardRule
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Service != service || !activeOn(*rule, date) {
+			continue
+		}
+		if rule.City != nil && !strings.EqualFold(strings.TrimSpace(*rule.City), strings.TrimSpace(city)) {
+			continue
+		}
+		if rule.Tier != nil && *rule.Tier != tier {
+			continue
+		}
+
+		if best == nil || moreSpecific(*rule, *best) {
+			best = rule
+		}
+	}
+
+	return best
+}
+
+func moreSpecific(a, b models.RewardRule) bool {
+	if specificity(a) != specificity(b) {
+		return specificity(a) > specificity(b)
+	}
+	if !a.ValidFrom.Equal(b.ValidFrom) {
+		return a.ValidFrom.After(b.ValidFrom)
+	}
+	return a.ID > b.ID
+}
+
+func specificity(rule models.RewardRule) int {
+	score := 0
+	if rule.City != nil {
+		score += 2
+	}
+	if rule.Tier != nil {
+		score++
+	}
+	return score
+}
+
+func activeOn(rule models.RewardRule, date time.Time) bool {
+	if date.Before(day(rule.ValidFrom)) {
+		return false
+	}
+	return rule.ValidTo == nil || !date.After(day(*rule.ValidTo))
+}
+
+// overlaps правила с одним ключом и пересекающимися периодами: какое из них применится, было бы неочевидно
+func overlaps(a, b models.RewardRule) bool {
+	if a.Service != b.Service || !sameValue(a.City, b.City, true) || !sameValue(a.Tier, b.Tier, false) {
+		return false
+	}
+
+	aEndsBeforeB := a.ValidTo != nil && day(*a.ValidTo).Before(day(b.ValidFrom))
+	bEndsBeforeA := b.ValidTo != nil && day(*b.ValidTo).Before(day(a.ValidFrom))
+
+	return !aEndsBeforeB && !bEndsBeforeA
+}
+
+func sameValue(a, b *string, ignoreCase bool) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if ignoreCase {
+		return strings.EqualFold(*a, *b)
+	}
+	return *a == *b
+}
+
+// day календарная дата без времени, чтобы сравнивать даты правил, пришедшие из БД в UTC, с датой заявки
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// expectedRewards ожидаемые вознаграждения за выбранные в заявке услуги. nil у невыбранной услуги
+// и у услуги, для которой не нашлось правила.
+func expectedRewards(rules []models.RewardRule, lead models.Lead, partner models.User) (internet, cleaning, shipping *money.Money) {
+	at := time.Now()
+	if lead.CreatedAt != nil {
+		at = *lead.CreatedAt
+	}
+
+	expected := func(service string, selected bool) *money.Money {
+		if !selected {
+			return nil
+		}
+		rule := match(rules, service, partner.City, partner.Tier, at)
+		if rule == nil {
+			return nil
+		}
+		amount := rule.Amount
+		return &amount
+	}
+
+	return expected(models.RewardServiceInternet, lead.Internet),
+		expected(models.RewardServiceCleaning, lead.Cleaning),
+		expected(models.RewardServiceShipping, lead.Shipping)
+}
+
+// mismatches услуги, по которым сумма из битрикса отличается от ожидаемой. Услуги без ожидаемой суммы не сверяются.
+func mismatches(lead models.Lead, internet, cleaning, shipping *money.Money) map[string]any {
+	result := make(map[string]any)
+
+	check := func(service string, selected bool, expected *money.Money, actual money.Money) {
+		if selected && expected != nil && *expected != actual {
+			result[service] = map[string]money.Money{"expected": *expected, "actual": actual}
+		}
+	}
+
+	check(models.RewardServiceInternet, lead.Internet, internet, lead.RewardInternet)
+	check(models.RewardServiceCleaning, lead.Cleaning, cleaning, lead.RewardCleaning)
+	check(models.RewardServiceShipping, lead.Shipping, shipping, lead.RewardShipping)
+
+	return result
+}
+
+// completed по завершённой заявке битрикс присылает итоговое вознаграждение
+func completed(lead models.Lead) bool {
+	return lead.StatusID == models.LeadStatusReady || lead.StatusID == models.LeadStatusPaid
+}
+
+func sum(amounts ...*money.Money) money.Money {
+	var total money.Money
+	for _, amount := range amounts {
+		if amount != nil {
+			total += *amount
+		}
+	}
+	return total
+}
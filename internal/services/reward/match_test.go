@@ -0,0 +1,129 @@
+package reward
+
+import (
+	"ia-online-golang/internal/models"
+	"testing"
+	"time"
+)
+
+func date(value string) time.Time {
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func datePtr(value string) *time.Time {
+	t := date(value)
+	return &t
+}
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func TestMatch(t *testing.T) {
+	rules := []models.RewardRule{
+		{ID: 1, Service: models.RewardServiceInternet, Amount: 100, ValidFrom: date("2024-01-01")},
+		{ID: 2, Service: models.RewardServiceInternet, Tier: strPtr("gold"), Amount: 200, ValidFrom: date("2024-01-01")},
+		{ID: 3, Service: models.RewardServiceInternet, City: strPtr("Казань"), Amount: 300, ValidFrom: date("2024-01-01")},
+		{ID: 4, Service: models.RewardServiceInternet, City: strPtr("Казань"), Tier: strPtr("gold"), Amount: 400, ValidFrom: date("2024-01-01"), ValidTo: datePtr("2024-06-30")},
+		{ID: 5, Service: models.RewardServiceInternet, Amount: 150, ValidFrom: date("2025-01-01")},
+		{ID: 6, Service: models.RewardServiceCleaning, Amount: 500, ValidFrom: date("2024-01-01")},
+		{ID: 7, Service: models.RewardServiceShipping, Amount: 600, ValidFrom: date("2024-03-01"), ValidTo: datePtr("2024-03-31")},
+	}
+
+	at := func(value string) time.Time {
+		d := date(value)
+		return time.Date(d.Year(), d.Month(), d.Day(), 12, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name    string
+		service string
+		city    string
+		tier    string
+		at      time.Time
+		wantID  int64
+	}{
+		{name: "general rule", service: models.RewardServiceInternet, city: "Москва", tier: "base", at: at("2024-05-01"), wantID: 1},
+		{name: "tier beats general", service: models.RewardServiceInternet, city: "Москва", tier: "gold", at: at("2024-05-01"), wantID: 2},
+		{name: "city beats tier", service: models.RewardServiceInternet, city: "Казань", tier: "base", at: at("2024-05-01"), wantID: 3},
+		{name: "city and tier beat city", service: models.RewardServiceInternet, city: "Казань", tier: "gold", at: at("2024-05-01"), wantID: 4},
+		{name: "city ignores case and spaces", service: models.RewardServiceInternet, city: " казань ", tier: "base", at: at("2024-05-01"), wantID: 3},
+		{name: "valid_to is inclusive", service: models.RewardServiceInternet, city: "Казань", tier: "gold", at: at("2024-06-30"), wantID: 4},
+		{name: "expired rule is skipped", service: models.RewardServiceInternet, city: "Казань", tier: "gold", at: at("2024-07-01"), wantID: 3},
+		{name: "later rule wins at equal specificity", service: models.RewardServiceInternet, city: "Москва", tier: "base", at: at("2025-02-01"), wantID: 5},
+		{name: "other service", service: models.RewardServiceCleaning, city: "Казань", tier: "gold", at: at("2024-05-01"), wantID: 6},
+		{name: "before any rule", service: models.RewardServiceInternet, city: "Москва", tier: "base", at: at("2023-12-31"), wantID: 0},
+		{name: "outside the only period", service: models.RewardServiceShipping, city: "Москва", tier: "base", at: at("2024-04-01"), wantID: 0},
+		{name: "first day of period", service: models.RewardServiceShipping, city: "Москва", tier: "base", at: at("2024-03-01"), wantID: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := match(rules, tt.service, tt.city, tt.tier, tt.at)
+
+			var gotID int64
+			if got != nil {
+				gotID = got.ID
+			}
+			if gotID != tt.wantID {
+				t.Errorf("match() = rule %d, want rule %d", gotID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestMatchPrefersHigherIDOnTie(t *testing.T) {
+	rules := []models.RewardRule{
+		{ID: 2, Service: models.RewardServiceInternet, Amount: 200, ValidFrom: date("2024-01-01")},
+		{ID: 1, Service: models.RewardServiceInternet, Amount: 100, ValidFrom: date("2024-01-01")},
+	}
+
+	got := match(rules, models.RewardServiceInternet, "Москва", "base", date("2024-05-01"))
+	if got == nil || got.ID != 2 {
+		t.Errorf("match() = %v, want rule 2", got)
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	base := models.RewardRule{Service: models.RewardServiceInternet, ValidFrom: date("2024-01-01"), ValidTo: datePtr("2024-06-30")}
+
+	with := func(change func(r *models.RewardRule)) models.RewardRule {
+		r := base
+		change(&r)
+		return r
+	}
+
+	tests := []struct {
+		name string
+		a, b models.RewardRule
+		want bool
+	}{
+		{name: "same period", a: base, b: base, want: true},
+		{name: "partial overlap", a: base, b: with(func(r *models.RewardRule) { r.ValidFrom = date("2024-06-01"); r.ValidTo = datePtr("2024-12-31") }), want: true},
+		{name: "touching on the last day", a: base, b: with(func(r *models.RewardRule) { r.ValidFrom = date("2024-06-30"); r.ValidTo = nil }), want: true},
+		{name: "next day after end", a: base, b: with(func(r *models.RewardRule) { r.ValidFrom = date("2024-07-01"); r.ValidTo = nil }), want: false},
+		{name: "ends before start", a: with(func(r *models.RewardRule) { r.ValidFrom = date("2025-01-01"); r.ValidTo = nil }), b: base, want: false},
+		{name: "both open ended", a: with(func(r *models.RewardRule) { r.ValidTo = nil }), b: with(func(r *models.RewardRule) { r.ValidFrom = date("2030-01-01"); r.ValidTo = nil }), want: true},
+		{name: "other service", a: base, b: with(func(r *models.RewardRule) { r.Service = models.RewardServiceCleaning }), want: false},
+		{name: "city and no city", a: base, b: with(func(r *models.RewardRule) { r.City = strPtr("Казань") }), want: false},
+		{name: "city ignores case", a: with(func(r *models.RewardRule) { r.City = strPtr("казань") }), b: with(func(r *models.RewardRule) { r.City = strPtr("Казань") }), want: true},
+		{name: "different cities", a: with(func(r *models.RewardRule) { r.City = strPtr("Москва") }), b: with(func(r *models.RewardRule) { r.City = strPtr("Казань") }), want: false},
+		{name: "same tier", a: with(func(r *models.RewardRule) { r.Tier = strPtr("gold") }), b: with(func(r *models.RewardRule) { r.Tier = strPtr("gold") }), want: true},
+		{name: "tier is case sensitive", a: with(func(r *models.RewardRule) { r.Tier = strPtr("gold") }), b: with(func(r *models.RewardRule) { r.Tier = strPtr("Gold") }), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlaps(tt.a, tt.b); got != tt.want {
+				t.Errorf("overlaps(a, b) = %t, want %t", got, tt.want)
+			}
+			if got := overlaps(tt.b, tt.a); got != tt.want {
+				t.Errorf("overlaps(b, a) = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
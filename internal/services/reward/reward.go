@@ -0,0 +1,465 @@
+// Package reward. Правила вознаграждения партнёров по услуге, городу, уровню партнёра и периоду действия.
+package reward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+	"ia-online-golang/internal/services/audit"
+	"ia-online-golang/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxDiscrepanciesLimit больше заявок с расхождением за один запрос не отдаётся
+	maxDiscrepanciesLimit = 100
+	// maxDryRunLeads столько заявок без правила или с расхождением перечисляется в ответе пробного прогона
+	maxDryRunLeads = 200
+)
+
+type RewardService struct {
+	log                  *logrus.Logger
+	RewardRuleRepository storage.RewardRuleRepositoryI
+	LeadRepository       storage.LeadRepositoryI
+	UserRepository       storage.UserRepositoryI
+	AuditService         audit.AuditServiceI
+}
+
+type RewardServiceI interface {
+	ExpectedLeadRewards(ctx context.Context, lead *models.Lead) error
+	CheckLeadReward(ctx context.Context, lead models.Lead) error
+	ReferralBonus(ctx context.Context, referral models.Referral) (*money.Money, error)
+	Rules(ctx context.Context) ([]dto.RewardRuleDTO, error)
+	CreateRule(ctx context.Context, ruleDTO dto.SaveRewardRuleDTO) (dto.RewardRuleDTO, error)
+	UpdateRule(ctx context.Context, id int64, ruleDTO dto.SaveRewardRuleDTO) (dto.RewardRuleDTO, error)
+	DeleteRule(ctx context.Context, id int64) error
+	DryRun(ctx context.Context, dryRunDTO dto.RewardDryRunRequestDTO) (dto.RewardDryRunDTO, error)
+	Discrepancies(ctx context.Context, limit, offset int64) (dto.RewardDiscrepancyPageDTO, error)
+}
+
+var (
+	ErrRewardRuleNotFound = errors.New("reward rule not found")
+	ErrInvalidRulePeriod  = errors.New("valid_to is before valid_from")
+	ErrRuleOverlap        = errors.New("reward rule overlaps existing rule")
+)
+
+func New(
+	log *logrus.Logger,
+	rewardRuleRepository storage.RewardRuleRepositoryI,
+	leadRepository storage.LeadRepositoryI,
+	userRepository storage.UserRepositoryI,
+	auditService audit.AuditServiceI,
+) *RewardService {
+	return &RewardService{
+		log:                  log,
+		RewardRuleRepository: rewardRuleRepository,
+		LeadRepository:       leadRepository,
+		UserRepository:       userRepository,
+		AuditService:         auditService,
+	}
+}
+
+// ExpectedLeadRewards заполняет ожидаемые вознаграждения новой заявки по правилам, действующим на дату её создания
+func (r *RewardService) ExpectedLeadRewards(ctx context.Context, lead *models.Lead) error {
+	op := "RewardService.ExpectedLeadRewards"
+
+	partner, err := r.UserRepository.UserById(ctx, lead.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rules, err := r.RewardRuleRepository.RewardRules(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	lead.ExpectedRewardInternet, lead.ExpectedRewardCleaning, lead.ExpectedRewardShipping = expectedRewards(rules, *lead, partner)
+
+	return nil
+}
+
+// CheckLeadReward сверяет итоговое вознаграждение завершённой заявки с ожидаемым и отмечает расхождение.
+// Если сумму в битриксе исправили или заявку вернули в работу, отметка снимается.
+func (r *RewardService) CheckLeadReward(ctx context.Context, lead models.Lead) error {
+	op := "RewardService.CheckLeadReward"
+
+	var found map[string]any
+	if completed(lead) {
+		found = mismatches(lead, lead.ExpectedRewardInternet, lead.ExpectedRewardCleaning, lead.ExpectedRewardShipping)
+	}
+
+	discrepancy := len(found) > 0
+	if discrepancy == lead.RewardDiscrepancy {
+		return nil
+	}
+
+	if err := r.LeadRepository.UpdateLeadRewardDiscrepancy(ctx, lead.ID, discrepancy); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !discrepancy {
+		r.log.Infof("%s: lead %d reward discrepancy resolved", op, lead.ID)
+		return nil
+	}
+
+	r.log.Warnf("%s: lead %d reward differs from expected: %v", op, lead.ID, found)
+
+	r.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionLeadRewardMismatch,
+		TargetType: audit.TargetLead,
+		TargetID:   strconv.FormatInt(lead.ID, 10),
+		Details:    map[string]any{"bitrix_id": lead.BitrixID, "user_id": lead.UserID, "services": found},
+	})
+
+	return nil
+}
+
+// ReferralBonus бонус владельцу реферального кода по правилам на текущую дату. nil, если правила нет.
+func (r *RewardService) ReferralBonus(ctx context.Context, referral models.Referral) (*money.Money, error) {
+	op := "RewardService.ReferralBonus"
+
+	referrer, err := r.UserRepository.UserByReferralCode(ctx, referral.ReferralCode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rules, err := r.RewardRuleRepository.RewardRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rule := match(rules, models.RewardServiceReferral, referrer.City, referrer.Tier, time.Now())
+	if rule == nil {
+		return nil, nil
+	}
+
+	return &rule.Amount, nil
+}
+
+func (r *RewardService) Rules(ctx context.Context) ([]dto.RewardRuleDTO, error) {
+	op := "RewardService.Rules"
+
+	rules, err := r.RewardRuleRepository.RewardRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result := make([]dto.RewardRuleDTO, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, ruleToDTO(rule))
+	}
+
+	return result, nil
+}
+
+// CreateRule добавляет правило. Правило с тем же ключом и пересекающимся периодом отклоняется,
+// старое правило нужно сначала закрыть датой valid_to.
+func (r *RewardService) CreateRule(ctx context.Context, ruleDTO dto.SaveRewardRuleDTO) (dto.RewardRuleDTO, error) {
+	op := "RewardService.CreateRule"
+
+	rule, err := ruleFromDTO(ruleDTO)
+	if err != nil {
+		return dto.RewardRuleDTO{}, err
+	}
+
+	if err := r.checkOverlap(ctx, rule); err != nil {
+		if errors.Is(err, ErrRuleOverlap) {
+			return dto.RewardRuleDTO{}, err
+		}
+		return dto.RewardRuleDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if actorID, ok := ctx.Value(context_keys.UserIDKey).(int64); ok {
+		rule.CreatedBy = &actorID
+	}
+
+	saved, err := r.RewardRuleRepository.SaveRewardRule(ctx, rule)
+	if err != nil {
+		return dto.RewardRuleDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionRewardRuleCreated,
+		TargetType: audit.TargetRewardRule,
+		TargetID:   strconv.FormatInt(saved.ID, 10),
+		After:      ruleToDTO(saved),
+	})
+
+	return ruleToDTO(saved), nil
+}
+
+// UpdateRule меняет правило. Ожидаемые вознаграждения уже созданных заявок не пересчитываются.
+func (r *RewardService) UpdateRule(ctx context.Context, id int64, ruleDTO dto.SaveRewardRuleDTO) (dto.RewardRuleDTO, error) {
+	op := "RewardService.UpdateRule"
+
+	before, err := r.RewardRuleRepository.RewardRule(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrRewardRuleNotFound) {
+			return dto.RewardRuleDTO{}, ErrRewardRuleNotFound
+		}
+		return dto.RewardRuleDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rule, err := ruleFromDTO(ruleDTO)
+	if err != nil {
+		return dto.RewardRuleDTO{}, err
+	}
+	rule.ID = id
+
+	if err := r.checkOverlap(ctx, rule); err != nil {
+		if errors.Is(err, ErrRuleOverlap) {
+			return dto.RewardRuleDTO{}, err
+		}
+		return dto.RewardRuleDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := r.RewardRuleRepository.UpdateRewardRule(ctx, rule)
+	if err != nil {
+		if errors.Is(err, storage.ErrRewardRuleNotFound) {
+			return dto.RewardRuleDTO{}, ErrRewardRuleNotFound
+		}
+		return dto.RewardRuleDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionRewardRuleUpdated,
+		TargetType: audit.TargetRewardRule,
+		TargetID:   strconv.FormatInt(id, 10),
+		Before:     ruleToDTO(before),
+		After:      ruleToDTO(updated),
+	})
+
+	return ruleToDTO(updated), nil
+}
+
+func (r *RewardService) DeleteRule(ctx context.Context, id int64) error {
+	op := "RewardService.DeleteRule"
+
+	before, err := r.RewardRuleRepository.RewardRule(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrRewardRuleNotFound) {
+			return ErrRewardRuleNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.RewardRuleRepository.DeleteRewardRule(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrRewardRuleNotFound) {
+			return ErrRewardRuleNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.AuditService.Log(ctx, audit.Event{
+		Action:     audit.ActionRewardRuleDeleted,
+		TargetType: audit.TargetRewardRule,
+		TargetID:   strconv.FormatInt(id, 10),
+		Before:     ruleToDTO(before),
+	})
+
+	return nil
+}
+
+// DryRun считает вознаграждения по заявкам за период так, как их посчитали бы правила, и сравнивает
+// с суммами из битрикса. Ничего не сохраняет.
+func (r *RewardService) DryRun(ctx context.Context, dryRunDTO dto.RewardDryRunRequestDTO) (dto.RewardDryRunDTO, error) {
+	op := "RewardService.DryRun"
+
+	var rules []models.RewardRule
+	if len(dryRunDTO.Rules) > 0 {
+		for i, ruleDTO := range dryRunDTO.Rules {
+			rule, err := ruleFromDTO(ruleDTO)
+			if err != nil {
+				return dto.RewardDryRunDTO{}, err
+			}
+			// Порядковый номер заменяет id, чтобы при равной точности выбор был тем же, что после сохранения
+			rule.ID = int64(i + 1)
+			rules = append(rules, rule)
+		}
+	} else {
+		var err error
+		rules, err = r.RewardRuleRepository.RewardRules(ctx)
+		if err != nil {
+			return dto.RewardDryRunDTO{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	users, err := r.UserRepository.Users(ctx)
+	if err != nil {
+		return dto.RewardDryRunDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+	partners := make(map[int64]models.User, len(users))
+	for _, u := range users {
+		partners[u.ID] = u
+	}
+
+	result := dto.RewardDryRunDTO{Leads: []dto.RewardDryRunLeadDTO{}}
+	err = r.LeadRepository.EachLead(ctx, dryRunDTO.StartDate, dryRunDTO.EndDate, func(lead models.Lead) error {
+		internet, cleaning, shipping := expectedRewards(rules, lead, partners[lead.UserID])
+
+		entry := dto.RewardDryRunLeadDTO{
+			LeadID:   lead.ID,
+			UserID:   lead.UserID,
+			StatusID: lead.StatusID,
+			Expected: sum(internet, cleaning, shipping),
+			MissingRule: (lead.Internet && internet == nil) ||
+				(lead.Cleaning && cleaning == nil) ||
+				(lead.Shipping && shipping == nil),
+		}
+
+		result.Checked++
+		if entry.MissingRule {
+			result.MissingRule++
+		}
+
+		if completed(lead) {
+			actual := lead.RewardInternet + lead.RewardCleaning + lead.RewardShipping
+			entry.Actual = &actual
+			entry.Discrepancy = len(mismatches(lead, internet, cleaning, shipping)) > 0
+
+			result.Completed++
+			result.ExpectedTotal += entry.Expected
+			result.ActualTotal += actual
+			if entry.Discrepancy {
+				result.Discrepancies++
+			}
+		}
+
+		if !entry.MissingRule && !entry.Discrepancy {
+			return nil
+		}
+		if len(result.Leads) >= maxDryRunLeads {
+			result.Truncated = true
+			return nil
+		}
+		result.Leads = append(result.Leads, entry)
+		return nil
+	})
+	if err != nil {
+		return dto.RewardDryRunDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result, nil
+}
+
+// Discrepancies заявки, по которым сумма из битрикса не совпала с ожидаемой, новые первыми
+func (r *RewardService) Discrepancies(ctx context.Context, limit, offset int64) (dto.RewardDiscrepancyPageDTO, error) {
+	op := "RewardService.Discrepancies"
+
+	if limit <= 0 || limit > maxDiscrepanciesLimit {
+		limit = maxDiscrepanciesLimit
+	}
+
+	leads, total, err := r.LeadRepository.LeadsWithRewardDiscrepancy(ctx, limit, offset)
+	if err != nil {
+		return dto.RewardDiscrepancyPageDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := dto.RewardDiscrepancyPageDTO{
+		Leads:  make([]dto.RewardDiscrepancyDTO, 0, len(leads)),
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+	for _, lead := range leads {
+		page.Leads = append(page.Leads, dto.RewardDiscrepancyDTO{
+			LeadID:                 lead.ID,
+			BitrixID:               lead.BitrixID,
+			UserID:                 lead.UserID,
+			StatusID:               lead.StatusID,
+			ExpectedRewardInternet: lead.ExpectedRewardInternet,
+			ExpectedRewardCleaning: lead.ExpectedRewardCleaning,
+			ExpectedRewardShipping: lead.ExpectedRewardShipping,
+			RewardInternet:         lead.RewardInternet,
+			RewardCleaning:         lead.RewardCleaning,
+			RewardShipping:         lead.RewardShipping,
+			CreatedAt:              lead.CreatedAt,
+		})
+	}
+
+	return page, nil
+}
+
+// checkOverlap проверяет, что новое или изменённое правило не пересекается с другими правилами того же ключа
+func (r *RewardService) checkOverlap(ctx context.Context, rule models.RewardRule) error {
+	rules, err := r.RewardRuleRepository.RewardRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range rules {
+		if existing.ID != rule.ID && overlaps(existing, rule) {
+			return fmt.Errorf("%w: rule %d", ErrRuleOverlap, existing.ID)
+		}
+	}
+
+	return nil
+}
+
+// ruleFromDTO разбирает даты правила. Пустые город и уровень означают «любой».
+func ruleFromDTO(ruleDTO dto.SaveRewardRuleDTO) (models.RewardRule, error) {
+	rule := models.RewardRule{
+		Service: ruleDTO.Service,
+		City:    optional(ruleDTO.City),
+		Tier:    optional(ruleDTO.Tier),
+		Amount:  ruleDTO.Amount,
+	}
+
+	validFrom, err := time.Parse(time.DateOnly, ruleDTO.ValidFrom)
+	if err != nil {
+		return models.RewardRule{}, fmt.Errorf("%w: %v", ErrInvalidRulePeriod, err)
+	}
+	rule.ValidFrom = validFrom
+
+	if ruleDTO.ValidTo != nil {
+		validTo, err := time.Parse(time.DateOnly, *ruleDTO.ValidTo)
+		if err != nil {
+			return models.RewardRule{}, fmt.Errorf("%w: %v", ErrInvalidRulePeriod, err)
+		}
+		if validTo.Before(validFrom) {
+			return models.RewardRule{}, ErrInvalidRulePeriod
+		}
+		rule.ValidTo = &validTo
+	}
+
+	return rule, nil
+}
+
+func optional(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+func ruleToDTO(rule models.RewardRule) dto.RewardRuleDTO {
+	ruleDTO := dto.RewardRuleDTO{
+		ID:        rule.ID,
+		Service:   rule.Service,
+		City:      rule.City,
+		Tier:      rule.Tier,
+		Amount:    rule.Amount,
+		ValidFrom: rule.ValidFrom.Format(time.DateOnly),
+		CreatedBy: rule.CreatedBy,
+		CreatedAt: rule.CreatedAt,
+		UpdatedAt: rule.UpdatedAt,
+	}
+	if rule.ValidTo != nil {
+		validTo := rule.ValidTo.Format(time.DateOnly)
+		ruleDTO.ValidTo = &validTo
+	}
+
+	return ruleDTO
+}
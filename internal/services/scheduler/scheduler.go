@@ -2,45 +2,141 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/services/lead"
+	"ia-online-golang/internal/services/ledger"
+	"ia-online-golang/internal/services/ratelimit"
 	"ia-online-golang/internal/services/referral"
+	"ia-online-golang/internal/storage"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 )
 
+// Имена встроенных задач
+const (
+	JobActiveReferrals     = "active_referrals"
+	JobReconcileDeals      = "reconcile_deals"
+	JobReferralCommissions = "referral_commissions"
+	JobRateLimitsCleanup   = "rate_limits_cleanup"
+	JobLedgerSync          = "ledger_sync"
+)
+
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobAlreadyExists  = errors.New("job already exists")
+	ErrJobAlreadyRunning = errors.New("job already running")
+	ErrSchedulerStopped  = errors.New("scheduler stopped")
+)
+
+// JobFunc тело задачи. Контекст отменяется, если задача не успела завершиться при остановке планировщика.
+type JobFunc func(ctx context.Context) error
+
+type job struct {
+	name    string
+	spec    string
+	run     JobFunc
+	entryID cron.EntryID
+	running atomic.Bool
+}
+
 type SchedulerService struct {
-	log             *logrus.Logger
-	ReferralService referral.ReferralServiceI
-	cron            *cron.Cron
+	log                    *logrus.Logger
+	cfg                    config.SchedulerConfig
+	ReferralService        referral.ReferralServiceI
+	LeadService            lead.LeadServiceI
+	LedgerService          ledger.LedgerServiceI
+	RateLimitService       ratelimit.RateLimitServiceI
+	SchedulerJobRepository storage.SchedulerJobRepositoryI
+	cron                   *cron.Cron
+
+	mu      sync.Mutex
+	jobs    []*job
+	stopped bool
+	wg      sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type SchedulerServiceI interface {
 	Run()
-	Stop()
+	Stop(ctx context.Context) error
+	Register(name, spec string, run JobFunc) error
+	Jobs(ctx context.Context) ([]dto.SchedulerJobDTO, error)
+	RunJob(ctx context.Context, name string) error
 }
 
-func New(log *logrus.Logger, referralService referral.ReferralServiceI) *SchedulerService {
+func New(
+	log *logrus.Logger,
+	cfg config.SchedulerConfig,
+	referralService referral.ReferralServiceI,
+	leadService lead.LeadServiceI,
+	ledgerService ledger.LedgerServiceI,
+	rateLimitService ratelimit.RateLimitServiceI,
+	schedulerJobRepository storage.SchedulerJobRepositoryI,
+) *SchedulerService {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &SchedulerService{
-		log:             log,
-		ReferralService: referralService,
-		cron:            cron.New(),
+		log:                    log,
+		cfg:                    cfg,
+		ReferralService:        referralService,
+		LeadService:            leadService,
+		LedgerService:          ledgerService,
+		RateLimitService:       rateLimitService,
+		SchedulerJobRepository: schedulerJobRepository,
+		cron:                   cron.New(),
+		ctx:                    ctx,
+		cancel:                 cancel,
 	}
 }
 
+// Run регистрирует встроенные задачи и запускает планировщик
 func (s *SchedulerService) Run() {
 	op := "SchedulerService.Run"
 
-	// Пример: запуск каждый день в 3:00 ночи
-	_, err := s.cron.AddFunc("*/10 * * * * *", func() {
-		ctx := context.Background()
-		err := s.ReferralService.UpdateActiveReferrals(ctx)
-		if err != nil {
-			s.log.Errorf("%s:%v", op, err)
-		} else {
-			s.log.Infof("%s: успешно обновлены активные рефералы", op)
-		}
+	err := s.Register(JobActiveReferrals, s.cfg.ActiveReferralsSpec, func(ctx context.Context) error {
+		return s.ReferralService.UpdateActiveReferrals(ctx)
+	})
+	if err != nil {
+		s.log.Fatalf("%s:%v", op, err)
+	}
+
+	// Сверка заявок с битриксом на случай потерянных вебхуков
+	err = s.Register(JobReconcileDeals, s.cfg.ReconcileSpec, func(ctx context.Context) error {
+		_, err := s.LeadService.ReconcileDeals(ctx, s.cfg.ReconcileDryRun)
+		return err
+	})
+	if err != nil {
+		s.log.Fatalf("%s:%v", op, err)
+	}
+
+	// Пересчёт процентов пригласившим по завершённым заявкам и после изменения настроек программы
+	err = s.Register(JobReferralCommissions, s.cfg.ReferralCommissionsSpec, func(ctx context.Context) error {
+		return s.ReferralService.SyncCommissions(ctx)
+	})
+	if err != nil {
+		s.log.Fatalf("%s:%v", op, err)
+	}
+
+	err = s.Register(JobRateLimitsCleanup, s.cfg.RateLimitsCleanupSpec, func(ctx context.Context) error {
+		return s.RateLimitService.Cleanup(ctx)
 	})
+	if err != nil {
+		s.log.Fatalf("%s:%v", op, err)
+	}
 
+	// Досоздание начислений в книге, которые не удалось провести сразу
+	err = s.Register(JobLedgerSync, s.cfg.LedgerSyncSpec, func(ctx context.Context) error {
+		return s.LedgerService.SyncAll(ctx)
+	})
 	if err != nil {
 		s.log.Fatalf("%s:%v", op, err)
 	}
@@ -49,7 +145,199 @@ func (s *SchedulerService) Run() {
 	s.log.Info("⏱️ Планировщик запущен")
 }
 
-func (s *SchedulerService) Stop() {
-	s.cron.Stop()
+// Stop перестаёт запускать задачи и ждёт завершения уже запущенных.
+// Если ctx истекает раньше, задачам отменяется контекст.
+func (s *SchedulerService) Stop(ctx context.Context) error {
+	const op = "SchedulerService.Stop"
+
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	cronCtx := s.cron.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		<-cronCtx.Done()
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("%s: %w", op, ctx.Err())
+		s.cancel()
+		<-done
+	}
+	s.cancel()
+
 	s.log.Info("🛑 Планировщик остановлен")
+
+	return err
+}
+
+// Register добавляет задачу с расписанием в формате cron
+func (s *SchedulerService) Register(name, spec string, run JobFunc) error {
+	const op = "SchedulerService.Register"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(name) != nil {
+		return fmt.Errorf("%s: %s: %w", op, name, ErrJobAlreadyExists)
+	}
+
+	j := &job{name: name, spec: spec, run: run}
+
+	entryID, err := s.cron.AddFunc(spec, func() {
+		if !j.running.CompareAndSwap(false, true) {
+			s.log.Warnf("%s: job %s skipped, previous run is still in progress", op, j.name)
+			return
+		}
+		s.wg.Add(1)
+		s.execute(j)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", op, name, err)
+	}
+
+	j.entryID = entryID
+	s.jobs = append(s.jobs, j)
+
+	return nil
+}
+
+// Jobs возвращает зарегистрированные задачи вместе с результатом последнего запуска
+func (s *SchedulerService) Jobs(ctx context.Context) ([]dto.SchedulerJobDTO, error) {
+	const op = "SchedulerService.Jobs"
+
+	stored, err := s.SchedulerJobRepository.SchedulerJobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]dto.SchedulerJobDTO, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobDTO := dto.SchedulerJobDTO{
+			Name:    j.name,
+			Spec:    j.spec,
+			Running: j.running.Load(),
+		}
+
+		if next := s.cron.Entry(j.entryID).Next; !next.IsZero() {
+			jobDTO.NextRunAt = &next
+		}
+
+		for _, st := range stored {
+			if st.Name != j.name {
+				continue
+			}
+			jobDTO.LastStartedAt = st.LastStartedAt
+			jobDTO.LastFinishedAt = st.LastFinishedAt
+			jobDTO.LastError = st.LastError
+			if st.LastDuration != nil {
+				ms := st.LastDuration.Milliseconds()
+				jobDTO.LastDurationMs = &ms
+			}
+		}
+
+		result = append(result, jobDTO)
+	}
+
+	return result, nil
+}
+
+// RunJob запускает задачу вне расписания. Задача выполняется в фоне.
+func (s *SchedulerService) RunJob(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j := s.find(name)
+	if j == nil {
+		return ErrJobNotFound
+	}
+
+	if s.stopped {
+		return ErrSchedulerStopped
+	}
+
+	if !j.running.CompareAndSwap(false, true) {
+		return ErrJobAlreadyRunning
+	}
+
+	s.wg.Add(1)
+	go s.execute(j)
+
+	return nil
+}
+
+// execute выполняет задачу и сохраняет результат. Флаг running должен быть уже выставлен.
+// Флаг защищает только от повторного запуска в этом процессе, от других экземпляров задачу закрывает блокировка в БД.
+func (s *SchedulerService) execute(j *job) {
+	const op = "SchedulerService.execute"
+
+	defer s.wg.Done()
+	defer j.running.Store(false)
+
+	// Результат пишем даже при остановке, иначе задача останется «запущенной» в БД
+	storeCtx := context.WithoutCancel(s.ctx)
+
+	unlock, locked, err := s.SchedulerJobRepository.TryLockSchedulerJob(storeCtx, j.name)
+	if err != nil {
+		s.log.Errorf("%s: job %s not started: %v", op, j.name, err)
+		return
+	}
+	if !locked {
+		s.log.Warnf("%s: job %s skipped, it is running on another instance", op, j.name)
+		return
+	}
+	defer unlock()
+
+	startedAt := time.Now()
+	if err := s.SchedulerJobRepository.StartSchedulerJob(storeCtx, j.name, j.spec, startedAt); err != nil {
+		s.log.Errorf("%s: %v", op, err)
+	}
+
+	s.log.Infof("%s: job %s started", op, j.name)
+
+	var lastError *string
+	err = s.safeRun(j)
+	duration := time.Since(startedAt)
+	if err != nil {
+		msg := err.Error()
+		lastError = &msg
+		s.log.Errorf("%s: job %s failed after %s: %v", op, j.name, duration, err)
+	} else {
+		s.log.Infof("%s: job %s finished in %s", op, j.name, duration)
+	}
+
+	if err := s.SchedulerJobRepository.FinishSchedulerJob(storeCtx, j.name, time.Now(), duration, lastError); err != nil {
+		s.log.Errorf("%s: %v", op, err)
+	}
+}
+
+// safeRun не даёт панике в задаче уронить сервер
+func (s *SchedulerService) safeRun(j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return j.run(s.ctx)
+}
+
+func (s *SchedulerService) find(name string) *job {
+	for _, j := range s.jobs {
+		if j.name == name {
+			return j
+		}
+	}
+
+	return nil
 }
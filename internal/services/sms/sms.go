@@ -0,0 +1,39 @@
+// Package sms. Отправка SMS. Провайдер подключается реализацией SMSSenderI.
+package sms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const SenderLog = "log"
+
+type SMSSenderI interface {
+	SendSMS(ctx context.Context, phoneNumber, text string) error
+}
+
+// LogSender пишет SMS в лог вместо отправки. Для разработки и стендов без провайдера.
+type LogSender struct {
+	log *logrus.Logger
+}
+
+func NewLogSender(log *logrus.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+func (l *LogSender) SendSMS(ctx context.Context, phoneNumber, text string) error {
+	l.log.Infof("LogSender.SendSMS: to %s: %s", phoneNumber, text)
+	return nil
+}
+
+// New создаёт отправителя по имени из конфига
+func New(log *logrus.Logger, sender string) (SMSSenderI, error) {
+	switch sender {
+	case SenderLog:
+		return NewLogSender(log), nil
+	default:
+		return nil, fmt.Errorf("unknown sms sender %q", sender)
+	}
+}
@@ -1,19 +1,32 @@
 package token
 
-import "ia-online-golang/internal/dto"
-
+// PayloadUserAccess только то, что нужно для авторизации запроса. Профиль отдаёт /api/v1/me.
 type PayloadUserAccess struct {
-	UserID       int64             `json:"user_id"`
-	Roles        []string          `json:"roles"`
-	Name         string            `json:"name"`
-	Email        string            `json:"email"`
-	PhoneNumber  string            `json:"phone_number"`
-	City         string            `json:"city"`
-	Telegram     string            `json:"telegram"`
-	ReferralCode string            `json:"referral_code"`
-	Referrals    []dto.ReferralDTO `json:"referrals"`
-	Statistic    dto.UserStatistic `json:"statistic"`
+	UserID    int64    `json:"user_id"`
+	SessionID string   `json:"session_id"`
+	Roles     []string `json:"roles"`
 }
+
+// PayloadUserRefresh содержит id сессии и уникальный id токена, чтобы каждый выпущенный токен отличался
 type PayloadUserRefresh struct {
-	UserID int64 `json:"user_id"`
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"session_id"`
+	TokenID   string `json:"jti"`
 }
+
+// PayloadChallenge подтверждает, что пароль верный, но второй фактор ещё не проверен.
+// Type отличает его от refresh-токена, который подписывается теми же ключами.
+type PayloadChallenge struct {
+	UserID     int64  `json:"user_id"`
+	Type       string `json:"typ"`
+	Enrollment bool   `json:"enrollment"`
+	TokenID    string `json:"jti"`
+}
+
+// Значения typ. Тип проверяется при разборе, поэтому токен одного вида не примут вместо другого,
+// даже если access и refresh-токены подписаны общими ключами.
+const (
+	accessType    = "access"
+	refreshType   = "refresh"
+	challengeType = "2fa"
+)
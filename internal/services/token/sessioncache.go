@@ -0,0 +1,73 @@
+package token
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionCacheLimit размер, после которого из кеша вычищаются устаревшие записи
+const sessionCacheLimit = 10000
+
+type sessionCacheEntry struct {
+	userID    int64
+	active    bool
+	expiresAt time.Time
+}
+
+// sessionCache недолго помнит результат проверки сессии. При ttl <= 0 кеш выключен.
+type sessionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]sessionCacheEntry
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		ttl:     ttl,
+		entries: make(map[string]sessionCacheEntry),
+	}
+}
+
+func (c *sessionCache) get(sessionID string, userID int64) (bool, bool) {
+	if c.ttl <= 0 {
+		return false, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[sessionID]
+	if !ok || entry.userID != userID || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+
+	return entry.active, true
+}
+
+func (c *sessionCache) put(sessionID string, userID int64, active bool) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= sessionCacheLimit {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+
+	c.entries[sessionID] = sessionCacheEntry{userID: userID, active: active, expiresAt: now.Add(c.ttl)}
+}
+
+// forget сбрасывает запись после отзыва сессии в этом процессе
+func (c *sessionCache) forget(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, sessionID)
+}
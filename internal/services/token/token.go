@@ -2,130 +2,350 @@ package token
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"ia-online-golang/internal/dto"
-	"ia-online-golang/internal/services/lead"
-	"ia-online-golang/internal/services/referral"
+	"ia-online-golang/internal/http/context_keys"
+	"ia-online-golang/internal/lib/jwtkeys"
+	"ia-online-golang/internal/models"
 	"ia-online-golang/internal/services/user"
 	"ia-online-golang/internal/storage"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 type TokenService struct {
 	log                   *logrus.Logger
-	SecretKeyAccess       string
-	SecretKeyRefresh      string
+	AccessKeys            *jwtkeys.KeySet
+	RefreshKeys           *jwtkeys.KeySet
 	ExpirationTimeAccess  int64
 	ExpirationTimeRefresh int64
+	ExpirationChallenge   int64
+	sessions              *sessionCache
 	TokenRepository       storage.TokenRepositoryI
 	UserService           user.UserServiceI
-	LeadService           lead.LeadServiceI
-	ReferralService       referral.ReferralServiceI
 }
 
 type TokenServiceI interface {
 	CreateUserTokens(ctx context.Context, userID int64) (dto.AuthTokensDTO, error)
+	RotateUserTokens(ctx context.Context, refreshToken string) (dto.AuthTokensDTO, error)
+	RevokeSession(ctx context.Context, refreshToken string) error
+	Sessions(ctx context.Context, userID int64, currentSessionID string) ([]dto.SessionDTO, error)
+	RevokeUserSession(ctx context.Context, userID int64, sessionID string) error
+	CreateChallengeToken(ctx context.Context, userID int64, enrollment bool) (string, error)
+	ValidateChallengeToken(ctx context.Context, challengeToken string) (PayloadChallenge, error)
+	ChallengeTTL() int64
 	GenerateTokens(ctx context.Context, payloadAccess any, payloadRefresh any) (dto.AuthTokensDTO, error)
 	GenerateAccessToken(ctx context.Context, payloadAccess any) (string, error)
-	SaveToken(ctx context.Context, userId int64, refreshToken string) error
 	ValidateRefreshToken(ctx context.Context, refresh_token string, payloadStruct any) (any, error)
 	ValidateAccessToken(ctx context.Context, token string, payloadStruct any) (any, error)
+	ValidateSession(ctx context.Context, userID int64, sessionID string) error
+	JWKS() jwtkeys.JWKS
 }
 
 var (
 	ErrSaveRefreshToken          = errors.New("error saving refresh token")
 	ErrRefreshTokenAlreadyExists = errors.New("refreshing token already exists")
 	ErrRefreshTokenNotExists     = errors.New("refreshing token not exists")
+	ErrRefreshTokenReused        = errors.New("refresh token reused")
+	ErrSessionNotFound           = errors.New("session not found")
 	ErrInvalidToken              = errors.New("token is invalid")
 	ErrInvalidRefreshToken       = errors.New("refresh token is invalid")
 	ErrInvalidAccessToken        = errors.New("access token is invalid")
 	ErrExpiredToken              = errors.New("expired token")
 	ErrExpiredRefreshToken       = errors.New("expired access token")
 	ErrExpiredAccessToken        = errors.New("expired refresh token")
+	ErrInvalidChallengeToken     = errors.New("challenge token is invalid")
+	ErrSessionRevoked            = errors.New("session revoked")
 )
 
 func New(log *logrus.Logger,
-	secretKeyAccess string,
-	secretKeyRefresh string,
+	accessKeys *jwtkeys.KeySet,
+	refreshKeys *jwtkeys.KeySet,
 	expiryTimeAccess int64,
 	expiryTimeRefresh int64,
+	expiryTimeChallenge int64,
+	sessionCacheTTL time.Duration,
 	tokenRepository storage.TokenRepositoryI,
-	userService user.UserServiceI,
-	leadService lead.LeadServiceI,
-	referralService referral.ReferralServiceI) *TokenService {
+	userService user.UserServiceI) *TokenService {
 	return &TokenService{
 		log:                   log,
-		SecretKeyAccess:       secretKeyAccess,
-		SecretKeyRefresh:      secretKeyRefresh,
+		AccessKeys:            accessKeys,
+		RefreshKeys:           refreshKeys,
 		ExpirationTimeAccess:  expiryTimeAccess,
 		ExpirationTimeRefresh: expiryTimeRefresh,
+		ExpirationChallenge:   expiryTimeChallenge,
+		sessions:              newSessionCache(sessionCacheTTL),
 		TokenRepository:       tokenRepository,
 		UserService:           userService,
-		LeadService:           leadService,
-		ReferralService:       referralService,
 	}
 }
 
+// CreateUserTokens открывает новую сессию. IP и User-Agent берутся из контекста запроса.
 func (s *TokenService) CreateUserTokens(ctx context.Context, userID int64) (dto.AuthTokensDTO, error) {
 	op := "TokenService.CreateUserTokens"
 
-	// Получаем пользователя по `UserID`
-	user, err := s.UserService.UserById(ctx, userID)
+	sessionID := uuid.New().String()
+
+	tokens, err := s.userTokens(ctx, userID, sessionID)
 	if err != nil {
+		s.log.Error(err)
+
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	ip, userAgent := requestInfo(ctx)
 	now := time.Now()
-	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
 
-	statistic, err := s.LeadService.GetUserPaymentStatistic(ctx, userID, &firstOfMonth, nil)
+	err = s.TokenRepository.SaveSession(ctx, models.Session{
+		ID:        sessionID,
+		UserID:    userID,
+		TokenHash: hashToken(tokens.RefreshToken),
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(s.ExpirationTimeRefresh) * time.Second),
+	})
 	if err != nil {
+		s.log.Error(err)
+
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	referrals, err := s.ReferralService.ReferralsUser(ctx, user.ReferralCode)
+	return tokens, nil
+}
+
+// RotateUserTokens выпускает новую пару токенов для сессии, старый refresh-токен перестаёт действовать.
+// Повторное использование уже заменённого токена означает, что его украли: сессия отзывается целиком.
+func (s *TokenService) RotateUserTokens(ctx context.Context, refreshToken string) (dto.AuthTokensDTO, error) {
+	op := "TokenService.RotateUserTokens"
+
+	var payload PayloadUserRefresh
+	if _, err := s.ValidateRefreshToken(ctx, refreshToken, &payload); err != nil {
+		return dto.AuthTokensDTO{}, err
+	}
+
+	session, err := s.TokenRepository.SessionByID(ctx, payload.SessionID)
 	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return dto.AuthTokensDTO{}, ErrRefreshTokenNotExists
+		}
+
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	payloadAccess := PayloadUserAccess{
-		UserID:       *user.ID,
-		Roles:        user.Roles,
-		Name:         user.Name,
-		Email:        user.Email,
-		PhoneNumber:  user.PhoneNumber,
-		City:         user.City,
-		Telegram:     user.Telegram,
-		ReferralCode: user.ReferralCode,
-		Statistic:    statistic,
-		Referrals:    referrals,
+	if session.RevokedAt != nil || session.UserID != payload.UserID {
+		return dto.AuthTokensDTO{}, ErrRefreshTokenNotExists
 	}
-	payloadRefresh := PayloadUserRefresh{
-		UserID: *user.ID,
+
+	oldHash := hashToken(refreshToken)
+	if session.TokenHash != oldHash {
+		return dto.AuthTokensDTO{}, s.revokeReused(ctx, session)
 	}
 
-	tokens, err := s.GenerateTokens(ctx, payloadAccess, payloadRefresh)
+	tokens, err := s.userTokens(ctx, session.UserID, session.ID)
 	if err != nil {
-		s.log.Error(err)
+		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ip, userAgent := requestInfo(ctx)
+	expiresAt := time.Now().Add(time.Duration(s.ExpirationTimeRefresh) * time.Second)
+
+	err = s.TokenRepository.RotateSession(ctx, session.ID, oldHash, hashToken(tokens.RefreshToken), ip, userAgent, expiresAt)
+	if err != nil {
+		// Токен успели обменять параллельным запросом: один и тот же токен предъявили дважды
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return dto.AuthTokensDTO{}, s.revokeReused(ctx, session)
+		}
 
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = s.SaveToken(ctx, *user.ID, tokens.RefreshToken)
+	return tokens, nil
+}
+
+// RevokeSession завершает сессию, которой принадлежит refresh-токен
+func (s *TokenService) RevokeSession(ctx context.Context, refreshToken string) error {
+	op := "TokenService.RevokeSession"
+
+	var payload PayloadUserRefresh
+	if _, err := s.ValidateRefreshToken(ctx, refreshToken, &payload); err != nil {
+		return err
+	}
+
+	if err := s.TokenRepository.RevokeSession(ctx, payload.SessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.sessions.forget(payload.SessionID)
+
+	return nil
+}
+
+// Sessions возвращает действующие сессии пользователя. Текущая сессия помечается флагом Current.
+func (s *TokenService) Sessions(ctx context.Context, userID int64, currentSessionID string) ([]dto.SessionDTO, error) {
+	op := "TokenService.Sessions"
+
+	sessions, err := s.TokenRepository.UserSessions(ctx, userID)
 	if err != nil {
-		s.log.Error(err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result := make([]dto.SessionDTO, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, dto.SessionDTO{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+
+	return result, nil
+}
+
+// RevokeUserSession завершает сессию пользователя по id. Access-токены сессии перестают приниматься сразу.
+func (s *TokenService) RevokeUserSession(ctx context.Context, userID int64, sessionID string) error {
+	op := "TokenService.RevokeUserSession"
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+
+	err := s.TokenRepository.RevokeUserSession(ctx, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return ErrSessionNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.sessions.forget(sessionID)
+
+	return nil
+}
+
+// ValidateSession проверяет, что сессия access-токена не отозвана и пользователь не заблокирован.
+// Подпись токена этого не гарантирует: роли и блокировка меняются раньше, чем он истекает.
+// Результат кешируется на SessionCacheTTL, чтобы не ходить в БД на каждый запрос.
+func (s *TokenService) ValidateSession(ctx context.Context, userID int64, sessionID string) error {
+	op := "TokenService.ValidateSession"
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrSessionRevoked
+	}
+
+	active, ok := s.sessions.get(sessionID, userID)
+	if !ok {
+		var err error
+		active, err = s.TokenRepository.SessionActive(ctx, sessionID, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		s.sessions.put(sessionID, userID, active)
+	}
+
+	if !active {
+		return ErrSessionRevoked
+	}
+
+	return nil
+}
+
+// CreateChallengeToken выдаётся после верного пароля, когда для входа нужен второй фактор.
+// Сессия при этом не создаётся.
+func (s *TokenService) CreateChallengeToken(ctx context.Context, userID int64, enrollment bool) (string, error) {
+	op := "TokenService.CreateChallengeToken"
 
+	payload, err := s.structToMap(PayloadChallenge{
+		UserID:     userID,
+		Type:       challengeType,
+		Enrollment: enrollment,
+		TokenID:    uuid.New().String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	challengeToken, err := s.createToken(payload, s.ExpirationChallenge, s.RefreshKeys, challengeType)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return challengeToken, nil
+}
+
+// ValidateChallengeToken проверяет challenge-токен. Просроченный токен считается недействительным: нужно заново ввести пароль.
+func (s *TokenService) ValidateChallengeToken(ctx context.Context, challengeToken string) (PayloadChallenge, error) {
+	op := "TokenService.ValidateChallengeToken"
+
+	var payload PayloadChallenge
+	if _, err := s.validateToken(challengeToken, s.RefreshKeys, challengeType, &payload); err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) {
+			return PayloadChallenge{}, ErrInvalidChallengeToken
+		}
+
+		return PayloadChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return payload, nil
+}
+
+// ChallengeTTL время жизни challenge-токена в секундах
+func (s *TokenService) ChallengeTTL() int64 {
+	return s.ExpirationChallenge
+}
+
+// userTokens подписывает пару токенов для сессии. Роли берутся из БД, чтобы изменения применялись при обновлении токенов.
+func (s *TokenService) userTokens(ctx context.Context, userID int64, sessionID string) (dto.AuthTokensDTO, error) {
+	op := "TokenService.userTokens"
+
+	// Получаем пользователя по `UserID`
+	user, err := s.UserService.UserById(ctx, userID)
+	if err != nil {
+		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	payloadAccess := PayloadUserAccess{
+		UserID:    *user.ID,
+		SessionID: sessionID,
+		Roles:     user.Roles,
+	}
+	payloadRefresh := PayloadUserRefresh{
+		UserID:    *user.ID,
+		SessionID: sessionID,
+		TokenID:   uuid.New().String(),
+	}
+
+	tokens, err := s.GenerateTokens(ctx, payloadAccess, payloadRefresh)
+	if err != nil {
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return tokens, nil
 }
 
+// revokeReused отзывает сессию, в которой предъявили уже заменённый refresh-токен
+func (s *TokenService) revokeReused(ctx context.Context, session models.Session) error {
+	op := "TokenService.revokeReused"
+
+	s.log.Warnf("%s: refresh token reuse detected, session %s of user %d revoked", op, session.ID, session.UserID)
+
+	if err := s.TokenRepository.RevokeSession(ctx, session.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ErrRefreshTokenReused
+}
+
 func (t *TokenService) GenerateTokens(ctx context.Context, payloadAccess any, payloadRefresh any) (dto.AuthTokensDTO, error) {
 	op := "TokenService.GenerateTokens"
 
@@ -140,13 +360,13 @@ func (t *TokenService) GenerateTokens(ctx context.Context, payloadAccess any, pa
 	}
 
 	// Создаем access-токен
-	accessToken, err := t.createToken(payloadMapAccess, t.ExpirationTimeAccess, t.SecretKeyAccess)
+	accessToken, err := t.createToken(payloadMapAccess, t.ExpirationTimeAccess, t.AccessKeys, accessType)
 	if err != nil {
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	// Создаем refresh-токен
-	refreshToken, err := t.createToken(payloadMapRefresh, t.ExpirationTimeRefresh, t.SecretKeyRefresh)
+	refreshToken, err := t.createToken(payloadMapRefresh, t.ExpirationTimeRefresh, t.RefreshKeys, refreshType)
 	if err != nil {
 		return dto.AuthTokensDTO{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -163,7 +383,7 @@ func (t *TokenService) GenerateAccessToken(ctx context.Context, payloadAccess an
 	}
 
 	// Создаем access-токен
-	accessToken, err := t.createToken(payloadMapAccess, t.ExpirationTimeAccess, t.SecretKeyAccess)
+	accessToken, err := t.createToken(payloadMapAccess, t.ExpirationTimeAccess, t.AccessKeys, accessType)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -171,34 +391,10 @@ func (t *TokenService) GenerateAccessToken(ctx context.Context, payloadAccess an
 	return accessToken, nil
 }
 
-func (t *TokenService) SaveToken(ctx context.Context, userId int64, refreshToken string) error {
-	op := "TokenService.SaveToken"
-
-	_, err := t.TokenRepository.RefreshTokenByUserId(ctx, userId)
-	if err != nil {
-		if errors.Is(err, storage.ErrTokenNotFound) {
-			// Токена нет — сохраняем новый
-			if err := t.TokenRepository.SaveRefreshToken(ctx, userId, refreshToken); err != nil {
-				return fmt.Errorf("%s: %w", op, err)
-			}
-			return nil
-		}
-		// Любая другая ошибка — возвращаем её сразу
-		return fmt.Errorf("%s: %w", op, err)
-	}
-
-	// Токен уже есть — обновляем
-	if err := t.TokenRepository.UpdateRefreshToken(ctx, userId, refreshToken); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
-
-	return nil
-}
-
 func (t *TokenService) ValidateRefreshToken(ctx context.Context, refresh_token string, payloadStruct any) (any, error) {
 	op := "TokenService.ValidateRefreshToken"
 
-	payload, err := t.validateToken(refresh_token, t.SecretKeyRefresh, payloadStruct)
+	payload, err := t.validateToken(refresh_token, t.RefreshKeys, refreshType, payloadStruct)
 	if err != nil {
 		if errors.Is(err, ErrInvalidToken) {
 			return nil, ErrInvalidRefreshToken
@@ -211,22 +407,13 @@ func (t *TokenService) ValidateRefreshToken(ctx context.Context, refresh_token s
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = t.TokenRepository.RefreshTokenByToken(ctx, refresh_token)
-	if err != nil {
-		if errors.Is(err, storage.ErrTokenNotFound) {
-			return nil, storage.ErrTokenNotFound
-		}
-
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-
 	return payload, nil
 }
 
 func (t *TokenService) ValidateAccessToken(ctx context.Context, token string, payloadStruct any) (any, error) {
 	op := "TokenService.ValidateAccessToken"
 
-	payload, err := t.validateToken(token, t.SecretKeyAccess, payloadStruct)
+	payload, err := t.validateToken(token, t.AccessKeys, accessType, payloadStruct)
 	if err != nil {
 		if errors.Is(err, ErrInvalidToken) {
 			return nil, ErrInvalidAccessToken
@@ -242,17 +429,22 @@ func (t *TokenService) ValidateAccessToken(ctx context.Context, token string, pa
 	return payload, nil
 }
 
-func (t *TokenService) createToken(payload map[string]interface{}, expirationTime int64, secretKey string) (string, error) {
+// JWKS открытые ключи access-токенов. Refresh-токены проверяет только этот сервис.
+func (t *TokenService) JWKS() jwtkeys.JWKS {
+	return t.AccessKeys.JWKS()
+}
+
+func (t *TokenService) createToken(payload map[string]interface{}, expirationTime int64, keys *jwtkeys.KeySet, tokenType string) (string, error) {
 	op := "TokenService.createToken"
 
 	claims := jwt.MapClaims{}
 	for key, value := range payload {
 		claims[key] = value
 	}
+	claims["typ"] = tokenType
 	claims["exp"] = time.Now().Add(time.Duration(expirationTime) * time.Second).Unix()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secretKey))
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -260,21 +452,19 @@ func (t *TokenService) createToken(payload map[string]interface{}, expirationTim
 	return tokenString, nil
 }
 
-func (t *TokenService) validateToken(tokenString string, secretKey string, payloadStruct any) (any, error) {
+// validateToken проверяет подпись, срок и тип токена. Тип не даёт предъявить токен одного вида вместо другого.
+func (t *TokenService) validateToken(tokenString string, keys *jwtkeys.KeySet, tokenType string, payloadStruct any) (any, error) {
 	op := "TokenService.validateToken"
 
-	// Парсим токен
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Проверяем метод подписи
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+	// Парсим токен. Ключ и допустимый метод подписи выбираются по kid.
+	token, err := jwt.Parse(tokenString, keys.Keyfunc)
 
-			return nil, fmt.Errorf("%s: error method %s", op, token.Header["alg"])
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
 		}
-		return []byte(secretKey), nil
-	})
 
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w: %v", op, ErrInvalidToken, err)
 	}
 
 	// Проверяем валидность токена
@@ -298,6 +488,11 @@ func (t *TokenService) validateToken(tokenString string, secretKey string, paylo
 		return nil, ErrExpiredToken
 	}
 
+	typ, _ := claims["typ"].(string)
+	if typ != tokenType {
+		return nil, fmt.Errorf("%s: %w: unexpected type %q", op, ErrInvalidToken, typ)
+	}
+
 	// Конвертируем `claims` в JSON и затем в структуру
 	claimsJSON, err := json.Marshal(claims)
 	if err != nil {
@@ -326,3 +521,17 @@ func (t *TokenService) structToMap(s interface{}) (map[string]interface{}, error
 
 	return result, nil
 }
+
+// hashToken хеш refresh-токена для хранения в БД
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestInfo IP и User-Agent клиента, которые RequestInfoMiddleware кладёт в контекст
+func requestInfo(ctx context.Context) (ip string, userAgent string) {
+	ip, _ = ctx.Value(context_keys.ClientIPKey).(string)
+	userAgent, _ = ctx.Value(context_keys.UserAgentKey).(string)
+
+	return ip, userAgent
+}
@@ -0,0 +1,263 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/config"
+	"ia-online-golang/internal/dto"
+	"ia-online-golang/internal/lib/totp"
+	"ia-online-golang/internal/storage"
+	"ia-online-golang/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recoveryCodeLength символов в коде восстановления, без дефиса посередине
+const recoveryCodeLength = 10
+
+type TwoFactorService struct {
+	log                 *logrus.Logger
+	cfg                 config.TwoFactorConfig
+	TwoFactorRepository storage.TwoFactorRepositoryI
+	UserRepository      storage.UserRepositoryI
+}
+
+type TwoFactorServiceI interface {
+	Status(ctx context.Context, userID int64) (dto.TwoFactorStatusDTO, error)
+	Enabled(ctx context.Context, userID int64) (bool, error)
+	Required(roles []string) bool
+	Enroll(ctx context.Context, userID int64) (dto.TOTPEnrollmentDTO, error)
+	Confirm(ctx context.Context, userID int64, code string) ([]string, error)
+	Verify(ctx context.Context, userID int64, code string) error
+	Disable(ctx context.Context, userID int64, code string) error
+}
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor enrollment not started")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication required for role")
+	ErrTwoFactorCodeIncorrect  = errors.New("two-factor code incorrect")
+)
+
+func New(log *logrus.Logger, cfg config.TwoFactorConfig, twoFactorRepository storage.TwoFactorRepositoryI, userRepository storage.UserRepositoryI) *TwoFactorService {
+	return &TwoFactorService{
+		log:                 log,
+		cfg:                 cfg,
+		TwoFactorRepository: twoFactorRepository,
+		UserRepository:      userRepository,
+	}
+}
+
+func (t *TwoFactorService) Status(ctx context.Context, userID int64) (dto.TwoFactorStatusDTO, error) {
+	op := "TwoFactorService.Status"
+
+	user, err := t.UserRepository.UserById(ctx, userID)
+	if err != nil {
+		return dto.TwoFactorStatusDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	enabled, err := t.Enabled(ctx, userID)
+	if err != nil {
+		return dto.TwoFactorStatusDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return dto.TwoFactorStatusDTO{Enabled: enabled, Required: t.Required(user.Roles)}, nil
+}
+
+// Enabled подключён ли второй фактор. Секрет, который ещё не подтвердили кодом, не считается.
+func (t *TwoFactorService) Enabled(ctx context.Context, userID int64) (bool, error) {
+	op := "TwoFactorService.Enabled"
+
+	secret, err := t.TwoFactorRepository.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return secret.EnabledAt != nil, nil
+}
+
+// Required требует ли одна из ролей второй фактор по конфигу
+func (t *TwoFactorService) Required(roles []string) bool {
+	for _, role := range roles {
+		if utils.Contains(t.cfg.RequiredRoles, role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enroll создаёт новый секрет. Второй фактор включается только после Confirm, до этого вход работает как раньше.
+func (t *TwoFactorService) Enroll(ctx context.Context, userID int64) (dto.TOTPEnrollmentDTO, error) {
+	op := "TwoFactorService.Enroll"
+
+	enabled, err := t.Enabled(ctx, userID)
+	if err != nil {
+		return dto.TOTPEnrollmentDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if enabled {
+		return dto.TOTPEnrollmentDTO{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	user, err := t.UserRepository.UserById(ctx, userID)
+	if err != nil {
+		return dto.TOTPEnrollmentDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return dto.TOTPEnrollmentDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.TwoFactorRepository.SaveTOTP(ctx, userID, secret); err != nil {
+		return dto.TOTPEnrollmentDTO{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return dto.TOTPEnrollmentDTO{
+		Secret: secret,
+		URI:    totp.URI(t.cfg.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm включает второй фактор по первому коду из приложения и возвращает коды восстановления.
+// Коды показываются один раз, в БД хранятся только хеши.
+func (t *TwoFactorService) Confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	op := "TwoFactorService.Confirm"
+
+	secret, err := t.TwoFactorRepository.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if secret.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(secret.Secret, normalizeCode(code), time.Now(), t.cfg.Skew)
+	if !ok {
+		return nil, ErrTwoFactorCodeIncorrect
+	}
+
+	codes := make([]string, 0, t.cfg.RecoveryCodes)
+	hashes := make([]string, 0, t.cfg.RecoveryCodes)
+	for i := 0; i < t.cfg.RecoveryCodes; i++ {
+		recoveryCode, err := utils.GeneratePasswordCode(recoveryCodeLength)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		codes = append(codes, recoveryCode[:recoveryCodeLength/2]+"-"+recoveryCode[recoveryCodeLength/2:])
+		hashes = append(hashes, hashRecoveryCode(recoveryCode))
+	}
+
+	if err := t.TwoFactorRepository.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return codes, nil
+}
+
+// Verify принимает код из приложения или код восстановления. Каждый код действует один раз.
+func (t *TwoFactorService) Verify(ctx context.Context, userID int64, code string) error {
+	op := "TwoFactorService.Verify"
+
+	secret, err := t.TwoFactorRepository.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return ErrTwoFactorNotEnabled
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if secret.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeCode(code)
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(secret.Secret, code, time.Now(), t.cfg.Skew)
+		if !ok {
+			return ErrTwoFactorCodeIncorrect
+		}
+
+		if err := t.TwoFactorRepository.UseTOTPStep(ctx, userID, step); err != nil {
+			if errors.Is(err, storage.ErrTOTPStepAlreadyUsed) {
+				return ErrTwoFactorCodeIncorrect
+			}
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	}
+
+	if err := t.TwoFactorRepository.UseRecoveryCode(ctx, userID, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+			return ErrTwoFactorCodeIncorrect
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	t.log.Infof("%s: user %d signed in with recovery code", op, userID)
+
+	return nil
+}
+
+// Disable отключает второй фактор по действующему коду. Для ролей из required_roles отключить нельзя.
+func (t *TwoFactorService) Disable(ctx context.Context, userID int64, code string) error {
+	op := "TwoFactorService.Disable"
+
+	user, err := t.UserRepository.UserById(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if t.Required(user.Roles) {
+		return ErrTwoFactorRequired
+	}
+
+	if err := t.Verify(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrTwoFactorNotEnabled) || errors.Is(err, ErrTwoFactorCodeIncorrect) {
+			return err
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.TwoFactorRepository.DisableTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// normalizeCode убирает пробелы и дефисы, которые пользователи вводят вместе с кодом
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
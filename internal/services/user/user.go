@@ -31,6 +31,9 @@ var (
 	ErrUserAlreadyExists = errors.New("user already exists")
 	ErrUserNotActivated  = errors.New("user not activated")
 	ErrUserNotFound      = errors.New("user not found")
+	ErrUserBanned        = errors.New("user banned")
+	// ErrContactChangeNotAllowed почта и телефон меняются только с подтверждением через ContactService
+	ErrContactChangeNotAllowed = errors.New("email and phone number change requires confirmation")
 )
 
 func New(
@@ -142,6 +145,26 @@ func (u *UserService) EditUser(ctx context.Context, userDTO dto.UserDTO) error {
 		user.ID = userID
 	}
 
+	// Неподтверждённая смена почты или телефона позволила бы перехватить восстановление пароля и выплаты.
+	// Клиенты присылают профиль целиком, поэтому совпадающие с текущими значения допускаются.
+	if user.Email != "" || user.PhoneNumber != "" {
+		current, err := u.UserRepository.UserById(ctx, user.ID)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if (user.Email != "" && user.Email != current.Email) ||
+			(user.PhoneNumber != "" && user.PhoneNumber != current.PhoneNumber) {
+			return ErrContactChangeNotAllowed
+		}
+
+		user.Email = ""
+		user.PhoneNumber = ""
+	}
+
 	err := u.UserRepository.UpdateUser(ctx, user)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserIsNotUpdated) {
@@ -14,6 +14,7 @@ type ActivationLinkRepositoryI interface {
 	SaveActivationLink(ctx context.Context, activation models.ActivationLink) error
 	DeleteActivationLink(ctx context.Context, activation models.ActivationLink) error
 	UpdateActivationLink(ctx context.Context, activation models.ActivationLink) error
+	SaveEmailChangeLink(ctx context.Context, activation models.ActivationLink) error
 }
 
 var (
@@ -27,11 +28,12 @@ func (s *Storage) ActivationLinkByActivationId(ctx context.Context, activationID
 	const op = "storage.auth.GetActivationLink"
 
 	var activationLink models.ActivationLink
-	query := "SELECT id, user_id, activation_id, expires_at FROM activation_links WHERE activation_id = $1"
+	query := "SELECT id, user_id, activation_id, new_email, expires_at FROM activation_links WHERE activation_id = $1"
 	err := s.db.QueryRowContext(ctx, query, activationID).Scan(
 		&activationLink.ID,
 		&activationLink.UserID,
 		&activationLink.ActivationID,
+		&activationLink.NewEmail,
 		&activationLink.ExpiresAt,
 	)
 	if err != nil {
@@ -44,11 +46,12 @@ func (s *Storage) ActivationLinkByActivationId(ctx context.Context, activationID
 	return activationLink, nil
 }
 
+// ActivationLinkByUserId возвращает ссылку активации аккаунта. Ссылки смены почты не учитываются.
 func (s *Storage) ActivationLinkByUserId(ctx context.Context, userID int64) (models.ActivationLink, error) {
 	const op = "storage.auth.ActivationLinkByUserId"
 
 	var activationLink models.ActivationLink
-	query := "SELECT id, user_id, activation_id, expires_at FROM activation_links WHERE user_id = $1"
+	query := "SELECT id, user_id, activation_id, expires_at FROM activation_links WHERE user_id = $1 AND new_email IS NULL"
 	err := s.db.QueryRowContext(ctx, query, userID).Scan(
 		&activationLink.ID,
 		&activationLink.UserID,
@@ -68,8 +71,8 @@ func (s *Storage) ActivationLinkByUserId(ctx context.Context, userID int64) (mod
 func (s *Storage) SaveActivationLink(ctx context.Context, activation models.ActivationLink) error {
 	const op = "storage.auth.SaveActivationLink"
 
-	query := "INSERT INTO activation_links (user_id, activation_id, expires_at) VALUES ($1, $2, $3)"
-	result, err := s.db.ExecContext(ctx, query, activation.UserID, activation.ActivationID, activation.ExpiresAt)
+	query := "INSERT INTO activation_links (user_id, activation_id, new_email, expires_at) VALUES ($1, $2, $3, $4)"
+	result, err := s.db.ExecContext(ctx, query, activation.UserID, activation.ActivationID, activation.NewEmail, activation.ExpiresAt)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -91,7 +94,7 @@ func (s *Storage) UpdateActivationLink(ctx context.Context, activation models.Ac
 	query := `
 		UPDATE activation_links
 		SET activation_id = $1, expires_at = $2
-		WHERE user_id = $3`
+		WHERE user_id = $3 AND new_email IS NULL`
 	result, err := s.db.ExecContext(ctx, query, activation.ActivationID, activation.ExpiresAt, activation.UserID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -127,3 +130,31 @@ func (s *Storage) DeleteActivationLink(ctx context.Context, activation models.Ac
 
 	return nil
 }
+
+// SaveEmailChangeLink сохраняет ссылку смены почты. Прежние ссылки смены почты пользователя удаляются,
+// чтобы подтвердить можно было только последний запрошенный адрес.
+func (s *Storage) SaveEmailChangeLink(ctx context.Context, activation models.ActivationLink) error {
+	const op = "storage.auth.SaveEmailChangeLink"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM activation_links WHERE user_id = $1 AND new_email IS NOT NULL"
+	if _, err := tx.ExecContext(ctx, query, activation.UserID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = "INSERT INTO activation_links (user_id, activation_id, new_email, expires_at) VALUES ($1, $2, $3, $4)"
+	if _, err := tx.ExecContext(ctx, query, activation.UserID, activation.ActivationID, activation.NewEmail, activation.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
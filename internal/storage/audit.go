@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"ia-online-golang/internal/models"
+	"strings"
+)
+
+type AuditRepositoryI interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+	AuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, int64, error)
+	EachAuditEvent(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEvent) error) error
+}
+
+const auditEventColumns = "id, actor_id, action, target_type, target_id, before, after, details, ip, request_id, created_at"
+
+func (s *Storage) SaveAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	const op = "storage.audit.SaveAuditEvent"
+
+	if err := insertAuditEvent(ctx, s.db, event); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// insertAuditEvent пишет событие в журнал. В транзакции действия событие сохраняется только вместе с ним.
+func insertAuditEvent(ctx context.Context, q querier, event models.AuditEvent) error {
+	details := event.Details
+	if len(details) == 0 {
+		details = []byte("{}")
+	}
+
+	query := `
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, before, after, details, ip, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := q.ExecContext(ctx, query,
+		event.ActorID, event.Action, event.TargetType, event.TargetID,
+		nullJSON(event.Before), nullJSON(event.After), string(details),
+		event.IP, event.RequestID,
+	)
+	return err
+}
+
+// AuditEvents возвращает страницу журнала, новые события первыми, и общее число событий по фильтру
+func (s *Storage) AuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, int64, error) {
+	const op = "storage.audit.AuditEvents"
+
+	where, args := auditWhere(filter)
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_events"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	events := make([]models.AuditEvent, 0, filter.Limit)
+	err := s.EachAuditEvent(ctx, filter, func(event models.AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, total, nil
+}
+
+// EachAuditEvent обходит события по фильтру без загрузки всех в память, например для выгрузки.
+// Если Limit равен нулю, обходятся все события.
+func (s *Storage) EachAuditEvent(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEvent) error) error {
+	const op = "storage.audit.EachAuditEvent"
+
+	where, args := auditWhere(filter)
+
+	query := "SELECT " + auditEventColumns + " FROM audit_events" + where + " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.AuditEvent
+		var before, after, details []byte
+		if err := rows.Scan(
+			&event.ID, &event.ActorID, &event.Action, &event.TargetType, &event.TargetID,
+			&before, &after, &details, &event.IP, &event.RequestID, &event.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		event.Before, event.After, event.Details = before, after, details
+
+		if err := fn(event); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func auditWhere(filter models.AuditFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorID != nil {
+		add("actor_id = $%d", *filter.ActorID)
+	}
+	if filter.Action != nil {
+		add("action = $%d", *filter.Action)
+	}
+	if filter.TargetType != nil {
+		add("target_type = $%d", *filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		add("target_id = $%d", *filter.TargetID)
+	}
+	if filter.RequestID != nil {
+		add("request_id = $%d", *filter.RequestID)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("created_at < $%d", *filter.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// nullJSON пустой JSON сохраняется как NULL: у события может не быть состояния до или после
+func nullJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
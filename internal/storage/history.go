@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+	"time"
+)
+
+type HistoryRepositoryI interface {
+	UpdateLeadWithHistory(ctx context.Context,
+		leadID int64,
+		statusID *int64,
+		rewardInternet, rewardCleaning, rewardShipping *money.Money,
+		completedAt, paymentAt *time.Time,
+		entries []models.HistoryEntry) error
+	LeadHistory(ctx context.Context, leadID int64) ([]models.HistoryEntry, error)
+}
+
+// UpdateLeadWithHistory обновляет заявку и записывает изменения в историю в одной транзакции
+func (s *Storage) UpdateLeadWithHistory(
+	ctx context.Context,
+	leadID int64,
+	statusID *int64,
+	rewardInternet, rewardCleaning, rewardShipping *money.Money,
+	completedAt, paymentAt *time.Time,
+	entries []models.HistoryEntry,
+) error {
+	const op = "storage.history.UpdateLeadWithHistory"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	err = updateLead(ctx, tx, &leadID, nil, statusID,
+		rewardInternet, rewardCleaning, rewardShipping,
+		nil, nil, nil, nil, nil, nil,
+		nil, completedAt, paymentAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		INSERT INTO history (lead_id, action, field, old_value, new_value, source, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	for _, entry := range entries {
+		_, err := tx.ExecContext(ctx, query, leadID, entry.Action, entry.Field, entry.OldValue, entry.NewValue, entry.Source, entry.UserID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) LeadHistory(ctx context.Context, leadID int64) ([]models.HistoryEntry, error) {
+	const op = "storage.history.LeadHistory"
+
+	query := `
+		SELECT h.id, h.lead_id, h.action, COALESCE(h.field, ''), h.old_value, h.new_value, h.source, h.user_id,
+			old_status.bitrix_name, new_status.bitrix_name, h.created_at
+		FROM history h
+		LEFT JOIN statuses old_status ON h.field = 'status_id' AND old_status.id::text = h.old_value
+		LEFT JOIN statuses new_status ON h.field = 'status_id' AND new_status.id::text = h.new_value
+		WHERE h.lead_id = $1
+		ORDER BY h.created_at, h.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, leadID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var entries []models.HistoryEntry
+	for rows.Next() {
+		var entry models.HistoryEntry
+		if err := rows.Scan(
+			&entry.ID, &entry.LeadID, &entry.Action, &entry.Field, &entry.OldValue, &entry.NewValue, &entry.Source, &entry.UserID,
+			&entry.OldStatus, &entry.NewStatus, &entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
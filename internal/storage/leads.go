@@ -5,13 +5,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"ia-online-golang/internal/lib/money"
 	"ia-online-golang/internal/models"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type LeadRepositoryI interface {
 	LeadByID(ctx context.Context, id int64) (*models.Lead, error)
+	LeadByBitrixID(ctx context.Context, bitrixID int64) (*models.Lead, error)
 	CreateLead(ctx context.Context, lead *models.Lead) error
 	Leads(ctx context.Context,
 		statusID *int64,
@@ -22,11 +26,16 @@ type LeadRepositoryI interface {
 		IsInternet, IsShipping, IsCleaning *bool) ([]models.Lead, error)
 	UpdateLead(ctx context.Context,
 		id, userID, statusID *int64,
-		reward_internet, reward_cleaning, reward_shipping *float64,
+		reward_internet, reward_cleaning, reward_shipping *money.Money,
 		fio, phone_number, address *string,
 		internet, cleaning, shipping *bool,
 		created_at, completed_at, payment_at *time.Time) error
 	DeleteLead(ctx context.Context, id int64) error
+	LeadsCountByStatus(ctx context.Context) (map[string]int64, error)
+	UpdateLeadRewardDiscrepancy(ctx context.Context, id int64, discrepancy bool) error
+	LeadsWithRewardDiscrepancy(ctx context.Context, limit, offset int64) ([]models.Lead, int64, error)
+	LeadsByBitrixIDs(ctx context.Context, bitrixIDs []int64) ([]models.Lead, error)
+	EachLead(ctx context.Context, startDate, endDate *time.Time, fn func(models.Lead) error) error
 }
 
 var (
@@ -34,21 +43,21 @@ var (
 	ErrLeadsNotFound = errors.New("leads not found")
 )
 
+// leadColumns порядок колонок, который ожидает scanLead
+const leadColumns = `id, bitrix_id, user_id, fio, address, status_id, phone_number, internet, cleaning, shipping, sync_status,
+		       reward_internet, reward_cleaning, reward_shipping, created_at, completed_at, payment_at,
+		       expected_reward_internet, expected_reward_cleaning, expected_reward_shipping, reward_discrepancy`
+
 func (s *Storage) LeadByID(ctx context.Context, id int64) (*models.Lead, error) {
 	const op = "storage.leads.GetLeadByID"
 
 	query := `
-		SELECT id, user_id, fio, address, status_id, phone_number, internet, cleaning, shipping, created_at, completed_at, payment_at
+		SELECT ` + leadColumns + `
 		FROM leads
 		WHERE id = $1
 	`
 
-	lead := &models.Lead{}
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&lead.ID, &lead.UserID, &lead.FIO, &lead.Address, &lead.StatusID, &lead.PhoneNumber, &lead.Internet,
-		&lead.Cleaning, &lead.Shipping, &lead.CreatedAt, &lead.CompletedAt, &lead.PaymentAt,
-	)
-
+	lead, err := scanLead(s.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrLeadNotFound
@@ -59,33 +68,74 @@ func (s *Storage) LeadByID(ctx context.Context, id int64) (*models.Lead, error)
 	return lead, nil
 }
 
-func (s *Storage) CreateLead(ctx context.Context, lead *models.Lead) error {
-	const op = "storage.leads.CreateLead"
+func (s *Storage) LeadByBitrixID(ctx context.Context, bitrixID int64) (*models.Lead, error) {
+	const op = "storage.leads.LeadByBitrixID"
 
 	query := `
-		INSERT INTO leads (id, user_id, fio, address, status_id, phone_number, internet, cleaning, shipping)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id
+		SELECT ` + leadColumns + `
+		FROM leads
+		WHERE bitrix_id = $1
 	`
 
-	// Выполнение запроса и возврат нового ID
-	err := s.db.QueryRowContext(ctx, query,
-		lead.ID, lead.UserID, lead.FIO, lead.Address, lead.StatusID, lead.PhoneNumber, lead.Internet,
-		lead.Cleaning, lead.Shipping,
-	).Scan(&lead.ID)
+	lead, err := scanLead(s.db.QueryRowContext(ctx, query, bitrixID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLeadNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return lead, nil
+}
 
+func scanLead(row rowScanner) (*models.Lead, error) {
+	lead := &models.Lead{}
+	err := row.Scan(
+		&lead.ID, &lead.BitrixID, &lead.UserID, &lead.FIO, &lead.Address, &lead.StatusID, &lead.PhoneNumber, &lead.Internet,
+		&lead.Cleaning, &lead.Shipping, &lead.SyncStatus, &lead.RewardInternet, &lead.RewardCleaning, &lead.RewardShipping,
+		&lead.CreatedAt, &lead.CompletedAt, &lead.PaymentAt,
+		&lead.ExpectedRewardInternet, &lead.ExpectedRewardCleaning, &lead.ExpectedRewardShipping, &lead.RewardDiscrepancy,
+	)
 	if err != nil {
+		return nil, err
+	}
+
+	return lead, nil
+}
+
+func (s *Storage) CreateLead(ctx context.Context, lead *models.Lead) error {
+	const op = "storage.leads.CreateLead"
+
+	if err := insertLead(ctx, s.db, lead); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
+// insertLead сохраняет заявку. Используется как отдельно, так и внутри транзакции.
+func insertLead(ctx context.Context, db querier, lead *models.Lead) error {
+	query := `
+		INSERT INTO leads (bitrix_id, user_id, fio, address, status_id, phone_number, internet, cleaning, shipping, sync_status,
+		                   reward_internet, reward_cleaning, reward_shipping,
+		                   expected_reward_internet, expected_reward_cleaning, expected_reward_shipping)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id, created_at
+	`
+
+	// Выполнение запроса и возврат нового ID
+	return db.QueryRowContext(ctx, query,
+		lead.BitrixID, lead.UserID, lead.FIO, lead.Address, lead.StatusID, lead.PhoneNumber, lead.Internet,
+		lead.Cleaning, lead.Shipping, lead.SyncStatus, lead.RewardInternet, lead.RewardCleaning, lead.RewardShipping,
+		lead.ExpectedRewardInternet, lead.ExpectedRewardCleaning, lead.ExpectedRewardShipping,
+	).Scan(&lead.ID, &lead.CreatedAt)
+}
+
 func (s *Storage) Leads(ctx context.Context, statusID *int64, startDate, endDate *time.Time, limit, offset int64, userID *int64, Search *string, IsInternet, IsShipping, IsCleaning *bool) ([]models.Lead, error) {
 	const op = "storage.leads.GetLeads"
 
 	query := `
-		SELECT id, user_id, fio, address, status_id, phone_number, internet, cleaning, shipping, created_at, completed_at, payment_at, reward_internet, reward_cleaning, reward_shipping
+		SELECT ` + leadColumns + `
 		FROM leads
 		WHERE 1=1
 	`
@@ -174,15 +224,12 @@ func (s *Storage) Leads(ctx context.Context, statusID *int64, startDate, endDate
 
 	var leads []models.Lead
 	for rows.Next() {
-		lead := models.Lead{}
-		if err := rows.Scan(
-			&lead.ID, &lead.UserID, &lead.FIO, &lead.Address, &lead.StatusID, &lead.PhoneNumber, &lead.Internet,
-			&lead.Cleaning, &lead.Shipping, &lead.CreatedAt, &lead.CompletedAt, &lead.PaymentAt, &lead.RewardInternet, &lead.RewardCleaning, &lead.RewardShipping,
-		); err != nil {
+		lead, err := scanLead(rows)
+		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
-		leads = append(leads, lead)
+		leads = append(leads, *lead)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -199,7 +246,24 @@ func (s *Storage) Leads(ctx context.Context, statusID *int64, startDate, endDate
 func (s *Storage) UpdateLead(
 	ctx context.Context,
 	id, userID, statusID *int64,
-	reward_internet, reward_cleaning, reward_shipping *float64,
+	reward_internet, reward_cleaning, reward_shipping *money.Money,
+	fio, phone_number, address *string,
+	internet, cleaning, shipping *bool,
+	created_at, completed_at, payment_at *time.Time,
+) error {
+	return updateLead(ctx, s.db, id, userID, statusID,
+		reward_internet, reward_cleaning, reward_shipping,
+		fio, phone_number, address,
+		internet, cleaning, shipping,
+		created_at, completed_at, payment_at,
+	)
+}
+
+func updateLead(
+	ctx context.Context,
+	db querier,
+	id, userID, statusID *int64,
+	reward_internet, reward_cleaning, reward_shipping *money.Money,
 	fio, phone_number, address *string,
 	internet, cleaning, shipping *bool,
 	created_at, completed_at, payment_at *time.Time,
@@ -269,7 +333,7 @@ func (s *Storage) UpdateLead(
 	query += fmt.Sprintf(" WHERE id = $%d", argCount)
 	args = append(args, id)
 
-	_, err := s.db.ExecContext(ctx, query, args...)
+	_, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -277,6 +341,40 @@ func (s *Storage) UpdateLead(
 	return nil
 }
 
+// LeadsCountByStatus количество заявок в каждом статусе, включая пустые
+func (s *Storage) LeadsCountByStatus(ctx context.Context) (map[string]int64, error) {
+	const op = "storage.leads.LeadsCountByStatus"
+
+	query := `
+		SELECT s.name, COUNT(l.id)
+		FROM statuses s
+		LEFT JOIN leads l ON l.status_id = s.id
+		GROUP BY s.name
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		counts[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return counts, nil
+}
+
 func (s *Storage) DeleteLead(ctx context.Context, id int64) error {
 	const op = "storage.leads.DeleteLead"
 
@@ -290,3 +388,139 @@ func (s *Storage) DeleteLead(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+// UpdateLeadRewardDiscrepancy отмечает расхождение суммы из битрикса с ожидаемым вознаграждением
+func (s *Storage) UpdateLeadRewardDiscrepancy(ctx context.Context, id int64, discrepancy bool) error {
+	const op = "storage.leads.UpdateLeadRewardDiscrepancy"
+
+	query := `UPDATE leads SET reward_discrepancy = $1 WHERE id = $2`
+
+	result, err := s.db.ExecContext(ctx, query, discrepancy, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return ErrLeadNotFound
+	}
+
+	return nil
+}
+
+// LeadsWithRewardDiscrepancy заявки с расхождением вознаграждения, новые первыми, и их общее количество
+func (s *Storage) LeadsWithRewardDiscrepancy(ctx context.Context, limit, offset int64) ([]models.Lead, int64, error) {
+	const op = "storage.leads.LeadsWithRewardDiscrepancy"
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM leads WHERE reward_discrepancy`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		SELECT ` + leadColumns + `
+		FROM leads
+		WHERE reward_discrepancy
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	leads := make([]models.Lead, 0)
+	for rows.Next() {
+		lead, err := scanLead(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		leads = append(leads, *lead)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return leads, total, nil
+}
+
+// eachLeadBatch столько заявок EachLead загружает за один запрос
+const eachLeadBatch = 500
+
+// LeadsByBitrixIDs заявки по id сделок. Сделки, созданные не через сайт, в результат не попадают.
+func (s *Storage) LeadsByBitrixIDs(ctx context.Context, bitrixIDs []int64) ([]models.Lead, error) {
+	const op = "storage.leads.LeadsByBitrixIDs"
+
+	query := `
+		SELECT ` + leadColumns + `
+		FROM leads
+		WHERE bitrix_id = ANY($1)
+	`
+
+	leads, err := s.queryLeads(ctx, query, pq.Array(bitrixIDs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return leads, nil
+}
+
+// EachLead обходит заявки, созданные в периоде, пачками по id, не загружая все в память.
+// Пачка читается целиком до вызова fn, поэтому fn может обращаться к базе. Ошибка fn прекращает обход.
+func (s *Storage) EachLead(ctx context.Context, startDate, endDate *time.Time, fn func(models.Lead) error) error {
+	const op = "storage.leads.EachLead"
+
+	query := `
+		SELECT ` + leadColumns + `
+		FROM leads
+		WHERE id > $1
+			AND ($2::TIMESTAMPTZ IS NULL OR created_at >= $2)
+			AND ($3::TIMESTAMPTZ IS NULL OR created_at <= $3)
+		ORDER BY id
+		LIMIT $4
+	`
+
+	var afterID int64
+	for {
+		leads, err := s.queryLeads(ctx, query, afterID, startDate, endDate, eachLeadBatch)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, lead := range leads {
+			if err := fn(lead); err != nil {
+				return err
+			}
+		}
+
+		if len(leads) < eachLeadBatch {
+			return nil
+		}
+		afterID = leads[len(leads)-1].ID
+	}
+}
+
+func (s *Storage) queryLeads(ctx context.Context, query string, args ...any) ([]models.Lead, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leads []models.Lead
+	for rows.Next() {
+		lead, err := scanLead(rows)
+		if err != nil {
+			return nil, err
+		}
+		leads = append(leads, *lead)
+	}
+
+	return leads, rows.Err()
+}
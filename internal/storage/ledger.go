@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+
+	"github.com/lib/pq"
+)
+
+type LedgerRepositoryI interface {
+	SyncLedgerAccrual(ctx context.Context, txn models.LedgerTransaction, target money.Money) (bool, error)
+	SaveLedgerTransaction(ctx context.Context, txn models.LedgerTransaction, amount money.Money, auditEvent models.AuditEvent) error
+	LedgerBalance(ctx context.Context, userID int64) (models.LedgerBalance, error)
+	LedgerRecords(ctx context.Context, userID int64, limit, offset int64) ([]models.LedgerRecord, int64, error)
+}
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrDuplicateReference  = errors.New("payment order already booked")
+)
+
+// SyncLedgerAccrual доводит сумму начислений по источнику до target. Проводится только разница,
+// поэтому повторный вызов с той же суммой ничего не меняет. Возвращает true, если проводка создана.
+func (s *Storage) SyncLedgerAccrual(ctx context.Context, txn models.LedgerTransaction, target money.Money) (bool, error) {
+	const op = "storage.ledger.SyncLedgerAccrual"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Вебхук и сверка могут обрабатывать одну заявку одновременно
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", txn.SourceType+":"+txn.SourceID); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Начисления лежат на счёте партнёра кредитом, то есть с минусом
+	query := `
+		SELECT ROUND($1::NUMERIC, 2) + COALESCE(SUM(e.amount), 0)
+		FROM ledger_entries e
+		JOIN ledger_transactions t ON t.id = e.transaction_id
+		WHERE t.kind = $2 AND t.source_type = $3 AND t.source_id = $4 AND e.account = $5`
+	var delta money.Money
+	if err := tx.QueryRowContext(ctx, query, target, txn.Kind, txn.SourceType, txn.SourceID, models.LedgerAccountPartner).Scan(&delta); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if delta == 0 {
+		return false, nil
+	}
+
+	if err := insertLedgerTransaction(ctx, tx, txn, delta, models.LedgerAccountRewardExpense); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// SaveLedgerTransaction проводит выплату или корректировку. amount увеличивает долг перед партнёром,
+// выплата передаётся с минусом. Списание не может затронуть сумму, зарезервированную открытыми заявками на выплату:
+// иначе возвращается ErrInsufficientBalance. Повторная выплата по тому же платёжному поручению возвращает ErrDuplicateReference.
+// Запись в журнале сохраняется в той же транзакции.
+func (s *Storage) SaveLedgerTransaction(ctx context.Context, txn models.LedgerTransaction, amount money.Money, auditEvent models.AuditEvent) error {
+	const op = "storage.ledger.SaveLedgerTransaction"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := lockLedgerBalance(ctx, tx, txn.UserID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if txn.SourceType == models.LedgerSourcePaymentOrder {
+		query := `
+			SELECT EXISTS (
+				SELECT 1 FROM ledger_transactions
+				WHERE user_id = $1 AND kind = $2 AND source_type = $3 AND source_id = $4
+			)`
+		var exists bool
+		if err := tx.QueryRowContext(ctx, query, txn.UserID, txn.Kind, txn.SourceType, txn.SourceID).Scan(&exists); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if exists {
+			return ErrDuplicateReference
+		}
+	}
+
+	var reserved money.Money
+	if amount < 0 {
+		reserved, err = payoutReserved(ctx, tx, txn.UserID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	enough, err := ledgerBalanceCovers(ctx, tx, txn.UserID, amount-reserved)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !enough {
+		return ErrInsufficientBalance
+	}
+
+	counterAccount := models.LedgerAccountRewardExpense
+	if txn.Kind == models.LedgerKindPayout {
+		counterAccount = models.LedgerAccountCash
+	}
+
+	if err := insertLedgerTransaction(ctx, tx, txn, amount, counterAccount); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := insertAuditEvent(ctx, tx, auditEvent); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// lockLedgerBalance две выплаты или заявки одновременно не должны пройти проверку баланса по отдельности
+func lockLedgerBalance(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('ledger'), $1)", userID)
+	return err
+}
+
+// ledgerBalanceCovers проверяет, что баланс партнёра после проводки на amount не станет отрицательным
+func ledgerBalanceCovers(ctx context.Context, tx *sql.Tx, userID int64, amount money.Money) (bool, error) {
+	query := `
+		SELECT -COALESCE(SUM(amount), 0) + ROUND($2::NUMERIC, 2) >= 0
+		FROM ledger_entries
+		WHERE account = $1 AND user_id = $3`
+	var enough bool
+	if err := tx.QueryRowContext(ctx, query, models.LedgerAccountPartner, amount, userID).Scan(&enough); err != nil {
+		return false, err
+	}
+
+	return enough, nil
+}
+
+// insertLedgerTransaction пишет проводку из двух записей: счёт партнёра и counterAccount на ту же сумму
+func insertLedgerTransaction(ctx context.Context, tx *sql.Tx, txn models.LedgerTransaction, amount money.Money, counterAccount string) error {
+	query := `
+		INSERT INTO ledger_transactions (kind, user_id, reason, source_type, source_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+	var id int64
+	err := tx.QueryRowContext(ctx, query,
+		txn.Kind, txn.UserID, txn.Reason, txn.SourceType, txn.SourceID, txn.CreatedBy,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO ledger_entries (transaction_id, account, user_id, amount)
+		VALUES ($1, $2, $3, -ROUND($5::NUMERIC, 2)), ($1, $4, NULL, ROUND($5::NUMERIC, 2))`
+	if _, err := tx.ExecContext(ctx, query, id, models.LedgerAccountPartner, txn.UserID, counterAccount, amount); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Storage) LedgerBalance(ctx context.Context, userID int64) (models.LedgerBalance, error) {
+	const op = "storage.ledger.LedgerBalance"
+
+	query := `
+		SELECT
+			COALESCE(-SUM(e.amount) FILTER (WHERE t.kind <> $3), 0),
+			COALESCE(SUM(e.amount) FILTER (WHERE t.kind = $3), 0),
+			COALESCE(-SUM(e.amount), 0),
+			(SELECT COALESCE(SUM(amount), 0) FROM payout_requests WHERE user_id = $2 AND status = ANY($4))
+		FROM ledger_entries e
+		JOIN ledger_transactions t ON t.id = e.transaction_id
+		WHERE e.account = $1 AND e.user_id = $2`
+	var balance models.LedgerBalance
+	err := s.db.QueryRowContext(ctx, query,
+		models.LedgerAccountPartner, userID, models.LedgerKindPayout, pq.Array(openPayoutStatuses),
+	).Scan(
+		&balance.Accrued,
+		&balance.Paid,
+		&balance.Pending,
+		&balance.Reserved,
+	)
+	if err != nil {
+		return models.LedgerBalance{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return balance, nil
+}
+
+// LedgerRecords возвращает проводки партнёра, новые первыми, и их общее число
+func (s *Storage) LedgerRecords(ctx context.Context, userID int64, limit, offset int64) ([]models.LedgerRecord, int64, error) {
+	const op = "storage.ledger.LedgerRecords"
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ledger_transactions WHERE user_id = $1", userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		SELECT t.id, t.kind, t.user_id, t.reason, t.source_type, t.source_id, t.created_by, t.created_at, -e.amount
+		FROM ledger_transactions t
+		JOIN ledger_entries e ON e.transaction_id = t.id AND e.account = $2
+		WHERE t.user_id = $1
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $3 OFFSET $4`
+	rows, err := s.db.QueryContext(ctx, query, userID, models.LedgerAccountPartner, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var records []models.LedgerRecord
+	for rows.Next() {
+		var record models.LedgerRecord
+		if err := rows.Scan(
+			&record.ID, &record.Kind, &record.UserID, &record.Reason, &record.SourceType, &record.SourceID,
+			&record.CreatedBy, &record.CreatedAt, &record.Amount,
+		); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return records, total, nil
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/models"
+	"time"
+)
+
+type OutboxRepositoryI interface {
+	CreateLeadWithOutbox(ctx context.Context, lead *models.Lead, message models.OutboxMessage) error
+	ClaimOutboxMessages(ctx context.Context, limit int64, lease time.Duration) ([]models.OutboxMessage, error)
+	CompleteOutboxMessage(ctx context.Context, id int64, leadID int64, bitrixID int64, next []models.OutboxMessage) error
+	CompleteOutboxComment(ctx context.Context, id int64, comment models.Comment) error
+	SaveOutboxBitrixID(ctx context.Context, id int64, bitrixID int64) error
+	SaveOutboxContactID(ctx context.Context, id int64, contactID int64) error
+	EnqueueOutboxMessage(ctx context.Context, message models.OutboxMessage) error
+	RetryOutboxMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error
+	FailOutboxMessage(ctx context.Context, id int64, leadID int64, attempts int, lastError string) error
+}
+
+var (
+	ErrOutboxMessageNotFound = errors.New("outbox message not found")
+)
+
+// CreateLeadWithOutbox сохраняет заявку и сообщение для битрикса в одной транзакции
+func (s *Storage) CreateLeadWithOutbox(ctx context.Context, lead *models.Lead, message models.OutboxMessage) error {
+	const op = "storage.outbox.CreateLeadWithOutbox"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := insertLead(ctx, tx, lead); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := "INSERT INTO bitrix_outbox (lead_id, event, payload) VALUES ($1, $2, $3)"
+	if _, err := tx.ExecContext(ctx, query, lead.ID, message.Event, message.Payload); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// EnqueueOutboxMessage ставит в очередь сообщение по уже сохранённой заявке
+func (s *Storage) EnqueueOutboxMessage(ctx context.Context, message models.OutboxMessage) error {
+	const op = "storage.outbox.EnqueueOutboxMessage"
+
+	query := "INSERT INTO bitrix_outbox (lead_id, event, payload) VALUES ($1, $2, $3)"
+	if _, err := s.db.ExecContext(ctx, query, message.LeadID, message.Event, message.Payload); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxMessages забирает готовые к отправке сообщения и откладывает их на время lease,
+// чтобы параллельно запущенные воркеры не отправили одно и то же сообщение дважды
+func (s *Storage) ClaimOutboxMessages(ctx context.Context, limit int64, lease time.Duration) ([]models.OutboxMessage, error) {
+	const op = "storage.outbox.ClaimOutboxMessages"
+
+	query := `
+		UPDATE bitrix_outbox
+		SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM bitrix_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, lead_id, event, payload, status, attempts, last_error, bitrix_id, contact_id, next_attempt_at, created_at, processed_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var m models.OutboxMessage
+		if err := rows.Scan(
+			&m.ID, &m.LeadID, &m.Event, &m.Payload, &m.Status, &m.Attempts,
+			&m.LastError, &m.BitrixID, &m.ContactID, &m.NextAttemptAt, &m.CreatedAt, &m.ProcessedAt,
+		); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		messages = append(messages, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messages, nil
+}
+
+// CompleteOutboxMessage помечает сообщение отправленным, записывает id сделки в заявку
+// и ставит в очередь следующие сообщения по ней
+func (s *Storage) CompleteOutboxMessage(ctx context.Context, id int64, leadID int64, bitrixID int64, next []models.OutboxMessage) error {
+	const op = "storage.outbox.CompleteOutboxMessage"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE leads SET bitrix_id = $1, sync_status = $2 WHERE id = $3"
+	if _, err := tx.ExecContext(ctx, query, bitrixID, models.LeadSyncSynced, leadID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := completeOutboxMessage(ctx, tx, id, bitrixID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = "INSERT INTO bitrix_outbox (lead_id, event, payload) VALUES ($1, $2, $3)"
+	for _, message := range next {
+		if _, err := tx.ExecContext(ctx, query, leadID, message.Event, message.Payload); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CompleteOutboxComment помечает сообщение отправленным и сохраняет комментарий с id из битрикса.
+// Комментарий мог уже прийти вебхуком, тогда он не перезаписывается.
+func (s *Storage) CompleteOutboxComment(ctx context.Context, id int64, comment models.Comment) error {
+	const op = "storage.outbox.CompleteOutboxComment"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO comments (id, lead_id, user_id, text) VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING"
+	if _, err := tx.ExecContext(ctx, query, comment.ID, comment.LeadID, comment.UserID, comment.Text); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := completeOutboxMessage(ctx, tx, id, comment.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func completeOutboxMessage(ctx context.Context, tx *sql.Tx, id int64, bitrixID int64) error {
+	query := "UPDATE bitrix_outbox SET status = $1, attempts = attempts + 1, last_error = NULL, bitrix_id = $2, processed_at = NOW() WHERE id = $3"
+	result, err := tx.ExecContext(ctx, query, models.OutboxStatusDone, bitrixID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrOutboxMessageNotFound
+	}
+
+	return nil
+}
+
+// SaveOutboxBitrixID запоминает id созданного в битриксе объекта, чтобы при повторной попытке не вызывать метод снова
+func (s *Storage) SaveOutboxBitrixID(ctx context.Context, id int64, bitrixID int64) error {
+	const op = "storage.outbox.SaveOutboxBitrixID"
+
+	query := "UPDATE bitrix_outbox SET bitrix_id = $1 WHERE id = $2"
+	result, err := s.db.ExecContext(ctx, query, bitrixID, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrOutboxMessageNotFound
+	}
+
+	return nil
+}
+
+// SaveOutboxContactID запоминает id созданного для сделки контакта до создания самой сделки
+func (s *Storage) SaveOutboxContactID(ctx context.Context, id int64, contactID int64) error {
+	const op = "storage.outbox.SaveOutboxContactID"
+
+	query := "UPDATE bitrix_outbox SET contact_id = $1 WHERE id = $2"
+	result, err := s.db.ExecContext(ctx, query, contactID, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrOutboxMessageNotFound
+	}
+
+	return nil
+}
+
+// RetryOutboxMessage откладывает сообщение до следующей попытки
+func (s *Storage) RetryOutboxMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	const op = "storage.outbox.RetryOutboxMessage"
+
+	query := "UPDATE bitrix_outbox SET attempts = $1, next_attempt_at = $2, last_error = $3 WHERE id = $4"
+	result, err := s.db.ExecContext(ctx, query, attempts, nextAttemptAt, lastError, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrOutboxMessageNotFound
+	}
+
+	return nil
+}
+
+// FailOutboxMessage окончательно помечает сообщение неотправленным. Заявка помечается, только если сделка по ней
+// так и не создана: неотправленный комментарий не делает заявку несинхронизированной.
+func (s *Storage) FailOutboxMessage(ctx context.Context, id int64, leadID int64, attempts int, lastError string) error {
+	const op = "storage.outbox.FailOutboxMessage"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE bitrix_outbox SET status = $1, attempts = $2, last_error = $3, processed_at = NOW() WHERE id = $4"
+	if _, err := tx.ExecContext(ctx, query, models.OutboxStatusFailed, attempts, lastError, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = "UPDATE leads SET sync_status = $1 WHERE id = $2 AND bitrix_id IS NULL"
+	if _, err := tx.ExecContext(ctx, query, models.LeadSyncFailed, leadID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -9,11 +9,9 @@ import (
 )
 
 type PasswordCodeRepositoryI interface {
-	PasswordCode(ctx context.Context, password_code string) (models.PasswordCode, error)
-	PasswordCodeByUserId(ctx context.Context, userID int64) (models.PasswordCode, error)
 	SavePasswordCode(ctx context.Context, password_code models.PasswordCode) error
-	DeletePasswordCode(ctx context.Context, password_code string) error
-	UpdatePasswordCode(ctx context.Context, password_code models.PasswordCode) error
+	AttemptPasswordCode(ctx context.Context, userID int64) (models.PasswordCode, error)
+	DeletePasswordCode(ctx context.Context, id int) error
 }
 
 var (
@@ -21,37 +19,39 @@ var (
 	ErrPasswordCodeInNotUpdated = errors.New("password code is not updated")
 )
 
-func (s *Storage) PasswordCode(ctx context.Context, password_code string) (models.PasswordCode, error) {
-	const op = "storage.passwordcode.PasswordCode"
+// SavePasswordCode сохраняет код пользователя. Предыдущий код и счётчик попыток заменяются.
+func (s *Storage) SavePasswordCode(ctx context.Context, password_code models.PasswordCode) error {
+	const op = "storage.passwordcode.SavePasswordCode"
 
-	var PasswordCode models.PasswordCode
-	query := "SELECT id, user_id, code, expires_at FROM password_codes WHERE code = $1"
-	err := s.db.QueryRowContext(ctx, query, password_code).Scan(
-		&PasswordCode.ID,
-		&PasswordCode.UserID,
-		&PasswordCode.Code,
-		&PasswordCode.ExpiresAt,
-	)
+	query := `
+		INSERT INTO password_codes (user_id, code_hash, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET code_hash = EXCLUDED.code_hash, attempts = 0, created_at = NOW(), expires_at = EXCLUDED.expires_at`
+	_, err := s.db.ExecContext(ctx, query, password_code.UserID, password_code.CodeHash, password_code.ExpiresAt)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.PasswordCode{}, ErrPasswordCodeIsNotFound
-		}
-		return models.PasswordCode{}, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return PasswordCode, nil
+	return nil
 }
 
-func (s *Storage) PasswordCodeByUserId(ctx context.Context, userID int64) (models.PasswordCode, error) {
-	const op = "storage.passwordcode.PasswordCodeByUserId"
+// AttemptPasswordCode учитывает попытку ввода кода и возвращает код с уже увеличенным счётчиком.
+// Счётчик увеличивается до проверки, чтобы параллельные запросы не обходили лимит попыток.
+func (s *Storage) AttemptPasswordCode(ctx context.Context, userID int64) (models.PasswordCode, error) {
+	const op = "storage.passwordcode.AttemptPasswordCode"
 
-	var PasswordCode models.PasswordCode
-	query := "SELECT id, user_id, code, expires_at FROM password_codes WHERE user_id = $1"
+	var passwordCode models.PasswordCode
+	query := `
+		UPDATE password_codes SET attempts = attempts + 1
+		WHERE user_id = $1
+		RETURNING id, user_id, code_hash, attempts, expires_at`
 	err := s.db.QueryRowContext(ctx, query, userID).Scan(
-		&PasswordCode.ID,
-		&PasswordCode.UserID,
-		&PasswordCode.Code,
-		&PasswordCode.ExpiresAt,
+		&passwordCode.ID,
+		&passwordCode.UserID,
+		&passwordCode.CodeHash,
+		&passwordCode.Attempts,
+		&passwordCode.ExpiresAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -60,43 +60,24 @@ func (s *Storage) PasswordCodeByUserId(ctx context.Context, userID int64) (model
 		return models.PasswordCode{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return PasswordCode, nil
+	return passwordCode, nil
 }
 
-func (s *Storage) SavePasswordCode(ctx context.Context, password_code models.PasswordCode) error {
-	const op = "storage.passwordcode.SavePasswordCode"
+// DeletePasswordCode удаляет код. Если кода уже нет, значит его использовали параллельным запросом.
+func (s *Storage) DeletePasswordCode(ctx context.Context, id int) error {
+	const op = "storage.passwordcode.DeletePasswordCode"
 
-	query := "INSERT INTO password_codes (user_id, code, expires_at) VALUES ($1, $2, $3)"
-	_, err := s.db.ExecContext(ctx, query, password_code.UserID, password_code.Code, password_code.ExpiresAt)
+	result, err := s.db.ExecContext(ctx, "DELETE FROM password_codes WHERE id = $1", id)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
-}
-
-func (s *Storage) UpdatePasswordCode(ctx context.Context, password_code models.PasswordCode) error {
-	const op = "storage.passwordcode.UpdatePasswordCode"
-
-	query := `
-		UPDATE password_codes
-		SET code = $1, expires_at = $2
-		WHERE user_id = $3`
-	_, err := s.db.ExecContext(ctx, query, password_code.Code, password_code.ExpiresAt, password_code.UserID)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-
-	return nil
-}
-
-func (s *Storage) DeletePasswordCode(ctx context.Context, password_code string) error {
-	const op = "storage.passwordcode.DeletePasswordCode"
-
-	query := "DELETE FROM password_codes WHERE code = $1"
-	_, err := s.db.ExecContext(ctx, query, password_code)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	if rowsAffected == 0 {
+		return ErrPasswordCodeIsNotFound
 	}
 
 	return nil
@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/lib/money"
+	"ia-online-golang/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type PayoutRepositoryI interface {
+	SavePayoutRequest(ctx context.Context, request models.PayoutRequest, comment string, auditEvent models.AuditEvent) (int64, error)
+	PayoutRequest(ctx context.Context, id int64) (models.PayoutRequest, error)
+	PayoutRequests(ctx context.Context, filter models.PayoutFilter) ([]models.PayoutRequest, int64, error)
+	PayoutRequestHistory(ctx context.Context, id int64) ([]models.PayoutRequestEvent, error)
+	UpdatePayoutStatus(ctx context.Context, id int64, from []string, event models.PayoutRequestEvent, auditEvent models.AuditEvent) error
+	PayPayoutRequest(ctx context.Context, id int64, event models.PayoutRequestEvent, txn models.LedgerTransaction, auditEvent models.AuditEvent) error
+}
+
+var (
+	ErrPayoutRequestNotFound = errors.New("payout request not found")
+	ErrPayoutStatusConflict  = errors.New("payout request status does not allow transition")
+)
+
+// openPayoutStatuses заявки в этих статусах резервируют часть баланса
+var openPayoutStatuses = []string{models.PayoutStatusRequested, models.PayoutStatusApproved}
+
+// SavePayoutRequest создаёт заявку, если сумма не превышает баланс к выплате за вычетом открытых заявок.
+// Иначе возвращает ErrInsufficientBalance. Запись в журнале сохраняется в той же транзакции, её TargetID заполняется id заявки.
+func (s *Storage) SavePayoutRequest(ctx context.Context, request models.PayoutRequest, comment string, auditEvent models.AuditEvent) (int64, error) {
+	const op = "storage.payout.SavePayoutRequest"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := lockLedgerBalance(ctx, tx, request.UserID); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	reserved, err := payoutReserved(ctx, tx, request.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	enough, err := ledgerBalanceCovers(ctx, tx, request.UserID, -(reserved + request.Amount))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if !enough {
+		return 0, ErrInsufficientBalance
+	}
+
+	query := `
+		INSERT INTO payout_requests (user_id, amount, method, details, details_mask, status)
+		VALUES ($1, ROUND($2::NUMERIC, 2), $3, $4, $5, $6)
+		RETURNING id`
+	var id int64
+	err = tx.QueryRowContext(ctx, query,
+		request.UserID, request.Amount, request.Method, request.Details, request.DetailsMask, models.PayoutStatusRequested,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	event := models.PayoutRequestEvent{
+		RequestID: id,
+		Status:    models.PayoutStatusRequested,
+		Comment:   comment,
+		AuthorID:  &request.UserID,
+	}
+	if err := insertPayoutEvent(ctx, tx, event); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	auditEvent.TargetID = strconv.FormatInt(id, 10)
+	if err := insertAuditEvent(ctx, tx, auditEvent); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// payoutReserved сумма открытых заявок партнёра на выплату
+func payoutReserved(ctx context.Context, tx *sql.Tx, userID int64) (money.Money, error) {
+	query := `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM payout_requests
+		WHERE user_id = $1 AND status = ANY($2)`
+	var reserved money.Money
+	if err := tx.QueryRowContext(ctx, query, userID, pq.Array(openPayoutStatuses)).Scan(&reserved); err != nil {
+		return 0, err
+	}
+
+	return reserved, nil
+}
+
+func (s *Storage) PayoutRequest(ctx context.Context, id int64) (models.PayoutRequest, error) {
+	const op = "storage.payout.PayoutRequest"
+
+	query := `
+		SELECT id, user_id, amount, method, details, details_mask, status, reviewed_by, reviewed_at, paid_at, created_at, updated_at
+		FROM payout_requests
+		WHERE id = $1`
+	request, err := scanPayoutRequest(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PayoutRequest{}, ErrPayoutRequestNotFound
+		}
+		return models.PayoutRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return request, nil
+}
+
+// PayoutRequests возвращает заявки по фильтру, новые первыми, и их общее число
+func (s *Storage) PayoutRequests(ctx context.Context, filter models.PayoutFilter) ([]models.PayoutRequest, int64, error) {
+	const op = "storage.payout.PayoutRequests"
+
+	var conditions []string
+	var args []interface{}
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		conditions = append(conditions, "user_id = $"+strconv.Itoa(len(args)))
+	}
+	if filter.Status != nil {
+		args = append(args, *filter.Status)
+		conditions = append(conditions, "status = $"+strconv.Itoa(len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM payout_requests"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := `
+		SELECT id, user_id, amount, method, details, details_mask, status, reviewed_by, reviewed_at, paid_at, created_at, updated_at
+		FROM payout_requests` + where + fmt.Sprintf(`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var requests []models.PayoutRequest
+	for rows.Next() {
+		request, err := scanPayoutRequest(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		requests = append(requests, request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return requests, total, nil
+}
+
+func (s *Storage) PayoutRequestHistory(ctx context.Context, id int64) ([]models.PayoutRequestEvent, error) {
+	const op = "storage.payout.PayoutRequestHistory"
+
+	query := `
+		SELECT id, request_id, status, comment, author_id, created_at
+		FROM payout_request_history
+		WHERE request_id = $1
+		ORDER BY created_at, id`
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.PayoutRequestEvent
+	for rows.Next() {
+		var event models.PayoutRequestEvent
+		if err := rows.Scan(&event.ID, &event.RequestID, &event.Status, &event.Comment, &event.AuthorID, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+// UpdatePayoutStatus переводит заявку в event.Status, если сейчас она в одном из статусов from.
+// Иначе возвращает ErrPayoutStatusConflict: заявку уже рассмотрели или отменили. Запись в журнале сохраняется в той же транзакции.
+func (s *Storage) UpdatePayoutStatus(ctx context.Context, id int64, from []string, event models.PayoutRequestEvent, auditEvent models.AuditEvent) error {
+	const op = "storage.payout.UpdatePayoutStatus"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := updatePayoutStatus(ctx, tx, id, from, event); err != nil {
+		if errors.Is(err, ErrPayoutStatusConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := insertAuditEvent(ctx, tx, auditEvent); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PayPayoutRequest отмечает одобренную заявку выплаченной и в той же транзакции проводит выплату по книге.
+// Если баланс к этому моменту уменьшился, например после корректировки, возвращает ErrInsufficientBalance.
+// Запись в журнале сохраняется в той же транзакции.
+func (s *Storage) PayPayoutRequest(ctx context.Context, id int64, event models.PayoutRequestEvent, txn models.LedgerTransaction, auditEvent models.AuditEvent) error {
+	const op = "storage.payout.PayPayoutRequest"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := lockLedgerBalance(ctx, tx, txn.UserID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var amount money.Money
+	err = tx.QueryRowContext(ctx, "SELECT amount FROM payout_requests WHERE id = $1 AND user_id = $2", id, txn.UserID).Scan(&amount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPayoutRequestNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := updatePayoutStatus(ctx, tx, id, []string{models.PayoutStatusApproved}, event); err != nil {
+		if errors.Is(err, ErrPayoutStatusConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	enough, err := ledgerBalanceCovers(ctx, tx, txn.UserID, -amount)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !enough {
+		return ErrInsufficientBalance
+	}
+
+	if err := insertLedgerTransaction(ctx, tx, txn, -amount, models.LedgerAccountCash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := insertAuditEvent(ctx, tx, auditEvent); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func updatePayoutStatus(ctx context.Context, tx *sql.Tx, id int64, from []string, event models.PayoutRequestEvent) error {
+	// Рассмотрением считаются все переходы менеджера, отмена партнёром его не меняет
+	query := `
+		UPDATE payout_requests
+		SET status = $1,
+			updated_at = NOW(),
+			reviewed_by = CASE WHEN $1 IN ($4, $5) THEN $3 ELSE reviewed_by END,
+			reviewed_at = CASE WHEN $1 IN ($4, $5) THEN NOW() ELSE reviewed_at END,
+			paid_at = CASE WHEN $1 = $6 THEN NOW() ELSE paid_at END
+		WHERE id = $2 AND status = ANY($7)`
+	result, err := tx.ExecContext(ctx, query,
+		event.Status, id, event.AuthorID,
+		models.PayoutStatusApproved, models.PayoutStatusRejected, models.PayoutStatusPaid,
+		pq.Array(from),
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrPayoutStatusConflict
+	}
+
+	event.RequestID = id
+	return insertPayoutEvent(ctx, tx, event)
+}
+
+func insertPayoutEvent(ctx context.Context, tx *sql.Tx, event models.PayoutRequestEvent) error {
+	query := `
+		INSERT INTO payout_request_history (request_id, status, comment, author_id)
+		VALUES ($1, $2, $3, $4)`
+	_, err := tx.ExecContext(ctx, query, event.RequestID, event.Status, event.Comment, event.AuthorID)
+	return err
+}
+
+func scanPayoutRequest(row rowScanner) (models.PayoutRequest, error) {
+	var request models.PayoutRequest
+	err := row.Scan(
+		&request.ID,
+		&request.UserID,
+		&request.Amount,
+		&request.Method,
+		&request.Details,
+		&request.DetailsMask,
+		&request.Status,
+		&request.ReviewedBy,
+		&request.ReviewedAt,
+		&request.PaidAt,
+		&request.CreatedAt,
+		&request.UpdatedAt,
+	)
+	return request, err
+}
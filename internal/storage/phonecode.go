@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/models"
+)
+
+type PhoneCodeRepositoryI interface {
+	SavePhoneCode(ctx context.Context, phoneCode models.PhoneCode) error
+	AttemptPhoneCode(ctx context.Context, userID int64) (models.PhoneCode, error)
+	DeletePhoneCode(ctx context.Context, id int) error
+}
+
+var (
+	ErrPhoneCodeIsNotFound = errors.New("phone code is not found")
+)
+
+// SavePhoneCode сохраняет код для нового номера. Предыдущий запрос смены номера и счётчик попыток заменяются.
+func (s *Storage) SavePhoneCode(ctx context.Context, phoneCode models.PhoneCode) error {
+	const op = "storage.phonecode.SavePhoneCode"
+
+	query := `
+		INSERT INTO phone_codes (user_id, phone_number, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET phone_number = EXCLUDED.phone_number, code_hash = EXCLUDED.code_hash, attempts = 0,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at`
+	_, err := s.db.ExecContext(ctx, query, phoneCode.UserID, phoneCode.PhoneNumber, phoneCode.CodeHash, phoneCode.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AttemptPhoneCode учитывает попытку ввода кода и возвращает код с уже увеличенным счётчиком
+func (s *Storage) AttemptPhoneCode(ctx context.Context, userID int64) (models.PhoneCode, error) {
+	const op = "storage.phonecode.AttemptPhoneCode"
+
+	var phoneCode models.PhoneCode
+	query := `
+		UPDATE phone_codes SET attempts = attempts + 1
+		WHERE user_id = $1
+		RETURNING id, user_id, phone_number, code_hash, attempts, expires_at`
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&phoneCode.ID,
+		&phoneCode.UserID,
+		&phoneCode.PhoneNumber,
+		&phoneCode.CodeHash,
+		&phoneCode.Attempts,
+		&phoneCode.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PhoneCode{}, ErrPhoneCodeIsNotFound
+		}
+		return models.PhoneCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return phoneCode, nil
+}
+
+// DeletePhoneCode удаляет код. Если кода уже нет, значит его использовали параллельным запросом.
+func (s *Storage) DeletePhoneCode(ctx context.Context, id int) error {
+	const op = "storage.phonecode.DeletePhoneCode"
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM phone_codes WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrPhoneCodeIsNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RateLimitRepositoryI счётчики попыток в фиксированном окне. Реализуется хранилищем в памяти и Postgres.
+type RateLimitRepositoryI interface {
+	HitRateLimit(ctx context.Context, key string, window time.Duration) (count int64, resetAt time.Time, err error)
+	ResetRateLimit(ctx context.Context, key string) error
+	DeleteExpiredRateLimits(ctx context.Context) error
+}
+
+// HitRateLimit увеличивает счётчик ключа. Если окно истекло, счётчик начинается заново.
+func (s *Storage) HitRateLimit(ctx context.Context, key string, window time.Duration) (int64, time.Time, error) {
+	const op = "storage.ratelimit.HitRateLimit"
+
+	query := `
+		INSERT INTO rate_limits (key, count, reset_at)
+		VALUES ($1, 1, NOW() + make_interval(secs => $2))
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limits.reset_at <= NOW() THEN 1 ELSE rate_limits.count + 1 END,
+			reset_at = CASE WHEN rate_limits.reset_at <= NOW() THEN EXCLUDED.reset_at ELSE rate_limits.reset_at END
+		RETURNING count, reset_at
+	`
+	var count int64
+	var resetAt time.Time
+	if err := s.db.QueryRowContext(ctx, query, key, window.Seconds()).Scan(&count, &resetAt); err != nil {
+		return 0, time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count, resetAt, nil
+}
+
+func (s *Storage) ResetRateLimit(ctx context.Context, key string) error {
+	const op = "storage.ratelimit.ResetRateLimit"
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE key = $1", key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteExpiredRateLimits(ctx context.Context) error {
+	const op = "storage.ratelimit.DeleteExpiredRateLimits"
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE reset_at <= NOW()"); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"ia-online-golang/internal/lib/money"
 	"ia-online-golang/internal/models"
+	"time"
 )
 
 type ReferralRepositoryI interface {
@@ -15,6 +17,14 @@ type ReferralRepositoryI interface {
 	Referrals(ctx context.Context) ([]models.Referral, error)
 	GetInactiveReferralsWithReadyLeads(ctx context.Context) ([]models.Referral, error)
 	UpdateActive(ctx context.Context, referral_id int64, active bool) error
+	UpdateReferralCost(ctx context.Context, referralID int64, cost money.Money) error
+	ReferralUpline(ctx context.Context, userID int64, depth int) ([]models.ReferralAncestor, error)
+	ReferralDownline(ctx context.Context, userID int64, depth int) ([]models.ReferralNode, error)
+	LeadReferralCommissions(ctx context.Context, leadID int64) ([]models.ReferralCommission, error)
+	ReferralCommissions(ctx context.Context) ([]models.ReferralCommission, error)
+	ReferralEarningsBySource(ctx context.Context, userID int64) (map[int64]money.Money, error)
+	ReferralEarnings(ctx context.Context, userID int64, startDate, endDate *time.Time) (money.Money, error)
+	SaveReferralCommission(ctx context.Context, commission models.ReferralCommission, limit money.Money) (models.ReferralCommission, error)
 	ActiveReferralsByReferralId(ctx context.Context, referral_id string) ([]models.Referral, error)
 }
 
@@ -173,13 +183,13 @@ func (s *Storage) GetInactiveReferralsWithReadyLeads(ctx context.Context) ([]mod
 		JOIN users u ON u.id = r.user_id
 		JOIN leads l ON l.user_id = u.id
 		WHERE r.active = false
-		  AND l.status_id = 4
+		  AND l.status_id = $1
 		GROUP BY r.id
 		HAVING COUNT(l.id) > 2;
 
 	`
 
-	rows, err := s.db.QueryContext(ctx, query)
+	rows, err := s.db.QueryContext(ctx, query, models.LeadStatusReady)
 	if err != nil {
 		return nil, err
 	}
@@ -227,3 +237,267 @@ func (s *Storage) UpdateActive(ctx context.Context, referral_id int64, active bo
 
 	return nil
 }
+
+// UpdateReferralCost меняет бонус за реферала, рассчитанный по правилам вознаграждения
+func (s *Storage) UpdateReferralCost(ctx context.Context, referralID int64, cost money.Money) error {
+	const op = "storage.referral.UpdateReferralCost"
+
+	query := "UPDATE referrals SET cost = $2 WHERE id = $1"
+	result, err := s.db.ExecContext(ctx, query, referralID, cost)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrReferralNotFound
+	}
+
+	return nil
+}
+
+// ReferralUpline цепочка пригласивших пользователя, начиная с пригласившего напрямую, не длиннее depth.
+// Связь строится по коду, с которым пользователь зарегистрировался, и users.referral_code владельца.
+func (s *Storage) ReferralUpline(ctx context.Context, userID int64, depth int) ([]models.ReferralAncestor, error) {
+	const op = "storage.referral.ReferralUpline"
+
+	query := `
+		WITH RECURSIVE upline AS (
+			SELECT u.id AS user_id, r.created_at, 1 AS level
+			FROM referrals r
+			JOIN users u ON u.referral_code = r.referral_id
+			WHERE r.user_id = $1
+			UNION ALL
+			SELECT u.id, r.created_at, up.level + 1
+			FROM upline up
+			JOIN referrals r ON r.user_id = up.user_id
+			JOIN users u ON u.referral_code = r.referral_id
+			WHERE up.level < $2
+		)
+		SELECT user_id, level, created_at FROM upline ORDER BY level`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, depth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var upline []models.ReferralAncestor
+	for rows.Next() {
+		var ancestor models.ReferralAncestor
+		if err := rows.Scan(&ancestor.UserID, &ancestor.Level, &ancestor.JoinedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		upline = append(upline, ancestor)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return upline, nil
+}
+
+// ReferralDownline все приглашённые пользователем напрямую и через других не глубже depth уровней
+func (s *Storage) ReferralDownline(ctx context.Context, userID int64, depth int) ([]models.ReferralNode, error) {
+	const op = "storage.referral.ReferralDownline"
+
+	query := `
+		WITH RECURSIVE downline AS (
+			SELECT u.id AS user_id, p.id AS parent_id, 1 AS level, u.name, u.city, r.active, r.created_at
+			FROM users p
+			JOIN referrals r ON r.referral_id = p.referral_code
+			JOIN users u ON u.id = r.user_id
+			WHERE p.id = $1
+			UNION ALL
+			SELECT u.id, d.user_id, d.level + 1, u.name, u.city, r.active, r.created_at
+			FROM downline d
+			JOIN users p ON p.id = d.user_id
+			JOIN referrals r ON r.referral_id = p.referral_code
+			JOIN users u ON u.id = r.user_id
+			WHERE d.level < $2
+		)
+		SELECT user_id, parent_id, level, name, city, COALESCE(active, FALSE), created_at
+		FROM downline
+		ORDER BY level, created_at`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, depth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var nodes []models.ReferralNode
+	for rows.Next() {
+		var node models.ReferralNode
+		if err := rows.Scan(&node.UserID, &node.ParentID, &node.Level, &node.Name, &node.City, &node.Active, &node.JoinedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nodes, nil
+}
+
+const referralCommissionColumns = "id, lead_id, user_id, source_user_id, level, percent, amount, created_at, updated_at"
+
+func (s *Storage) LeadReferralCommissions(ctx context.Context, leadID int64) ([]models.ReferralCommission, error) {
+	const op = "storage.referral.LeadReferralCommissions"
+
+	query := "SELECT " + referralCommissionColumns + " FROM referral_commissions WHERE lead_id = $1 ORDER BY level"
+
+	commissions, err := s.queryReferralCommissions(ctx, query, leadID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return commissions, nil
+}
+
+func (s *Storage) ReferralCommissions(ctx context.Context) ([]models.ReferralCommission, error) {
+	const op = "storage.referral.ReferralCommissions"
+
+	query := "SELECT " + referralCommissionColumns + " FROM referral_commissions ORDER BY id"
+
+	commissions, err := s.queryReferralCommissions(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return commissions, nil
+}
+
+func (s *Storage) queryReferralCommissions(ctx context.Context, query string, args ...any) ([]models.ReferralCommission, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commissions []models.ReferralCommission
+	for rows.Next() {
+		var c models.ReferralCommission
+		err := rows.Scan(&c.ID, &c.LeadID, &c.UserID, &c.SourceUserID, &c.Level, &c.Percent, &c.Amount, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		commissions = append(commissions, c)
+	}
+
+	return commissions, rows.Err()
+}
+
+// ReferralEarningsBySource сумма процентов партнёра с заявок каждого из его приглашённых
+func (s *Storage) ReferralEarningsBySource(ctx context.Context, userID int64) (map[int64]money.Money, error) {
+	const op = "storage.referral.ReferralEarningsBySource"
+
+	query := `
+		SELECT source_user_id, SUM(amount)
+		FROM referral_commissions
+		WHERE user_id = $1
+		GROUP BY source_user_id`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	earnings := make(map[int64]money.Money)
+	for rows.Next() {
+		var sourceUserID int64
+		var amount money.Money
+		if err := rows.Scan(&sourceUserID, &amount); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		earnings[sourceUserID] = amount
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return earnings, nil
+}
+
+// ReferralEarnings сумма процентов партнёра с заявок приглашённых, созданных в периоде. Границы периода необязательны.
+func (s *Storage) ReferralEarnings(ctx context.Context, userID int64, startDate, endDate *time.Time) (money.Money, error) {
+	const op = "storage.referral.ReferralEarnings"
+
+	query := `
+		SELECT COALESCE(SUM(c.amount), 0)
+		FROM referral_commissions c
+		JOIN leads l ON l.id = c.lead_id
+		WHERE c.user_id = $1
+		  AND ($2::TIMESTAMPTZ IS NULL OR l.created_at >= $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR l.created_at <= $3)`
+	var earned money.Money
+	if err := s.db.QueryRowContext(ctx, query, userID, startDate, endDate).Scan(&earned); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return earned, nil
+}
+
+// SaveReferralCommission сохраняет процент с заявки. Если limit больше нуля, сумма урезается так, чтобы
+// все проценты партнёра с того же приглашённого на том же уровне не превысили limit.
+// Возвращает сохранённую запись с итоговой суммой.
+func (s *Storage) SaveReferralCommission(ctx context.Context, commission models.ReferralCommission, limit money.Money) (models.ReferralCommission, error) {
+	const op = "storage.referral.SaveReferralCommission"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ReferralCommission{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Заявки одного приглашённого могут пересчитываться одновременно и вместе превысить предел
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('referral_commission'), $1)", commission.UserID); err != nil {
+		return models.ReferralCommission{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if limit > 0 {
+		query := `
+			SELECT COALESCE(SUM(amount), 0)
+			FROM referral_commissions
+			WHERE user_id = $1 AND source_user_id = $2 AND level = $3 AND lead_id <> $4`
+		var earned money.Money
+		err := tx.QueryRowContext(ctx, query, commission.UserID, commission.SourceUserID, commission.Level, commission.LeadID).Scan(&earned)
+		if err != nil {
+			return models.ReferralCommission{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		commission.Amount = min(commission.Amount, max(limit-earned, 0))
+	}
+
+	query := `
+		INSERT INTO referral_commissions (lead_id, user_id, source_user_id, level, percent, amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (lead_id, user_id) DO UPDATE
+		SET source_user_id = EXCLUDED.source_user_id, level = EXCLUDED.level, percent = EXCLUDED.percent,
+		    amount = EXCLUDED.amount, updated_at = NOW()
+		RETURNING ` + referralCommissionColumns
+	var saved models.ReferralCommission
+	err = tx.QueryRowContext(ctx, query,
+		commission.LeadID, commission.UserID, commission.SourceUserID, commission.Level, commission.Percent, commission.Amount,
+	).Scan(
+		&saved.ID, &saved.LeadID, &saved.UserID, &saved.SourceUserID, &saved.Level, &saved.Percent, &saved.Amount,
+		&saved.CreatedAt, &saved.UpdatedAt,
+	)
+	if err != nil {
+		return models.ReferralCommission{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ReferralCommission{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return saved, nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/models"
+)
+
+type RewardRuleRepositoryI interface {
+	RewardRules(ctx context.Context) ([]models.RewardRule, error)
+	RewardRule(ctx context.Context, id int64) (models.RewardRule, error)
+	SaveRewardRule(ctx context.Context, rule models.RewardRule) (models.RewardRule, error)
+	UpdateRewardRule(ctx context.Context, rule models.RewardRule) (models.RewardRule, error)
+	DeleteRewardRule(ctx context.Context, id int64) error
+}
+
+var ErrRewardRuleNotFound = errors.New("reward rule not found")
+
+const rewardRuleColumns = "id, service, city, tier, amount, valid_from, valid_to, created_by, created_at, updated_at"
+
+// RewardRules все правила вознаграждения. Правил немного, подходящее выбирается в сервисе.
+func (s *Storage) RewardRules(ctx context.Context) ([]models.RewardRule, error) {
+	const op = "storage.reward.RewardRules"
+
+	query := "SELECT " + rewardRuleColumns + " FROM reward_rules ORDER BY service, valid_from, id"
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	rules := make([]models.RewardRule, 0)
+	for rows.Next() {
+		rule, err := scanRewardRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rules, nil
+}
+
+func (s *Storage) RewardRule(ctx context.Context, id int64) (models.RewardRule, error) {
+	const op = "storage.reward.RewardRule"
+
+	query := "SELECT " + rewardRuleColumns + " FROM reward_rules WHERE id = $1"
+
+	rule, err := scanRewardRule(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RewardRule{}, ErrRewardRuleNotFound
+		}
+		return models.RewardRule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rule, nil
+}
+
+func (s *Storage) SaveRewardRule(ctx context.Context, rule models.RewardRule) (models.RewardRule, error) {
+	const op = "storage.reward.SaveRewardRule"
+
+	query := `
+		INSERT INTO reward_rules (service, city, tier, amount, valid_from, valid_to, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + rewardRuleColumns
+
+	saved, err := scanRewardRule(s.db.QueryRowContext(ctx, query,
+		rule.Service, rule.City, rule.Tier, rule.Amount, rule.ValidFrom, rule.ValidTo, rule.CreatedBy,
+	))
+	if err != nil {
+		return models.RewardRule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return saved, nil
+}
+
+func (s *Storage) UpdateRewardRule(ctx context.Context, rule models.RewardRule) (models.RewardRule, error) {
+	const op = "storage.reward.UpdateRewardRule"
+
+	query := `
+		UPDATE reward_rules
+		SET service = $2, city = $3, tier = $4, amount = $5, valid_from = $6, valid_to = $7, updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + rewardRuleColumns
+
+	updated, err := scanRewardRule(s.db.QueryRowContext(ctx, query,
+		rule.ID, rule.Service, rule.City, rule.Tier, rule.Amount, rule.ValidFrom, rule.ValidTo,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RewardRule{}, ErrRewardRuleNotFound
+		}
+		return models.RewardRule{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updated, nil
+}
+
+func (s *Storage) DeleteRewardRule(ctx context.Context, id int64) error {
+	const op = "storage.reward.DeleteRewardRule"
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM reward_rules WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrRewardRuleNotFound
+	}
+
+	return nil
+}
+
+func scanRewardRule(row rowScanner) (models.RewardRule, error) {
+	var rule models.RewardRule
+	err := row.Scan(
+		&rule.ID,
+		&rule.Service,
+		&rule.City,
+		&rule.Tier,
+		&rule.Amount,
+		&rule.ValidFrom,
+		&rule.ValidTo,
+		&rule.CreatedBy,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	return rule, err
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"ia-online-golang/internal/models"
+	"time"
+)
+
+type SchedulerJobRepositoryI interface {
+	SchedulerJobs(ctx context.Context) ([]models.SchedulerJob, error)
+	StartSchedulerJob(ctx context.Context, name, spec string, startedAt time.Time) error
+	FinishSchedulerJob(ctx context.Context, name string, finishedAt time.Time, duration time.Duration, lastError *string) error
+	TryLockSchedulerJob(ctx context.Context, name string) (unlock func(), locked bool, err error)
+}
+
+func (s *Storage) SchedulerJobs(ctx context.Context) ([]models.SchedulerJob, error) {
+	const op = "storage.schedulerjob.SchedulerJobs"
+
+	query := "SELECT name, spec, last_started_at, last_finished_at, last_duration_ms, last_error FROM scheduler_jobs ORDER BY name"
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var jobs []models.SchedulerJob
+	for rows.Next() {
+		var job models.SchedulerJob
+		var durationMs sql.NullInt64
+		if err := rows.Scan(&job.Name, &job.Spec, &job.LastStartedAt, &job.LastFinishedAt, &durationMs, &job.LastError); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if durationMs.Valid {
+			duration := time.Duration(durationMs.Int64) * time.Millisecond
+			job.LastDuration = &duration
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return jobs, nil
+}
+
+// StartSchedulerJob отмечает начало запуска задачи, создавая запись при первом запуске
+func (s *Storage) StartSchedulerJob(ctx context.Context, name, spec string, startedAt time.Time) error {
+	const op = "storage.schedulerjob.StartSchedulerJob"
+
+	query := `
+		INSERT INTO scheduler_jobs (name, spec, last_started_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET spec = EXCLUDED.spec, last_started_at = EXCLUDED.last_started_at
+	`
+	if _, err := s.db.ExecContext(ctx, query, name, spec, startedAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) FinishSchedulerJob(ctx context.Context, name string, finishedAt time.Time, duration time.Duration, lastError *string) error {
+	const op = "storage.schedulerjob.FinishSchedulerJob"
+
+	query := "UPDATE scheduler_jobs SET last_finished_at = $1, last_duration_ms = $2, last_error = $3 WHERE name = $4"
+	if _, err := s.db.ExecContext(ctx, query, finishedAt, duration.Milliseconds(), lastError, name); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TryLockSchedulerJob берёт advisory-блокировку задачи, чтобы её не выполняли одновременно несколько экземпляров сервиса.
+// Блокировка держится на отдельном соединении до вызова unlock. Если соединение оборвётся, PostgreSQL снимет её сам.
+// Если задачу уже выполняет другой экземпляр, возвращает locked = false.
+func (s *Storage) TryLockSchedulerJob(ctx context.Context, name string) (func(), bool, error) {
+	const op = "storage.schedulerjob.TryLockSchedulerJob"
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var locked bool
+	query := "SELECT pg_try_advisory_lock(hashtext('scheduler_job'), hashtext($1))"
+	if err := conn.QueryRowContext(ctx, query, name).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		// Если снять блокировку не удалось, соединение не возвращается в пул, чтобы она не осталась висеть
+		query := "SELECT pg_advisory_unlock(hashtext('scheduler_job'), hashtext($1))"
+		if _, err := conn.ExecContext(context.Background(), query, name); err != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	return unlock, true, nil
+}
@@ -1,16 +1,33 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
 	_ "github.com/lib/pq"
 )
 
+type HealthRepositoryI interface {
+	Ping(ctx context.Context) error
+}
+
 type Storage struct {
 	db *sql.DB
 }
 
+// querier общий интерфейс для *sql.DB и *sql.Tx, чтобы одни и те же запросы работали в транзакции и без неё
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rowScanner общий интерфейс для *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
 func NewStorage(dsn string) (*Storage, error) {
 	const op = "storage.NewStorage"
 
@@ -27,6 +44,16 @@ func NewStorage(dsn string) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
+// Ping проверяет соединение с БД
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Stats статистика пула соединений
+func (s *Storage) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
 func (s *Storage) Close() error {
 	return s.db.Close()
 }
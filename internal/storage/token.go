@@ -6,91 +6,129 @@ import (
 	"errors"
 	"fmt"
 	"ia-online-golang/internal/models"
+	"time"
 )
 
 type TokenRepositoryI interface {
-	RefreshTokenByUserId(ctx context.Context, userID int64) (models.Token, error)
-	RefreshTokenByToken(ctx context.Context, refresh_token string) (models.Token, error)
-	SaveRefreshToken(ctx context.Context, userID int64, token string) error
-	DeleteRefreshToken(ctx context.Context, refreshToken string) error
-	UpdateRefreshToken(ctx context.Context, userID int64, token string) error
+	SaveSession(ctx context.Context, session models.Session) error
+	SessionByID(ctx context.Context, id string) (models.Session, error)
+	UserSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RotateSession(ctx context.Context, id, oldHash, newHash, ip, userAgent string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSession(ctx context.Context, userID int64, id string) error
+	RevokeUserSessions(ctx context.Context, userID int64) error
+	SessionActive(ctx context.Context, id string, userID int64) (bool, error)
 }
 
 var (
 	ErrTokenNotFound = errors.New("token not found")
 )
 
-func (s *Storage) RefreshTokenByToken(ctx context.Context, refresh_token string) (models.Token, error) {
-	const op = "storage.auth.GetRefreshTokenByToken"
-	var token models.Token
+const sessionColumns = "id, user_id, token_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at"
+
+func scanSession(row interface{ Scan(dest ...any) error }) (models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.TokenHash,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+
+	return session, err
+}
 
-	// Запрос для получения refresh-токена по user_id
-	query := "SELECT id, user_id, refresh_token FROM tokens WHERE refresh_token = $1"
-	err := s.db.QueryRowContext(ctx, query, refresh_token).Scan(
-		&token.ID,
-		&token.UserID,
-		&token.RefreshToken,
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "storage.token.SaveSession"
+
+	query := `
+		INSERT INTO tokens (id, user_id, token_hash, user_agent, ip, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		session.ID,
+		session.UserID,
+		session.TokenHash,
+		session.UserAgent,
+		session.IP,
+		session.CreatedAt,
+		session.ExpiresAt,
 	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Token{}, ErrTokenNotFound
-		}
-		return models.Token{}, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return token, nil
+	return nil
 }
 
-func (s *Storage) RefreshTokenByUserId(ctx context.Context, userID int64) (models.Token, error) {
-	const op = "storage.auth.GetRefreshToken"
-	var token models.Token
+func (s *Storage) SessionByID(ctx context.Context, id string) (models.Session, error) {
+	const op = "storage.token.SessionByID"
 
-	// Запрос для получения refresh-токена по user_id
-	query := "SELECT id, user_id, refresh_token FROM tokens WHERE user_id = $1"
-	err := s.db.QueryRowContext(ctx, query, userID).Scan(
-		&token.ID,
-		&token.UserID,
-		&token.RefreshToken,
-	)
+	query := "SELECT " + sessionColumns + " FROM tokens WHERE id = $1"
+	session, err := scanSession(s.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.Token{}, ErrTokenNotFound
+			return models.Session{}, ErrTokenNotFound
 		}
-		return models.Token{}, fmt.Errorf("%s: %w", op, err)
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return token, nil
+	return session, nil
 }
 
-func (s *Storage) SaveRefreshToken(ctx context.Context, userID int64, token string) error {
-	const op = "storage.auth.SaveRefreshToken"
+// UserSessions возвращает действующие сессии пользователя, последние использованные первыми
+func (s *Storage) UserSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "storage.token.UserSessions"
 
-	// Запрос на сохранение нового refresh-токена
-	query := "INSERT INTO tokens (user_id, refresh_token) VALUES ($1, $2)"
-	_, err := s.db.ExecContext(ctx, query, userID, token)
+	query := "SELECT " + sessionColumns + ` FROM tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC`
+	rows, err := s.db.QueryContext(ctx, query, userID)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer rows.Close()
 
-	return nil
-}
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, session)
+	}
 
-func (s *Storage) DeleteRefreshToken(ctx context.Context, refreshToken string) error {
-	const op = "storage.auth.DeleteRefreshToken"
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-	// Запрос на удаление refresh-токена
-	query := "DELETE FROM tokens WHERE refresh_token = $1"
-	result, err := s.db.ExecContext(ctx, query, refreshToken)
+	return sessions, nil
+}
+
+// RotateSession заменяет хеш refresh-токена, только если в сессии всё ещё oldHash.
+// Если токен уже успели сменить параллельным запросом, возвращает ErrTokenNotFound.
+func (s *Storage) RotateSession(ctx context.Context, id, oldHash, newHash, ip, userAgent string, expiresAt time.Time) error {
+	const op = "storage.token.RotateSession"
+
+	query := `
+		UPDATE tokens
+		SET token_hash = $3, ip = $4, user_agent = $5, expires_at = $6, last_used_at = NOW()
+		WHERE id = $1 AND token_hash = $2 AND revoked_at IS NULL
+	`
+	result, err := s.db.ExecContext(ctx, query, id, oldHash, newHash, ip, userAgent, expiresAt)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Проверяем, сколько строк было удалено
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-
 	if rowsAffected == 0 {
 		return ErrTokenNotFound
 	}
@@ -98,17 +136,27 @@ func (s *Storage) DeleteRefreshToken(ctx context.Context, refreshToken string) e
 	return nil
 }
 
-func (s *Storage) UpdateRefreshToken(ctx context.Context, userID int64, token string) error {
-	const op = "storage.auth.UpdateRefreshToken"
+func (s *Storage) RevokeSession(ctx context.Context, id string) error {
+	const op = "storage.token.RevokeSession"
 
-	// Запрос на обновление refresh-токена
-	query := "UPDATE tokens SET refresh_token = $2 WHERE user_id = $1"
-	result, err := s.db.ExecContext(ctx, query, userID, token)
+	query := "UPDATE tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL"
+	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeUserSession отзывает сессию, только если она принадлежит пользователю
+func (s *Storage) RevokeUserSession(ctx context.Context, userID int64, id string) error {
+	const op = "storage.token.RevokeUserSession"
+
+	query := "UPDATE tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	result, err := s.db.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Проверка, был ли обновлен хотя бы один пользователь
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -119,3 +167,34 @@ func (s *Storage) UpdateRefreshToken(ctx context.Context, userID int64, token st
 
 	return nil
 }
+
+func (s *Storage) RevokeUserSessions(ctx context.Context, userID int64) error {
+	const op = "storage.token.RevokeUserSessions"
+
+	query := "UPDATE tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL"
+	if _, err := s.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SessionActive сессия не отозвана и её владелец не заблокирован
+func (s *Storage) SessionActive(ctx context.Context, id string, userID int64) (bool, error) {
+	const op = "storage.token.SessionActive"
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM tokens t
+			JOIN users u ON u.id = t.user_id
+			WHERE t.id = $1 AND t.user_id = $2 AND t.revoked_at IS NULL AND u.banned_at IS NULL
+		)
+	`
+
+	var active bool
+	if err := s.db.QueryRowContext(ctx, query, id, userID).Scan(&active); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return active, nil
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ia-online-golang/internal/models"
+)
+
+type TwoFactorRepositoryI interface {
+	TOTP(ctx context.Context, userID int64) (models.TOTP, error)
+	SaveTOTP(ctx context.Context, userID int64, secret string) error
+	EnableTOTP(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	UseTOTPStep(ctx context.Context, userID int64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+}
+
+var (
+	ErrTOTPNotFound         = errors.New("totp not found")
+	ErrTOTPStepAlreadyUsed  = errors.New("totp step already used")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+func (s *Storage) TOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	const op = "storage.twofactor.TOTP"
+
+	var totp models.TOTP
+	query := "SELECT user_id, secret, enabled_at, last_step FROM user_totp WHERE user_id = $1"
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &totp.EnabledAt, &totp.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, ErrTOTPNotFound
+		}
+		return models.TOTP{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return totp, nil
+}
+
+// SaveTOTP сохраняет новый секрет, ещё не подтверждённый кодом
+func (s *Storage) SaveTOTP(ctx context.Context, userID int64, secret string) error {
+	const op = "storage.twofactor.SaveTOTP"
+
+	query := `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled_at = NULL, last_step = 0, created_at = NOW()`
+	if _, err := s.db.ExecContext(ctx, query, userID, secret); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// EnableTOTP включает второй фактор и заменяет коды восстановления
+func (s *Storage) EnableTOTP(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string) error {
+	const op = "storage.twofactor.EnableTOTP"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE user_totp SET enabled_at = NOW(), last_step = $2 WHERE user_id = $1"
+	if _, err := tx.ExecContext(ctx, query, userID, step); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		query := "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)"
+		if _, err := tx.ExecContext(ctx, query, userID, hash); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DisableTOTP(ctx context.Context, userID int64) error {
+	const op = "storage.twofactor.DisableTOTP"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep запоминает принятый шаг. Шаг, не больше уже принятого, отклоняется: код перехвачен или введён повторно.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	const op = "storage.twofactor.UseTOTPStep"
+
+	query := "UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2"
+	result, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrTOTPStepAlreadyUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode гасит неиспользованный код восстановления
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	const op = "storage.twofactor.UseRecoveryCode"
+
+	query := "UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+	result, err := s.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
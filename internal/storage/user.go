@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"ia-online-golang/internal/models"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -23,13 +25,28 @@ type UserRepositoryI interface {
 	UpdateActiveUser(ctx context.Context, userID int64, isActive bool) error
 	UpdatePasswordUser(ctx context.Context, password_hash string, userID int64) error
 	UpdateUser(ctx context.Context, user models.User) error
-	DeleteUser(ctx context.Context, id int) error
+	UpdateUserEmail(ctx context.Context, userID int64, email string) error
+	UpdateUserPhone(ctx context.Context, userID int64, phoneNumber string) error
+	SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int64, error)
+	UpdateUserRoles(ctx context.Context, userID int64, roles []string, auditEvent models.AuditEvent) error
+	UpdateBannedUser(ctx context.Context, userID int64, bannedAt *time.Time) error
+	UpdateUserTier(ctx context.Context, userID int64, tier string) error
+	DeleteUser(ctx context.Context, id int64) error
 }
 
 var (
 	ErrUserExists       = errors.New("user already exists")
 	ErrUserNotFound     = errors.New("user not found")
 	ErrUserIsNotUpdated = errors.New("user is not updated")
+	ErrUserHasRelations = errors.New("user has leads, referrals or comments")
+)
+
+const userColumns = "id, email, name, phone_number, telegram, is_active, created_at, city, password_hash, referral_code, roles, banned_at, tier"
+
+// Коды ошибок PostgreSQL: на строку ссылаются другие таблицы и нарушена уникальность
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
 )
 
 // Получение пользователя по email
@@ -37,7 +54,7 @@ func (s *Storage) UserByEmail(ctx context.Context, email string) (models.User, e
 	const op = "storage.user.UserByEmail"
 	var user models.User
 
-	query := "SELECT id, email, name, phone_number, telegram, is_active, created_at, city, password_hash, referral_code, roles FROM users WHERE email = $1"
+	query := "SELECT " + userColumns + " FROM users WHERE email = $1"
 	err := s.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
@@ -50,6 +67,8 @@ func (s *Storage) UserByEmail(ctx context.Context, email string) (models.User, e
 		&user.PasswordHash,
 		&user.ReferralCode,
 		&user.Roles,
+		&user.BannedAt,
+		&user.Tier,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -65,7 +84,7 @@ func (s *Storage) Users(ctx context.Context) ([]models.User, error) {
 	const op = "storage.user.Users"
 	var users []models.User
 
-	query := "SELECT id, email, name, phone_number, telegram, is_active, created_at, city, password_hash, referral_code, roles FROM users"
+	query := "SELECT " + userColumns + " FROM users"
 	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -77,7 +96,7 @@ func (s *Storage) Users(ctx context.Context) ([]models.User, error) {
 		if err := rows.Scan(
 			&user.ID, &user.Email, &user.Name, &user.PhoneNumber, &user.Telegram,
 			&user.IsActive, &user.CreatedAt, &user.City, &user.PasswordHash,
-			&user.ReferralCode, &user.Roles,
+			&user.ReferralCode, &user.Roles, &user.BannedAt, &user.Tier,
 		); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
@@ -95,7 +114,7 @@ func (s *Storage) UserByReferralCode(ctx context.Context, referral_code string)
 	const op = "storage.user.UserByReferralCode"
 	var user models.User
 
-	query := "SELECT id, email, name, phone_number, telegram, is_active, created_at, city, password_hash, referral_code, roles FROM users WHERE referral_code = $1"
+	query := "SELECT " + userColumns + " FROM users WHERE referral_code = $1"
 	err := s.db.QueryRowContext(ctx, query, referral_code).Scan(
 		&user.ID,
 		&user.Email,
@@ -108,6 +127,8 @@ func (s *Storage) UserByReferralCode(ctx context.Context, referral_code string)
 		&user.PasswordHash,
 		&user.ReferralCode,
 		&user.Roles,
+		&user.BannedAt,
+		&user.Tier,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -123,7 +144,7 @@ func (s *Storage) UserById(ctx context.Context, id int64) (models.User, error) {
 	const op = "storage.user.UserById"
 	var user models.User
 
-	query := "SELECT id, email, name, phone_number, telegram, is_active, created_at, city, password_hash, referral_code, roles FROM users WHERE id = $1"
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1"
 	err := s.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
@@ -136,6 +157,8 @@ func (s *Storage) UserById(ctx context.Context, id int64) (models.User, error) {
 		&user.PasswordHash,
 		&user.ReferralCode,
 		&user.Roles,
+		&user.BannedAt,
+		&user.Tier,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -230,12 +253,12 @@ func (s *Storage) CreateUser(ctx context.Context, user models.User) (models.User
 
 	// Правильный SQL-запрос для PostgreSQL, который возвращает все поля пользователя
 	query := `INSERT INTO users (email, password_hash, phone_number, name, telegram, city, referral_code, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, roles, email, password_hash, phone_number, name, telegram, city, referral_code, is_active`
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, roles, email, password_hash, phone_number, name, telegram, city, referral_code, is_active, tier`
 
 	var newUser models.User
 	// Извлекаем все данные о пользователе
 	err := s.db.QueryRowContext(ctx, query, user.Email, user.PasswordHash, user.PhoneNumber, user.Name, user.Telegram, user.City, user.ReferralCode, user.IsActive).
-		Scan(&newUser.ID, &newUser.Roles, &newUser.Email, &newUser.PasswordHash, &newUser.PhoneNumber, &newUser.Name, &newUser.Telegram, &newUser.City, &newUser.ReferralCode, &newUser.IsActive)
+		Scan(&newUser.ID, &newUser.Roles, &newUser.Email, &newUser.PasswordHash, &newUser.PhoneNumber, &newUser.Name, &newUser.Telegram, &newUser.City, &newUser.ReferralCode, &newUser.IsActive, &newUser.Tier)
 	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -290,8 +313,9 @@ func (s *Storage) UpdateUser(ctx context.Context, user models.User) error {
 	if user.PhoneNumber != "" {
 		updateFields["phone_number"] = user.PhoneNumber
 	}
-	if len(user.Roles) > 0 {
-		updateFields["roles"] = pq.Array(user.Roles)
+	// Менять нечего, например профиль прислали без изменений
+	if len(updateFields) == 0 {
+		return nil
 	}
 
 	// Строим динамический запрос
@@ -354,14 +378,266 @@ func (s *Storage) UpdatePasswordUser(ctx context.Context, password_hash string,
 	return nil
 }
 
-func (s *Storage) DeleteUser(ctx context.Context, id int) error {
+// SearchUsers возвращает страницу пользователей по фильтру и общее число подходящих пользователей
+func (s *Storage) SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int64, error) {
+	const op = "storage.user.SearchUsers"
+
+	var conditions []string
+	var args []interface{}
+	argCount := 1
+
+	if filter.City != nil {
+		conditions = append(conditions, fmt.Sprintf("LOWER(city) = LOWER($%d)", argCount))
+		args = append(args, *filter.City)
+		argCount++
+	}
+
+	if filter.Role != nil {
+		conditions = append(conditions, fmt.Sprintf("$%d::user_role = ANY(roles)", argCount))
+		args = append(args, *filter.Role)
+		argCount++
+	}
+
+	if filter.IsActive != nil {
+		conditions = append(conditions, fmt.Sprintf("is_active = $%d", argCount))
+		args = append(args, *filter.IsActive)
+		argCount++
+	}
+
+	if filter.IsBanned != nil {
+		if *filter.IsBanned {
+			conditions = append(conditions, "banned_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "banned_at IS NULL")
+		}
+	}
+
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argCount))
+		args = append(args, *filter.CreatedFrom)
+		argCount++
+	}
+
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", argCount))
+		args = append(args, *filter.CreatedTo)
+		argCount++
+	}
+
+	if filter.Search != nil && *filter.Search != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			"(email ILIKE $%d OR name ILIKE $%d OR phone_number ILIKE $%d OR telegram ILIKE $%d)",
+			argCount, argCount, argCount, argCount,
+		))
+		args = append(args, "%"+*filter.Search+"%")
+		argCount++
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := "SELECT " + userColumns + " FROM users" + where +
+		fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", argCount, argCount+1)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(
+			&user.ID, &user.Email, &user.Name, &user.PhoneNumber, &user.Telegram,
+			&user.IsActive, &user.CreatedAt, &user.City, &user.PasswordHash,
+			&user.ReferralCode, &user.Roles, &user.BannedAt, &user.Tier,
+		); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, total, nil
+}
+
+// UpdateUserRoles меняет роли вместе с записью в журнале: смена ролей без записи не допускается
+func (s *Storage) UpdateUserRoles(ctx context.Context, userID int64, roles []string, auditEvent models.AuditEvent) error {
+	const op = "storage.user.UpdateUserRoles"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE users SET roles = $1::user_role[] WHERE id = $2"
+	result, err := tx.ExecContext(ctx, query, pq.Array(roles), userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := insertAuditEvent(ctx, tx, auditEvent); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdateUserEmail меняет почту. Если адрес занят другим пользователем, возвращается ErrUserExists.
+func (s *Storage) UpdateUserEmail(ctx context.Context, userID int64, email string) error {
+	const op = "storage.user.UpdateUserEmail"
+
+	if err := s.updateUserContact(ctx, "email", userID, email); err != nil {
+		if errors.Is(err, ErrUserExists) || errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdateUserPhone меняет номер телефона. Если номер занят другим пользователем, возвращается ErrUserExists.
+func (s *Storage) UpdateUserPhone(ctx context.Context, userID int64, phoneNumber string) error {
+	const op = "storage.user.UpdateUserPhone"
+
+	if err := s.updateUserContact(ctx, "phone_number", userID, phoneNumber); err != nil {
+		if errors.Is(err, ErrUserExists) || errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// updateUserContact column передаётся только из кода, поэтому подставляется в запрос напрямую
+func (s *Storage) updateUserContact(ctx context.Context, column string, userID int64, value string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET "+column+" = $1 WHERE id = $2", value, userID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrUserExists
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdateBannedUser блокирует пользователя или снимает блокировку, если bannedAt nil
+func (s *Storage) UpdateBannedUser(ctx context.Context, userID int64, bannedAt *time.Time) error {
+	const op = "storage.user.UpdateBannedUser"
+
+	query := "UPDATE users SET banned_at = $1 WHERE id = $2"
+	result, err := s.db.ExecContext(ctx, query, bannedAt, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdateUserTier меняет уровень партнёра, от которого зависят правила вознаграждения
+func (s *Storage) UpdateUserTier(ctx context.Context, userID int64, tier string) error {
+	const op = "storage.user.UpdateUserTier"
+
+	query := "UPDATE users SET tier = $1 WHERE id = $2"
+	result, err := s.db.ExecContext(ctx, query, tier, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// DeleteUser удаляет пользователя вместе с данными авторизации. Пользователя с заявками, рефералами
+// или комментариями удалить нельзя: возвращается ErrUserHasRelations, такого пользователя нужно блокировать.
+func (s *Storage) DeleteUser(ctx context.Context, id int64) error {
 	const op = "storage.user.DeleteUser"
 
-	query := "DELETE FROM users WHERE id = $1"
-	_, err := s.db.ExecContext(ctx, query, id)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
+
+	authTables := []string{"tokens", "activation_links", "password_codes", "recovery_codes", "user_totp", "api_keys", "phone_codes"}
+	for _, table := range authTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = $1", id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return ErrUserHasRelations
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
 	return nil
 }
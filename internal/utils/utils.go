@@ -38,10 +38,10 @@ func UserToDTO(user models.User) dto.UserDTO {
 	}
 }
 
+// DtoToUser роли не переносятся: они меняются только через AdminService.UpdateRoles
 func DtoToUser(user dto.UserDTO) models.User {
 	return models.User{
 		ID:           derefInt64(user.ID),
-		Roles:        user.Roles,
 		ReferralCode: user.ReferralCode,
 		Email:        user.Email,
 		Name:         user.Name,
@@ -76,6 +76,21 @@ func GeneratePasswordCode(length int) (string, error) {
 	return string(result), nil
 }
 
+// GenerateDigitCode код только из цифр, его удобно набирать с SMS
+func GenerateDigitCode(length int) (string, error) {
+	result := make([]byte, length)
+
+	for i := 0; i < length; i++ {
+		num, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		result[i] = byte('0' + num.Int64())
+	}
+
+	return string(result), nil
+}
+
 func Contains(slice []string, value string) bool {
 	for _, v := range slice {
 		if v == value {
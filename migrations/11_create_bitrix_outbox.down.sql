@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS bitrix_outbox;
+
+ALTER TABLE leads DROP COLUMN IF EXISTS sync_status;
+ALTER TABLE leads DROP COLUMN IF EXISTS bitrix_id;
@@ -0,0 +1,25 @@
+ALTER TABLE leads ADD COLUMN bitrix_id INTEGER UNIQUE;
+ALTER TABLE leads ADD COLUMN sync_status VARCHAR(20) NOT NULL DEFAULT 'synced';
+
+-- Раньше id заявки совпадал с id сделки в битриксе
+UPDATE leads SET bitrix_id = id;
+
+-- Заявки теперь получают свой id до отправки в битрикс
+SELECT setval('leads_id_seq', GREATEST((SELECT MAX(id) FROM leads), 1));
+
+CREATE TABLE bitrix_outbox (
+    id SERIAL PRIMARY KEY,
+    lead_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP WITH TIME ZONE,
+
+    FOREIGN KEY (lead_id) REFERENCES leads(id)
+);
+
+CREATE INDEX bitrix_outbox_pending_idx ON bitrix_outbox (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,8 @@
+CREATE TABLE scheduler_jobs (
+    name VARCHAR(100) PRIMARY KEY,
+    spec VARCHAR(100) NOT NULL,
+    last_started_at TIMESTAMP WITH TIME ZONE,
+    last_finished_at TIMESTAMP WITH TIME ZONE,
+    last_duration_ms BIGINT,
+    last_error TEXT
+);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS history_lead_id_idx;
+
+ALTER TABLE history
+    DROP COLUMN IF EXISTS user_id,
+    DROP COLUMN IF EXISTS source,
+    DROP COLUMN IF EXISTS new_value,
+    DROP COLUMN IF EXISTS old_value,
+    DROP COLUMN IF EXISTS field;
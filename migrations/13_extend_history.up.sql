@@ -0,0 +1,8 @@
+ALTER TABLE history
+    ADD COLUMN field VARCHAR(50),
+    ADD COLUMN old_value TEXT,
+    ADD COLUMN new_value TEXT,
+    ADD COLUMN source VARCHAR(20) NOT NULL DEFAULT 'manager',
+    ADD COLUMN user_id INTEGER REFERENCES users(id);
+
+CREATE INDEX history_lead_id_idx ON history (lead_id, created_at);
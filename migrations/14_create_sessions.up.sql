@@ -0,0 +1,16 @@
+-- Старые токены хранились открытым текстом и не содержат id сессии, поэтому пользователям придётся войти заново
+DROP TABLE IF EXISTS tokens;
+
+CREATE TABLE tokens (
+    id UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    token_hash VARCHAR(64) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX tokens_user_id_idx ON tokens (user_id) WHERE revoked_at IS NULL;
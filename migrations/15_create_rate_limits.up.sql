@@ -0,0 +1,7 @@
+CREATE TABLE rate_limits (
+    key VARCHAR(255) PRIMARY KEY,
+    count BIGINT NOT NULL,
+    reset_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX rate_limits_reset_at_idx ON rate_limits (reset_at);
@@ -0,0 +1,11 @@
+-- Коды хранились открытым текстом и не использовались, поэтому таблицу пересоздаём
+DROP TABLE IF EXISTS password_codes;
+
+CREATE TABLE password_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL UNIQUE REFERENCES users(id),
+    code_hash VARCHAR(255) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
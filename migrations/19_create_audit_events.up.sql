@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN banned_at TIMESTAMP WITH TIME ZONE;
+
+-- Журнал действий с аккаунтами. actor_id NULL, если действие выполнила система.
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL,
+    target_id VARCHAR(64) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id, created_at);
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, created_at);
@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+DROP TRIGGER IF EXISTS audit_events_no_update_delete ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+
+DROP INDEX IF EXISTS audit_events_request_id_idx;
+DROP INDEX IF EXISTS audit_events_action_idx;
+DROP INDEX IF EXISTS audit_events_created_at_idx;
+
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS request_id,
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS after,
+    DROP COLUMN IF EXISTS before,
+    ADD CONSTRAINT audit_events_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL NOT VALID;
@@ -0,0 +1,26 @@
+-- actor_id остаётся без внешнего ключа: ON DELETE SET NULL менял бы журнал при удалении пользователя
+ALTER TABLE audit_events
+    DROP CONSTRAINT IF EXISTS audit_events_actor_id_fkey,
+    ADD COLUMN before JSONB,
+    ADD COLUMN after JSONB,
+    ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+CREATE INDEX audit_events_action_idx ON audit_events (action, created_at);
+CREATE INDEX audit_events_request_id_idx ON audit_events (request_id) WHERE request_id <> '';
+
+-- Журнал только дополняется: изменить или удалить записи нельзя даже с доступом к БД от имени приложения
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
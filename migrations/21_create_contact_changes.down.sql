@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS phone_codes;
+
+DELETE FROM activation_links WHERE new_email IS NOT NULL;
+ALTER TABLE activation_links DROP COLUMN IF EXISTS new_email;
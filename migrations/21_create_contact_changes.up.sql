@@ -0,0 +1,12 @@
+-- Ссылка с new_email подтверждает смену почты, без него активирует аккаунт
+ALTER TABLE activation_links ADD COLUMN new_email VARCHAR(255);
+
+CREATE TABLE phone_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL UNIQUE REFERENCES users(id),
+    phone_number VARCHAR(20) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_transactions;
+
+DROP FUNCTION IF EXISTS ledger_append_only();
+DROP FUNCTION IF EXISTS ledger_check_balanced();
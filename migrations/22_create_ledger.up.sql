@@ -0,0 +1,58 @@
+-- Проводка: одна операция по счёту партнёра, например начисление за заявку или выплата
+CREATE TABLE ledger_transactions (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(32) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    reason TEXT NOT NULL,
+    -- Откуда операция: заявка, реферал, платёжное поручение или ручная корректировка
+    source_type VARCHAR(32) NOT NULL,
+    source_id VARCHAR(64) NOT NULL DEFAULT '',
+    -- NULL, если операцию провела система
+    created_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ledger_transactions_user_idx ON ledger_transactions (user_id, created_at);
+CREATE INDEX ledger_transactions_source_idx ON ledger_transactions (source_type, source_id);
+
+-- Записи двойной записи: дебет положительный, кредит отрицательный, сумма по проводке равна нулю
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES ledger_transactions(id),
+    account VARCHAR(32) NOT NULL,
+    user_id INTEGER REFERENCES users(id),
+    amount NUMERIC(12,2) NOT NULL
+);
+
+CREATE INDEX ledger_entries_transaction_idx ON ledger_entries (transaction_id);
+CREATE INDEX ledger_entries_account_idx ON ledger_entries (account, user_id);
+
+-- Проверяется при коммите, когда все записи проводки уже вставлены
+CREATE OR REPLACE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM ledger_entries WHERE transaction_id = NEW.transaction_id) <> 0 THEN
+        RAISE EXCEPTION 'ledger transaction % is not balanced', NEW.transaction_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+    AFTER INSERT ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_balanced();
+
+-- Ошибки исправляются новыми проводками, существующие не меняются
+CREATE OR REPLACE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_transactions_append_only
+    BEFORE UPDATE OR DELETE ON ledger_transactions
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS payout_request_history;
+DROP TABLE IF EXISTS payout_requests;
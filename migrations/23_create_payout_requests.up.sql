@@ -0,0 +1,30 @@
+CREATE TABLE payout_requests (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    amount NUMERIC(12,2) NOT NULL CHECK (amount > 0),
+    method VARCHAR(16) NOT NULL,
+    -- Реквизиты зашифрованы AES-GCM ключом из конфига, открыто хранится только маска
+    details BYTEA NOT NULL,
+    details_mask VARCHAR(128) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'requested',
+    reviewed_by INTEGER,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    paid_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX payout_requests_user_idx ON payout_requests (user_id, created_at);
+CREATE INDEX payout_requests_status_idx ON payout_requests (status, created_at);
+
+-- Смены статуса заявки с комментарием партнёра или менеджера
+CREATE TABLE payout_request_history (
+    id BIGSERIAL PRIMARY KEY,
+    request_id BIGINT NOT NULL REFERENCES payout_requests(id),
+    status VARCHAR(16) NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    author_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX payout_request_history_request_idx ON payout_request_history (request_id, created_at);
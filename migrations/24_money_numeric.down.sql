@@ -0,0 +1,7 @@
+ALTER TABLE leads
+    ALTER COLUMN reward_internet TYPE FLOAT USING reward_internet::FLOAT,
+    ALTER COLUMN reward_cleaning TYPE FLOAT USING reward_cleaning::FLOAT,
+    ALTER COLUMN reward_shipping TYPE FLOAT USING reward_shipping::FLOAT;
+
+ALTER TABLE referrals
+    ALTER COLUMN cost TYPE FLOAT USING cost::FLOAT;
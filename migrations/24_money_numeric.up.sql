@@ -0,0 +1,8 @@
+-- Суммы хранятся точно до копейки, FLOAT накапливал ошибку при суммировании
+ALTER TABLE leads
+    ALTER COLUMN reward_internet TYPE NUMERIC(12,2) USING ROUND(reward_internet::NUMERIC, 2),
+    ALTER COLUMN reward_cleaning TYPE NUMERIC(12,2) USING ROUND(reward_cleaning::NUMERIC, 2),
+    ALTER COLUMN reward_shipping TYPE NUMERIC(12,2) USING ROUND(reward_shipping::NUMERIC, 2);
+
+ALTER TABLE referrals
+    ALTER COLUMN cost TYPE NUMERIC(12,2) USING ROUND(cost::NUMERIC, 2);
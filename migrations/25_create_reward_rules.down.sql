@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS leads_reward_discrepancy_idx;
+
+ALTER TABLE leads
+    DROP COLUMN IF EXISTS expected_reward_internet,
+    DROP COLUMN IF EXISTS expected_reward_cleaning,
+    DROP COLUMN IF EXISTS expected_reward_shipping,
+    DROP COLUMN IF EXISTS reward_discrepancy;
+
+DROP TABLE IF EXISTS reward_rules;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tier;
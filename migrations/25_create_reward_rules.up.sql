@@ -0,0 +1,32 @@
+ALTER TABLE users ADD COLUMN tier VARCHAR(32) NOT NULL DEFAULT 'base';
+
+CREATE TABLE reward_rules (
+    id BIGSERIAL PRIMARY KEY,
+    -- internet, cleaning, shipping или referral
+    service VARCHAR(16) NOT NULL,
+    -- NULL подходит для любого города или уровня партнёра
+    city VARCHAR(255),
+    tier VARCHAR(32),
+    amount NUMERIC(12,2) NOT NULL CHECK (amount >= 0),
+    valid_from DATE NOT NULL,
+    -- Включительно, NULL действует бессрочно
+    valid_to DATE,
+    created_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (valid_to IS NULL OR valid_to >= valid_from)
+);
+
+CREATE INDEX reward_rules_service_idx ON reward_rules (service, valid_from);
+
+-- Бонус за реферала раньше задавался значением по умолчанию колонки referrals.cost
+INSERT INTO reward_rules (service, amount, valid_from) VALUES ('referral', 500, '2000-01-01');
+
+-- Ожидаемое вознаграждение по правилам на момент создания заявки. NULL, если услуга не выбрана или правила нет.
+ALTER TABLE leads
+    ADD COLUMN expected_reward_internet NUMERIC(12,2),
+    ADD COLUMN expected_reward_cleaning NUMERIC(12,2),
+    ADD COLUMN expected_reward_shipping NUMERIC(12,2),
+    ADD COLUMN reward_discrepancy BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX leads_reward_discrepancy_idx ON leads (created_at) WHERE reward_discrepancy;
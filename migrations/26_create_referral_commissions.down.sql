@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS referrals_referral_id_idx;
+DROP INDEX IF EXISTS referrals_user_id_idx;
+
+DROP TABLE IF EXISTS referral_commissions;
@@ -0,0 +1,20 @@
+-- Процент партнёру с вознаграждения за заявку партнёра, приглашённого им напрямую или через других на level уровней ниже
+CREATE TABLE referral_commissions (
+    id BIGSERIAL PRIMARY KEY,
+    lead_id INTEGER NOT NULL REFERENCES leads(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    -- Автор заявки
+    source_user_id INTEGER NOT NULL REFERENCES users(id),
+    level SMALLINT NOT NULL CHECK (level > 0),
+    percent NUMERIC(5,2) NOT NULL,
+    amount NUMERIC(12,2) NOT NULL CHECK (amount >= 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (lead_id, user_id)
+);
+
+CREATE INDEX referral_commissions_user_idx ON referral_commissions (user_id, source_user_id);
+
+-- Дерево рефералов обходится от кода приглашения к владельцу и обратно
+CREATE INDEX referrals_user_id_idx ON referrals (user_id);
+CREATE INDEX referrals_referral_id_idx ON referrals (referral_id);
@@ -0,0 +1,2 @@
+-- id объекта, созданного в битриксе. Если он записан, вызов уже выполнен и повторяется только сохранение результата.
+ALTER TABLE bitrix_outbox ADD COLUMN bitrix_id INTEGER;
@@ -0,0 +1 @@
+ALTER TABLE history ALTER COLUMN source SET DEFAULT 'manager';
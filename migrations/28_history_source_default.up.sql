@@ -0,0 +1,2 @@
+-- Источник всегда передаётся явно, значение по умолчанию выдавало бы записи за правки менеджера
+ALTER TABLE history ALTER COLUMN source DROP DEFAULT;
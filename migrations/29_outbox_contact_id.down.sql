@@ -0,0 +1 @@
+ALTER TABLE bitrix_outbox DROP COLUMN IF EXISTS contact_id;
@@ -0,0 +1,2 @@
+-- id контакта, созданного для сделки. Записывается до создания сделки, чтобы повторная попытка не создавала второй контакт.
+ALTER TABLE bitrix_outbox ADD COLUMN contact_id INTEGER;
@@ -0,0 +1 @@
+ALTER TABLE referrals ALTER COLUMN cost SET DEFAULT 500;
@@ -0,0 +1,2 @@
+-- Бонус определяется правилами reward_rules при активации, значение по умолчанию начисляло бы его в обход правил
+ALTER TABLE referrals ALTER COLUMN cost DROP DEFAULT;